@@ -0,0 +1,115 @@
+package ddl
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/emirpasic/gods/lists/arraylist"
+)
+
+// A table may have an AUTO_INCREMENT column, or on TiDB an AUTO_RANDOM one,
+// which is the only column of its primary key. INSERT omits it, and the model
+// records the ID allocated by the server, i.e. `LastInsertId`, which is
+// checked by `checkAutoID`.
+
+// AutoIDProbability is the probability that a table is created with an
+// AUTO_INCREMENT or AUTO_RANDOM column.
+var AutoIDProbability = 0.2
+
+// autoRandomShardBits is the number of the shard bits of AUTO_RANDOM, which
+// follow the sign bit of an ID.
+const autoRandomShardBits = 5
+
+// newAutoIDColumn returns a BIGINT primary key column which IDs are allocated
+// by the server.
+func newAutoIDColumn(r *rand.Rand, autoRandom bool) *ddlTestColumn {
+	column := &ddlTestColumn{
+		k:            KindBigInt,
+		name:         RandName(r),
+		fieldType:    ALLFieldType[KindBigInt],
+		rows:         arraylist.New(),
+		isPrimaryKey: true,
+		notNull:      true,
+	}
+	if autoRandom {
+		column.autoRandomBits = autoRandomShardBits
+	} else {
+		column.autoIncrement = true
+	}
+	return column
+}
+
+// isAutoID reports whether the values of the column are allocated by the
+// server, such a column can be neither modified nor dropped.
+func (col *ddlTestColumn) isAutoID() bool {
+	return col.autoIncrement || col.autoRandomBits > 0
+}
+
+// autoIDColumn returns the AUTO_INCREMENT or AUTO_RANDOM column, or nil.
+func (table *ddlTestTable) autoIDColumn() *ddlTestColumn {
+	for ite := table.columns.Iterator(); ite.Next(); {
+		if column := ite.Value().(*ddlTestColumn); column.isAutoID() {
+			return column
+		}
+	}
+	return nil
+}
+
+func (table *ddlTestTable) isAutoRandom() bool {
+	column := table.autoIDColumn()
+	return column != nil && column.autoRandomBits > 0
+}
+
+// autoIDShardBits returns the number of the high bits of an ID which aren't
+// allocated incrementally, i.e. the shard bits of AUTO_RANDOM or
+// SHARD_ROW_ID_BITS.
+func (table *ddlTestTable) autoIDShardBits() int64 {
+	if column := table.autoIDColumn(); column != nil && column.autoRandomBits > 0 {
+		return column.autoRandomBits
+	}
+	return table.shardRowId
+}
+
+// maxAutoID returns the max incremental part of an ID with `shardBits`.
+func maxAutoID(shardBits int64) int64 {
+	return int64(1<<(64-uint(shardBits)-1)) - 1
+}
+
+// checkAutoID checks the ID allocated by the INSERT `task`: it's positive,
+// never allocated before, not less than the base set by REBASE when the task
+// is prepared, and fits in the bits left by SHARD_ROW_ID_BITS. The caller
+// should hold the lock of the table.
+func (table *ddlTestTable) checkAutoID(task *dmlJobTask) error {
+	id := task.lastInsertID
+	column := table.autoIDColumn()
+	if column == nil {
+		return fmt.Errorf("table %s has no auto ID column, but ID %d is allocated by %s", table.name, id, task.sql)
+	}
+	if id <= 0 {
+		return fmt.Errorf("auto ID %d of table %s allocated by %s isn't positive", id, table.name, task.sql)
+	}
+	if _, ok := table.autoIDs[id]; ok {
+		return fmt.Errorf("auto ID %d of table %s allocated by %s is allocated twice", id, table.name, task.sql)
+	}
+	incremental := id
+	if column.autoRandomBits > 0 {
+		incremental = id & maxAutoID(column.autoRandomBits)
+	} else {
+		// SHARD_ROW_ID_BITS may be changed after the task is prepared.
+		shardBits := task.autoIDShardBits
+		if bits := table.autoIDShardBits(); bits < shardBits {
+			shardBits = bits
+		}
+		if id > maxAutoID(shardBits) {
+			return fmt.Errorf("auto ID %d of table %s allocated by %s overflows %d shard bits", id, table.name, task.sql, shardBits)
+		}
+	}
+	if incremental < task.autoIDBase {
+		return fmt.Errorf("auto ID %d of table %s allocated by %s is less than the base %d", id, table.name, task.sql, task.autoIDBase)
+	}
+	if table.autoIDs == nil {
+		table.autoIDs = make(map[int64]struct{})
+	}
+	table.autoIDs[id] = struct{}{}
+	return nil
+}
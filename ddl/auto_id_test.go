@@ -0,0 +1,46 @@
+package ddl
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/emirpasic/gods/lists/arraylist"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckAutoID(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	id := newAutoIDColumn(r, false)
+	name := &ddlTestColumn{k: KindVarChar, name: "name", fieldType: "VARCHAR(10)", rows: arraylist.New()}
+	table := &ddlTestTable{
+		name:       "t",
+		columns:    arraylist.New(id, name),
+		primaryKey: []*ddlTestColumn{id},
+		lock:       new(sync.RWMutex),
+	}
+	assert.Equal(t, "BIGINT NOT NULL AUTO_INCREMENT", id.getDefinition())
+	assert.Same(t, id, table.autoIDColumn())
+	assert.False(t, id.canBeIndex())
+
+	task := &dmlJobTask{sql: "insert", tblInfo: table, allocatesAutoID: true, lastInsertID: 5, autoIDBase: 3}
+	assert.NoError(t, table.checkAutoID(task))
+	assert.Error(t, table.checkAutoID(task), "allocated twice")
+	task.lastInsertID = 2
+	assert.Error(t, table.checkAutoID(task), "less than the base")
+	task.lastInsertID = 1 << 60
+	task.autoIDShardBits = 4
+	table.shardRowId = 4
+	assert.Error(t, table.checkAutoID(task), "overflows the shard bits")
+	task.autoIDShardBits = 2
+	assert.NoError(t, table.checkAutoID(task))
+
+	// The shard bits of AUTO_RANDOM are ignored.
+	id.autoIncrement, id.autoRandomBits = false, autoRandomShardBits
+	assert.Equal(t, "BIGINT NOT NULL /*T![auto_rand] AUTO_RANDOM(5) */", id.getDefinition())
+	assert.Equal(t, int64(autoRandomShardBits), table.autoIDShardBits())
+	task.lastInsertID = 3<<58 + 4
+	assert.NoError(t, table.checkAutoID(task))
+	task.lastInsertID = 3<<58 + 2
+	assert.Error(t, table.checkAutoID(task), "less than the base")
+}
@@ -0,0 +1,435 @@
+package ddl
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emirpasic/gods/lists/arraylist"
+	"github.com/juju/errors"
+)
+
+// MODIFY COLUMN and CHANGE COLUMN change the type of a column by the matrix
+// `columnConversions`, which is keyed by the kinds of the original and the new
+// type, and may lose data: narrowing an integer or a decimal, converting
+// between integers and strings, shrinking a string, between signed and
+// unsigned integers, and between the date and time types. Each conversion
+// converts a value of the model the way the server does under the strict SQL
+// mode, or returns the error the server fails with if the value doesn't fit.
+// The servers report the same failure with different codes, e.g. MySQL 1406
+// and TiDB 1265 for a string that is too long. A conversion that only loses
+// precision, like rounding a decimal, succeeds on both. TiDB refuses to
+// rewrite the values of some columns, see `rewritesData`.
+
+// UnsignedProbability is the probability that MODIFY COLUMN changes an
+// integer column between signed and unsigned.
+var UnsignedProbability = 0.2
+
+// The error codes of the values that don't fit the new type.
+const (
+	errCodeBlobKeyWithoutLength uint16 = 1170 // ER_BLOB_KEY_WITHOUT_LENGTH
+	errCodeDataOutOfRange       uint16 = 1264 // ER_WARN_DATA_OUT_OF_RANGE
+	errCodeDataTruncated        uint16 = 1265 // WARN_DATA_TRUNCATED
+	errCodeTruncatedWrongValue  uint16 = 1292 // ER_TRUNCATED_WRONG_VALUE
+	errCodeIncorrectValue       uint16 = 1366 // ER_TRUNCATED_WRONG_VALUE_FOR_FIELD
+	errCodeDataTooLong          uint16 = 1406 // ER_DATA_TOO_LONG
+	errCodeValueOutOfRange      uint16 = 1690 // ER_DATA_OUT_OF_RANGE
+)
+
+// conversionErrorCodes are the codes of a value that doesn't fit the type of
+// its column on either server.
+var conversionErrorCodes = map[uint16]bool{
+	errCodeDataOutOfRange:      true,
+	errCodeDataTruncated:       true,
+	errCodeTruncatedWrongValue: true,
+	errCodeIncorrectValue:      true,
+	errCodeDataTooLong:         true,
+	errCodeValueOutOfRange:     true,
+}
+
+// conversionErrorCode returns the code of a failed conversion on the server,
+// which is `mysqlCode` on MySQL and `tidbCode` on TiDB.
+func (c *testCase) conversionErrorCode(mysqlCode, tidbCode uint16) uint16 {
+	if c.cfg.MySQLCompatible {
+		return mysqlCode
+	}
+	return tidbCode
+}
+
+// convertFunc converts the non-NULL value `v` of the column `from` to the
+// type of the column `to`, or returns the error code if `v` doesn't fit.
+type convertFunc func(c *testCase, from, to *ddlTestColumn, v interface{}) (value interface{}, code uint16)
+
+type kindPair struct {
+	from, to int
+}
+
+var columnConversions = map[kindPair]convertFunc{}
+
+func init() {
+	integerKinds := []int{KindTINYINT, KindSMALLINT, KindMEDIUMINT, KindInt32, KindBigInt}
+	stringKinds := []int{KindChar, KindVarChar, KindTEXT}
+	for _, from := range integerKinds {
+		for _, to := range integerKinds {
+			columnConversions[kindPair{from, to}] = (*testCase).convertInteger
+		}
+		for _, to := range stringKinds {
+			columnConversions[kindPair{from, to}] = (*testCase).convertToString
+		}
+		columnConversions[kindPair{from, KindDECIMAL}] = (*testCase).convertToDecimal
+		columnConversions[kindPair{KindDECIMAL, from}] = (*testCase).convertDecimalToInteger
+	}
+	for _, from := range stringKinds {
+		for _, to := range stringKinds {
+			columnConversions[kindPair{from, to}] = (*testCase).convertToString
+		}
+		for _, to := range integerKinds {
+			columnConversions[kindPair{from, to}] = (*testCase).convertStringToInteger
+		}
+	}
+	columnConversions[kindPair{KindDECIMAL, KindDECIMAL}] = (*testCase).convertToDecimal
+	columnConversions[kindPair{KindDECIMAL, KindChar}] = (*testCase).convertToString
+	columnConversions[kindPair{KindDECIMAL, KindVarChar}] = (*testCase).convertToString
+	columnConversions[kindPair{KindBLOB, KindBLOB}] = (*testCase).convertToString
+	for _, pair := range []kindPair{
+		{KindDATE, KindDATETIME},
+		{KindDATETIME, KindDATE},
+		{KindDATETIME, KindTIMESTAMP},
+		{KindTIMESTAMP, KindDATETIME},
+		{KindTIMESTAMP, KindDATE},
+	} {
+		columnConversions[pair] = (*testCase).convertTime
+	}
+}
+
+// conversionsFrom returns the kinds that the column can be modified to.
+func (col *ddlTestColumn) conversionsFrom() []int {
+	var kinds []int
+	for k := range ALLFieldType {
+		if _, ok := columnConversions[kindPair{col.k, k}]; !ok {
+			continue
+		}
+		// A generated column keeps its expression, so it's only widened.
+		if col.isGenerated() && !col.widensTo(k) {
+			continue
+		}
+		kinds = append(kinds, k)
+	}
+	// The map is iterated in random order.
+	sort.Ints(kinds)
+	return kinds
+}
+
+// widensTo reports whether every value of the column fits the kind `k`,
+// which is an integer kind or a string kind of the same length or longer.
+func (col *ddlTestColumn) widensTo(k int) bool {
+	switch col.k {
+	case KindTINYINT, KindSMALLINT, KindMEDIUMINT, KindInt32, KindBigInt:
+		return isIntegerKind(k) && k >= col.k
+	case KindChar, KindVarChar:
+		return k == KindVarChar || k == col.k
+	}
+	return false
+}
+
+// canChangeType reports whether the column `from` of the table can be
+// modified to `to`. The checks compare the column with integers, the columns
+// of an index cannot be a BLOB or a TEXT without a prefix length, and the
+// prefixes and the expressions of the indexes keep the type of their columns.
+func (table *ddlTestTable) canChangeType(from, to *ddlTestColumn) bool {
+	if len(table.checksOn(from)) > 0 && !isIntegerKind(to.k) {
+		return false
+	}
+	if table.hasPartialKeyPart(from) && to.fieldType != from.fieldType {
+		return false
+	}
+	return !(from.isPrimaryKey || from.indexReferences > 0) || to.canBeIndex()
+}
+
+// setRandType sets the type of the column to a random type of the kind
+// `col.k`, which is modified from the column `orig`.
+func (col *ddlTestColumn) setRandType(r *rand.Rand, orig *ddlTestColumn) {
+	col.unsigned = false
+	col.filedTypeM, col.filedTypeD = 0, 0
+	col.fieldType = ALLFieldType[col.k]
+	switch col.k {
+	case KindTINYINT, KindSMALLINT, KindMEDIUMINT, KindInt32, KindBigInt:
+		col.unsigned = orig.unsigned
+		if !orig.isGenerated() && r.Float64() < UnsignedProbability {
+			col.unsigned = !col.unsigned
+		}
+		if col.unsigned {
+			col.fieldType += " UNSIGNED"
+		}
+	case KindChar, KindVarChar, KindTEXT, KindBLOB:
+		maxLen := GetMaxLenByKind(col.k)
+		col.filedTypeM = r.Intn(maxLen-1) + 1
+		if orig.isGenerated() && orig.filedTypeM >= maxLen {
+			col.filedTypeM = orig.filedTypeM
+		} else if orig.isGenerated() {
+			col.filedTypeM = r.Intn(maxLen-orig.filedTypeM) + orig.filedTypeM
+		}
+		col.fieldType = fmt.Sprintf("%s(%d)", ALLFieldType[col.k], col.filedTypeM)
+	case KindDECIMAL:
+		col.filedTypeM, col.filedTypeD = RandMD(r)
+		col.fieldType = fmt.Sprintf("%s(%d,%d)", ALLFieldType[col.k], col.filedTypeM, col.filedTypeD)
+	}
+}
+
+// intRange returns the range of the values of an integer column. The values
+// of an unsigned BIGINT are limited to the range of int64.
+func (col *ddlTestColumn) intRange() (int64, int64) {
+	lower, upper := intKindRange(col.k)
+	if !col.unsigned {
+		return lower, upper
+	}
+	if col.k == KindBigInt {
+		return 0, math.MaxInt64
+	}
+	return 0, upper*2 + 1
+}
+
+// capacity returns the maximum number of characters of a string column. The
+// server chooses the type of a BLOB or a TEXT by the length.
+func (col *ddlTestColumn) capacity() int {
+	switch col.k {
+	case KindBLOB, KindTEXT:
+		if col.filedTypeM <= math.MaxUint8 {
+			return math.MaxUint8
+		}
+		return math.MaxUint16
+	}
+	return col.filedTypeM
+}
+
+func (c *testCase) convertInteger(_, to *ddlTestColumn, v interface{}) (interface{}, uint16) {
+	n, _ := partitionValue(v)
+	lower, upper := to.intRange()
+	if n < lower || n > upper {
+		return nil, c.conversionErrorCode(errCodeDataOutOfRange, errCodeValueOutOfRange)
+	}
+	return intValueOfKind(to.k, n), 0
+}
+
+func (c *testCase) convertToString(_, to *ddlTestColumn, v interface{}) (interface{}, uint16) {
+	s := fmt.Sprintf("%v", v)
+	if len(s) > to.capacity() {
+		return nil, c.conversionErrorCode(errCodeDataTooLong, errCodeDataTruncated)
+	}
+	return s, 0
+}
+
+// The numbers that a string starts with. MySQL takes an "e" without digits as
+// the exponent 0, while TiDB stops before it.
+var (
+	mysqlNumberPrefix = regexp.MustCompile(`^-?[0-9]+(\.[0-9]*)?(e-?[0-9]*)?`)
+	tidbNumberPrefix  = regexp.MustCompile(`^-?[0-9]+(\.[0-9]*)?(e-?[0-9]+)?`)
+)
+
+// parseIntegerPrefix parses the number that the string `s` starts with by
+// `prefix`, and rounds it half away from zero. It returns the number and the
+// rest of the string, or false if the number doesn't fit an int64.
+func parseIntegerPrefix(s string, prefix *regexp.Regexp) (int64, string, bool) {
+	number := prefix.FindString(s)
+	rest := s[len(number):]
+	if number == "" {
+		return 0, rest, true
+	}
+	number = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(number, "-"), "e"), ".")
+	if i := strings.IndexByte(number, 'e'); i >= 0 {
+		exponent, err := strconv.Atoi(number[i+1:])
+		if err != nil || exponent > 40 || exponent < -40 {
+			// A mantissa that isn't 0 overflows or is rounded to 0.
+			if strings.Trim(number[:i], "-0.") != "" && !strings.HasPrefix(number[i+1:], "-") {
+				return 0, rest, false
+			}
+			return 0, rest, true
+		}
+	}
+	rounded, _, _ := roundDecimal(number, 0)
+	n, err := strconv.ParseInt(rounded, 10, 64)
+	return n, rest, err == nil
+}
+
+// convertStringToInteger converts the number that a string starts with, like
+// "12", "1.5" or "1e5". MySQL fails with 1366 if there is no number and with
+// 1265 if other characters follow it, TiDB fails with 1292 in both cases. A
+// number out of range fails first.
+func (c *testCase) convertStringToInteger(from, to *ddlTestColumn, v interface{}) (interface{}, uint16) {
+	s := fmt.Sprintf("%v", v)
+	prefix := tidbNumberPrefix
+	if c.cfg.MySQLCompatible {
+		prefix = mysqlNumberPrefix
+	}
+	n, rest, ok := parseIntegerPrefix(s, prefix)
+	if !ok {
+		return nil, c.conversionErrorCode(errCodeDataOutOfRange, errCodeValueOutOfRange)
+	}
+	value, code := c.convertInteger(from, to, n)
+	switch {
+	case code != 0:
+		return nil, code
+	case len(rest) == len(s):
+		return nil, c.conversionErrorCode(errCodeIncorrectValue, errCodeTruncatedWrongValue)
+	case rest != "":
+		return nil, c.conversionErrorCode(errCodeDataTruncated, errCodeTruncatedWrongValue)
+	}
+	return value, 0
+}
+
+func (c *testCase) convertToDecimal(_, to *ddlTestColumn, v interface{}) (interface{}, uint16) {
+	s, intDigits, _ := roundDecimal(fmt.Sprintf("%v", v), to.filedTypeD)
+	if intDigits > to.filedTypeM-to.filedTypeD {
+		return nil, c.conversionErrorCode(errCodeDataOutOfRange, errCodeValueOutOfRange)
+	}
+	return s, 0
+}
+
+func (c *testCase) convertDecimalToInteger(from, to *ddlTestColumn, v interface{}) (interface{}, uint16) {
+	s, _, _ := roundDecimal(fmt.Sprintf("%v", v), 0)
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, c.conversionErrorCode(errCodeDataOutOfRange, errCodeValueOutOfRange)
+	}
+	return c.convertInteger(from, to, n)
+}
+
+// roundDecimal rounds the decimal `s` half away from zero to `scale` digits
+// after the point, and formats it like the server. It returns the number of
+// digits before the point, and whether no digit is lost.
+func roundDecimal(s string, scale int) (string, int, bool) {
+	value, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return s, 0, true
+	}
+	num := new(big.Int).Mul(value.Num(), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+	q, m := new(big.Int).QuoRem(num, value.Denom(), new(big.Int))
+	exact := m.Sign() == 0
+	if new(big.Int).Mul(new(big.Int).Abs(m), big.NewInt(2)).Cmp(value.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(value.Sign())))
+	}
+	digits := new(big.Int).Abs(q).String()
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	intPart, fracPart := digits[:len(digits)-scale], digits[len(digits)-scale:]
+	intDigits := len(intPart)
+	if intPart == "0" {
+		intDigits = 0
+	}
+	result := intPart
+	if scale > 0 {
+		result += "." + fracPart
+	}
+	if q.Sign() < 0 {
+		result = "-" + result
+	}
+	return result, intDigits, exact
+}
+
+// timestampRange returns the DATETIME values of the first and the last
+// second of TIMESTAMP in the time zone of the session.
+func timestampRange(db *sql.DB) (string, string, error) {
+	var min, max string
+	err := db.QueryRow("SELECT FROM_UNIXTIME(1), FROM_UNIXTIME(2147483647)").Scan(&min, &max)
+	return min, max, errors.Trace(err)
+}
+
+// convertTime converts between the date and time types. The time of a
+// DATETIME is dropped when it's converted to a DATE, and a TIMESTAMP fails
+// out of its range in the time zone of the session, see `timestampRange`.
+func (c *testCase) convertTime(_, to *ddlTestColumn, v interface{}) (interface{}, uint16) {
+	s := fmt.Sprintf("%v", v)
+	switch to.k {
+	case KindDATE:
+		if len(s) > len(TimeFormatForDATE) {
+			return s[:len(TimeFormatForDATE)], 0
+		}
+	case KindDATETIME:
+		if len(s) == len(TimeFormatForDATE) {
+			return s + " 00:00:00", 0
+		}
+	case KindTIMESTAMP:
+		if s < c.minTimestamp || s > c.maxTimestamp {
+			return nil, errCodeTruncatedWrongValue
+		}
+	}
+	return s, 0
+}
+
+// rewritesData reports whether modifying the column to `to` rewrites its
+// values. Widening an integer of the same sign or lengthening a string of the
+// same kind only changes the definition.
+func (col *ddlTestColumn) rewritesData(to *ddlTestColumn) bool {
+	switch col.k {
+	case KindTINYINT, KindSMALLINT, KindMEDIUMINT, KindInt32, KindBigInt:
+		return !isIntegerKind(to.k) || to.k < col.k || to.unsigned != col.unsigned
+	case KindChar, KindVarChar, KindTEXT, KindBLOB:
+		return to.k != col.k || to.capacity() < col.capacity()
+	}
+	return true
+}
+
+// convertRows converts the rows of the column `from` of the table to the type
+// of the column `to`, and returns the error that the task should fail with if
+// the type cannot be changed, a value doesn't fit or the converted values
+// duplicate a unique key. The caller should hold the lock of the table.
+func (c *testCase) convertRows(table *ddlTestTable, from, to *ddlTestColumn) (*arraylist.List, error) {
+	convert, ok := columnConversions[kindPair{from.k, to.k}]
+	if !ok {
+		return nil, expectError(0, "column %s of table %s cannot be modified to %s", from.name, table.name, to.fieldType)
+	}
+	// TiDB doesn't rewrite the values of a column of the primary key or of an
+	// index, or of a partitioned table.
+	if !c.cfg.MySQLCompatible && from.rewritesData(to) && (to.isPrimaryKey || to.indexReferences > 0 || table.partition != nil) {
+		return nil, expectError(errCodeUnsupportedDDLOperation, "column %s of table %s cannot be modified to %s", from.name, table.name, to.fieldType)
+	}
+	if (to.isPrimaryKey || to.indexReferences > 0) && !to.canBeIndex() {
+		return nil, expectError(errCodeBlobKeyWithoutLength, "column %s of an index of table %s is modified to %s", from.name, table.name, to.fieldType)
+	}
+	rows := arraylist.New()
+	for i := 0; i < table.numberOfRows; i++ {
+		v := getRowFromArrayList(from.rows, i)
+		if v == nil || v == ddlTestValueNull {
+			rows.Add(v)
+			continue
+		}
+		value, code := convert(c, from, to, v)
+		if code != 0 {
+			return nil, expectError(code, "value %v of column %s of table %s doesn't fit %s", v, from.name, table.name, to.fieldType)
+		}
+		rows.Add(value)
+	}
+	// The converted keys are compared by the collation of `to`.
+	var keys [][]*ddlTestColumn
+	for _, key := range table.uniqueKeys() {
+		if containsColumn(key, from) {
+			convertedKey := make([]*ddlTestColumn, 0, len(key))
+			for _, column := range key {
+				if column == from {
+					column = to
+				}
+				convertedKey = append(convertedKey, column)
+			}
+			keys = append(keys, convertedKey)
+		}
+	}
+	pos := table.columns.IndexOf(from)
+	converted := *table
+	converted.columns = arraylist.New(table.columns.Values()...)
+	converted.columns.Set(pos, to)
+	changed := table.allRows()
+	for i, row := range changed {
+		row[pos] = getRowFromArrayList(rows, i)
+	}
+	if err := converted.duplicateError(keys, changed, nil, c.newCollation); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
@@ -0,0 +1,160 @@
+package ddl
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/emirpasic/gods/lists/arraylist"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundDecimal(t *testing.T) {
+	for _, c := range []struct {
+		s         string
+		scale     int
+		expected  string
+		intDigits int
+		exact     bool
+	}{
+		{"12.345", 2, "12.35", 2, false},
+		{"-12.345", 2, "-12.35", 2, false},
+		{"12.3", 2, "12.30", 2, true},
+		{"0.004", 2, "0.00", 0, false},
+		{"-0.004", 2, "0.00", 0, false},
+		{"99.5", 0, "100", 3, false},
+		{"7", 1, "7.0", 1, true},
+	} {
+		s, intDigits, exact := roundDecimal(c.s, c.scale)
+		assert.Equal(t, c.expected, s, c.s)
+		assert.Equal(t, c.intDigits, intDigits, c.s)
+		assert.Equal(t, c.exact, exact, c.s)
+	}
+}
+
+func TestColumnConversions(t *testing.T) {
+	tinyint := &ddlTestColumn{k: KindTINYINT, fieldType: "TINYINT"}
+	unsigned := &ddlTestColumn{k: KindTINYINT, fieldType: "TINYINT UNSIGNED", unsigned: true}
+	varchar := &ddlTestColumn{k: KindVarChar, fieldType: "VARCHAR(3)", filedTypeM: 3}
+	decimal := &ddlTestColumn{k: KindDECIMAL, fieldType: "DECIMAL(4,1)", filedTypeM: 4, filedTypeD: 1}
+	timestamp := &ddlTestColumn{k: KindTIMESTAMP, fieldType: "TIMESTAMP"}
+	datetime := &ddlTestColumn{k: KindDATETIME, fieldType: "DATETIME"}
+	date := &ddlTestColumn{k: KindDATE, fieldType: "DATE"}
+	for _, c := range []struct {
+		from, to  *ddlTestColumn
+		v         interface{}
+		expected  interface{}
+		mysqlCode uint16
+		tidbCode  uint16
+	}{
+		{tinyint, unsigned, int32(-1), nil, errCodeDataOutOfRange, errCodeValueOutOfRange},
+		{unsigned, tinyint, int32(200), nil, errCodeDataOutOfRange, errCodeValueOutOfRange},
+		{unsigned, tinyint, int32(100), int32(100), 0, 0},
+		{tinyint, varchar, int32(-100), nil, errCodeDataTooLong, errCodeDataTruncated},
+		{tinyint, varchar, int32(-10), "-10", 0, 0},
+		{varchar, tinyint, "12", int32(12), 0, 0},
+		{varchar, tinyint, "-1.5", int32(-2), 0, 0},
+		{varchar, tinyint, "ab1", nil, errCodeIncorrectValue, errCodeTruncatedWrongValue},
+		{varchar, tinyint, "1ab", nil, errCodeDataTruncated, errCodeTruncatedWrongValue},
+		{varchar, tinyint, "1e2", int32(100), 0, 0},
+		{varchar, tinyint, "1e3", nil, errCodeDataOutOfRange, errCodeValueOutOfRange},
+		{varchar, tinyint, "9e99999999999", nil, errCodeDataOutOfRange, errCodeValueOutOfRange},
+		{varchar, tinyint, "999ab", nil, errCodeDataOutOfRange, errCodeValueOutOfRange},
+		{decimal, decimal, "999.95", nil, errCodeDataOutOfRange, errCodeValueOutOfRange},
+		{decimal, decimal, "123.45", "123.5", 0, 0},
+		{decimal, tinyint, "12.5", int32(13), 0, 0},
+		{tinyint, decimal, int32(127), "127.0", 0, 0},
+		{date, datetime, "2000-01-02", "2000-01-02 00:00:00", 0, 0},
+		{timestamp, date, "2000-01-02 03:04:05", "2000-01-02", 0, 0},
+		{datetime, timestamp, "1000-01-01 00:00:00", nil, errCodeTruncatedWrongValue, errCodeTruncatedWrongValue},
+		{datetime, timestamp, "2038-01-19 04:00:00", nil, errCodeTruncatedWrongValue, errCodeTruncatedWrongValue},
+		{datetime, timestamp, "2038-01-19 03:14:07", "2038-01-19 03:14:07", 0, 0},
+		{datetime, timestamp, "2000-01-01 00:00:00", "2000-01-01 00:00:00", 0, 0},
+	} {
+		for _, mysqlCompatible := range []bool{true, false} {
+			tc := &testCase{cfg: &DDLCaseConfig{MySQLCompatible: mysqlCompatible}, minTimestamp: "1970-01-01 00:00:01", maxTimestamp: "2038-01-19 03:14:07"}
+			code := c.tidbCode
+			if mysqlCompatible {
+				code = c.mysqlCode
+			}
+			value, actual := columnConversions[kindPair{c.from.k, c.to.k}](tc, c.from, c.to, c.v)
+			assert.Equal(t, c.expected, value, "%s to %s: %v", c.from.fieldType, c.to.fieldType, c.v)
+			assert.Equal(t, code, actual, "%s to %s: %v, MySQL: %v", c.from.fieldType, c.to.fieldType, c.v, mysqlCompatible)
+		}
+	}
+
+	// TiDB doesn't take an exponent without digits.
+	tc := &testCase{cfg: &DDLCaseConfig{MySQLCompatible: true}}
+	value, code := tc.convertStringToInteger(varchar, tinyint, "12e")
+	assert.Equal(t, int32(12), value)
+	assert.Equal(t, uint16(0), code)
+	tc.cfg.MySQLCompatible = false
+	_, code = tc.convertStringToInteger(varchar, tinyint, "12e")
+	assert.Equal(t, errCodeTruncatedWrongValue, code)
+}
+
+func TestConvertRows(t *testing.T) {
+	a := &ddlTestColumn{k: KindDECIMAL, name: "a", fieldType: "DECIMAL(4,2)", filedTypeM: 4, filedTypeD: 2, isPrimaryKey: true, rows: arraylist.New()}
+	table := &ddlTestTable{name: "t", columns: arraylist.New(a), primaryKey: []*ddlTestColumn{a}, lock: new(sync.RWMutex)}
+	table.addRows([][]interface{}{{"1.20"}, {"1.40"}, {ddlTestValueNull}})
+	c := &testCase{cfg: &DDLCaseConfig{MySQLCompatible: true}}
+	to := &ddlTestColumn{k: KindDECIMAL, name: "a", fieldType: "DECIMAL(4,1)", filedTypeM: 4, filedTypeD: 1, isPrimaryKey: true}
+	rows, err := c.convertRows(table, a, to)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"1.2", "1.4", ddlTestValueNull}, rows.Values())
+
+	// The rounded values are duplicated.
+	to = &ddlTestColumn{k: KindInt32, name: "a", fieldType: "INT", isPrimaryKey: true}
+	_, err = c.convertRows(table, a, to)
+	assert.Equal(t, errCodeDupEntry, expectedErrorCode(err))
+
+	// A BLOB or a TEXT cannot be a key without a prefix length.
+	b := &ddlTestColumn{k: KindVarChar, name: "b", fieldType: "VARCHAR(10)", filedTypeM: 10, indexReferences: 1, rows: arraylist.New()}
+	to = &ddlTestColumn{k: KindTEXT, name: "b", fieldType: "TEXT(10)", filedTypeM: 10, indexReferences: 1}
+	_, err = c.convertRows(table, b, to)
+	assert.Equal(t, errCodeBlobKeyWithoutLength, expectedErrorCode(err))
+}
+
+func TestConvertRowsUnsupportedOnTiDB(t *testing.T) {
+	a := &ddlTestColumn{k: KindInt32, name: "a", fieldType: "INT", isPrimaryKey: true, rows: arraylist.New()}
+	b := &ddlTestColumn{k: KindVarChar, name: "b", fieldType: "VARCHAR(10)", filedTypeM: 10, rows: arraylist.New()}
+	table := &ddlTestTable{name: "t", columns: arraylist.New(a, b), primaryKey: []*ddlTestColumn{a}, lock: new(sync.RWMutex)}
+	table.addRows([][]interface{}{{int32(1), "x"}})
+	c := &testCase{cfg: &DDLCaseConfig{}}
+
+	// A column of the primary key is only widened.
+	to := &ddlTestColumn{k: KindBigInt, name: "a", fieldType: "BIGINT", isPrimaryKey: true}
+	_, err := c.convertRows(table, a, to)
+	assert.NoError(t, err)
+	to = &ddlTestColumn{k: KindSMALLINT, name: "a", fieldType: "SMALLINT", isPrimaryKey: true}
+	_, err = c.convertRows(table, a, to)
+	assert.Equal(t, errCodeUnsupportedDDLOperation, expectedErrorCode(err))
+
+	// So is a column of a partitioned table.
+	table.partition = &ddlTestPartition{}
+	to = &ddlTestColumn{k: KindVarChar, name: "b", fieldType: "VARCHAR(20)", filedTypeM: 20}
+	_, err = c.convertRows(table, b, to)
+	assert.NoError(t, err)
+	to = &ddlTestColumn{k: KindVarChar, name: "b", fieldType: "VARCHAR(5)", filedTypeM: 5}
+	_, err = c.convertRows(table, b, to)
+	assert.Equal(t, errCodeUnsupportedDDLOperation, expectedErrorCode(err))
+
+	// MySQL rewrites them.
+	c.cfg.MySQLCompatible = true
+	rows, err := c.convertRows(table, b, to)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"x"}, rows.Values())
+}
+
+func TestGenerateRandModifiedColumn(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	json := &ddlTestColumn{k: KindJSON, name: "j", fieldType: "JSON"}
+	generated := &ddlTestColumn{k: KindSMALLINT, name: "g", fieldType: "SMALLINT", dependency: json}
+	assert.Equal(t, []int{KindSMALLINT, KindMEDIUMINT, KindInt32, KindBigInt}, generated.conversionsFrom())
+	assert.Nil(t, generateRandModifiedColumn(r, json, false))
+	for i := 0; i < 100; i++ {
+		column := generateRandModifiedColumn(r, generated, false)
+		assert.True(t, column.k >= KindSMALLINT && column.k <= KindBigInt)
+		assert.False(t, column.unsigned)
+	}
+}
@@ -0,0 +1,222 @@
+package ddl
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/juju/errors"
+)
+
+// Config is the content of the TOML configuration file. The fields of
+// `DBConfig` and `DDLCaseConfig` are at the top level of the file, the knobs
+// of the generated workload are in the `[workload]` table, and the error
+// classes are in the `[[error_class]]` and `[[acceptable_error]]` tables.
+type Config struct {
+	DBConfig
+	DDLCaseConfig
+	Workload         WorkloadConfig          `toml:"workload"`
+	ErrorClasses     []ErrorClassConfig      `toml:"error_class"`
+	AcceptableErrors []AcceptableErrorConfig `toml:"acceptable_error"`
+}
+
+// NewConfig returns a Config with the default values.
+func NewConfig() *Config {
+	return &Config{
+		DBConfig: DBConfig{
+			Addr: "127.0.0.1:4000",
+			DB:   "test",
+			User: "root",
+		},
+		DDLCaseConfig: DDLCaseConfig{
+			Concurrency:    20,
+			TablesToCreate: 1,
+			TestTp:         SerialDDLTest,
+		},
+	}
+}
+
+// LoadConfig loads the TOML configuration file at `path` into `cfg`, the
+// fields that are not in the file are kept. The workload knobs in the file
+// and the error classes are applied at once.
+func LoadConfig(path string, cfg *Config) error {
+	meta, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		return errors.Annotatef(err, "load config %s", path)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return errors.Errorf("unknown config items %v in %s", undecoded, path)
+	}
+	if err := cfg.Workload.apply(); err != nil {
+		return errors.Trace(err)
+	}
+	for _, class := range cfg.ErrorClasses {
+		if err := registerErrorClass(class.Name, class.Codes, class.Messages); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for _, acceptable := range cfg.AcceptableErrors {
+		cond := acceptAlways
+		if acceptable.ParallelOnly {
+			cond = acceptInParallel
+		}
+		if err := acceptErrorClasses(acceptable.Kind, acceptable.Classes, cond); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// DBConfig is the address and the account of the tested database.
+type DBConfig struct {
+	Addr     string `toml:"addr"`
+	DB       string `toml:"db"`
+	User     string `toml:"user"`
+	Password string `toml:"password"`
+}
+
+// DSN returns the data source name of the database `DB`.
+func (c DBConfig) DSN() string {
+	return fmt.Sprintf("%s:%s@tcp(%s)/%s", c.User, c.Password, c.Addr, c.DB)
+}
+
+// serverDSN returns the data source name of the server without choosing a database.
+func (c DBConfig) serverDSN() string {
+	return fmt.Sprintf("%s:%s@tcp(%s)/", c.User, c.Password, c.Addr)
+}
+
+func (t DDLTestType) String() string {
+	if t == ParallelDDLTest {
+		return "parallel"
+	}
+	return "serial"
+}
+
+func (t *DDLTestType) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "serial":
+		*t = SerialDDLTest
+	case "parallel":
+		*t = ParallelDDLTest
+	default:
+		return fmt.Errorf("unknown test mode: %s", text)
+	}
+	return nil
+}
+
+// Duration is a `time.Duration` written as a string like "1h30m" in the
+// config file.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// WorkloadConfig changes the knobs of the generated workload, the zero value
+// of each field keeps the default.
+type WorkloadConfig struct {
+	// DDLKindProbability is the probability of each kind of DDL, keyed by the
+	// names in `mapOfDDLKind`, for example "add index".
+	DDLKindProbability map[string]float64 `toml:"ddl_kind_probability"`
+	// FieldTypes are the data types to test, the names are the ones in
+	// `ALLFieldType`, for example "VARCHAR".
+	FieldTypes []string `toml:"field_types"`
+	// MaxLen is the max length of the data types, keyed by the names in
+	// `ALLFieldType`.
+	MaxLen            map[string]int `toml:"max_len"`
+	MaxShardRowIDBits int            `toml:"max_shard_row_id_bits"`
+	DMLSizeEachRound  int            `toml:"dml_size_each_round"`
+	JsonFieldNum      int            `toml:"json_field_num"`
+}
+
+func (w *WorkloadConfig) apply() error {
+	for name, probability := range w.DDLKindProbability {
+		kind, ok := mapOfDDLKind[name]
+		if !ok {
+			return fmt.Errorf("unknown DDL kind %q in ddl_kind_probability", name)
+		}
+		if probability < 0 || probability > 1 {
+			return fmt.Errorf("invalid probability %v of %q", probability, name)
+		}
+		mapOfDDLKindProbability[kind] = probability
+	}
+	if len(w.FieldTypes) > 0 {
+		fieldTypes := make([]int, 0, len(w.FieldTypes))
+		for _, name := range w.FieldTypes {
+			kind, ok := fieldTypeKind(name)
+			if !ok {
+				return fmt.Errorf("unknown field type %q in field_types", name)
+			}
+			fieldTypes = append(fieldTypes, kind)
+		}
+		TestFieldType = fieldTypes
+	}
+	for name, maxLen := range w.MaxLen {
+		kind, ok := fieldTypeKind(name)
+		if !ok {
+			return fmt.Errorf("unknown field type %q in max_len", name)
+		}
+		ptr, ok := maxLenOfKind[kind]
+		if !ok {
+			return fmt.Errorf("field type %q has no max length", name)
+		}
+		if maxLen <= 0 {
+			return fmt.Errorf("invalid max length %d of %q", maxLen, name)
+		}
+		*ptr = maxLen
+	}
+	if w.MaxShardRowIDBits < 0 || w.DMLSizeEachRound < 0 || w.JsonFieldNum < 0 {
+		return fmt.Errorf("max_shard_row_id_bits, dml_size_each_round and json_field_num can't be negative")
+	}
+	if w.MaxShardRowIDBits > 0 {
+		MaxShardRowIDBits = w.MaxShardRowIDBits
+	}
+	if w.DMLSizeEachRound > 0 {
+		dmlSizeEachRound = w.DMLSizeEachRound
+	}
+	if w.JsonFieldNum > 0 {
+		JsonFieldNum = w.JsonFieldNum
+	}
+	return nil
+}
+
+// fieldTypeKind returns the kind of the data type named `name` in `ALLFieldType`.
+func fieldTypeKind(name string) (int, bool) {
+	for kind, tp := range ALLFieldType {
+		if strings.EqualFold(tp, name) {
+			return kind, true
+		}
+	}
+	return 0, false
+}
+
+// ErrorClassConfig adds the MySQL error codes and the message patterns to the
+// error class `Name`, which is created if it isn't a built-in one like
+// "duplicate-entry". The message patterns are regular expressions, which only
+// match the errors without a MySQL error code and the ones with code 1105 or
+// 8200.
+type ErrorClassConfig struct {
+	Name     string   `toml:"name"`
+	Codes    []uint16 `toml:"codes"`
+	Messages []string `toml:"messages"`
+}
+
+// AcceptableErrorConfig makes the error classes acceptable for the statement
+// kind `Kind`, which is a name in `mapOfDDLKind`, "insert", "update",
+// "delete", "insert select", "commit", "admin check", or "ddl" and "dml" for all kinds of DDL
+// and DML. `ParallelOnly` accepts them only in the parallel DDL test.
+type AcceptableErrorConfig struct {
+	Kind         string   `toml:"kind"`
+	Classes      []string `toml:"classes"`
+	ParallelOnly bool     `toml:"parallel_only"`
+}
@@ -0,0 +1,109 @@
+package ddl
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	oldProbability := mapOfDDLKindProbability[ddlAddIndex]
+	oldFieldTypes := TestFieldType
+	oldVarCharMaxLen := VarCharMaxLen
+	oldDMLSizeEachRound := dmlSizeEachRound
+	defer func() {
+		mapOfDDLKindProbability[ddlAddIndex] = oldProbability
+		TestFieldType = oldFieldTypes
+		VarCharMaxLen = oldVarCharMaxLen
+		dmlSizeEachRound = oldDMLSizeEachRound
+	}()
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	err := ioutil.WriteFile(path, []byte(`
+addr = "10.0.0.1:4000"
+user = "tester"
+password = "secret"
+concurrency = 4
+test_type = "parallel"
+duration = "1h30m"
+rounds = 10
+
+[workload]
+field_types = ["int", "VARCHAR"]
+dml_size_each_round = 3
+
+[workload.max_len]
+VARCHAR = 32
+
+[workload.ddl_kind_probability]
+"add index" = 0.2
+`), 0644)
+	assert.Nil(t, err)
+
+	cfg := NewConfig()
+	assert.Nil(t, LoadConfig(path, cfg))
+	assert.Equal(t, "10.0.0.1:4000", cfg.Addr)
+	assert.Equal(t, "test", cfg.DB)
+	assert.Equal(t, "tester:secret@tcp(10.0.0.1:4000)/test", cfg.DSN())
+	assert.Equal(t, 4, cfg.Concurrency)
+	assert.Equal(t, 1, cfg.TablesToCreate)
+	assert.Equal(t, ParallelDDLTest, cfg.TestTp)
+	assert.Equal(t, 90*time.Minute, time.Duration(cfg.Duration))
+	assert.Equal(t, 10, cfg.Rounds)
+	assert.Equal(t, 0.2, mapOfDDLKindProbability[ddlAddIndex])
+	assert.Equal(t, []int{KindInt32, KindVarChar}, TestFieldType)
+	assert.Equal(t, 32, GetMaxLenByKind(KindVarChar))
+	assert.Equal(t, 3, dmlSizeEachRound)
+}
+
+func TestLoadConfigErrorClasses(t *testing.T) {
+	defer func() {
+		delete(errorClasses, "lock-wait-timeout")
+		delete(classOfErrorCode, 1205)
+		delete(dmlCommonAcceptableErrors, "lock-wait-timeout")
+		delete(ddlAcceptableErrors[ddlAddIndex], classDuplicateEntry)
+	}()
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	err := ioutil.WriteFile(path, []byte(`
+[[error_class]]
+name = "lock-wait-timeout"
+codes = [1205]
+
+[[acceptable_error]]
+kind = "dml"
+classes = ["lock-wait-timeout"]
+
+[[acceptable_error]]
+kind = "add index"
+classes = ["duplicate-entry"]
+parallel_only = true
+`), 0644)
+	assert.Nil(t, err)
+
+	assert.Nil(t, LoadConfig(path, NewConfig()))
+	assert.Equal(t, "lock-wait-timeout", classOfErrorCode[1205])
+	assert.Equal(t, acceptAlways, dmlCommonAcceptableErrors["lock-wait-timeout"])
+	assert.Equal(t, acceptInParallel, ddlAcceptableErrors[ddlAddIndex][classDuplicateEntry])
+}
+
+func TestLoadConfigError(t *testing.T) {
+	dir := t.TempDir()
+	for _, content := range []string{
+		`unknown_item = 1`,
+		`test_type = "random"`,
+		`duration = "10 minutes"`,
+		"[workload]\nfield_types = [\"NOTYPE\"]",
+		"[workload.ddl_kind_probability]\n\"add something\" = 0.5",
+		"[workload.max_len]\nINT = 10",
+		"[[error_class]]\nname = \"dup\"\ncodes = [1062]",
+		"[[acceptable_error]]\nkind = \"insert\"\nclasses = [\"no-such-class\"]",
+	} {
+		path := filepath.Join(dir, "config.toml")
+		assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+		assert.NotNil(t, LoadConfig(path, NewConfig()), content)
+	}
+}
@@ -0,0 +1,359 @@
+package ddl
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"strconv"
+
+	"github.com/ngaut/log"
+)
+
+// The columns may be NOT NULL, and the tables may have CHECK constraints. A
+// check compares an integer column with a constant, so that the model can
+// evaluate it, and it's declared with the column or with the table when the
+// table is created, or added by `ADD CONSTRAINT`. The model predicts whether
+// an INSERT or an UPDATE sets a NOT NULL column to NULL or violates an
+// enforced check, and whether a DDL fails because of the existing rows.
+
+// NotNullProbability is the probability that a new column is NOT NULL, or
+// that MODIFY COLUMN changes whether a column is NOT NULL.
+var NotNullProbability = 0.2
+
+// NullValueProbability is the probability that an INSERT or an UPDATE sets a
+// column to NULL.
+var NullValueProbability = 0.05
+
+// CheckProbability is the probability that an integer column of a new table
+// has a check.
+var CheckProbability = 0.2
+
+type ddlTestCheck struct {
+	name     string
+	column   *ddlTestColumn
+	op       string // ">=" or "<=".
+	value    int64
+	enforced bool
+	inline   bool // whether it's declared with the column when the table is created.
+}
+
+func (check *ddlTestCheck) expression() string {
+	return fmt.Sprintf("`%s` %s %d", check.column.name, check.op, check.value)
+}
+
+func (check *ddlTestCheck) definition() string {
+	sql := fmt.Sprintf("CONSTRAINT `%s` CHECK (%s)", check.name, check.expression())
+	if !check.enforced {
+		sql += " NOT ENFORCED"
+	}
+	return sql
+}
+
+// accepts reports whether `value` satisfies the check, NULL always does. The
+// column may be modified to a string or a decimal, whose values are compared
+// as numbers like the server does, see `numericPrefix`.
+func (check *ddlTestCheck) accepts(value interface{}) bool {
+	if value == nil || value == ddlTestValueNull {
+		return true
+	}
+	if v, ok := partitionValue(value); ok {
+		if check.op == ">=" {
+			return v >= check.value
+		}
+		return v <= check.value
+	}
+	v := numericPrefix(fmt.Sprintf("%v", value))
+	if check.op == ">=" {
+		return v >= float64(check.value)
+	}
+	return v <= float64(check.value)
+}
+
+var numericPrefixRe = regexp.MustCompile(`^[+-]?[0-9]*(\.[0-9]*)?([eE][+-]?[0-9]+)?`)
+
+// numericPrefix converts a string to a number the way MySQL compares it with
+// a number, i.e. by the longest prefix that is a number, or 0 if there is none.
+func numericPrefix(s string) float64 {
+	v, err := strconv.ParseFloat(numericPrefixRe.FindString(s), 64)
+	if err != nil && !math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
+
+// newRandCheck returns an enforced check on `column` mostly, which rejects
+// at most a quarter of the random values.
+func newRandCheck(r *rand.Rand, column *ddlTestColumn) *ddlTestCheck {
+	lower, upper := column.intRange()
+	width := upper/4 - lower/4
+	check := &ddlTestCheck{
+		name:     RandName(r),
+		column:   column,
+		op:       ">=",
+		value:    randInt64Between(r, lower, lower+width),
+		enforced: r.Intn(5) > 0,
+	}
+	if r.Intn(2) == 0 {
+		check.op = "<="
+		check.value = randInt64Between(r, upper-width, upper)
+	}
+	return check
+}
+
+func (col *ddlTestColumn) canHaveCheck() bool {
+	return isIntegerKind(col.k) && !col.isGenerated() && !col.isAutoID() && !col.isDeleted()
+}
+
+// setRandNotNull makes the column NOT NULL randomly, and drops its default
+// value sometimes if `canDropDefault`. Otherwise only the column with a
+// default value becomes NOT NULL, so that the existing rows have the value.
+func (col *ddlTestColumn) setRandNotNull(r *rand.Rand, canDropDefault bool) {
+	if col.isGenerated() || col.hasGenerateCol() || r.Float64() >= NotNullProbability {
+		return
+	}
+	if !canDropDefault && col.defaultValue == nil {
+		return
+	}
+	col.notNull = true
+	if canDropDefault && r.Intn(2) == 0 {
+		col.defaultValue = nil
+	}
+}
+
+// canBeNull reports whether a DML may set the column to NULL, which is
+// rejected if the column is NOT NULL.
+func (table *ddlTestTable) canBeNull(col *ddlTestColumn) bool {
+	return !col.isPrimaryKey && !col.isAutoID() && !col.hasGenerateCol() &&
+		(table.partition == nil || table.partition.column != col)
+}
+
+// checksOn returns the checks of the table on `column`.
+func (table *ddlTestTable) checksOn(column *ddlTestColumn) []*ddlTestCheck {
+	var checks []*ddlTestCheck
+	for _, check := range table.checks {
+		if check.column == column {
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
+
+func (table *ddlTestTable) removeChecksOn(column *ddlTestColumn) {
+	checks := table.checks[:0]
+	for _, check := range table.checks {
+		if check.column != column {
+			checks = append(checks, check)
+		}
+	}
+	table.checks = checks
+}
+
+func (table *ddlTestTable) findCheck(name string) int {
+	for i, check := range table.checks {
+		if check.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// violates reports whether `row` violates `check` when it's enforced. The
+// caller should hold the lock of the table.
+func (table *ddlTestTable) violates(check *ddlTestCheck, row []interface{}) bool {
+	pos := table.columns.IndexOf(check.column)
+	return check.enforced && pos >= 0 && !check.accepts(row[pos])
+}
+
+// hasViolatingRows reports whether a row of the table violates `check`.
+func (table *ddlTestTable) hasViolatingRows(check *ddlTestCheck) bool {
+	for i := 0; i < table.numberOfRows; i++ {
+		if !check.accepts(getRowFromArrayList(check.column.rows, i)) {
+			return true
+		}
+	}
+	return false
+}
+
+// predictConstraintViolation returns the error that the task should fail
+// with, if one of the new `rows` sets a NOT NULL column to NULL or violates
+// an enforced check. The prediction is skipped if a DDL changes the
+// constraints of the table concurrently.
+func (task *dmlJobTask) predictConstraintViolation(rows [][]interface{}) error {
+	table := task.tblInfo
+	if task.racesUniqueChange() {
+		return nil
+	}
+	for _, row := range rows {
+		for i := 0; i < table.columns.Size(); i++ {
+			column := getColumnFromArrayList(table.columns, i)
+			if column.notNull && !column.isAutoID() && (row[i] == nil || row[i] == ddlTestValueNull) {
+				return expectError(errCodeBadNull, "column %s of table %s cannot be null", column.name, table.name)
+			}
+		}
+		for _, check := range table.checks {
+			if table.violates(check, row) {
+				return expectError(errCodeCheckViolated, "check %s of table %s is violated", check.name, table.name)
+			}
+		}
+	}
+	return nil
+}
+
+// enableCheckConstraints turns on the CHECK constraints of TiDB, which are
+// parsed but ignored by default. It returns false if the server doesn't
+// support them.
+func enableCheckConstraints(db *sql.DB, mysqlCompatible bool) (bool, error) {
+	if mysqlCompatible {
+		return true, nil
+	}
+	_, err := db.Exec("SET GLOBAL tidb_enable_check_constraint = ON")
+	if mysqlErrorCode(err) == errCodeUnknownSystemVariable {
+		log.Warnf("[ddl] CHECK constraints are not supported: %v", err)
+		return false, nil
+	}
+	return err == nil, err
+}
+
+type ddlCheckJobArg struct {
+	check    *ddlTestCheck
+	enforced bool // the enforcement set by ALTER CONSTRAINT.
+}
+
+func (c *testCase) generateAddCheck() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareAddCheck, nil, ddlAddCheck})
+	return nil
+}
+
+func (c *testCase) prepareAddCheck(_ interface{}, taskCh chan *ddlJobTask) error {
+	if !c.checkConstraints {
+		return nil
+	}
+	table := c.pickupRandomTable(c.ddlRand)
+	if table == nil {
+		return nil
+	}
+	columns := table.filterColumns(func(col *ddlTestColumn) bool { return col.canHaveCheck() })
+	if len(columns) == 0 {
+		return nil
+	}
+	check := newRandCheck(c.ddlRand, columns[c.ddlRand.Intn(len(columns))])
+	task := &ddlJobTask{
+		k:       ddlAddCheck,
+		sql:     fmt.Sprintf("ALTER TABLE %s ADD %s", table.quotedName(), check.definition()),
+		tblInfo: table,
+		arg:     ddlJobArg(&ddlCheckJobArg{check: check, enforced: check.enforced}),
+	}
+	taskCh <- task
+	return nil
+}
+
+func (c *testCase) addCheckJob(task *ddlJobTask) error {
+	table := task.tblInfo
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	if c.isTableDeleted(table) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
+	}
+	check := (*ddlCheckJobArg)(task.arg).check
+	// The column may be modified since the task is prepared.
+	pos := -1
+	for i := 0; i < table.columns.Size(); i++ {
+		if getColumnFromArrayList(table.columns, i).name == check.column.name {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		return expectError(0, "local Execute add check %s on column %s error , column is deleted", check.name, check.column.name)
+	}
+	check.column = getColumnFromArrayList(table.columns, pos)
+	if check.enforced && table.hasViolatingRows(check) {
+		return expectError(errCodeCheckViolated, "a row of table %s violates check %s", table.name, check.name)
+	}
+	table.checks = append(table.checks, check)
+	return nil
+}
+
+func (c *testCase) generateDropCheck() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareDropCheck, nil, ddlDropCheck})
+	return nil
+}
+
+func (c *testCase) prepareDropCheck(_ interface{}, taskCh chan *ddlJobTask) error {
+	table := c.pickupRandomTable(c.ddlRand)
+	if table == nil || len(table.checks) == 0 {
+		return nil
+	}
+	check := table.checks[c.ddlRand.Intn(len(table.checks))]
+	task := &ddlJobTask{
+		k:       ddlDropCheck,
+		sql:     fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT `%s`", table.quotedName(), check.name),
+		tblInfo: table,
+		arg:     ddlJobArg(&ddlCheckJobArg{check: check}),
+	}
+	taskCh <- task
+	return nil
+}
+
+func (c *testCase) dropCheckJob(task *ddlJobTask) error {
+	table := task.tblInfo
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	if c.isTableDeleted(table) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
+	}
+	check := (*ddlCheckJobArg)(task.arg).check
+	i := table.findCheck(check.name)
+	if i < 0 {
+		return expectError(errCodeConstraintNotFound, "table %s , check %s is not exists", table.name, check.name)
+	}
+	table.checks = append(table.checks[:i], table.checks[i+1:]...)
+	return nil
+}
+
+func (c *testCase) generateAlterCheck() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareAlterCheck, nil, ddlAlterCheck})
+	return nil
+}
+
+// prepareAlterCheck switches a check between ENFORCED and NOT ENFORCED.
+func (c *testCase) prepareAlterCheck(_ interface{}, taskCh chan *ddlJobTask) error {
+	table := c.pickupRandomTable(c.ddlRand)
+	if table == nil || len(table.checks) == 0 {
+		return nil
+	}
+	check := table.checks[c.ddlRand.Intn(len(table.checks))]
+	enforcement := "ENFORCED"
+	if check.enforced {
+		enforcement = "NOT ENFORCED"
+	}
+	task := &ddlJobTask{
+		k:       ddlAlterCheck,
+		sql:     fmt.Sprintf("ALTER TABLE %s ALTER CONSTRAINT `%s` %s", table.quotedName(), check.name, enforcement),
+		tblInfo: table,
+		arg:     ddlJobArg(&ddlCheckJobArg{check: check, enforced: !check.enforced}),
+	}
+	taskCh <- task
+	return nil
+}
+
+func (c *testCase) alterCheckJob(task *ddlJobTask) error {
+	table := task.tblInfo
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	if c.isTableDeleted(table) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
+	}
+	arg := (*ddlCheckJobArg)(task.arg)
+	i := table.findCheck(arg.check.name)
+	if i < 0 {
+		return expectError(errCodeConstraintNotFound, "table %s , check %s is not exists", table.name, arg.check.name)
+	}
+	check := table.checks[i]
+	if arg.enforced && table.hasViolatingRows(check) {
+		return expectError(errCodeCheckViolated, "a row of table %s violates check %s", table.name, check.name)
+	}
+	check.enforced = arg.enforced
+	return nil
+}
@@ -0,0 +1,82 @@
+package ddl
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/emirpasic/gods/lists/arraylist"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckConstraint(t *testing.T) {
+	a := &ddlTestColumn{k: KindInt32, name: "a", fieldType: "INT", notNull: true, rows: arraylist.New()}
+	b := &ddlTestColumn{k: KindInt32, name: "b", fieldType: "INT", rows: arraylist.New()}
+	table := &ddlTestTable{
+		name:    "t",
+		columns: arraylist.New(a, b),
+		comment: "c",
+		charset: "utf8mb4",
+		collate: "utf8mb4_bin",
+		lock:    new(sync.RWMutex),
+	}
+	inline := &ddlTestCheck{name: "c1", column: a, op: ">=", value: 0, enforced: true, inline: true}
+	check := &ddlTestCheck{name: "c2", column: b, op: "<=", value: 10}
+	table.checks = []*ddlTestCheck{inline, check}
+	assert.Equal(t, "CREATE TABLE `t` (`a` INT NOT NULL CONSTRAINT `c1` CHECK (`a` >= 0), `b` INT NULL, "+
+		"CONSTRAINT `c2` CHECK (`b` <= 10) NOT ENFORCED) COMMENT 'c' CHARACTER SET 'utf8mb4' COLLATE 'utf8mb4_bin'", table.createTableSQL())
+
+	assert.True(t, check.accepts(int32(10)))
+	assert.False(t, check.accepts(int32(11)))
+	assert.True(t, check.accepts(ddlTestValueNull))
+	// A check that isn't enforced is never violated.
+	assert.False(t, table.violates(check, []interface{}{int32(0), int32(11)}))
+	assert.True(t, table.violates(inline, []interface{}{int32(-1), int32(0)}))
+
+	table.addRows([][]interface{}{{int32(1), int32(20)}})
+	assert.True(t, table.hasViolatingRows(check))
+	assert.False(t, table.hasViolatingRows(inline))
+	assert.Len(t, table.checksOn(b), 1)
+	table.removeChecksOn(b)
+	assert.Equal(t, -1, table.findCheck("c2"))
+	assert.Equal(t, 0, table.findCheck("c1"))
+}
+
+func TestPredictConstraintViolation(t *testing.T) {
+	a := &ddlTestColumn{k: KindInt32, name: "a", fieldType: "INT", notNull: true, rows: arraylist.New()}
+	b := &ddlTestColumn{k: KindInt32, name: "b", fieldType: "INT", rows: arraylist.New()}
+	table := &ddlTestTable{name: "t", columns: arraylist.New(a, b), lock: new(sync.RWMutex)}
+	table.checks = []*ddlTestCheck{{name: "c", column: b, op: ">=", value: 0, enforced: true}}
+	task := &dmlJobTask{tblInfo: table}
+
+	assert.NoError(t, task.predictConstraintViolation([][]interface{}{{int32(1), ddlTestValueNull}}))
+	err := task.predictConstraintViolation([][]interface{}{{int32(1), int32(2)}, {ddlTestValueNull, int32(2)}})
+	assert.Equal(t, errCodeBadNull, expectedErrorCode(err))
+	err = task.predictConstraintViolation([][]interface{}{{int32(1), int32(-2)}})
+	assert.Equal(t, errCodeCheckViolated, expectedErrorCode(err))
+
+	// The prediction is skipped if a DDL changes the constraints concurrently.
+	table.beginUniqueChange()
+	task = &dmlJobTask{tblInfo: table, uniqueEpoch: table.loadUniqueEpoch()}
+	assert.NoError(t, task.predictConstraintViolation([][]interface{}{{int32(1), int32(-2)}}))
+}
+
+func TestDropColumnWithCheck(t *testing.T) {
+	a := &ddlTestColumn{k: KindInt32, name: "a", fieldType: "INT", rows: arraylist.New()}
+	b := &ddlTestColumn{k: KindInt32, name: "b", fieldType: "INT", rows: arraylist.New()}
+	table := &ddlTestTable{name: "t", columns: arraylist.New(a, b), lock: new(sync.RWMutex)}
+	table.checks = []*ddlTestCheck{{name: "c", column: b, op: ">=", value: 0, enforced: true, inline: true}}
+	c := &testCase{cfg: &DDLCaseConfig{}, tables: map[objectKey]*ddlTestTable{table.key(): table}}
+	task := &ddlJobTask{k: ddlDropColumn, tblInfo: table, arg: ddlJobArg(&ddlColumnJobArg{column: b})}
+
+	// MySQL refuses to drop a column used by a check.
+	c.cfg.MySQLCompatible = true
+	assert.Equal(t, errCodeDependentByCheck, expectedErrorCode(c.updateTableInfo(task)))
+	assert.Equal(t, 2, table.columns.Size())
+	assert.Len(t, table.checks, 1)
+
+	// TiDB drops the check with the column.
+	c.cfg.MySQLCompatible = false
+	assert.NoError(t, c.updateTableInfo(task))
+	assert.Equal(t, 1, table.columns.Size())
+	assert.Empty(t, table.checks)
+}
@@ -0,0 +1,341 @@
+package ddl
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/emirpasic/gods/lists/arraylist"
+)
+
+// A table is copied from another one, the source, by CREATE TABLE ... LIKE,
+// which copies the columns, the indexes and the options without the rows, and
+// by CREATE TABLE ... SELECT and INSERT ... SELECT, which copy the rows of the
+// selected columns. The model copies the source when the job or the INSERT
+// runs, so the DDLs on the source ordered before it are seen by the copy.
+
+// ddlCopyTableArg is the argument of CREATE TABLE ... LIKE and CREATE TABLE
+// ... SELECT.
+type ddlCopyTableArg struct {
+	source  *ddlTestTable
+	columns []*ddlTestColumn // the columns selected by CREATE TABLE ... SELECT.
+}
+
+// columnByName returns the column `name` of the table, or nil.
+func (table *ddlTestTable) columnByName(name string) *ddlTestColumn {
+	for ite := table.columns.Iterator(); ite.Next(); {
+		if column := ite.Value().(*ddlTestColumn); column.name == name {
+			return column
+		}
+	}
+	return nil
+}
+
+// copyLike returns the table `schema`.`name` created by CREATE TABLE ... LIKE
+// the table. The auto IDs start over. The caller should hold the lock of the
+// table.
+func (table *ddlTestTable) copyLike(schema, name string) *ddlTestTable {
+	newTable := table.clone(false)
+	newTable.schema = schema
+	newTable.name = name
+	newTable.id = ""
+	newTable.autoIncID = 0
+	newTable.autoIDs = nil
+	return newTable
+}
+
+func (c *testCase) generateCreateTableLike() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareCreateTableLike, nil, ddlCreateTableLike})
+	return nil
+}
+
+// prepareCreateTableLike copies the structure of a table. The tables with
+// checks or foreign keys aren't copied, MySQL names the checks of the copy
+// anew, and neither server copies the foreign keys.
+func (c *testCase) prepareCreateTableLike(_ interface{}, taskCh chan *ddlJobTask) error {
+	source := c.pickupRandomTable(c.ddlRand)
+	if source == nil {
+		return nil
+	}
+	source.lock.RLock()
+	defer source.lock.RUnlock()
+	if len(source.checks) > 0 || len(source.foreignKeys) > 0 {
+		return nil
+	}
+	table := source.copyLike(c.pickupRandomSchemaName(c.ddlRand), RandName(c.ddlRand))
+	task := &ddlJobTask{
+		k:       ddlCreateTableLike,
+		sql:     fmt.Sprintf("CREATE TABLE %s LIKE %s", table.quotedName(), source.quotedName()),
+		tblInfo: table,
+		arg:     ddlJobArg(&ddlCopyTableArg{source: source}),
+	}
+	taskCh <- task
+	return nil
+}
+
+// createTableLikeJob adds the copy of the source. `task.tblInfo` is the copy
+// when the task is prepared, the server copies the source when the statement
+// starts, which may be before or after the DDLs on the source in the same
+// batch, see `resolveTableCopy`.
+func (c *testCase) createTableLikeJob(task *ddlJobTask) error {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	source := (*ddlCopyTableArg)(task.arg).source
+	if c.isTableDeleted(source) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", source.name)
+	}
+	if c.isSchemaNameDeleted(task.tblInfo.schema) {
+		return expectError(errCodeBadDB, "schema %s doesn't exist", task.tblInfo.schema)
+	}
+	source.lock.RLock()
+	table := source.copyLike(task.tblInfo.schema, task.tblInfo.name)
+	source.lock.RUnlock()
+	if table.createTableSQL() != task.tblInfo.createTableSQL() {
+		table = c.resolveTableCopy(table, task.tblInfo)
+	}
+	table.id = task.tblInfo.id
+	task.tblInfo = table
+	c.tables[table.key()] = table
+	return nil
+}
+
+// resolveTableCopy returns the one of `copies` matching the table created on
+// the server. If none matches, the table is resynced, see `markTablesUnknown`.
+func (c *testCase) resolveTableCopy(copies ...*ddlTestTable) *ddlTestTable {
+	table := copies[0]
+	actual, err := readTableSchema(c.dbs[0], c.schemaName(table.schema), table.name)
+	if err == nil {
+		// The table is dropped by a later DDL of the batch.
+		if actual == nil {
+			return table
+		}
+		for _, copied := range copies {
+			if len(copied.schemaDiff(actual, !c.cfg.MySQLCompatible)) == 0 {
+				return copied
+			}
+		}
+	}
+	c.markTablesUnknown(fmt.Sprintf("the copy %s of a changing table is unknown", table.name), table.key())
+	return table
+}
+
+func (c *testCase) generateCreateTableSelect() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareCreateTableSelect, nil, ddlCreateTableSelect})
+	return nil
+}
+
+// prepareCreateTableSelect creates a table from some columns of another one,
+// which are neither generated nor auto IDs. TiDB doesn't support CREATE TABLE
+// ... SELECT.
+func (c *testCase) prepareCreateTableSelect(_ interface{}, taskCh chan *ddlJobTask) error {
+	if !c.cfg.MySQLCompatible {
+		return nil
+	}
+	source := c.pickupRandomTable(c.ddlRand)
+	if source == nil {
+		return nil
+	}
+	source.lock.RLock()
+	defer source.lock.RUnlock()
+	var columns []*ddlTestColumn
+	var names []string
+	for _, column := range source.filterColumns(source.predicateNotGenerated) {
+		if !column.isAutoID() && c.ddlRand.Intn(2) == 0 {
+			columns = append(columns, column)
+			names = append(names, fmt.Sprintf("`%s`", column.name))
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	// The columns keep the charset of the source.
+	table := &ddlTestTable{
+		schema:  c.pickupRandomSchemaName(c.ddlRand),
+		name:    RandName(c.ddlRand),
+		columns: arraylist.New(),
+		indexes: make([]*ddlTestIndex, 0),
+		comment: RandName(c.ddlRand),
+		charset: source.charset,
+		collate: source.collate,
+		lock:    new(sync.RWMutex),
+	}
+	sql := fmt.Sprintf("CREATE TABLE %s COMMENT '%s' CHARACTER SET '%s' COLLATE '%s' SELECT %s FROM %s", table.quotedName(),
+		table.comment, table.charset, table.collate, strings.Join(names, ", "), source.quotedName())
+	task := &ddlJobTask{
+		k:       ddlCreateTableSelect,
+		sql:     sql,
+		tblInfo: table,
+		arg:     ddlJobArg(&ddlCopyTableArg{source: source, columns: columns}),
+	}
+	taskCh <- task
+	return nil
+}
+
+// createTableSelectJob adds the table with the selected columns and the rows
+// of the source. The columns keep their types, NOT NULL and defaults, but no
+// keys.
+func (c *testCase) createTableSelectJob(task *ddlJobTask) error {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	arg := (*ddlCopyTableArg)(task.arg)
+	source := arg.source
+	if c.isTableDeleted(source) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", source.name)
+	}
+	if c.isSchemaNameDeleted(task.tblInfo.schema) {
+		return expectError(errCodeBadDB, "schema %s doesn't exist", task.tblInfo.schema)
+	}
+	source.lock.RLock()
+	defer source.lock.RUnlock()
+	_, copyColumn := source.copyTable(source.name, true)
+	columns := make([]*ddlTestColumn, 0, len(arg.columns))
+	for _, selected := range arg.columns {
+		column := source.columnByName(selected.name)
+		if column == nil {
+			return expectError(errCodeBadField, "column %s of table %s, column is deleted", selected.name, source.name)
+		}
+		newColumn := copyColumn(column)
+		newColumn.isPrimaryKey = false
+		newColumn.indexReferences = 0
+		newColumn.dependenciedCols = nil
+		columns = append(columns, newColumn)
+	}
+	table := task.tblInfo
+	for _, column := range columns {
+		table.columns.Add(column)
+	}
+	table.numberOfRows = source.numberOfRows
+	c.tables[table.key()] = table
+	return nil
+}
+
+func (c *testCase) generateInsertSelect() error {
+	c.dmlOps = append(c.dmlOps, dmlTestOpExecutor{c.prepareInsertSelect, nil})
+	return nil
+}
+
+// insertSelectColumns maps the columns of `target` to the columns `from` of
+// the source with the same names and types, which are copied by INSERT ...
+// SELECT, a NOT NULL column is only copied from a NOT NULL one. It returns nil
+// if the other columns of `target` cannot be omitted, or if `target` has a
+// generated column or an auto ID. The caller should hold the lock of `target`.
+func insertSelectColumns(target *ddlTestTable, from []*ddlTestColumn) (targetColumns, sourceColumns []*ddlTestColumn) {
+	for _, column := range target.filterColumns(target.predicateAll) {
+		if column.isGenerated() || column.isAutoID() {
+			return nil, nil
+		}
+		matched := false
+		for _, col := range from {
+			if col.name == column.name && col.fieldType == column.fieldType && col.unsigned == column.unsigned &&
+				(col.notNull || !column.notNull) && strings.Join(col.setValue, ",") == strings.Join(column.setValue, ",") {
+				targetColumns = append(targetColumns, column)
+				sourceColumns = append(sourceColumns, col)
+				matched = true
+				break
+			}
+		}
+		if !matched && column.notNull && column.defaultValue == nil {
+			return nil, nil
+		}
+	}
+	return targetColumns, sourceColumns
+}
+
+// prepareInsertSelect copies the rows of a table, or of itself, to a table
+// by the columns with the same names and types.
+func (c *testCase) prepareInsertSelect(_ interface{}, taskCh chan *dmlJobTask) error {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	target := c.pickupRandomTable(c.dmlRand)
+	if target == nil {
+		return nil
+	}
+	// The tables are locked one by one, which may be the same one.
+	source := c.pickupRandomTable(c.dmlRand)
+	source.lock.RLock()
+	from := source.filterColumns(source.predicateNotGenerated)
+	source.lock.RUnlock()
+	target.lock.Lock()
+	defer target.lock.Unlock()
+	targetColumns, sourceColumns := insertSelectColumns(target, from)
+	if len(targetColumns) == 0 {
+		return nil
+	}
+	assigns := make([]*ddlTestColumnDescriptor, 0, len(targetColumns))
+	targetNames := make([]string, 0, len(targetColumns))
+	sourceNames := make([]string, 0, len(sourceColumns))
+	for i, column := range targetColumns {
+		assigns = append(assigns, &ddlTestColumnDescriptor{column: column})
+		targetNames = append(targetNames, fmt.Sprintf("`%s`", column.name))
+		sourceNames = append(sourceNames, fmt.Sprintf("`%s`", sourceColumns[i].name))
+	}
+	task := &dmlJobTask{
+		k: dmlInsertSelect,
+		sql: fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", target.quotedName(), strings.Join(targetNames, ", "),
+			strings.Join(sourceNames, ", "), source.quotedName()),
+		tblInfo:       target,
+		assigns:       assigns,
+		source:        source,
+		sourceColumns: sourceColumns,
+		uniqueEpoch:   target.loadUniqueEpoch(),
+		sourceEpoch:   source.loadUniqueEpoch(),
+		fkEpochs:      c.foreignKeyEpochs(target),
+	}
+	taskCh <- task
+	return nil
+}
+
+// racesSourceChange reports whether a DDL that changes the rows of the source
+// of INSERT ... SELECT runs since the task was prepared, see
+// `racesUniqueChange`.
+func (task *dmlJobTask) racesSourceChange() bool {
+	return task.source != nil && (task.sourceEpoch%2 != 0 || task.source.loadUniqueEpoch() != task.sourceEpoch)
+}
+
+// doInsertSelectJob appends the rows of the source to the target. The columns
+// not selected get their defaults, and a generated column added since the task
+// was prepared is unknown.
+func (c *testCase) doInsertSelectJob(task *dmlJobTask) error {
+	table := task.tblInfo
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+
+	task.source.lock.RLock()
+	selected := make([][]interface{}, 0, task.source.numberOfRows)
+	for i := 0; i < task.source.numberOfRows; i++ {
+		values := make([]interface{}, 0, len(task.sourceColumns))
+		for _, column := range task.sourceColumns {
+			values = append(values, getRowFromArrayList(column.rows, i))
+		}
+		selected = append(selected, values)
+	}
+	task.source.lock.RUnlock()
+
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	rows := make([][]interface{}, 0, len(selected))
+	for _, values := range selected {
+		row := make([]interface{}, 0, table.columns.Size())
+		for ite := table.columns.Iterator(); ite.Next(); {
+			column := ite.Value().(*ddlTestColumn)
+			value := column.defaultValue
+			for i, cd := range task.assigns {
+				if cd.column == column {
+					value = values[i]
+				}
+			}
+			if column.isGenerated() {
+				value = nil
+			}
+			row = append(row, value)
+		}
+		rows = append(rows, row)
+	}
+	err := chooseExpectedError(task.err, c.predictDuplicate(task, nil, rows), task.predictNoReferencedRow(rows),
+		task.predictConstraintViolation(rows))
+	if err != nil || task.err != nil {
+		return err
+	}
+	table.addRows(rows)
+	return nil
+}
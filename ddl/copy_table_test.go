@@ -0,0 +1,82 @@
+package ddl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateTableLike(t *testing.T) {
+	c, source := newMultiSchemaTable()
+	source.autoIncID = 100
+	newTable := source.copyLike("", "t2")
+	task := &ddlJobTask{k: ddlCreateTableLike, tblInfo: newTable, arg: ddlJobArg(&ddlCopyTableArg{source: source})}
+	assert.True(t, task.isJobKind(ddlAddTable))
+	assert.NoError(t, c.updateTableInfo(task))
+	table := c.tables[objectKey{"", "t2"}]
+	assert.Equal(t, "CREATE TABLE `t2` (`a` INT NULL, `b` INT NULL, INDEX `idx` (`a`)) COMMENT '' CHARACTER SET '' COLLATE ''", table.createTableSQL())
+	assert.Zero(t, table.numberOfRows)
+	assert.Zero(t, table.autoIncID)
+
+	// The copy is independent of the source.
+	getColumnFromArrayList(source.columns, 0).rows.Add(int32(4))
+	assert.Zero(t, getColumnFromArrayList(table.columns, 0).rows.Size())
+	assert.False(t, table.indexes[0].columns[0] == source.indexes[0].columns[0])
+
+	source.setDeleted()
+	delete(c.tables, source.key())
+	task.tblInfo = source.copyLike("", "t3")
+	assert.Equal(t, errCodeNoSuchTable, expectedErrorCode(c.updateTableInfo(task)))
+}
+
+func TestCreateTableSelect(t *testing.T) {
+	c, source := newMultiSchemaTable()
+	b := getColumnFromArrayList(source.columns, 1)
+	b.notNull = true
+	b.isPrimaryKey = true
+	b.indexReferences = 1
+	table := newSchemaTable("", "t2")
+	table.columns.Clear()
+	task := &ddlJobTask{k: ddlCreateTableSelect, tblInfo: table, arg: ddlJobArg(&ddlCopyTableArg{source: source, columns: []*ddlTestColumn{b}})}
+	assert.NoError(t, c.updateTableInfo(task))
+	assert.Equal(t, "CREATE TABLE `t2` (`b` INT NOT NULL) COMMENT '' CHARACTER SET '' COLLATE ''", table.createTableSQL())
+	assert.Equal(t, 2, table.numberOfRows)
+	copied := getColumnFromArrayList(table.columns, 0)
+	assert.Equal(t, b.rows.Values(), copied.rows.Values())
+	assert.False(t, copied.isPrimaryKey)
+	assert.Zero(t, copied.indexReferences)
+
+	// The selected column is dropped before the job.
+	source.columns.Remove(1)
+	task.tblInfo = newSchemaTable("", "t3")
+	assert.Equal(t, errCodeBadField, expectedErrorCode(c.updateTableInfo(task)))
+}
+
+func TestInsertSelect(t *testing.T) {
+	c, source := newMultiSchemaTable()
+	target := newSchemaTable("", "t2")
+	target.indexes = []*ddlTestIndex{{name: "u", unique: true, columns: []*ddlTestColumn{getColumnFromArrayList(target.columns, 0)}}}
+	c.tables[target.key()] = target
+
+	targetColumns, sourceColumns := insertSelectColumns(target, source.filterColumns(source.predicateNotGenerated))
+	assert.Equal(t, []*ddlTestColumn{getColumnFromArrayList(source.columns, 0)}, sourceColumns)
+	task := &dmlJobTask{k: dmlInsertSelect, tblInfo: target, assigns: []*ddlTestColumnDescriptor{{column: targetColumns[0]}},
+		source: source, sourceColumns: sourceColumns}
+
+	// Both rows of the source have `a` = 1, which duplicates on the unique key.
+	assert.Equal(t, errCodeDupEntry, expectedErrorCode(c.doInsertSelectJob(task)))
+	target.indexes = nil
+	assert.NoError(t, c.doInsertSelectJob(task))
+	assert.Equal(t, []interface{}{int32(1), int32(1)}, getColumnFromArrayList(target.columns, 0).rows.Values())
+
+	// A NOT NULL column without a default cannot be omitted.
+	target.columns.Add(&ddlTestColumn{k: KindInt32, name: "c", fieldType: "INT", notNull: true})
+	targetColumns, _ = insertSelectColumns(target, source.filterColumns(source.predicateNotGenerated))
+	assert.Empty(t, targetColumns)
+
+	// The source changes its rows concurrently.
+	source.beginUniqueChange()
+	assert.True(t, task.racesUniqueChange())
+	getColumnFromArrayList(source.columns, 0).setDeleted()
+	assert.Error(t, checkConflict(task))
+}
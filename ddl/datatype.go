@@ -141,12 +141,13 @@ var AllowPartitionType = []int{
 	KindBigInt,
 }
 
-func RandDataType() int {
-	i := rand.Intn(len(TestFieldType))
+func RandDataType(r *rand.Rand) int {
+	i := r.Intn(len(TestFieldType))
 	return TestFieldType[i]
 }
 
-const (
+// The max lengths can be changed by the `max_len` table of the config file.
+var (
 	BitMaxLen        = 64
 	CharMaxLen       = 256
 	VarCharMaxLen    = 256 // varchar max len , actual range is [0,65536)
@@ -160,11 +161,29 @@ const (
 	MEDIUMTEXTMaxLen = 256 // MEDIUMTEXT max len , actual range is [0,16777216)
 	LONGTEXTMaxLen   = 256 // LONGTEXT max len , actual range is [0,4294967296)
 
-	MAXDECIMALM = 65 // 1~65
-	MAXDECIMALN = 30 // 0~30
-
 	EnumMaxLen = 10
 	SetMaxLen  = 10
+)
+
+var maxLenOfKind = map[int]*int{
+	KindChar:       &CharMaxLen,
+	KindVarChar:    &VarCharMaxLen,
+	KindBLOB:       &BLOBMaxLen,
+	KindTINYBLOB:   &TINYBLOBMaxLen,
+	KindMEDIUMBLOB: &MEDIUMBLOBMaxLen,
+	KindLONGBLOB:   &LONGBLOBMaxLen,
+	KindTEXT:       &TEXTMaxLen,
+	KindTINYTEXT:   &TINYTEXTMaxLen,
+	KindMEDIUMTEXT: &MEDIUMTEXTMaxLen,
+	KindLONGTEXT:   &LONGTEXTMaxLen,
+	KindBit:        &BitMaxLen,
+	KindEnum:       &EnumMaxLen,
+	KindSet:        &SetMaxLen,
+}
+
+const (
+	MAXDECIMALM = 65 // 1~65
+	MAXDECIMALN = 30 // 0~30
 
 	TimeFormat        = "2006-01-02 15:04:05"
 	TimeFormatForDATE = "2006-01-02"
@@ -189,33 +208,8 @@ var MaxTIMESTAMP time.Time
 var GapTIMESTAMPUnix int64
 
 func GetMaxLenByKind(kind int) int {
-	switch kind {
-	case KindChar:
-		return CharMaxLen
-	case KindVarChar:
-		return VarCharMaxLen
-	case KindBLOB:
-		return BLOBMaxLen
-	case KindTINYBLOB:
-		return TINYBLOBMaxLen
-	case KindMEDIUMBLOB:
-		return MEDIUMBLOBMaxLen
-	case KindLONGBLOB:
-		return LONGBLOBMaxLen
-	case KindTEXT:
-		return TEXTMaxLen
-	case KindTINYTEXT:
-		return TINYTEXTMaxLen
-	case KindMEDIUMTEXT:
-		return MEDIUMTEXTMaxLen
-	case KindLONGTEXT:
-		return LONGTEXTMaxLen
-	case KindBit:
-		return BitMaxLen
-	case KindEnum:
-		return EnumMaxLen
-	case KindSet:
-		return SetMaxLen
+	if maxLen, ok := maxLenOfKind[kind]; ok {
+		return *maxLen
 	}
 	return 0
 }
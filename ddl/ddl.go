@@ -41,6 +41,17 @@ type DDLCaseConfig struct {
 	MySQLCompatible bool        `toml:"mysql_compactible"`
 	TablesToCreate  int         `toml:"tables_to_create"`
 	TestTp          DDLTestType `toml:"test_type"`
+	Seed            int64       `toml:"seed"`
+	TracePath       string      `toml:"trace"`
+	// Duration and Rounds bound the test, the test stops when either of them
+	// is reached. Zero means no bound.
+	Duration Duration `toml:"duration"`
+	Rounds   int      `toml:"rounds"`
+	// MetricsAddr is the address to serve the metrics at `/metrics`, and
+	// PushGateway is the address of the pushgateway to push the metrics to.
+	// Empty means disabled.
+	MetricsAddr string `toml:"metrics_addr"`
+	PushGateway string `toml:"push_gateway"`
 }
 
 type DDLTestType int
@@ -62,7 +73,10 @@ func (c *DDLCase) String() string {
 	return "ddl"
 }
 
-// Execute executes each goroutine (i.e. `testCase`) concurrently.
+// Execute executes each goroutine (i.e. `testCase`) concurrently, until `ctx`
+// is done, the configured duration or rounds are reached, or an error occurs.
+// Then it verifies all tables for the last time and prints a summary. The
+// first error of the `testCase`s is returned.
 func (c *DDLCase) Execute(ctx context.Context, dbss [][]*sql.DB, exeDDLFunc ExecuteDDLFunc, exeDMLFunc ExecuteDMLFunc) error {
 	for _, dbs := range dbss {
 		for _, db := range dbs {
@@ -74,42 +88,141 @@ func (c *DDLCase) Execute(ctx context.Context, dbss [][]*sql.DB, exeDDLFunc Exec
 	defer func() {
 		log.Infof("[%s] test end...", c)
 	}()
+	start := time.Now()
+	if c.cfg.Duration > 0 {
+		timer := time.AfterFunc(time.Duration(c.cfg.Duration), func() {
+			log.Infof("[%s] duration %v is reached, stopping...", c, c.cfg.Duration)
+			c.stopAll()
+		})
+		defer timer.Stop()
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.stopAll()
+		case <-done:
+		}
+	}()
+
 	var wg sync.WaitGroup
+	errs := make([]error, c.cfg.Concurrency)
 	for i := 0; i < c.cfg.Concurrency; i++ {
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
-			for {
-				select {
-				case <-ctx.Done():
+			tc := c.cases[i]
+			for !tc.isStop() {
+				err := tc.execute(exeDDLFunc, exeDMLFunc)
+				if err != nil {
+					log.Errorf("[ddl] [instance %d] [seed %d] ERROR: %s", i, c.cfg.Seed, errors.ErrorStack(err))
+					errs[i] = errors.Annotatef(err, "[instance %d] [seed %d]", i, c.cfg.Seed)
+					c.stopAll()
 					return
-				default:
 				}
-				err := c.cases[i].execute(exeDDLFunc, exeDMLFunc)
-				if err != nil {
-					for _, dbs := range dbss {
-						for _, db := range dbs {
-							disableTiKVGC(db)
-						}
-					}
-					log.Fatalf("[ddl] [instance %d] ERROR: %s", i, errors.ErrorStack(err))
+				tc.rounds++
+				if c.cfg.Rounds > 0 && tc.rounds >= c.cfg.Rounds {
+					return
 				}
 			}
 		}(i)
 	}
 	wg.Wait()
+
+	var err error
+	for _, e := range errs {
+		if e != nil {
+			err = e
+			break
+		}
+	}
+	if err == nil {
+		err = c.finalCheck()
+	}
+	if err != nil {
+		for _, dbs := range dbss {
+			for _, db := range dbs {
+				disableTiKVGC(db)
+			}
+		}
+	}
+	c.printSummary(time.Since(start), err)
+	return err
+}
+
+// stopAll stops all `testCase`s, each of them stops after the running operation.
+func (c *DDLCase) stopAll() {
+	for _, tc := range c.cases {
+		tc.stopTest()
+	}
+}
+
+// finalCheck verifies the data, the schema and the indexes of all tables after
+// all `testCase`s stop.
+func (c *DDLCase) finalCheck() error {
+	for i, tc := range c.cases {
+		log.Infof("[ddl] [instance %d] final check", i)
+		if err := tc.executeVerifyIntegrity(); err != nil {
+			return errors.Annotatef(err, "[instance %d] [seed %d] final check", i, c.cfg.Seed)
+		}
+		if err := tc.executeVerifySchema(); err != nil {
+			return errors.Annotatef(err, "[instance %d] [seed %d] final check", i, c.cfg.Seed)
+		}
+		if c.cfg.MySQLCompatible {
+			continue
+		}
+		if err := tc.executeAdminCheck(); err != nil {
+			return errors.Annotatef(err, "[instance %d] [seed %d] final check", i, c.cfg.Seed)
+		}
+	}
 	return nil
 }
 
+func (c *DDLCase) printSummary(elapsed time.Duration, err error) {
+	log.Infof("[%s] ========== summary ==========", c)
+	log.Infof("[%s] seed: %d, elapsed: %v", c, c.cfg.Seed, elapsed)
+	for i, tc := range c.cases {
+		log.Infof("[%s] [instance %d] rounds: %d, DDL statements: %d, DML statements: %d, tables: %d",
+			c, i, tc.rounds, atomic.LoadInt64(&tc.ddlCount), atomic.LoadInt64(&tc.dmlCount), len(tc.tables))
+	}
+	if err != nil {
+		log.Infof("[%s] result: FAILED, %v", c, err)
+	} else {
+		log.Infof("[%s] result: PASSED", c)
+	}
+}
+
 // Initialize initializes all supported charsets, collates and each concurrent
 // goroutine (i.e. `testCase`).
 func (c *DDLCase) Initialize(ctx context.Context, dbss [][]*sql.DB, initDB string) error {
+	checkConstraints, err := enableCheckConstraints(dbss[0][0], c.cfg.MySQLCompatible)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	newCollation, err := newCollationEnabled(dbss[0][0], c.cfg.MySQLCompatible)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	minTimestamp, maxTimestamp, err := timestampRange(dbss[0][0])
+	if err != nil {
+		return errors.Trace(err)
+	}
+	placementPolicy, err := createPlacementPolicy(dbss[0][0], c.cfg.MySQLCompatible)
+	if err != nil {
+		return errors.Trace(err)
+	}
 	charsets, charsetsCollates, err := getAllCharsetAndCollates(dbss[0][0])
 	if err != nil {
 		return errors.Trace(err)
 	}
 	for i := 0; i < c.cfg.Concurrency; i++ {
 		c.cases[i].initDB = initDB
+		c.cases[i].checkConstraints = checkConstraints
+		c.cases[i].newCollation = newCollation
+		c.cases[i].minTimestamp, c.cases[i].maxTimestamp = minTimestamp, maxTimestamp
+		c.cases[i].placementPolicy = placementPolicy
+		c.cases[i].recoverable = !c.cfg.MySQLCompatible
 		c.cases[i].setCharsetsAndCollates(charsets, charsetsCollates)
 		err := c.cases[i].initialize(dbss[i])
 		if err != nil {
@@ -147,19 +260,39 @@ func getAllCharsetAndCollates(db *sql.DB) ([]string, map[string][]string, error)
 	return charsets, charsetsCollates, nil
 }
 
+// SetTrace records the statements executed by all `testCase`s to a trace
+// file at `path`, see `Replay`. The returned function closes the file.
+func (c *DDLCase) SetTrace(path string) (func() error, error) {
+	trace, err := newTraceRecorder(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, tc := range c.cases {
+		tc.trace = trace
+	}
+	return trace.close, nil
+}
+
 // NewDDLCase returns a DDLCase, which contains specified `testCase`s.
+// The random sources of each `testCase` are derived from `cfg.Seed` and
+// the case index, so the same configuration always generates the same cases.
 func NewDDLCase(cfg *DDLCaseConfig) *DDLCase {
 	cases := make([]*testCase, cfg.Concurrency)
+	seeds := rand.New(rand.NewSource(cfg.Seed))
 	for i := 0; i < cfg.Concurrency; i++ {
+		caseSeed := seeds.Int63()
 		cases[i] = &testCase{
 			cfg:       cfg,
-			tables:    make(map[string]*ddlTestTable),
+			tables:    make(map[objectKey]*ddlTestTable),
 			schemas:   make(map[string]*ddlTestSchema),
-			views:     make(map[string]*ddlTestView),
+			views:     make(map[objectKey]*ddlTestView),
 			ddlOps:    make([]ddlTestOpExecutor, 0),
 			dmlOps:    make([]dmlTestOpExecutor, 0),
 			caseIndex: i,
 			stop:      0,
+			seed:      caseSeed,
+			ddlRand:   rand.New(rand.NewSource(caseSeed)),
+			dmlRand:   rand.New(rand.NewSource(caseSeed ^ 0x5eed)),
 		}
 	}
 	b := &DDLCase{
@@ -191,8 +324,18 @@ const (
 	dmlInsert DMLKind = iota
 	dmlUpdate
 	dmlDelete
+	dmlInsertSelect
+
+	dmlKindNil
 )
 
+var mapOfDMLKindToString = map[DMLKind]string{
+	dmlInsert:       "insert",
+	dmlUpdate:       "update",
+	dmlDelete:       "delete",
+	dmlInsertSelect: "insert select",
+}
+
 type dmlJobArg unsafe.Pointer
 
 type dmlJobTask struct {
@@ -201,7 +344,24 @@ type dmlJobTask struct {
 	sql          string
 	assigns      []*ddlTestColumnDescriptor
 	whereColumns []*ddlTestColumnDescriptor
-	err          error
+	uniqueEpoch  int64 // `uniqueEpoch` of the table when the task is prepared.
+	// fkEpochs are `uniqueEpoch` of the tables related by the foreign keys
+	// when the task is prepared, see `racesForeignKeyChange`.
+	fkEpochs map[*ddlTestTable]int64
+	// allocatesAutoID is true if the INSERT omits the auto ID column, then
+	// `lastInsertID` is the ID allocated by the server, which is checked with
+	// the base and the shard bits of the table when the task is prepared.
+	allocatesAutoID bool
+	lastInsertID    int64
+	autoIDBase      int64
+	autoIDShardBits int64
+	err             error
+
+	// source is the table copied by INSERT ... SELECT, `assigns` are the
+	// columns copied from `sourceColumns`.
+	source        *ddlTestTable
+	sourceColumns []*ddlTestColumn
+	sourceEpoch   int64 // `uniqueEpoch` of the source when the task is prepared.
 }
 
 // initialize generates possible DDL and DML operations for one `testCase`.
@@ -215,6 +375,7 @@ func (c *testCase) initialize(dbs []*sql.DB) error {
 	if err = c.generateDMLOps(); err != nil {
 		return errors.Trace(err)
 	}
+	log.Infof("[ddl] [instance %d] seed %d", c.caseIndex, c.seed)
 	// Create 2 table before executes DDL & DML
 	taskCh := make(chan *ddlJobTask, 2)
 	c.prepareAddTable(nil, taskCh)
@@ -250,14 +411,14 @@ ParallelExecuteOperations executes process:
 6. Judge the every DDL execution result of TiDB and local. If both of local and TiDB execute result are no wrong, or both are wrong it will be ok. Otherwise, It must be something wrong.
 */
 func ParallelExecuteOperations(c *testCase, ops []ddlTestOpExecutor, postOp func() error) error {
-	perm := rand.Perm(len(ops))
+	perm := c.ddlRand.Perm(len(ops))
 	taskCh := make(chan *ddlJobTask, len(ops))
 	for _, idx := range perm {
 		if c.isStop() {
 			return nil
 		}
 		op := ops[idx]
-		if rand.Float64() > mapOfDDLKindProbability[op.ddlKind] {
+		if c.ddlRand.Float64() > mapOfDDLKindProbability[op.ddlKind] {
 			continue
 		}
 		op.executeFunc(op.config, taskCh)
@@ -267,19 +428,24 @@ func ParallelExecuteOperations(c *testCase, ops []ddlTestOpExecutor, postOp func
 		return errors.Trace(err)
 	}
 	close(taskCh)
-	time.Sleep(time.Duration(rand.Intn(100)) * time.Millisecond)
+	if postOp != nil {
+		if err := postOp(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	time.Sleep(time.Duration(c.ddlRand.Intn(100)) * time.Millisecond)
 	return nil
 }
 
 func SerialExecuteOperations(c *testCase, ops []ddlTestOpExecutor, postOp func() error) error {
-	perm := rand.Perm(len(ops))
+	perm := c.ddlRand.Perm(len(ops))
 	taskCh := make(chan *ddlJobTask, 1)
 	for _, idx := range perm {
 		if c.isStop() {
 			return nil
 		}
 		op := ops[idx]
-		if rand.Float64() > mapOfDDLKindProbability[op.ddlKind] {
+		if c.ddlRand.Float64() > mapOfDDLKindProbability[op.ddlKind] {
 			continue
 		}
 		op.executeFunc(op.config, taskCh)
@@ -289,18 +455,23 @@ func SerialExecuteOperations(c *testCase, ops []ddlTestOpExecutor, postOp func()
 		}
 	}
 	close(taskCh)
-	time.Sleep(time.Duration(rand.Intn(100)) * time.Millisecond)
+	if postOp != nil {
+		if err := postOp(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	time.Sleep(time.Duration(c.ddlRand.Intn(100)) * time.Millisecond)
 	return nil
 }
 
 func TransactionExecuteOperations(c *testCase, ops []dmlTestOpExecutor, postOp func() error) error {
-	transactionOpsLen := rand.Intn(len(ops))
+	transactionOpsLen := c.dmlRand.Intn(len(ops))
 	if transactionOpsLen < 1 {
 		transactionOpsLen = 1
 	}
 	taskCh := make(chan *dmlJobTask, len(ops))
 	opNum := 0
-	perm := rand.Perm(len(ops))
+	perm := c.dmlRand.Perm(len(ops))
 	for i, idx := range perm {
 		if c.isStop() {
 			return nil
@@ -319,7 +490,7 @@ func TransactionExecuteOperations(c *testCase, ops []dmlTestOpExecutor, postOp f
 			if err != nil {
 				return errors.Trace(err)
 			}
-			transactionOpsLen = rand.Intn(len(ops))
+			transactionOpsLen = c.dmlRand.Intn(len(ops))
 			if transactionOpsLen < 1 {
 				transactionOpsLen = 1
 			}
@@ -333,14 +504,14 @@ func TransactionExecuteOperations(c *testCase, ops []dmlTestOpExecutor, postOp f
 					return errors.Trace(err)
 				}
 			}
-			time.Sleep(time.Duration(rand.Intn(50)) * time.Millisecond)
+			time.Sleep(time.Duration(c.dmlRand.Intn(50)) * time.Millisecond)
 		}
 	}
 	return nil
 }
 
 func SerialExecuteDML(c *testCase, ops []dmlTestOpExecutor, postOp func() error) error {
-	perm := rand.Perm(len(ops))
+	perm := c.dmlRand.Perm(len(ops))
 	taskCh := make(chan *dmlJobTask, 1)
 	for _, idx := range perm {
 		if c.isStop() {
@@ -360,7 +531,7 @@ func SerialExecuteDML(c *testCase, ops []dmlTestOpExecutor, postOp func() error)
 		}
 	}
 	close(taskCh)
-	time.Sleep(time.Duration(rand.Intn(100)) * time.Millisecond)
+	time.Sleep(time.Duration(c.dmlRand.Intn(100)) * time.Millisecond)
 	return nil
 }
 
@@ -377,7 +548,9 @@ func (c *testCase) execute(executeDDL ExecuteDDLFunc, exeDMLFunc ExecuteDMLFunc)
 	err := parallel(func() error {
 		var err error
 		for {
-			err = executeDDL(c, c.ddlOps, nil)
+			err = executeDDL(c, c.ddlOps, func() error {
+				return c.executeVerifySchema()
+			})
 			atomic.StoreInt32(&ddlAllComplete, 1)
 			if atomic.LoadInt32(&ddlAllComplete) != 0 && atomic.LoadInt32(&dmlAllComplete) != 0 || err != nil {
 				break
@@ -434,6 +607,8 @@ func (c *testCase) executeVerifyIntegrity() error {
 	for _, table := range tablesSnapshot {
 		table.lock.RLock()
 		columnsSnapshot := table.filterColumns(table.predicateAll)
+		indexesSnapshot := append([]*ddlTestIndex(nil), table.indexes...)
+		partitionSnapshot := table.partition
 		table.lock.RUnlock()
 
 		// build SQL
@@ -444,129 +619,186 @@ func (c *testCase) executeVerifyIntegrity() error {
 			}
 			sql += fmt.Sprintf("%s", column.getSelectName())
 		}
-		sql += fmt.Sprintf(" FROM `%s`", table.name)
+		sql += " FROM " + table.quotedName()
 
-		dbIdx := rand.Intn(len(c.dbs))
-		db := c.dbs[dbIdx]
-
-		// execute
-		opStart := time.Now()
-		rows, err := db.Query(sql)
-		log.Infof("[ddl] [instance %d] %s, elapsed time:%v, got table time:%v, selectID:%v", c.caseIndex, sql, time.Since(opStart).Seconds(), gotTableTime, uniqID)
-		if err == nil {
-			defer rows.Close()
+		ok, err := c.verifyTableRows(table, columnsSnapshot, sql, nil, isStaleRead(table, columnsSnapshot), uniqID, gotTableTime)
+		if err != nil {
+			return errors.Trace(err)
 		}
-		// When column is removed, SELECT statement may return error so that we ignore them here.
-		if table.isDeleted() {
-			return nil
+		if !ok {
+			break
 		}
-		for _, column := range columnsSnapshot {
-			if column.isDeleted() {
-				return nil
+		for _, index := range indexesSnapshot {
+			ok, err = c.verifyIndexRows(table, index, columnsSnapshot, uniqID, gotTableTime)
+			if !ok || err != nil {
+				break
 			}
 		}
+		if err == nil && ok && partitionSnapshot != nil {
+			ok, err = c.verifyPartitionRows(table, partitionSnapshot, columnsSnapshot, sql, uniqID, gotTableTime)
+		}
 		if err != nil {
-			return errors.Annotatef(err, "Error when executing SQL: %s\n%s", sql, table.debugPrintToString())
+			return errors.Trace(err)
 		}
+		if !ok {
+			break
+		}
+	}
+	if err := c.executeVerifyViews(uniqID, gotTableTime); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(c.executeVerifyForeignKeys(uniqID))
+}
 
-		// Read all rows.
-		var actualRows [][]interface{}
-		for rows.Next() {
-			cols, err1 := rows.Columns()
-			if err1 != nil {
-				return errors.Trace(err)
+// isStaleRead returns a function that reports whether `table` or one of
+// `columns` is deleted, and then the selected rows differ from the model.
+func isStaleRead(table *ddlTestTable, columns []*ddlTestColumn) func() bool {
+	return func() bool {
+		if table.isDeleted() {
+			return true
+		}
+		for _, column := range columns {
+			if column.isDeleted() {
+				return true
 			}
+		}
+		return false
+	}
+}
 
-			log.Infof("[ddl] [instance %d] rows.Columns():%v, len(cols):%v, selectID:%v", c.caseIndex, cols, len(cols), uniqID)
+// verifyTableRows executes `sql`, which selects `columns` from `table`, and
+// compares the result with the rows in memory for which `filter` returns true,
+// nil means all rows. It returns false if `isStale` reports that the table or
+// the columns are deleted during the verification.
+func (c *testCase) verifyTableRows(table *ddlTestTable, columns []*ddlTestColumn, sql string, filter func(i int) bool, isStale func() bool, uniqID int32, gotTableTime time.Time) (bool, error) {
+	dbIdx := c.dmlRand.Intn(len(c.dbs))
+	db := c.dbs[dbIdx]
 
-			// See https://stackoverflow.com/questions/14477941/read-select-columns-into-string-in-go
-			rawResult := make([][]byte, len(cols))
-			result := make([]interface{}, len(cols))
-			dest := make([]interface{}, len(cols))
-			for i := range rawResult {
-				dest[i] = &rawResult[i]
-			}
+	// execute
+	opStart := time.Now()
+	rows, err := db.Query(sql)
+	log.Infof("[ddl] [instance %d] %s, elapsed time:%v, got table time:%v, selectID:%v", c.caseIndex, sql, time.Since(opStart).Seconds(), gotTableTime, uniqID)
+	if err == nil {
+		defer rows.Close()
+	}
+	// When column is removed, SELECT statement may return error so that we ignore them here.
+	if isStale() {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Annotatef(err, "Error when executing SQL: %s\n%s", sql, table.debugPrintToString())
+	}
 
-			err1 = rows.Scan(dest...)
-			if err1 != nil {
-				return errors.Trace(err)
-			}
+	columnKinds := make([]int, 0, len(columns))
+	for _, column := range columns {
+		columnKinds = append(columnKinds, column.k)
+	}
+	actualRowsMap, err := readRowSignatures(rows, columnKinds)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
 
-			for i, raw := range rawResult {
-				if raw == nil {
-					result[i] = ddlTestValueNull
-				} else {
-					result[i] = trimValue(columnsSnapshot[i].k, raw)
-				}
+	// Even if SQL executes successfully, column deletion will cause different data as well
+	if isStale() {
+		return false, nil
+	}
+
+	// Make signatures for expecting rows.
+	checkTime := time.Now()
+	expectedRows := make([]string, 0, table.numberOfRows)
+	for i := 0; i < table.numberOfRows; i++ {
+		if filter != nil && !filter(i) {
+			continue
+		}
+		rowString := ""
+		for _, column := range columns {
+			row := getRowFromArrayList(column.rows, i)
+			if row == nil {
+				rowString += fmt.Sprintf("NULL,")
+			} else {
+				rowString += fmt.Sprintf("%v,", row)
 			}
+		}
+		expectedRows = append(expectedRows, rowString)
+	}
 
-			actualRows = append(actualRows, result)
+	// Compare with expecting rows.
+	missing, unexpected := checkRowSignatures(expectedRows, actualRowsMap)
+	if missing != "" {
+		err = fmt.Errorf("Expecting row %s in table `%s` but not found, sql: %s, selectID:%v, checkTime:%v, rowErr:%v, actualRowsMap:%#v\n%s", missing, table.name, sql, uniqID, checkTime, rows.Err(), actualRowsMap, table.debugPrintToString())
+	} else if unexpected != "" {
+		err = fmt.Errorf("Unexpected row %s in table `%s`, sql: %s, selectID:%v, checkTime:%v, rowErr:%v, actualRowsMap:%#v\n%s", unexpected, table.name, sql, uniqID, checkTime, rows.Err(), actualRowsMap, table.debugPrintToString())
+	}
+	if c.trace != nil {
+		ev := &traceEvent{Instance: c.caseIndex, Conn: dbIdx, Kind: traceVerify, SQL: sql, Kinds: columnKinds, Rows: expectedRows}
+		if err != nil {
+			ev.Err = err.Error()
 		}
-		if rows.Err() != nil {
-			return errors.Trace(rows.Err())
+		c.trace.record(ev)
+	}
+	if err != nil {
+		verifyCounter.WithLabelValues("fail").Inc()
+		c.stopTest()
+		log.Infof("err: %v", err)
+		return false, errors.Trace(err)
+	}
+	verifyCounter.WithLabelValues("pass").Inc()
+	tableRows.Observe(float64(len(expectedRows)))
+	return true, nil
+}
+
+// readRowSignatures reads all rows and returns the number of occurrences of
+// each row signature. `columnKinds` are the data types of the selected columns.
+func readRowSignatures(rows *sql.Rows, columnKinds []int) (map[string]int, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	actualRowsMap := make(map[string]int)
+	for rows.Next() {
+		// See https://stackoverflow.com/questions/14477941/read-select-columns-into-string-in-go
+		rawResult := make([][]byte, len(cols))
+		dest := make([]interface{}, len(cols))
+		for i := range rawResult {
+			dest[i] = &rawResult[i]
 		}
 
-		// Even if SQL executes successfully, column deletion will cause different data as well
-		if table.isDeleted() {
-			return nil
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, errors.Trace(err)
 		}
-		for _, column := range columnsSnapshot {
-			if column.isDeleted() {
-				return nil
+
+		rowString := ""
+		for i, raw := range rawResult {
+			if raw == nil {
+				rowString += fmt.Sprintf("%v,", ddlTestValueNull)
+			} else {
+				rowString += fmt.Sprintf("%v,", trimValue(columnKinds[i], raw))
 			}
 		}
+		actualRowsMap[rowString]++
+	}
+	if rows.Err() != nil {
+		return nil, errors.Trace(rows.Err())
+	}
+	return actualRowsMap, nil
+}
 
-		// Make signatures for actual rows.
-		actualRowsMap := make(map[string]int)
-		for _, row := range actualRows {
-			rowString := ""
-			for _, col := range row {
-				rowString += fmt.Sprintf("%v,", col)
-			}
-			_, ok := actualRowsMap[rowString]
-			if !ok {
-				actualRowsMap[rowString] = 0
-			}
-			actualRowsMap[rowString]++
-		}
-
-		// Compare with expecting rows.
-		checkTime := time.Now()
-		for i := 0; i < table.numberOfRows; i++ {
-			rowString := ""
-			for _, column := range columnsSnapshot {
-				row := getRowFromArrayList(column.rows, i)
-				if row == nil {
-					rowString += fmt.Sprintf("NULL,")
-				} else {
-					rowString += fmt.Sprintf("%v,", row)
-				}
-			}
-			_, ok := actualRowsMap[rowString]
-			if !ok {
-				c.stopTest()
-				err = fmt.Errorf("Expecting row %s in table `%s` but not found, sql: %s, selectID:%v, checkTime:%v, rowErr:%v, actualRowsMap:%#v\n%s", rowString, table.name, sql, uniqID, checkTime, rows.Err(), actualRowsMap, table.debugPrintToString())
-				log.Infof("err: %v", err)
-				return errors.Trace(err)
-			}
-			actualRowsMap[rowString]--
-			if actualRowsMap[rowString] < 0 {
-				c.stopTest()
-				err = fmt.Errorf("Expecting row %s in table `%s` but not found, sql: %s, selectID:%v, checkTime:%v, rowErr:%v, actualRowsMap:%#v\n%s", rowString, table.name, sql, uniqID, checkTime, rows.Err(), actualRowsMap, table.debugPrintToString())
-				log.Infof("err: %v", err)
-				return errors.Trace(err)
-			}
+// checkRowSignatures consumes `actualRowsMap` with the expecting rows, it returns
+// the first expecting row that is not found and the first unexpected row, if any.
+func checkRowSignatures(expectedRows []string, actualRowsMap map[string]int) (missing string, unexpected string) {
+	for _, rowString := range expectedRows {
+		actualRowsMap[rowString]--
+		if actualRowsMap[rowString] < 0 {
+			return rowString, ""
 		}
-		for rowString, occurs := range actualRowsMap {
-			if occurs > 0 {
-				c.stopTest()
-				err = fmt.Errorf("Unexpected row %s in table `%s`, sql: %s, selectID:%v, checkTime:%v, rowErr:%v, actualRowsMap:%#v\n%s", rowString, table.name, sql, uniqID, checkTime, rows.Err(), actualRowsMap, table.debugPrintToString())
-				log.Infof("err: %v", err)
-				return errors.Trace(err)
-			}
+	}
+	for rowString, occurs := range actualRowsMap {
+		if occurs > 0 {
+			return "", rowString
 		}
 	}
-	return nil
+	return "", ""
 }
 
 func trimValue(tp int, val []byte) string {
@@ -598,16 +830,17 @@ func (c *testCase) executeAdminCheck() error {
 		if i > 0 {
 			sql += ", "
 		}
-		sql += fmt.Sprintf("`%s`", table.name)
+		sql += table.quotedName()
 		i++
 	}
-	dbIdx := rand.Intn(len(c.dbs))
+	dbIdx := c.ddlRand.Intn(len(c.dbs))
 	db := c.dbs[dbIdx]
 	// execute
 	log.Infof("[ddl] [instance %d] %s", c.caseIndex, sql)
 	_, err := db.Exec(sql)
+	c.trace.recordSQL(c.caseIndex, dbIdx, 0, traceAdminCheck, sql, err)
 	if err != nil {
-		if dmlIgnoreError(err) {
+		if adminCheckIgnoreError(c.cfg.TestTp, err) {
 			return nil
 		}
 		return errors.Annotatef(err, "Error when executing SQL: %s", sql)
@@ -3,17 +3,16 @@ package ddl
 import (
 	"database/sql"
 	"fmt"
-	"math/rand"
 	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
 	"github.com/emirpasic/gods/lists/arraylist"
 	"github.com/juju/errors"
 	"github.com/ngaut/log"
-	"github.com/twinj/uuid"
 )
 
 func (c *testCase) generateDDLOps() error {
@@ -50,6 +49,12 @@ func (c *testCase) generateDDLOps() error {
 	if err := c.generateCreateView(); err != nil {
 		return errors.Trace(err)
 	}
+	if err := c.generateReplaceView(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateDropView(); err != nil {
+		return errors.Trace(err)
+	}
 	if err := c.generateAddIndex(); err != nil {
 		return errors.Trace(err)
 	}
@@ -59,6 +64,12 @@ func (c *testCase) generateDDLOps() error {
 	if err := c.generateDropIndex(); err != nil {
 		return errors.Trace(err)
 	}
+	if err := c.generateAddPrimaryKey(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateDropPrimaryKey(); err != nil {
+		return errors.Trace(err)
+	}
 	if err := c.generateAddColumn(); err != nil {
 		return errors.Trace(err)
 	}
@@ -71,6 +82,69 @@ func (c *testCase) generateDDLOps() error {
 	if err := c.generateSetDefaultValue(); err != nil {
 		return errors.Trace(err)
 	}
+	if err := c.generateAddPartition(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateDropPartition(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateTruncatePartition(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateReorganizePartition(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateCoalescePartition(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateExchangePartition(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateAddForeignKey(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateDropForeignKey(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateAddCheck(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateDropCheck(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateAlterCheck(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateRenameColumn(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateMultiSchemaChange(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateAlterIndexVisibility(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateAlterSchema(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateRecoverTable(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateFlashbackTable(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateRecoverSchema(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateCreateTableLike(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateCreateTableSelect(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.generateRenameTables(); err != nil {
+		return errors.Trace(err)
+	}
 	return nil
 }
 
@@ -80,13 +154,17 @@ const (
 	ddlAddTable DDLKind = iota
 	ddlAddIndex
 	ddlAddColumn
+	ddlAddPrimaryKey
 	ddlCreateSchema
 	ddlCreateView
+	ddlReplaceView
 
 	ddlDropTable
 	ddlDropIndex
 	ddlDropColumn
 	ddlDropSchema
+	ddlDropView
+	ddlDropPrimaryKey
 
 	ddlRenameTable
 	ddlRenameIndex
@@ -98,46 +176,124 @@ const (
 	ddlModifyTableComment
 	ddlModifyTableCharsetAndCollate
 
+	ddlAddPartition
+	ddlDropPartition
+	ddlTruncatePartition
+	ddlReorganizePartition
+	ddlCoalescePartition
+	ddlExchangePartition
+
+	ddlAddForeignKey
+	ddlDropForeignKey
+
+	ddlAddCheck
+	ddlDropCheck
+	ddlAlterCheck
+
+	ddlRenameColumn
+	ddlMultiSchemaChange
+
+	ddlAlterIndexVisibility
+
+	ddlAlterSchema
+
+	ddlRecoverTable
+	ddlFlashbackTable
+	ddlRecoverSchema
+
+	ddlCreateTableLike
+	ddlCreateTableSelect
+
+	ddlRenameTables
+
 	ddlKindNil
 )
 
 var mapOfDDLKind = map[string]DDLKind{
-	"create schema": ddlCreateSchema,
-	"create table":  ddlAddTable,
-	"add index":     ddlAddIndex,
-	"add column":    ddlAddColumn,
-
-	"drop schema": ddlDropSchema,
-	"drop table":  ddlDropTable,
-	"drop index":  ddlDropIndex,
-	"drop column": ddlDropColumn,
-
-	"create view": ddlCreateView,
+	"create schema":   ddlCreateSchema,
+	"create table":    ddlAddTable,
+	"add index":       ddlAddIndex,
+	"add column":      ddlAddColumn,
+	"add primary key": ddlAddPrimaryKey,
+
+	"drop schema":      ddlDropSchema,
+	"drop table":       ddlDropTable,
+	"drop index":       ddlDropIndex,
+	"drop column":      ddlDropColumn,
+	"drop view":        ddlDropView,
+	"drop primary key": ddlDropPrimaryKey,
+
+	"create view":  ddlCreateView,
+	"replace view": ddlReplaceView,
 
 	"rename table":                     ddlRenameTable,
 	"rename index":                     ddlRenameIndex,
 	"truncate table":                   ddlTruncateTable,
 	"shard row ID":                     ddlShardRowID,
 	"rebase auto_increment ID":         ddlRebaseAutoID,
+	"rebase auto_random ID":            ddlRebaseAutoID,
 	"set default value":                ddlSetDefaultValue,
 	"modify table comment":             ddlModifyTableComment,
 	"modify table charset and collate": ddlModifyTableCharsetAndCollate,
 
 	"modify column": ddlModifyColumn,
-}
 
-var mapOfDDLKindToString = map[DDLKind]string{
-	ddlCreateSchema: "create schema",
-	ddlAddTable:     "create table",
-	ddlAddIndex:     "add index",
-	ddlAddColumn:    "add column",
+	"add partition":        ddlAddPartition,
+	"drop partition":       ddlDropPartition,
+	"truncate partition":   ddlTruncatePartition,
+	"reorganize partition": ddlReorganizePartition,
+	"coalesce partition":   ddlCoalescePartition,
+	"exchange partition":   ddlExchangePartition,
+	// The job type of REORGANIZE PARTITION in `admin show ddl jobs`.
+	"alter table reorganize partition": ddlReorganizePartition,
 
-	ddlDropSchema: "drop schema",
-	ddlDropTable:  "drop table",
-	ddlDropIndex:  "drop index",
-	ddlDropColumn: "drop column",
+	"add foreign key":  ddlAddForeignKey,
+	"drop foreign key": ddlDropForeignKey,
 
-	ddlCreateView: "create view",
+	"add check constraint":   ddlAddCheck,
+	"drop check constraint":  ddlDropCheck,
+	"alter check constraint": ddlAlterCheck,
+
+	// RENAME COLUMN is a "modify column" job, see `isJobKind`.
+	"rename column":                   ddlRenameColumn,
+	"alter table multi-schema change": ddlMultiSchemaChange,
+
+	"alter index visibility": ddlAlterIndexVisibility,
+
+	"modify schema charset and collate": ddlAlterSchema,
+	// The job type of ALTER SCHEMA ... PLACEMENT POLICY in `admin show ddl jobs`.
+	"modify schema default placement": ddlAlterSchema,
+
+	// FLASHBACK TABLE is a "recover table" job, see `isJobKind`.
+	"recover table":   ddlRecoverTable,
+	"flashback table": ddlFlashbackTable,
+	"recover schema":  ddlRecoverSchema,
+
+	// CREATE TABLE ... LIKE and CREATE TABLE ... SELECT are "create table"
+	// jobs, see `isJobKind`.
+	"create table like":   ddlCreateTableLike,
+	"create table select": ddlCreateTableSelect,
+
+	// RENAME TABLE of more than one table, see `getSortTask`.
+	"rename tables": ddlRenameTables,
+}
+
+var mapOfDDLKindToString = map[DDLKind]string{
+	ddlCreateSchema:  "create schema",
+	ddlAddTable:      "create table",
+	ddlAddIndex:      "add index",
+	ddlAddColumn:     "add column",
+	ddlAddPrimaryKey: "add primary key",
+
+	ddlDropSchema:     "drop schema",
+	ddlDropTable:      "drop table",
+	ddlDropIndex:      "drop index",
+	ddlDropColumn:     "drop column",
+	ddlDropView:       "drop view",
+	ddlDropPrimaryKey: "drop primary key",
+
+	ddlCreateView:  "create view",
+	ddlReplaceView: "replace view",
 
 	ddlRenameTable:                  "rename table",
 	ddlRenameIndex:                  "rename index",
@@ -148,6 +304,36 @@ var mapOfDDLKindToString = map[DDLKind]string{
 	ddlModifyTableComment:           "modify table comment",
 	ddlModifyTableCharsetAndCollate: "modify table charset and collate",
 	ddlModifyColumn:                 "modify column",
+
+	ddlAddPartition:        "add partition",
+	ddlDropPartition:       "drop partition",
+	ddlTruncatePartition:   "truncate partition",
+	ddlReorganizePartition: "reorganize partition",
+	ddlCoalescePartition:   "coalesce partition",
+	ddlExchangePartition:   "exchange partition",
+
+	ddlAddForeignKey:  "add foreign key",
+	ddlDropForeignKey: "drop foreign key",
+
+	ddlAddCheck:   "add check constraint",
+	ddlDropCheck:  "drop check constraint",
+	ddlAlterCheck: "alter check constraint",
+
+	ddlRenameColumn:      "rename column",
+	ddlMultiSchemaChange: "alter table multi-schema change",
+
+	ddlAlterIndexVisibility: "alter index visibility",
+
+	ddlAlterSchema: "modify schema charset and collate",
+
+	ddlRecoverTable:   "recover table",
+	ddlFlashbackTable: "flashback table",
+	ddlRecoverSchema:  "recover schema",
+
+	ddlCreateTableLike:   "create table like",
+	ddlCreateTableSelect: "create table select",
+
+	ddlRenameTables: "rename tables",
 }
 
 // mapOfDDLKindProbability use to control every kind of ddl request execute probability.
@@ -158,11 +344,16 @@ var mapOfDDLKindProbability = map[DDLKind]float64{
 	ddlAddIndex:  0.8,
 	ddlDropIndex: 0.5,
 
+	ddlAddPrimaryKey:  0.20,
+	ddlDropPrimaryKey: 0.20,
+
 	ddlAddColumn:    0.8,
 	ddlModifyColumn: 0.5,
 	ddlDropColumn:   0.5,
 
-	ddlCreateView: 0.30,
+	ddlCreateView:  0.30,
+	ddlReplaceView: 0.20,
+	ddlDropView:    0.15,
 
 	ddlCreateSchema:                 0.10,
 	ddlDropSchema:                   0.10,
@@ -174,6 +365,36 @@ var mapOfDDLKindProbability = map[DDLKind]float64{
 	ddlSetDefaultValue:              0.30,
 	ddlModifyTableComment:           0.30,
 	ddlModifyTableCharsetAndCollate: 0.30,
+
+	ddlAddPartition:        0.20,
+	ddlDropPartition:       0.15,
+	ddlTruncatePartition:   0.15,
+	ddlReorganizePartition: 0.15,
+	ddlCoalescePartition:   0.10,
+	ddlExchangePartition:   0.15,
+
+	ddlAddForeignKey:  0.30,
+	ddlDropForeignKey: 0.15,
+
+	ddlAddCheck:   0.20,
+	ddlDropCheck:  0.15,
+	ddlAlterCheck: 0.15,
+
+	ddlRenameColumn:      0.30,
+	ddlMultiSchemaChange: 0.30,
+
+	ddlAlterIndexVisibility: 0.30,
+
+	ddlAlterSchema: 0.20,
+
+	ddlRecoverTable:   0.10,
+	ddlFlashbackTable: 0.10,
+	ddlRecoverSchema:  0.10,
+
+	ddlCreateTableLike:   0.15,
+	ddlCreateTableSelect: 0.15,
+
+	ddlRenameTables: 0.30,
 }
 
 type ddlJob struct {
@@ -199,6 +420,17 @@ type ddlJobTask struct {
 	err        error // err is an error executed by the remote TiDB.
 }
 
+// debugPrintToString dumps the local table of the task if any.
+func (task *ddlJobTask) debugPrintToString() string {
+	if task.tblInfo == nil {
+		return ""
+	}
+	return task.tblInfo.debugPrintToString()
+}
+
+// updateTableInfo executes the task on the local model. When it returns a
+// `ddlExpectedError`, the model is unchanged, and the server should fail with
+// the predicted MySQL error code.
 func (c *testCase) updateTableInfo(task *ddlJobTask) error {
 	switch task.k {
 	case ddlCreateSchema:
@@ -223,12 +455,32 @@ func (c *testCase) updateTableInfo(task *ddlJobTask) error {
 		return c.dropTableJob(task)
 	case ddlCreateView:
 		return c.createViewJob(task)
+	case ddlReplaceView:
+		return c.replaceViewJob(task)
+	case ddlDropView:
+		return c.dropViewJob(task)
+	case ddlAddPartition:
+		return c.addPartitionJob(task)
+	case ddlDropPartition:
+		return c.dropPartitionJob(task)
+	case ddlTruncatePartition:
+		return c.truncatePartitionJob(task)
+	case ddlReorganizePartition:
+		return c.reorganizePartitionJob(task)
+	case ddlCoalescePartition:
+		return c.coalescePartitionJob(task)
+	case ddlExchangePartition:
+		return c.exchangePartitionJob(task)
 	case ddlAddIndex:
 		return c.addIndexJob(task)
 	case ddlRenameIndex:
 		return c.renameIndexJob(task)
 	case ddlDropIndex:
 		return c.dropIndexJob(task)
+	case ddlAddPrimaryKey:
+		return c.addPrimaryKeyJob(task)
+	case ddlDropPrimaryKey:
+		return c.dropPrimaryKeyJob(task)
 	case ddlAddColumn:
 		return c.addColumnJob(task)
 	case ddlModifyColumn:
@@ -237,6 +489,34 @@ func (c *testCase) updateTableInfo(task *ddlJobTask) error {
 		return c.dropColumnJob(task)
 	case ddlSetDefaultValue:
 		return c.setDefaultValueJob(task)
+	case ddlAddForeignKey:
+		return c.addForeignKeyJob(task)
+	case ddlDropForeignKey:
+		return c.dropForeignKeyJob(task)
+	case ddlAddCheck:
+		return c.addCheckJob(task)
+	case ddlDropCheck:
+		return c.dropCheckJob(task)
+	case ddlAlterCheck:
+		return c.alterCheckJob(task)
+	case ddlRenameColumn:
+		return c.modifyColumnJob(task)
+	case ddlMultiSchemaChange:
+		return c.multiSchemaChangeJob(task)
+	case ddlAlterIndexVisibility:
+		return c.alterIndexVisibilityJob(task)
+	case ddlAlterSchema:
+		return c.alterSchemaJob(task)
+	case ddlRecoverTable, ddlFlashbackTable:
+		return c.recoverTableJob(task)
+	case ddlRecoverSchema:
+		return c.recoverSchemaJob(task)
+	case ddlCreateTableLike:
+		return c.createTableLikeJob(task)
+	case ddlCreateTableSelect:
+		return c.createTableSelectJob(task)
+	case ddlRenameTables:
+		return c.renameTablesJob(task)
 	}
 	return fmt.Errorf("unknow ddl task , %v", *task)
 }
@@ -247,34 +527,50 @@ execParaDDLSQL get a batch of ddl from taskCh, and then:
 2. Wait all DDL SQLs request finish
 3. Send `admin show ddl jobs` request to TiDB to confirm parallel DDL requests execute order
 4. Do the same DDL change on local with the same DDL requests executed order of TiDB
-5. Judge the every DDL execution result of TiDB and local. If both of local and TiDB execute result are no wrong, or both are wrong it will be ok. Otherwise, It must be something wrong.
+5. Judge the every DDL execution result of TiDB and local. If both of local and TiDB execute result are no wrong, or both are wrong with the error code predicted by local it will be ok. Otherwise, It must be something wrong.
 */
 func (c *testCase) execParaDDLSQL(taskCh chan *ddlJobTask, num int) error {
 	if num == 0 {
 		return nil
 	}
 	tasks := make([]*ddlJobTask, 0, num)
+	// The epoch of a table changed by more than one task is only begun once,
+	// so that it stays odd until the batch ends.
+	changing := make(map[*ddlTestTable]struct{})
 	var wg sync.WaitGroup
 	for i := 0; i < num; i++ {
 		task := <-taskCh
 		tasks = append(tasks, task)
+		for _, table := range task.uniqueChangeTables() {
+			if _, ok := changing[table]; ok {
+				continue
+			}
+			changing[table] = struct{}{}
+			table.beginUniqueChange()
+			defer table.endUniqueChange()
+		}
 		wg.Add(1)
 		go func(task *ddlJobTask) {
 			defer wg.Done()
 			opStart := time.Now()
 			db := c.dbs[0]
 			_, err := db.Exec(task.sql)
-			if !ddlIgnoreError(err) {
+			atomic.AddInt64(&c.ddlCount, 1)
+			c.trace.recordSQL(c.caseIndex, 0, 0, traceDDL, task.sql, err)
+			ignored := err != nil && acceptableDDLError(task.k, c.cfg.TestTp, err)
+			observeDDL(task.k, opStart, err, ignored)
+			if err != nil && !ignored {
 				log.Infof("[ddl] [instance %d] TiDB execute %s , err %v, elapsed time:%v", c.caseIndex, task.sql, err, time.Since(opStart).Seconds())
-				task.err = err
 			}
+			task.err = err
 		}(task)
 	}
 	wg.Wait()
 	db := c.dbs[0]
 	SortTasks, err := c.getSortTask(db, tasks)
 	if err != nil {
-		if ddlIgnoreError(err) {
+		if ddlIgnoreError(ddlKindNil, c.cfg.TestTp, err) {
+			c.markTasksUnknown("the local model gives up a batch of DDLs", tasks...)
 			return nil
 		}
 		return err
@@ -288,11 +584,28 @@ func (c *testCase) execParaDDLSQL(taskCh chan *ddlJobTask, num int) error {
 		} else if task.viewInfo != nil {
 			log.Infof("[ddl] [instance %d] local execute %s, err %v , view_id %s, ddlID %v", c.caseIndex, task.sql, err, task.viewInfo.id, task.ddlID)
 		}
+		if isUnknownResult(err) {
+			log.Infof("[ddl] [instance %d] the error of %s isn't compared, %v", c.caseIndex, task.sql, err)
+			continue
+		}
+		if err == nil && task.err != nil && ddlIgnoreError(task.k, c.cfg.TestTp, task.err) {
+			c.markTasksUnknown(fmt.Sprintf("%s fails but the local model executes it", task.sql), task)
+			continue
+		}
 		if err == nil && task.err != nil || err != nil && task.err == nil {
-			if err != nil && ddlIgnoreError(err) {
+			if err != nil && ddlIgnoreError(task.k, c.cfg.TestTp, err) {
+				c.markTasksUnknown("the local model gives up a batch of DDLs", tasks...)
 				return nil
 			}
-			return fmt.Errorf("Error when executing SQL: %s\n, local err: %#v, remote tidb err: %#v\n%s\n", task.sql, err, task.err, task.tblInfo.debugPrintToString())
+			return fmt.Errorf("Error when executing SQL: %s\n, local err: %#v, remote tidb err: %#v\n%s\n", task.sql, err, task.err, task.debugPrintToString())
+		}
+		// Both failed, the remote error must be the predicted one, unless it is
+		// acceptable without the help of the parallel mode, like "Information
+		// schema is changed".
+		if err != nil && task.err != nil {
+			if err := checkExpectedError(err, task.err); err != nil && !ddlIgnoreError(task.k, SerialDDLTest, task.err) {
+				return fmt.Errorf("Error when executing SQL: %s\n, %v\n%s\n", task.sql, err, task.debugPrintToString())
+			}
 		}
 	}
 	return nil
@@ -304,12 +617,37 @@ func (c *testCase) execSerialDDLSQL(taskCh chan *ddlJobTask) error {
 		return nil
 	}
 	task := <-taskCh
+	for _, table := range task.uniqueChangeTables() {
+		table.beginUniqueChange()
+		defer table.endUniqueChange()
+	}
 	db := c.dbs[0]
 	opStart := time.Now()
 	_, err := db.Exec(task.sql)
+	task.err = err
+	atomic.AddInt64(&c.ddlCount, 1)
+	c.trace.recordSQL(c.caseIndex, 0, 0, traceDDL, task.sql, err)
 	log.Infof("[ddl] [instance %d] %s, err: %v, elapsed time:%v", c.caseIndex, task.sql, err, time.Since(opStart).Seconds())
+	ignored := err != nil && ddlIgnoreError(task.k, c.cfg.TestTp, err)
+	observeDDL(task.k, opStart, err, ignored)
 	if err != nil {
-		if ddlIgnoreError(err) {
+		if ignored {
+			if classifyError(err) == classConnection {
+				c.markTasksUnknown(fmt.Sprintf("the result of %s is unknown", task.sql), task)
+			}
+			return nil
+		}
+		// The local model stays unchanged if it predicts the same error.
+		localErr := c.updateTableInfo(task)
+		if isUnknownResult(localErr) {
+			log.Infof("[ddl] [instance %d] the error of %s isn't compared, %v", c.caseIndex, task.sql, localErr)
+			return nil
+		}
+		if expectedErrorCode(localErr) != 0 {
+			if err := checkExpectedError(localErr, err); err != nil {
+				return fmt.Errorf("Error when executing SQL: %s\n %v\n%s\n", task.sql, err, task.debugPrintToString())
+			}
+			log.Infof("[ddl] [instance %d] %s fails as expected", c.caseIndex, task.sql)
 			return nil
 		}
 		if task.tblInfo != nil {
@@ -337,14 +675,14 @@ func (c *testCase) generateCreateSchema() error {
 var dbSchemaSyntax = [...]string{"DATABASE", "SCHEMA"}
 
 func (c *testCase) prepareCreateSchema(_ interface{}, taskCh chan *ddlJobTask) error {
-	charset, collate := c.pickupRandomCharsetAndCollate()
+	charset, collate := c.pickupRandomCharsetAndCollate(c.ddlRand)
 	schema := ddlTestSchema{
-		name:    uuid.NewV4().String(),
+		name:    RandName(c.ddlRand),
 		deleted: false,
 		charset: charset,
 		collate: collate,
 	}
-	sql := fmt.Sprintf("CREATE %s `%s` CHARACTER SET '%s' COLLATE '%s'", dbSchemaSyntax[rand.Intn(len(dbSchemaSyntax))], schema.name,
+	sql := fmt.Sprintf("CREATE %s `%s` CHARACTER SET '%s' COLLATE '%s'", dbSchemaSyntax[c.ddlRand.Intn(len(dbSchemaSyntax))], schema.name,
 		charset, collate)
 	task := &ddlJobTask{
 		k:          ddlCreateSchema,
@@ -360,32 +698,79 @@ func (c *testCase) createSchemaJob(task *ddlJobTask) error {
 	return nil
 }
 
+// ddlDropSchemaArg is the argument of DROP SCHEMA.
+type ddlDropSchemaArg struct {
+	tables []*ddlTestTable // the tables of the schema when the task is prepared.
+}
+
 func (c *testCase) generateDropSchema() error {
 	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareDropSchema, nil, ddlDropSchema})
 	return nil
 }
 
 func (c *testCase) prepareDropSchema(_ interface{}, taskCh chan *ddlJobTask) error {
-	schema := c.pickupRandomSchema()
+	schema := c.pickupRandomSchema(c.ddlRand)
 	if schema == nil {
 		return nil
 	}
 	schema.setDeleted()
-	sql := fmt.Sprintf("DROP %s `%s`", dbSchemaSyntax[rand.Intn(len(dbSchemaSyntax))], schema.name)
+	sql := fmt.Sprintf("DROP %s `%s`", dbSchemaSyntax[c.ddlRand.Intn(len(dbSchemaSyntax))], schema.name)
+	arg := &ddlDropSchemaArg{}
+	for _, key := range c.tableKeys() {
+		if key.schema == schema.name {
+			arg.tables = append(arg.tables, c.tables[key])
+		}
+	}
 	task := &ddlJobTask{
 		k:          ddlDropSchema,
 		sql:        sql,
 		schemaInfo: schema,
+		arg:        ddlJobArg(arg),
 	}
 	taskCh <- task
 	return nil
 }
 
+// dropSchemaJob drops the schema with its tables and views. It fails if a
+// table of the schema is referenced by a foreign key of a table in another
+// schema.
 func (c *testCase) dropSchemaJob(task *ddlJobTask) error {
-	if c.isSchemaDeleted(task.schemaInfo) {
-		return fmt.Errorf("schema %s doesn't exist", task.schemaInfo.name)
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	schema := task.schemaInfo
+	if c.isSchemaDeleted(schema) {
+		return expectError(errCodeDBDropExists, "schema %s doesn't exist", schema.name)
+	}
+	for _, key := range c.tableKeys() {
+		if key.schema != schema.name {
+			continue
+		}
+		for _, ref := range c.referencingForeignKeys(c.tables[key]) {
+			if ref.child.schema != schema.name {
+				schema.deleted = false
+				return expectError(errCodeFKCannotDropParent, "table %s is referenced by foreign key %s of table %s",
+					key.name, ref.fk.name, ref.child.name)
+			}
+		}
+	}
+	var tables []*ddlTestTable
+	for _, key := range c.tableKeys() {
+		if key.schema == schema.name {
+			tables = append(tables, c.tables[key])
+		}
 	}
-	delete(c.schemas, task.schemaInfo.name)
+	c.addSchemaTombstone(schema, tables)
+	for _, table := range tables {
+		table.setDeleted()
+		delete(c.tables, table.key())
+	}
+	for key, view := range c.views {
+		if key.schema == schema.name {
+			view.setDeleted()
+			delete(c.views, key)
+		}
+	}
+	delete(c.schemas, schema.name)
 	return nil
 }
 
@@ -395,66 +780,127 @@ func (c *testCase) generateAddTable() error {
 }
 
 func (c *testCase) prepareAddTable(cfg interface{}, taskCh chan *ddlJobTask) error {
-	columnCount := rand.Intn(c.cfg.TablesToCreate) + 2
+	columnCount := c.ddlRand.Intn(c.cfg.TablesToCreate) + 2
 	tableColumns := arraylist.New()
 	for i := 0; i < columnCount; i++ {
-		columns := getRandDDLTestColumns()
+		columns := getRandDDLTestColumns(c.ddlRand)
 		for _, column := range columns {
+			column.setRandNotNull(c.ddlRand, true)
 			tableColumns.Add(column)
 		}
 	}
 
+	// An auto ID column is the first column and the only column of the
+	// primary key, AUTO_RANDOM needs a clustered primary key.
+	var autoIDColumn *ddlTestColumn
+	if c.ddlRand.Float64() < AutoIDProbability {
+		autoIDColumn = newAutoIDColumn(c.ddlRand, !c.cfg.MySQLCompatible && c.ddlRand.Intn(2) == 0)
+		tableColumns.Insert(0, autoIDColumn)
+	}
+
 	// Generate primary key with [0, 3) size
-	primaryKeyFields := rand.Intn(3)
-	primaryKeys := make([]int, 0)
-	if primaryKeyFields > 0 {
+	primaryKeyFields := c.ddlRand.Intn(3)
+	primaryKeys := make([]*ddlTestColumn, 0)
+	if autoIDColumn != nil {
+		primaryKeys = append(primaryKeys, autoIDColumn)
+	} else if primaryKeyFields > 0 {
 		// Random elections column as primary key, but also check the column whether can be primary key.
-		perm := rand.Perm(tableColumns.Size())[0:primaryKeyFields]
+		perm := c.ddlRand.Perm(tableColumns.Size())[0:primaryKeyFields]
 		for _, columnIndex := range perm {
 			column := getColumnFromArrayList(tableColumns, columnIndex)
 			if column.canBePrimary() {
 				column.isPrimaryKey = true
-				primaryKeys = append(primaryKeys, columnIndex)
+				column.notNull = true
+				column.defaultValue = nil
+				primaryKeys = append(primaryKeys, column)
 			}
 		}
-		primaryKeyFields = len(primaryKeys)
 	}
 
-	charset, collate := c.pickupRandomCharsetAndCollate()
+	charset, collate := c.pickupRandomCharsetAndCollate(c.ddlRand)
+
+	pkType := ""
+	if len(primaryKeys) > 0 {
+		pkType = c.randPKType()
+	}
+	if autoIDColumn != nil && autoIDColumn.autoRandomBits > 0 {
+		pkType = pkTypeClustered
+	}
 
 	tableInfo := ddlTestTable{
-		name:         uuid.NewV4().String(),
+		schema:       c.pickupRandomSchemaName(c.ddlRand),
+		name:         RandName(c.ddlRand),
 		columns:      tableColumns,
 		indexes:      make([]*ddlTestIndex, 0),
+		primaryKey:   primaryKeys,
+		pkType:       pkType,
 		numberOfRows: 0,
 		deleted:      0,
-		comment:      uuid.NewV4().String(),
+		comment:      RandName(c.ddlRand),
 		charset:      charset,
 		collate:      collate,
 		lock:         new(sync.RWMutex),
 	}
+	if schema, ok := c.schemas[tableInfo.schema]; ok && c.ddlRand.Float64() < InheritCharsetProbability {
+		tableInfo.dbCharset = true
+		tableInfo.charset, tableInfo.collate = schema.charset, schema.collate
+	}
 
-	sql := fmt.Sprintf("CREATE TABLE `%s` (", tableInfo.name)
-	for i := 0; i < tableInfo.columns.Size(); i++ {
-		if i > 0 {
-			sql += ", "
+	// The partitioning column must be a part of the primary key if any.
+	if c.ddlRand.Float64() < PartitionedTableProbability && !tableInfo.isAutoRandom() {
+		candidates := make([]*ddlTestColumn, 0)
+		for ite := tableColumns.Iterator(); ite.Next(); {
+			column := ite.Value().(*ddlTestColumn)
+			if column.canBePartitionColumn() && (len(primaryKeys) == 0 || column.isPrimaryKey) {
+				candidates = append(candidates, column)
+			}
+		}
+		if len(candidates) > 0 {
+			column := candidates[c.ddlRand.Intn(len(candidates))]
+			tableInfo.partition = newRandPartition(c.ddlRand, column)
+			if !column.isPrimaryKey && column.canHaveDefaultValue() && tableInfo.partition.isLocatable() {
+				column.defaultValue = tableInfo.partition.randValue(c.ddlRand)
+			}
 		}
-		column := getColumnFromArrayList(tableColumns, i)
-		sql += fmt.Sprintf("`%s` %s", column.name, column.getDefinition())
 	}
-	if primaryKeyFields > 0 {
-		sql += ", PRIMARY KEY ("
-		for i, columnIndex := range primaryKeys {
-			if i > 0 {
-				sql += ", "
+
+	// A unique key on one or two columns, which must include the partitioning
+	// column of a partitioned table.
+	if c.ddlRand.Float64() < UniqueKeyProbability {
+		index := &ddlTestIndex{name: RandName(c.ddlRand), columns: make([]*ddlTestColumn, 0)}
+		for _, idx := range c.ddlRand.Perm(tableColumns.Size())[:1+c.ddlRand.Intn(2)] {
+			column := getColumnFromArrayList(tableColumns, idx)
+			if column.canBeIndex() && !column.isGenerated() && !column.isPrimaryKey {
+				index.columns = append(index.columns, column)
 			}
-			column := getColumnFromArrayList(tableColumns, columnIndex)
-			sql += fmt.Sprintf("`%s`", column.name)
 		}
-		sql += ")"
+		if tableInfo.partition != nil && len(index.columns) > 0 && !containsColumn(index.columns, tableInfo.partition.column) {
+			index.columns = append(index.columns, tableInfo.partition.column)
+		}
+		if len(index.columns) > 0 {
+			index.unique = true
+			for _, column := range index.columns {
+				index.signature += column.name + ","
+				column.indexReferences++
+			}
+			tableInfo.indexes = append(tableInfo.indexes, index)
+		}
 	}
-	sql += fmt.Sprintf(") COMMENT '%s' CHARACTER SET '%s' COLLATE '%s'",
-		tableInfo.comment, charset, collate)
+
+	// The checks on the integer columns, declared with the columns or with
+	// the table.
+	if c.checkConstraints {
+		for ite := tableColumns.Iterator(); ite.Next(); {
+			column := ite.Value().(*ddlTestColumn)
+			if column.canHaveCheck() && c.ddlRand.Float64() < CheckProbability {
+				check := newRandCheck(c.ddlRand, column)
+				check.inline = c.ddlRand.Intn(2) == 0
+				tableInfo.checks = append(tableInfo.checks, check)
+			}
+		}
+	}
+
+	sql := tableInfo.createTableSQL()
 
 	task := &ddlJobTask{
 		k:       ddlAddTable,
@@ -468,7 +914,14 @@ func (c *testCase) prepareAddTable(cfg interface{}, taskCh chan *ddlJobTask) err
 func (c *testCase) addTableInfo(task *ddlJobTask) error {
 	c.tablesLock.Lock()
 	defer c.tablesLock.Unlock()
-	c.tables[task.tblInfo.name] = task.tblInfo
+	if c.isSchemaNameDeleted(task.tblInfo.schema) {
+		return expectError(errCodeBadDB, "schema %s doesn't exist", task.tblInfo.schema)
+	}
+	c.inheritSchemaCharset(task.tblInfo)
+	for ite := task.tblInfo.columns.Iterator(); ite.Next(); {
+		ite.Value().(*ddlTestColumn).collate = task.tblInfo.collate
+	}
+	c.tables[task.tblInfo.key()] = task.tblInfo
 	return nil
 }
 
@@ -482,7 +935,7 @@ var toAsSyntax = [...]string{"TO", "AS"}
 func (c *testCase) prepareRenameTable(_ interface{}, taskCh chan *ddlJobTask) error {
 	c.tablesLock.Lock()
 	defer c.tablesLock.Unlock()
-	table := c.pickupRandomTable()
+	table := c.pickupRandomTable(c.ddlRand)
 	if table == nil {
 		return nil
 	}
@@ -491,9 +944,13 @@ func (c *testCase) prepareRenameTable(_ interface{}, taskCh chan *ddlJobTask) er
 	defer table.lock.Unlock()
 	newTbl := *table
 	table.setDeleted()
-	newTbl.name = uuid.NewV4().String()
-	sql := fmt.Sprintf("ALTER TABLE `%s` RENAME %s `%s`", table.name,
-		toAsSyntax[rand.Intn(len(toAsSyntax))], newTbl.name)
+	key := c.pickupRenameKey(table)
+	newTbl.schema, newTbl.name = key.schema, key.name
+	sql := fmt.Sprintf("ALTER TABLE %s RENAME %s %s", table.quotedName(),
+		toAsSyntax[c.ddlRand.Intn(len(toAsSyntax))], newTbl.quotedName())
+	if c.ddlRand.Intn(2) == 0 {
+		sql = fmt.Sprintf("RENAME TABLE %s TO %s", table.quotedName(), newTbl.quotedName())
+	}
 	task := &ddlJobTask{
 		k:       ddlRenameTable,
 		sql:     sql,
@@ -509,11 +966,18 @@ func (c *testCase) renameTableJob(task *ddlJobTask) error {
 	defer c.tablesLock.Unlock()
 	table := task.tblInfo
 	if c.isTableDeleted(table) {
-		return fmt.Errorf("table %s is not exists", table.name)
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
 	}
-	delete(c.tables, table.name)
 	newTbl := (*ddlTestTable)(task.arg)
-	c.tables[newTbl.name] = newTbl
+	if c.isSchemaNameDeleted(newTbl.schema) {
+		return expectError(0, "schema %s doesn't exist", newTbl.schema)
+	}
+	delete(c.tables, table.key())
+	c.tables[newTbl.key()] = newTbl
+	// The foreign keys referencing the table follow it.
+	for _, ref := range c.referencingForeignKeys(table) {
+		ref.fk.parent = newTbl
+	}
 	return nil
 }
 
@@ -523,11 +987,11 @@ func (c *testCase) generateTruncateTable() error {
 }
 
 func (c *testCase) prepareTruncateTable(_ interface{}, taskCh chan *ddlJobTask) error {
-	tableToTruncate := c.pickupRandomTable()
+	tableToTruncate := c.pickupRandomTable(c.ddlRand)
 	if tableToTruncate == nil {
 		return nil
 	}
-	sql := fmt.Sprintf("TRUNCATE TABLE `%s`", tableToTruncate.name)
+	sql := fmt.Sprintf("TRUNCATE TABLE %s", tableToTruncate.quotedName())
 	task := &ddlJobTask{
 		k:       ddlTruncateTable,
 		sql:     sql,
@@ -542,8 +1006,12 @@ func (c *testCase) truncateTableJob(task *ddlJobTask) error {
 	table.lock.Lock()
 	defer table.lock.Unlock()
 	if c.isTableDeleted(table) {
-		return fmt.Errorf("table %s is not exists", task.tblInfo.name)
+		return expectError(errCodeNoSuchTable, "table %s is not exists", task.tblInfo.name)
 	}
+	if refs := c.referencingForeignKeys(table); len(refs) > 0 {
+		return expectError(errCodeTruncateIllegalFK, "table %s is referenced by foreign key %s of table %s", table.name, refs[0].fk.name, refs[0].child.name)
+	}
+	c.addTableTombstone(table, true)
 	table.numberOfRows = 0
 	for ite := table.columns.Iterator(); ite.Next(); {
 		column := ite.Value().(*ddlTestColumn)
@@ -551,6 +1019,9 @@ func (c *testCase) truncateTableJob(task *ddlJobTask) error {
 			column.rows.Clear()
 		}
 	}
+	// MySQL resets the auto ID.
+	table.autoIncID = 0
+	table.autoIDs = nil
 	return nil
 }
 
@@ -560,12 +1031,12 @@ func (c *testCase) generateModifyTableComment() error {
 }
 
 func (c *testCase) prepareModifyTableComment(_ interface{}, taskCh chan *ddlJobTask) error {
-	table := c.pickupRandomTable()
+	table := c.pickupRandomTable(c.ddlRand)
 	if table == nil {
 		return nil
 	}
-	newComm := uuid.NewV4().String()
-	sql := fmt.Sprintf("ALTER TABLE `%s` COMMENT '%s'", table.name, newComm)
+	newComm := RandName(c.ddlRand)
+	sql := fmt.Sprintf("ALTER TABLE %s COMMENT '%s'", table.quotedName(), newComm)
 	task := &ddlJobTask{
 		k:       ddlModifyTableComment,
 		tblInfo: table,
@@ -579,7 +1050,7 @@ func (c *testCase) prepareModifyTableComment(_ interface{}, taskCh chan *ddlJobT
 func (c *testCase) modifyTableCommentJob(task *ddlJobTask) error {
 	table := task.tblInfo
 	if c.isTableDeleted(table) {
-		return fmt.Errorf("table %s is not exists", table.name)
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
 	}
 	newComm := *((*string)(task.arg))
 	table.comment = newComm
@@ -598,7 +1069,7 @@ func (c *testCase) generateModifyTableCharsetAndCollate() error {
 }
 
 func (c *testCase) prepareModifyTableCharsetAndCollate(_ interface{}, taskCh chan *ddlJobTask) error {
-	table := c.pickupRandomTable()
+	table := c.pickupRandomTable(c.ddlRand)
 	if table == nil {
 		return nil
 	}
@@ -619,12 +1090,12 @@ func (c *testCase) prepareModifyTableCharsetAndCollate(_ interface{}, taskCh cha
 	if hasBlob {
 		return nil
 	}
-	charset, collate := c.pickupRandomCharsetAndCollate()
+	charset, collate := c.pickupRandomCharsetAndCollate(c.ddlRand)
 	if table.charset != "utf8" || charset != "utf8mb4" {
 		return nil
 	}
-	sql := fmt.Sprintf("ALTER TABLE `%s` CHARACTER SET '%s' COLLATE '%s'",
-		table.name, charset, collate)
+	sql := fmt.Sprintf("ALTER TABLE %s CHARACTER SET '%s' COLLATE '%s'",
+		table.quotedName(), charset, collate)
 	task := &ddlJobTask{
 		k:       ddlModifyTableCharsetAndCollate,
 		sql:     sql,
@@ -641,7 +1112,7 @@ func (c *testCase) prepareModifyTableCharsetAndCollate(_ interface{}, taskCh cha
 func (c *testCase) modifyTableCharsetAndCollateJob(task *ddlJobTask) error {
 	table := task.tblInfo
 	if c.isTableDeleted(table) {
-		return fmt.Errorf("table %s is not exists", table.name)
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
 	}
 	arg := (*ddlModifyTableCharsetAndCollateJob)(task.arg)
 	table.charset = arg.newCharset
@@ -649,7 +1120,7 @@ func (c *testCase) modifyTableCharsetAndCollateJob(task *ddlJobTask) error {
 	return nil
 }
 
-const MaxShardRowIDBits int = 7
+var MaxShardRowIDBits = 7
 
 func (c *testCase) generateShardRowID() error {
 	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareShardRowID, nil, ddlShardRowID})
@@ -657,18 +1128,17 @@ func (c *testCase) generateShardRowID() error {
 }
 
 func (c *testCase) prepareShardRowID(_ interface{}, taskCh chan *ddlJobTask) error {
-	// For table has auto_increment column, cannot set shard_row_id_bits to a non-zero value.
-	// Since current create table, add column, and modify column job wouldn't create
-	// auto_increment column, so ignore checking whether table has an auto_increment column
-	// and just execute the set shard_row_id_bits job. This needed to be changed when auto_increment
-	// column is generated possibly.
-	table := c.pickupRandomTable()
+	// The row IDs and the auto_increment IDs share the allocator, so the shard
+	// bits bound the auto_increment IDs as well, see `checkAutoID`. A table
+	// with a clustered primary key, including the AUTO_RANDOM ones, has no row
+	// ID, and cannot set shard_row_id_bits to a non-zero value.
+	table := c.pickupRandomTable(c.ddlRand)
 	if table == nil {
 		return nil
 	}
 	// Don't make shard row bits too large.
-	shardRowId := rand.Intn(MaxShardRowIDBits)
-	sql := fmt.Sprintf("ALTER TABLE `%s` SHARD_ROW_ID_BITS = %d", table.name, shardRowId)
+	shardRowId := c.ddlRand.Intn(MaxShardRowIDBits)
+	sql := fmt.Sprintf("ALTER TABLE %s SHARD_ROW_ID_BITS = %d", table.quotedName(), shardRowId)
 	task := &ddlJobTask{
 		k:       ddlShardRowID,
 		tblInfo: table,
@@ -682,9 +1152,12 @@ func (c *testCase) prepareShardRowID(_ interface{}, taskCh chan *ddlJobTask) err
 func (c *testCase) shardRowIDJob(task *ddlJobTask) error {
 	table := task.tblInfo
 	if c.isTableDeleted(table) {
-		return fmt.Errorf("table %s is not exists", table.name)
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
 	}
 	shardRowId := *((*int)(task.arg))
+	if shardRowId > 0 && table.isClustered() {
+		return expectError(errCodeUnsupportedDDLOperation, "table %s has a clustered primary key", table.name)
+	}
 	table.shardRowId = int64(shardRowId)
 	return nil
 }
@@ -695,37 +1168,41 @@ func (c *testCase) generateRebaseAutoID() error {
 }
 
 func (c *testCase) prepareRebaseAutoID(_ interface{}, taskCh chan *ddlJobTask) error {
-	table := c.pickupRandomTable()
+	table := c.pickupRandomTable(c.ddlRand)
 	if table == nil {
 		return nil
 	}
-	newAutoID := table.newRandAutoID()
+	newAutoID := table.newRandAutoID(c.ddlRand)
 	if newAutoID < 0 {
 		return nil
 	}
-	sql := fmt.Sprintf("alter table `%s` auto_increment=%d", table.name, newAutoID)
+	sql := fmt.Sprintf("alter table %s auto_increment=%d", table.quotedName(), newAutoID)
+	if table.isAutoRandom() {
+		sql = fmt.Sprintf("alter table %s auto_random_base=%d", table.quotedName(), newAutoID)
+	}
 	task := &ddlJobTask{
 		k:       ddlRebaseAutoID,
 		sql:     sql,
 		tblInfo: table,
+		arg:     ddlJobArg(&newAutoID),
 	}
 	taskCh <- task
 	return nil
 }
 
 func (c *testCase) rebaseAutoIDJob(task *ddlJobTask) error {
-	// The autoID might be different from what we specified in task, so instead, do
-	// a simple query to fetch the AutoID.
+	// The auto ID reported by the server might be larger than what we specified
+	// in task because of the ID caches of TiDB, but the IDs allocated from now
+	// on are never less than it.
 	table := task.tblInfo
 	table.lock.Lock()
 	defer table.lock.Unlock()
 	if c.isTableDeleted(table) {
-		return fmt.Errorf("table %s is not exists", table.name)
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
+	}
+	if newAutoID := *((*int64)(task.arg)); newAutoID > table.autoIncID {
+		table.autoIncID = newAutoID
 	}
-	sql := fmt.Sprintf("select auto_increment from information_schema.tables "+
-		"where table_schema='test' and table_name='%s'", table.name)
-	// Ignore check error, it doesn't matter.
-	c.dbs[0].QueryRow(sql).Scan(&table.autoIncID)
 	return nil
 }
 
@@ -737,12 +1214,12 @@ func (c *testCase) generateDropTable() error {
 func (c *testCase) prepareDropTable(cfg interface{}, taskCh chan *ddlJobTask) error {
 	c.tablesLock.Lock()
 	defer c.tablesLock.Unlock()
-	tableToDrop := c.pickupRandomTable()
+	tableToDrop := c.pickupRandomTable(c.ddlRand)
 	if len(c.tables) <= 1 || tableToDrop == nil {
 		return nil
 	}
 	tableToDrop.setDeleted()
-	sql := fmt.Sprintf("DROP TABLE `%s`", tableToDrop.name)
+	sql := fmt.Sprintf("DROP TABLE %s", tableToDrop.quotedName())
 
 	task := &ddlJobTask{
 		k:       ddlDropTable,
@@ -757,9 +1234,16 @@ func (c *testCase) dropTableJob(task *ddlJobTask) error {
 	c.tablesLock.Lock()
 	defer c.tablesLock.Unlock()
 	if c.isTableDeleted(task.tblInfo) {
-		return fmt.Errorf("table %s is not exists", task.tblInfo.name)
+		return expectError(errCodeBadTable, "table %s is not exists", task.tblInfo.name)
+	}
+	if refs := c.referencingForeignKeys(task.tblInfo); len(refs) > 0 {
+		task.tblInfo.setDeletedRecover()
+		return expectError(errCodeFKCannotDropParent, "table %s is referenced by foreign key %s of table %s", task.tblInfo.name, refs[0].fk.name, refs[0].child.name)
 	}
-	delete(c.tables, task.tblInfo.name)
+	task.tblInfo.lock.RLock()
+	c.addTableTombstone(task.tblInfo, false)
+	task.tblInfo.lock.RUnlock()
+	delete(c.tables, task.tblInfo.key())
 	return nil
 }
 
@@ -769,25 +1253,21 @@ func (c *testCase) generateCreateView() error {
 }
 
 func (c *testCase) prepareCreateView(_ interface{}, taskCh chan *ddlJobTask) error {
-	table := c.pickupRandomTable()
+	table := c.pickupRandomTable(c.ddlRand)
 	if table == nil {
 		return nil
 	}
-	columns := table.pickupRandomColumns()
+	columns := table.pickupRandomColumns(c.ddlRand)
 	if len(columns) == 0 {
 		return nil
 	}
 	view := &ddlTestView{
-		name:    uuid.NewV4().String(),
+		schema:  c.pickupRandomSchemaName(c.ddlRand),
+		name:    RandName(c.ddlRand),
 		columns: columns,
 		table:   table,
 	}
-	sql := fmt.Sprintf("create view `%s` as select ", view.name)
-	var i = 0
-	for ; i < len(columns)-1; i++ {
-		sql += fmt.Sprintf("`%s`, ", columns[i].name)
-	}
-	sql += fmt.Sprintf("`%s` from `%s`", columns[i].name, table.name)
+	sql := fmt.Sprintf("create view %s as %s", view.quotedName(), view.selectSQL())
 	task := &ddlJobTask{
 		k:        ddlCreateView,
 		sql:      sql,
@@ -798,7 +1278,104 @@ func (c *testCase) prepareCreateView(_ interface{}, taskCh chan *ddlJobTask) err
 }
 
 func (c *testCase) createViewJob(task *ddlJobTask) error {
-	c.views[task.viewInfo.name] = task.viewInfo
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	if c.isSchemaNameDeleted(task.viewInfo.schema) {
+		return expectError(errCodeBadDB, "schema %s doesn't exist", task.viewInfo.schema)
+	}
+	if c.isTableDeleted(task.viewInfo.table) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", task.viewInfo.table.name)
+	}
+	c.views[task.viewInfo.key()] = task.viewInfo
+	return nil
+}
+
+func (c *testCase) generateReplaceView() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareReplaceView, nil, ddlReplaceView})
+	return nil
+}
+
+func (c *testCase) prepareReplaceView(_ interface{}, taskCh chan *ddlJobTask) error {
+	view := c.pickupRandomView(c.ddlRand)
+	if view == nil {
+		return nil
+	}
+	table := c.pickupRandomTable(c.ddlRand)
+	if table == nil {
+		return nil
+	}
+	columns := table.pickupRandomColumns(c.ddlRand)
+	if len(columns) == 0 {
+		return nil
+	}
+	newView := &ddlTestView{
+		schema:  view.schema,
+		name:    view.name,
+		columns: columns,
+		table:   table,
+	}
+	view.setDeleted()
+	// TiDB doesn't support `ALTER VIEW`.
+	alter := c.cfg.MySQLCompatible && c.ddlRand.Intn(2) == 0
+	sql := fmt.Sprintf("create or replace view %s as %s", newView.quotedName(), newView.selectSQL())
+	if alter {
+		sql = fmt.Sprintf("alter view %s as %s", newView.quotedName(), newView.selectSQL())
+	}
+	task := &ddlJobTask{
+		k:        ddlReplaceView,
+		sql:      sql,
+		viewInfo: newView,
+		arg:      ddlJobArg(&alter),
+	}
+	taskCh <- task
+	return nil
+}
+
+func (c *testCase) replaceViewJob(task *ddlJobTask) error {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	alter := *((*bool)(task.arg))
+	if c.isSchemaNameDeleted(task.viewInfo.schema) {
+		return expectError(errCodeBadDB, "schema %s doesn't exist", task.viewInfo.schema)
+	}
+	if alter && c.isViewDeleted(task.viewInfo) {
+		return expectError(errCodeNoSuchTable, "view %s is not exists", task.viewInfo.name)
+	}
+	if c.isTableDeleted(task.viewInfo.table) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", task.viewInfo.table.name)
+	}
+	c.views[task.viewInfo.key()] = task.viewInfo
+	return nil
+}
+
+func (c *testCase) generateDropView() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareDropView, nil, ddlDropView})
+	return nil
+}
+
+func (c *testCase) prepareDropView(_ interface{}, taskCh chan *ddlJobTask) error {
+	view := c.pickupRandomView(c.ddlRand)
+	if view == nil {
+		return nil
+	}
+	view.setDeleted()
+	sql := fmt.Sprintf("DROP VIEW %s", view.quotedName())
+	task := &ddlJobTask{
+		k:        ddlDropView,
+		sql:      sql,
+		viewInfo: view,
+	}
+	taskCh <- task
+	return nil
+}
+
+func (c *testCase) dropViewJob(task *ddlJobTask) error {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	if c.isViewDeleted(task.viewInfo) {
+		return expectError(errCodeBadTable, "view %s is not exists", task.viewInfo.name)
+	}
+	delete(c.views, task.viewInfo.key())
 	return nil
 }
 
@@ -827,14 +1404,14 @@ func (c *testCase) generateAddIndex() error {
 }
 
 func (c *testCase) prepareAddIndex(_ interface{}, taskCh chan *ddlJobTask) error {
-	table := c.pickupRandomTable()
+	table := c.pickupRandomTable(c.ddlRand)
 	if table == nil {
 		return nil
 	}
-	strategy := rand.Intn(ddlTestIndexStrategyMultipleColumnRandom) + ddlTestIndexStrategySingleColumnAtBeginning
+	strategy := c.ddlRand.Intn(ddlTestIndexStrategyMultipleColumnRandom) + ddlTestIndexStrategySingleColumnAtBeginning
 	// build index definition
 	index := ddlTestIndex{
-		name:      uuid.NewV4().String(),
+		name:      RandName(c.ddlRand),
 		signature: "",
 		columns:   make([]*ddlTestColumn, 0),
 	}
@@ -842,32 +1419,32 @@ func (c *testCase) prepareAddIndex(_ interface{}, taskCh chan *ddlJobTask) error
 	switch strategy {
 	case ddlTestIndexStrategySingleColumnAtBeginning:
 		column0 := getColumnFromArrayList(table.columns, 0)
-		if !column0.canBeIndex() {
+		if !column0.canBeKeyPart() {
 			return nil
 		}
 		index.columns = append(index.columns, column0)
 	case ddlTestIndexStrategySingleColumnAtEnd:
 		lastColumn := getColumnFromArrayList(table.columns, table.columns.Size()-1)
-		if !lastColumn.canBeIndex() {
+		if !lastColumn.canBeKeyPart() {
 			return nil
 		}
 		index.columns = append(index.columns, lastColumn)
 	case ddlTestIndexStrategySingleColumnRandom:
-		col := getColumnFromArrayList(table.columns, rand.Intn(table.columns.Size()))
-		if !col.canBeIndex() {
+		col := getColumnFromArrayList(table.columns, c.ddlRand.Intn(table.columns.Size()))
+		if !col.canBeKeyPart() {
 			return nil
 		}
 		index.columns = append(index.columns, col)
 	case ddlTestIndexStrategyMultipleColumnRandom:
-		numberOfColumns := rand.Intn(table.columns.Size()) + 1
+		numberOfColumns := c.ddlRand.Intn(table.columns.Size()) + 1
 		// Multiple columns of one index should no more than 16.
 		if numberOfColumns > 10 {
 			numberOfColumns = 10
 		}
-		perm := rand.Perm(table.columns.Size())[:numberOfColumns]
+		perm := c.ddlRand.Perm(table.columns.Size())[:numberOfColumns]
 		for _, idx := range perm {
 			column := getColumnFromArrayList(table.columns, idx)
-			if column.canBeIndex() {
+			if column.canBeKeyPart() {
 				index.columns = append(index.columns, column)
 			}
 		}
@@ -876,12 +1453,25 @@ func (c *testCase) prepareAddIndex(_ interface{}, taskCh chan *ddlJobTask) error
 	if len(index.columns) == 0 {
 		return nil
 	}
+	index.parts = make([]ddlTestKeyPart, 0, len(index.columns))
+	for _, column := range index.columns {
+		index.parts = append(index.parts, randKeyPart(c.ddlRand, column))
+	}
 
-	signature := ""
-	for _, col := range index.columns {
-		signature += col.name + ","
+	// The unique indexes are only built on the whole columns whose values are
+	// known by the model, see `predictDuplicate`. A unique index of a
+	// partitioned table must include the partitioning column, or it fails.
+	index.unique = c.ddlRand.Intn(3) == 0
+	for i, column := range index.columns {
+		if column.isGenerated() || !index.part(i).isColumn() {
+			index.unique = false
+		}
+	}
+	if index.unique && table.partition != nil && c.ddlRand.Intn(2) == 0 && !containsColumn(index.columns, table.partition.column) {
+		index.columns = append(index.columns, table.partition.column)
 	}
-	index.signature = signature
+
+	index.signature = index.keyPartsSignature()
 
 	// check whether index duplicates
 	for _, idx := range table.indexes {
@@ -890,20 +1480,10 @@ func (c *testCase) prepareAddIndex(_ interface{}, taskCh chan *ddlJobTask) error
 		}
 	}
 
-	// build SQL
-	sql := fmt.Sprintf("ALTER TABLE `%s` ADD INDEX `%s` (", table.name, index.name)
-	for i, column := range index.columns {
-		if i > 0 {
-			sql += ", "
-		}
-		sql += fmt.Sprintf("`%s`", column.name)
-	}
-	sql += ")"
-
 	arg := &ddlIndexJobArg{index: &index}
 	task := &ddlJobTask{
 		k:       ddlAddIndex,
-		sql:     sql,
+		sql:     fmt.Sprintf("ALTER TABLE %s %s", table.quotedName(), index.clause()),
 		tblInfo: table,
 		arg:     ddlJobArg(arg),
 	}
@@ -912,16 +1492,32 @@ func (c *testCase) prepareAddIndex(_ interface{}, taskCh chan *ddlJobTask) error
 }
 
 func (c *testCase) addIndexJob(task *ddlJobTask) error {
+	task.tblInfo.lock.Lock()
+	defer task.tblInfo.lock.Unlock()
+	return c.applyAddIndex(task)
+}
+
+// applyAddIndex is `addIndexJob` without locking, the caller should hold the
+// lock of the table.
+func (c *testCase) applyAddIndex(task *ddlJobTask) error {
 	jobArg := (*ddlIndexJobArg)(task.arg)
 	tblInfo := task.tblInfo
 
 	if c.isTableDeleted(tblInfo) {
-		return fmt.Errorf("table %s is not exists", tblInfo.name)
+		return expectError(errCodeNoSuchTable, "table %s is not exists", tblInfo.name)
 	}
 
 	for _, column := range jobArg.index.columns {
 		if tblInfo.isColumnDeleted(column) {
-			return fmt.Errorf("local Execute add index %s on column %s error , column is deleted", jobArg.index.name, column.name)
+			return expectError(errCodeKeyColumnNotExists, "local Execute add index %s on column %s error , column is deleted", jobArg.index.name, column.name)
+		}
+	}
+	if jobArg.index.unique {
+		if tblInfo.partition != nil && !containsColumn(jobArg.index.columns, tblInfo.partition.column) {
+			return expectError(errCodeUniqueKeyNeedAllFields, "unique index %s on table %s doesn't include the partitioning column", jobArg.index.name, tblInfo.name)
+		}
+		if err := tblInfo.duplicateError([][]*ddlTestColumn{jobArg.index.columns}, tblInfo.allRows(), nil, c.newCollation); err != nil {
+			return err
 		}
 	}
 	tblInfo.indexes = append(tblInfo.indexes, jobArg.index)
@@ -942,15 +1538,15 @@ func (c *testCase) generateRenameIndex() error {
 }
 
 func (c *testCase) prepareRenameIndex(_ interface{}, taskCh chan *ddlJobTask) error {
-	table := c.pickupRandomTable()
+	table := c.pickupRandomTable(c.ddlRand)
 	if table == nil || len(table.indexes) == 0 {
 		return nil
 	}
-	loc := rand.Intn(len(table.indexes))
+	loc := c.ddlRand.Intn(len(table.indexes))
 	index := table.indexes[loc]
-	newIndex := uuid.NewV4().String()
-	sql := fmt.Sprintf("ALTER TABLE `%s` RENAME INDEX `%s` to `%s`",
-		table.name, index.name, newIndex)
+	newIndex := RandName(c.ddlRand)
+	sql := fmt.Sprintf("ALTER TABLE %s RENAME INDEX `%s` to `%s`",
+		table.quotedName(), index.name, newIndex)
 	task := &ddlJobTask{
 		k:       ddlRenameIndex,
 		sql:     sql,
@@ -965,10 +1561,10 @@ func (c *testCase) renameIndexJob(task *ddlJobTask) error {
 	table := task.tblInfo
 	arg := (*ddlRenameIndexArg)(task.arg)
 	if c.isTableDeleted(table) {
-		return fmt.Errorf("table %s is not exists", table.name)
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
 	}
 	if c.isIndexDeleted(table.indexes[arg.preIndex], table) {
-		return fmt.Errorf("index %s on table %s is not exists", table.indexes[arg.preIndex].name, table.name)
+		return expectError(errCodeKeyDoesNotExist, "index %s on table %s is not exists", table.indexes[arg.preIndex].name, table.name)
 	}
 	table.indexes[arg.preIndex].name = arg.newIndex
 	return nil
@@ -980,16 +1576,16 @@ func (c *testCase) generateDropIndex() error {
 }
 
 func (c *testCase) prepareDropIndex(_ interface{}, taskCh chan *ddlJobTask) error {
-	table := c.pickupRandomTable()
+	table := c.pickupRandomTable(c.ddlRand)
 	if table == nil {
 		return nil
 	}
 	if len(table.indexes) == 0 {
 		return nil
 	}
-	indexToDropIndex := rand.Intn(len(table.indexes))
+	indexToDropIndex := c.ddlRand.Intn(len(table.indexes))
 	indexToDrop := table.indexes[indexToDropIndex]
-	sql := fmt.Sprintf("ALTER TABLE `%s` DROP INDEX `%s`", table.name, indexToDrop.name)
+	sql := fmt.Sprintf("ALTER TABLE %s DROP INDEX `%s`", table.quotedName(), indexToDrop.name)
 
 	arg := &ddlIndexJobArg{index: indexToDrop}
 	task := &ddlJobTask{
@@ -1007,7 +1603,7 @@ func (c *testCase) dropIndexJob(task *ddlJobTask) error {
 	tblInfo := task.tblInfo
 
 	if c.isTableDeleted(tblInfo) {
-		return fmt.Errorf("table %s is not exists", tblInfo.name)
+		return expectError(errCodeNoSuchTable, "table %s is not exists", tblInfo.name)
 	}
 
 	iOfDropIndex := -1
@@ -1018,7 +1614,10 @@ func (c *testCase) dropIndexJob(task *ddlJobTask) error {
 		}
 	}
 	if iOfDropIndex == -1 {
-		return fmt.Errorf("table %s , index %s is not exists", tblInfo.name, jobArg.index.name)
+		return expectError(errCodeCantDropFieldOrKey, "table %s , index %s is not exists", tblInfo.name, jobArg.index.name)
+	}
+	if fk := c.foreignKeyNeedingIndex(tblInfo, jobArg.index.name); fk != nil {
+		return expectError(errCodeDropIndexFK, "table %s , index %s is needed in foreign key %s", tblInfo.name, jobArg.index.name, fk.name)
 	}
 
 	for _, column := range jobArg.index.columns {
@@ -1059,22 +1658,23 @@ func (c *testCase) generateAddColumn() error {
 }
 
 func (c *testCase) prepareAddColumn(_ interface{}, taskCh chan *ddlJobTask) error {
-	table := c.pickupRandomTable()
+	table := c.pickupRandomTable(c.ddlRand)
 	if table == nil {
 		return nil
 	}
-	strategy := rand.Intn(ddlTestAddDropColumnStrategyAtRandom) + ddlTestAddDropColumnStrategyAtBeginning
-	newColumn := getRandDDLTestColumn()
+	strategy := c.ddlRand.Intn(ddlTestAddDropColumnStrategyAtRandom) + ddlTestAddDropColumnStrategyAtBeginning
+	newColumn := getRandDDLTestColumn(c.ddlRand)
+	newColumn.setRandNotNull(c.ddlRand, false)
 	insertAfterPosition := -1
 	// build SQL
-	sql := fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s", table.name, newColumn.name, newColumn.getDefinition())
+	sql := fmt.Sprintf("ALTER TABLE %s ADD COLUMN `%s` %s", table.quotedName(), newColumn.name, newColumn.getDefinition())
 	switch strategy {
 	case ddlTestAddDropColumnStrategyAtBeginning:
 		sql += " FIRST"
 	case ddlTestAddDropColumnStrategyAtEnd:
 		// do nothing
 	case ddlTestAddDropColumnStrategyAtRandom:
-		insertAfterPosition = rand.Intn(table.columns.Size())
+		insertAfterPosition = c.ddlRand.Intn(table.columns.Size())
 		column := getColumnFromArrayList(table.columns, insertAfterPosition)
 		sql += fmt.Sprintf(" AFTER `%s`", column.name)
 	}
@@ -1097,15 +1697,22 @@ func (c *testCase) prepareAddColumn(_ interface{}, taskCh chan *ddlJobTask) erro
 }
 
 func (c *testCase) addColumnJob(task *ddlJobTask) error {
+	task.tblInfo.lock.Lock()
+	defer task.tblInfo.lock.Unlock()
+	return c.applyAddColumn(task)
+}
+
+// applyAddColumn is `addColumnJob` without locking, the caller should hold the
+// lock of the table.
+func (c *testCase) applyAddColumn(task *ddlJobTask) error {
 	jobArg := (*ddlColumnJobArg)(task.arg)
 	table := task.tblInfo
-	table.lock.Lock()
-	defer table.lock.Unlock()
 
 	if c.isTableDeleted(table) {
-		return fmt.Errorf("table %s is not exists", table.name)
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
 	}
 	newColumn := jobArg.column
+	newColumn.collate = table.collate
 	strategy := jobArg.strategy
 
 	newColumn.rows = arraylist.New()
@@ -1128,7 +1735,7 @@ func (c *testCase) addColumnJob(task *ddlJobTask) error {
 			}
 		}
 		if insertAfterPosition == -1 {
-			return fmt.Errorf("table %s ,insert column %s after column, column %s is not exists ", table.name, newColumn.name, jobArg.insertAfterColumn.name)
+			return expectError(errCodeBadField, "table %s ,insert column %s after column, column %s is not exists ", table.name, newColumn.name, jobArg.insertAfterColumn.name)
 		}
 		table.columns.Insert(insertAfterPosition+1, newColumn)
 	}
@@ -1141,33 +1748,50 @@ func (c *testCase) generateModifyColumn() error {
 }
 
 func (c *testCase) prepareModifyColumn(_ interface{}, taskCh chan *ddlJobTask) error {
-	table := c.pickupRandomTable()
+	table := c.pickupRandomTable(c.ddlRand)
 	if table == nil {
 		return nil
 	}
 	table.lock.Lock()
 	defer table.lock.Unlock()
-	origColIndex, origColumn := table.pickupRandomColumn()
-	if origColumn == nil || !origColumn.canBeModified() {
+	origColIndex, origColumn := table.pickupRandomColumn(c.ddlRand)
+	if origColumn == nil || origColumn.isAutoID() {
+		return nil
+	}
+	if fk, _ := c.foreignKeyOnColumn(table, origColumn); fk != nil {
+		return nil
+	}
+	// The partitioning column cannot be modified.
+	if table.partition != nil && table.partition.column == origColumn {
+		return nil
+	}
+	renameCol := c.ddlRand.Float64() > 0.5
+	// If a column has dependency, it cannot be renamed.
+	if renameCol && (origColumn.hasGenerateCol() || table.hasExpressionOn(origColumn)) {
+		return nil
+	}
+	modifiedColumn := generateRandModifiedColumn(c.ddlRand, origColumn, renameCol)
+	if modifiedColumn == nil {
+		return nil
+	}
+	if !table.canChangeType(origColumn, modifiedColumn) {
 		return nil
 	}
-	var modifiedColumn *ddlTestColumn
 	var sql string
-	if rand.Float64() > 0.5 {
-		// If a column has dependency, it cannot be renamed.
-		if origColumn.hasGenerateCol() {
-			return nil
-		}
-		modifiedColumn = generateRandModifiedColumn(origColumn, true)
+	if renameCol {
 		origColumn.setRenamed()
-		sql = fmt.Sprintf("alter table `%s` change column `%s` `%s` %s", table.name,
+		sql = fmt.Sprintf("alter table %s change column `%s` `%s` %s", table.quotedName(),
 			origColumn.name, modifiedColumn.name, modifiedColumn.getDefinition())
 	} else {
-		modifiedColumn = generateRandModifiedColumn(origColumn, false)
-		sql = fmt.Sprintf("alter table `%s` modify column `%s` %s", table.name,
+		// MODIFY COLUMN changes a column from NULL to NOT NULL or back
+		// sometimes, which fails if the column has NULL.
+		if !origColumn.isPrimaryKey && !origColumn.hasGenerateCol() && c.ddlRand.Float64() < NotNullProbability {
+			modifiedColumn.notNull = !origColumn.notNull
+		}
+		sql = fmt.Sprintf("alter table %s modify column `%s` %s", table.quotedName(),
 			origColumn.name, modifiedColumn.getDefinition())
 	}
-	strategy := rand.Intn(ddlTestAddDropColumnStrategyAtRandom) + ddlTestAddDropColumnStrategyAtBeginning
+	strategy := c.ddlRand.Intn(ddlTestAddDropColumnStrategyAtRandom) + ddlTestAddDropColumnStrategyAtBeginning
 	var insertAfterColumn *ddlTestColumn = nil
 	switch strategy {
 	case ddlTestAddDropColumnStrategyAtBeginning:
@@ -1178,7 +1802,7 @@ func (c *testCase) prepareModifyColumn(_ interface{}, taskCh chan *ddlJobTask) e
 			sql += fmt.Sprintf(" AFTER `%s`", endColumn.name)
 		}
 	case ddlTestAddDropColumnStrategyAtRandom:
-		insertPosition := rand.Intn(table.columns.Size())
+		insertPosition := c.ddlRand.Intn(table.columns.Size())
 		insertAfterColumn = getColumnFromArrayList(table.columns, insertPosition)
 		if insertPosition != origColIndex {
 			sql += fmt.Sprintf(" AFTER `%s`", insertAfterColumn.name)
@@ -1201,17 +1825,104 @@ func (c *testCase) prepareModifyColumn(_ interface{}, taskCh chan *ddlJobTask) e
 }
 
 func (c *testCase) modifyColumnJob(task *ddlJobTask) error {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	task.tblInfo.lock.Lock()
+	defer task.tblInfo.lock.Unlock()
+	return c.applyModifyColumn(task)
+}
+
+// applyModifyColumn is `modifyColumnJob` without locking, the caller should
+// hold `c.tablesLock` and the lock of the table.
+func (c *testCase) applyModifyColumn(task *ddlJobTask) error {
 	table := task.tblInfo
-	table.lock.Lock()
-	defer table.lock.Unlock()
 	if c.isTableDeleted(table) {
-		return fmt.Errorf("table %s is not exists", table.name)
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
 	}
 	arg := (*ddlColumnJobArg)(task.arg)
 	if c.isColumnDeleted(arg.origColumn, table) {
-		return fmt.Errorf("column %s on table %s is not exists", arg.origColumn.name, table.name)
+		return expectError(errCodeBadField, "column %s on table %s is not exists", arg.origColumn.name, table.name)
+	}
+	// The columns may be added or dropped since the task is prepared.
+	for i := 0; i < table.columns.Size(); i++ {
+		if getColumnFromArrayList(table.columns, i).name == arg.origColumn.name {
+			arg.origColumnIndex = i
+			break
+		}
+	}
+	// The primary key and the indexes may be changed since the task is prepared.
+	arg.column.isPrimaryKey = containsColumn(table.primaryKey, arg.origColumn)
+	arg.column.indexReferences = arg.origColumn.indexReferences
+	if arg.column.isPrimaryKey && !arg.column.notNull {
+		return expectError(errCodePrimaryCantHaveNull, "column %s of the primary key of table %s is modified to NULL", arg.column.name, table.name)
+	}
+	// The column takes the collation of the table unless it's only renamed.
+	if task.k != ddlRenameColumn {
+		arg.column.collate = table.collate
+	}
+	var nullErr, convertErr error
+	if arg.column.notNull && !arg.origColumn.notNull &&
+		(arg.origColumn.rows.Contains(nil) || arg.origColumn.rows.Contains(ddlTestValueNull)) {
+		nullErr = expectError(errCodeInvalidUseOfNull, "column %s of table %s has NULL", arg.origColumn.name, table.name)
+	}
+	// The rows are converted if the type is changed.
+	rows := arg.origColumn.rows
+	if arg.column.fieldType != arg.origColumn.fieldType {
+		rows, convertErr = c.convertRows(table, arg.origColumn, arg.column)
+	}
+	if err := chooseExpectedError(task.err, nullErr, convertErr); err != nil {
+		return err
 	}
+	if arg.column.name != arg.origColumn.name && table.hasExpressionOn(arg.origColumn) {
+		return expectError(errCodeDependentByFunctionalIndex, "column %s of table %s is used by an expression index", arg.origColumn.name, table.name)
+	}
+	// The prefix or the expression of an index added meanwhile may not fit
+	// the new type. `prepareModifyColumn` keeps the type of such a column, so
+	// it only happens in the parallel mode, where any error is accepted. The
+	// error isn't predicted: whether a prefix fits depends on the new length
+	// and charset, and whether an expression overflows on the rows, which the
+	// servers check differently.
+	if task.err != nil && arg.column.fieldType != arg.origColumn.fieldType && table.hasPartialKeyPart(arg.origColumn) {
+		return expectError(0, "column %s of table %s is indexed by a prefix or an expression", arg.origColumn.name, table.name)
+	}
+	checks := table.checksOn(arg.origColumn)
+	// Both servers refuse to rename a column used by checks, whose
+	// expressions refer to the column by name.
+	if len(checks) > 0 && arg.column.name != arg.origColumn.name {
+		return expectError(errCodeDependentByCheck, "column %s of table %s is used by check %s", arg.origColumn.name, table.name, checks[0].name)
+	}
+	// The foreign key may be added since the task is prepared.
+	if fk, isChild := c.foreignKeyOnColumn(table, arg.origColumn); fk != nil {
+		if arg.column.k != arg.origColumn.k || arg.column.fieldType != arg.origColumn.fieldType ||
+			isChild && arg.column.notNull && (fk.onDelete == fkActionSetNull || fk.onUpdate == fkActionSetNull) {
+			return expectError(0, "column %s of table %s in foreign key %s is modified to %s", arg.origColumn.name, table.name, fk.name, arg.column.getDefinition())
+		}
+		c.replaceForeignKeyColumn(table, arg.origColumn, arg.column)
+	}
+	for _, check := range checks {
+		check.column = arg.column
+	}
+	arg.column.rows = rows
 	table.columns.Remove(arg.origColumnIndex)
+	for _, index := range table.indexes {
+		for i, column := range index.columns {
+			if column == arg.origColumn {
+				index.columns[i] = arg.column
+			}
+		}
+	}
+	for i, column := range table.primaryKey {
+		if column == arg.origColumn {
+			table.primaryKey[i] = arg.column
+		}
+	}
+	if arg.origColumn.isGenerated() {
+		for i, column := range arg.origColumn.dependency.dependenciedCols {
+			if column == arg.origColumn {
+				arg.origColumn.dependency.dependenciedCols[i] = arg.column
+			}
+		}
+	}
 	switch arg.strategy {
 	case ddlTestAddDropColumnStrategyAtBeginning:
 		table.columns.Insert(0, arg.column)
@@ -1231,13 +1942,59 @@ func (c *testCase) modifyColumnJob(task *ddlJobTask) error {
 	return nil
 }
 
+func (c *testCase) generateRenameColumn() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareRenameColumn, nil, ddlRenameColumn})
+	return nil
+}
+
+// prepareRenameColumn renames a column by RENAME COLUMN, which runs as a
+// MODIFY COLUMN that keeps the definition and the position of the column.
+func (c *testCase) prepareRenameColumn(_ interface{}, taskCh chan *ddlJobTask) error {
+	table := c.pickupRandomTable(c.ddlRand)
+	if table == nil {
+		return nil
+	}
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	origColIndex, origColumn := table.pickupRandomColumn(c.ddlRand)
+	// The generated columns and the expression indexes refer to their
+	// columns by name.
+	if origColumn == nil || origColumn.isRenamed() || origColumn.hasGenerateCol() || table.hasExpressionOn(origColumn) {
+		return nil
+	}
+	if fk, _ := c.foreignKeyOnColumn(table, origColumn); fk != nil {
+		return nil
+	}
+	if table.partition != nil && table.partition.column == origColumn {
+		return nil
+	}
+	renamedColumn := *origColumn
+	renamedColumn.name = RandName(c.ddlRand)
+	origColumn.setRenamed()
+	task := &ddlJobTask{
+		k:       ddlRenameColumn,
+		tblInfo: table,
+		sql:     fmt.Sprintf("ALTER TABLE %s RENAME COLUMN `%s` TO `%s`", table.quotedName(), origColumn.name, renamedColumn.name),
+		arg: ddlJobArg(&ddlColumnJobArg{
+			origColumnIndex: origColIndex,
+			origColumn:      origColumn,
+			column:          &renamedColumn,
+			// The column is inserted after itself, i.e. at its position.
+			strategy:          ddlTestAddDropColumnStrategyAtRandom,
+			insertAfterColumn: origColumn,
+		}),
+	}
+	taskCh <- task
+	return nil
+}
+
 func (c *testCase) generateDropColumn() error {
 	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareDropColumn, nil, ddlDropColumn})
 	return nil
 }
 
 func (c *testCase) prepareDropColumn(_ interface{}, taskCh chan *ddlJobTask) error {
-	table := c.pickupRandomTable()
+	table := c.pickupRandomTable(c.ddlRand)
 	if table == nil {
 		return nil
 	}
@@ -1247,7 +2004,7 @@ func (c *testCase) prepareDropColumn(_ interface{}, taskCh chan *ddlJobTask) err
 		return nil
 	}
 
-	strategy := rand.Intn(ddlTestAddDropColumnStrategyAtRandom) + ddlTestAddDropColumnStrategyAtBeginning
+	strategy := c.ddlRand.Intn(ddlTestAddDropColumnStrategyAtRandom) + ddlTestAddDropColumnStrategyAtBeginning
 	columnToDropIndex := -1
 	switch strategy {
 	case ddlTestAddDropColumnStrategyAtBeginning:
@@ -1255,7 +2012,7 @@ func (c *testCase) prepareDropColumn(_ interface{}, taskCh chan *ddlJobTask) err
 	case ddlTestAddDropColumnStrategyAtEnd:
 		columnToDropIndex = table.columns.Size() - 1
 	case ddlTestAddDropColumnStrategyAtRandom:
-		columnToDropIndex = rand.Intn(table.columns.Size())
+		columnToDropIndex = c.ddlRand.Intn(table.columns.Size())
 	}
 
 	columnToDrop := getColumnFromArrayList(table.columns, columnToDropIndex)
@@ -1274,8 +2031,13 @@ func (c *testCase) prepareDropColumn(_ interface{}, taskCh chan *ddlJobTask) err
 	if columnToDrop.indexReferences > 0 {
 		return nil
 	}
+
+	// The partitioning column cannot be dropped
+	if table.partition != nil && table.partition.column == columnToDrop {
+		return nil
+	}
 	columnToDrop.setDeleted()
-	sql := fmt.Sprintf("ALTER TABLE `%s` DROP COLUMN `%s`", table.name, columnToDrop.name)
+	sql := fmt.Sprintf("ALTER TABLE %s DROP COLUMN `%s`", table.quotedName(), columnToDrop.name)
 
 	arg := &ddlColumnJobArg{
 		column:            columnToDrop,
@@ -1293,17 +2055,37 @@ func (c *testCase) prepareDropColumn(_ interface{}, taskCh chan *ddlJobTask) err
 }
 
 func (c *testCase) dropColumnJob(task *ddlJobTask) error {
+	task.tblInfo.lock.Lock()
+	defer task.tblInfo.lock.Unlock()
+	return c.applyDropColumn(task)
+}
+
+// applyDropColumn is `dropColumnJob` without locking, the caller should hold
+// the lock of the table.
+func (c *testCase) applyDropColumn(task *ddlJobTask) error {
 	jobArg := (*ddlColumnJobArg)(task.arg)
 	table := task.tblInfo
-	table.lock.Lock()
-	defer table.lock.Unlock()
 	if c.isTableDeleted(table) {
-		return fmt.Errorf("table %s is not exists", table.name)
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
 	}
 	columnToDrop := jobArg.column
-	if columnToDrop.indexReferences > 0 {
+	if fk, isChild := c.foreignKeyOnColumn(table, columnToDrop); fk != nil {
+		columnToDrop.setDeletedRecover()
+		if isChild {
+			return expectError(errCodeFKColumnCannotDrop, "column %s of table %s is needed in foreign key %s", columnToDrop.name, table.name, fk.name)
+		}
+		return expectError(errCodeFKColumnCannotDropChild, "column %s of table %s is referenced by foreign key %s", columnToDrop.name, table.name, fk.name)
+	}
+	if columnToDrop.indexReferences > 0 || columnToDrop.isPrimaryKey {
+		columnToDrop.setDeletedRecover()
+		return expectError(0, "local Execute drop column %s on table %s error , column has index reference", jobArg.column.name, table.name)
+	}
+	// TiDB drops the checks referring to the column only with it, and refuses
+	// the ones referring to other columns too, which the model doesn't have.
+	// MySQL refuses any check on the column.
+	if checks := table.checksOn(columnToDrop); len(checks) > 0 && c.cfg.MySQLCompatible {
 		columnToDrop.setDeletedRecover()
-		return fmt.Errorf("local Execute drop column %s on table %s error , column has index reference", jobArg.column.name, table.name)
+		return expectError(errCodeDependentByCheck, "column %s of table %s is used by check %s", columnToDrop.name, table.name, checks[0].name)
 	}
 	dropColumnPosition := -1
 	for i := 0; i < table.columns.Size(); i++ {
@@ -1314,10 +2096,11 @@ func (c *testCase) dropColumnJob(task *ddlJobTask) error {
 		}
 	}
 	if dropColumnPosition == -1 {
-		return fmt.Errorf("table %s ,drop column , column %s is not exists ", table.name, columnToDrop.name)
+		return expectError(errCodeCantDropFieldOrKey, "table %s ,drop column , column %s is not exists ", table.name, columnToDrop.name)
 	}
 	// update table definitions
 	table.columns.Remove(dropColumnPosition)
+	table.removeChecksOn(columnToDrop)
 	// if the drop column is a generated column , we should update the dependency column
 	if columnToDrop.isGenerated() {
 		col := columnToDrop.dependency
@@ -1344,7 +2127,7 @@ func (c *testCase) generateSetDefaultValue() error {
 }
 
 func (c *testCase) prepareSetDefaultValue(_ interface{}, taskCh chan *ddlJobTask) error {
-	table := c.pickupRandomTable()
+	table := c.pickupRandomTable(c.ddlRand)
 	if table == nil {
 		return nil
 	}
@@ -1352,14 +2135,14 @@ func (c *testCase) prepareSetDefaultValue(_ interface{}, taskCh chan *ddlJobTask
 	if len(columns) == 0 {
 		return nil
 	}
-	loc := rand.Intn(len(columns))
+	loc := c.ddlRand.Intn(len(columns))
 	column := columns[loc]
 	// If the chosen column cannot have default value, just return nil.
-	if !column.canHaveDefaultValue() {
+	if !column.canHaveDefaultValue() || column.isAutoID() {
 		return nil
 	}
-	newDefaultValue := column.randValue()
-	sql := fmt.Sprintf("ALTER TABLE `%s` ALTER `%s` SET DEFAULT %s", table.name,
+	newDefaultValue := table.randColumnValue(c.ddlRand, column)
+	sql := fmt.Sprintf("ALTER TABLE %s ALTER `%s` SET DEFAULT %s", table.quotedName(),
 		column.name, getDefaultValueString(column.k, newDefaultValue))
 	task := &ddlJobTask{
 		k:       ddlSetDefaultValue,
@@ -1380,11 +2163,11 @@ func (c *testCase) setDefaultValueJob(task *ddlJobTask) error {
 	table.lock.Lock()
 	defer table.lock.Unlock()
 	if c.isTableDeleted(table) {
-		return fmt.Errorf("table %s is not exists", table.name)
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
 	}
 	arg := (*ddlSetDefaultValueArg)(task.arg)
 	if c.isColumnDeleted(arg.column, table) {
-		return fmt.Errorf("column %s on table %s is not exists", arg.column.name, table.name)
+		return expectError(errCodeBadField, "column %s on table %s is not exists", arg.column.name, table.name)
 	}
 	column := getColumnFromArrayList(table.columns, arg.columnIndex)
 	column.defaultValue = arg.newDefaultValue
@@ -1495,7 +2278,8 @@ func (c *testCase) getSortTask(db *sql.DB, tasks []*ddlJobTask) ([]*ddlJobTask,
 	sortTasks := make([]*ddlJobTask, 0, len(tasks))
 	for _, job := range jobs {
 		for _, task := range tasks {
-			if task.k == ddlAddTable && job.k == ddlAddTable && task.tblInfo.name == job.tableName {
+			if task.isJobKind(ddlAddTable) && job.k == ddlAddTable && task.tblInfo.name == job.tableName &&
+				c.schemaName(task.tblInfo.schema) == job.schemaName {
 				task.ddlID = job.id
 				task.tblInfo.id = job.tableID
 				sortTasks = append(sortTasks, task)
@@ -1507,13 +2291,57 @@ func (c *testCase) getSortTask(db *sql.DB, tasks []*ddlJobTask) ([]*ddlJobTask,
 				sortTasks = append(sortTasks, task)
 				break
 			}
-			if task.k == ddlCreateView && job.k == ddlCreateView && task.viewInfo.name == job.tableName {
+			if task.k == ddlCreateView && job.k == ddlCreateView && task.viewInfo.name == job.tableName &&
+				c.schemaName(task.viewInfo.schema) == job.schemaName {
 				task.ddlID = job.id
 				task.viewInfo.id = job.tableID
 				sortTasks = append(sortTasks, task)
 				break
 			}
-			if task.k != ddlAddTable && job.k == task.k {
+			// `CREATE OR REPLACE VIEW` is a "create view" job.
+			if task.k == ddlReplaceView && job.k == ddlCreateView && task.viewInfo.name == job.tableName &&
+				c.schemaName(task.viewInfo.schema) == job.schemaName {
+				task.ddlID = job.id
+				task.viewInfo.id = job.tableID
+				sortTasks = append(sortTasks, task)
+				break
+			}
+			// RECOVER and FLASHBACK restore a table or a schema with its old ID
+			// and the new name.
+			if task.isJobKind(ddlRecoverTable) && job.k == ddlRecoverTable {
+				arg := (*ddlRecoverArg)(task.arg)
+				if arg.newName == job.tableName && c.schemaName(arg.key.schema) == job.schemaName {
+					task.ddlID = job.id
+					arg.id = job.tableID
+					sortTasks = append(sortTasks, task)
+					break
+				}
+			}
+			if task.k == ddlRecoverSchema && job.k == ddlRecoverSchema && (*ddlRecoverArg)(task.arg).newName == job.schemaName {
+				task.ddlID = job.id
+				(*ddlRecoverArg)(task.arg).id = job.schemaID
+				sortTasks = append(sortTasks, task)
+				break
+			}
+			// The job of EXCHANGE PARTITION is on the non-partitioned table.
+			if task.k == ddlExchangePartition && job.k == ddlExchangePartition {
+				nt := (*ddlPartitionJobArg)(task.arg).table
+				if nt.id == job.tableID || task.tblInfo.id == job.tableID {
+					task.ddlID = job.id
+					sortTasks = append(sortTasks, task)
+					break
+				}
+			}
+			// RENAME TABLE of more than one table is a "rename tables" job on
+			// one of the tables, or a "rename table" job per table, the
+			// task is ordered by the first one.
+			if task.k == ddlRenameTables && (job.k == ddlRenameTables || job.k == ddlRenameTable) && task.ddlID == 0 &&
+				(*ddlRenameTablesArg)(task.arg).hasTableID(job.tableID) {
+				task.ddlID = job.id
+				sortTasks = append(sortTasks, task)
+				break
+			}
+			if !task.isJobKind(ddlAddTable) && task.isJobKind(job.k) {
 				if task.tblInfo != nil && task.tblInfo.id == job.tableID {
 					task.ddlID = job.id
 					sortTasks = append(sortTasks, task)
@@ -1521,6 +2349,7 @@ func (c *testCase) getSortTask(db *sql.DB, tasks []*ddlJobTask) ([]*ddlJobTask,
 				} else if task.viewInfo != nil && task.viewInfo.id == job.tableID {
 					task.ddlID = job.id
 					sortTasks = append(sortTasks, task)
+					break
 				} else if task.schemaInfo != nil && task.schemaInfo.id == job.schemaID {
 					task.ddlID = job.id
 					sortTasks = append(sortTasks, task)
@@ -1543,13 +2372,12 @@ func (c *testCase) getSortTask(db *sql.DB, tasks []*ddlJobTask) ([]*ddlJobTask,
 		str += fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\n", "Job_ID", "DB_NAME", "TABLE_NAME", "JOB_TYPE", "SCHEMA_ID", "TABLE_ID")
 		for _, task := range tasks {
 			if task.tblInfo != nil {
-				// NOTE: currently all table or view operations only happened at initDB schema, but we don't know the initdb schema id, so
-				// here just print "_" as the schema id which means it is the initDB schema.
-				str += fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\n", task.ddlID, c.initDB, task.tblInfo.name, mapOfDDLKindToString[task.k], "_", task.tblInfo.id)
+				// The schema ID of a table or a view is unknown, so "_" is printed.
+				str += fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\n", task.ddlID, c.schemaName(task.tblInfo.schema), task.tblInfo.name, mapOfDDLKindToString[task.k], "_", task.tblInfo.id)
 			} else if task.schemaInfo != nil {
 				str += fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\n", task.ddlID, task.schemaInfo.name, "", mapOfDDLKindToString[task.k], task.schemaInfo.id, "")
 			} else if task.viewInfo != nil {
-				str += fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\n", task.ddlID, c.initDB, task.viewInfo.name, mapOfDDLKindToString[task.k], "_", task.viewInfo.id)
+				str += fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\n", task.ddlID, c.schemaName(task.viewInfo.schema), task.viewInfo.name, mapOfDDLKindToString[task.k], "_", task.viewInfo.id)
 			}
 		}
 
@@ -1557,11 +2385,11 @@ func (c *testCase) getSortTask(db *sql.DB, tasks []*ddlJobTask) ([]*ddlJobTask,
 		str += fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\n", "Job_ID", "DB_NAME", "TABLE_NAME", "JOB_TYPE", "SCHEMA_ID", "TABLE_ID")
 		for _, task := range sortTasks {
 			if task.tblInfo != nil {
-				str += fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\n", task.ddlID, c.initDB, task.tblInfo.name, mapOfDDLKindToString[task.k], "_", task.tblInfo.id)
+				str += fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\n", task.ddlID, c.schemaName(task.tblInfo.schema), task.tblInfo.name, mapOfDDLKindToString[task.k], "_", task.tblInfo.id)
 			} else if task.schemaInfo != nil {
 				str += fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\n", task.ddlID, task.schemaInfo.name, "", mapOfDDLKindToString[task.k], task.schemaInfo.id, "")
 			} else if task.viewInfo != nil {
-				str += fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\n", task.ddlID, c.initDB, task.viewInfo.name, mapOfDDLKindToString[task.k], "_", task.viewInfo.id)
+				str += fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\n", task.ddlID, c.schemaName(task.viewInfo.schema), task.viewInfo.name, mapOfDDLKindToString[task.k], "_", task.viewInfo.id)
 			}
 		}
 		return nil, fmt.Errorf(str)
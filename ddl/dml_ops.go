@@ -4,7 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"math/rand"
+	"sync/atomic"
+	"time"
 
 	"github.com/juju/errors"
 	"github.com/ngaut/log"
@@ -20,6 +21,9 @@ func (c *testCase) generateDMLOps() error {
 	if err := c.generateDelete(); err != nil {
 		return errors.Trace(err)
 	}
+	if err := c.generateInsertSelect(); err != nil {
+		return errors.Trace(err)
+	}
 	return nil
 }
 
@@ -69,33 +73,87 @@ func checkConflict(task *dmlJobTask) error {
 			}
 		}
 	}
+	if task.source != nil {
+		if task.source.isDeleted() {
+			return ddlTestErrorConflict{}
+		}
+		for _, column := range task.sourceColumns {
+			if column.isDeleted() || column.isRenamed() {
+				return ddlTestErrorConflict{}
+			}
+		}
+	}
 	return nil
 }
 
-func (c *testCase) sendDMLRequest(ctx context.Context, conn *sql.Conn, task *dmlJobTask) error {
-	_, err := conn.ExecContext(ctx, task.sql)
+// sendDMLRequest executes the task on `conn`, which is got from `c.dbs[dbIdx]`.
+// `txnID` is the transaction the task belongs to in the trace, 0 means none.
+func (c *testCase) sendDMLRequest(ctx context.Context, conn *sql.Conn, dbIdx int, txnID int64, task *dmlJobTask) error {
+	opStart := time.Now()
+	result, err := conn.ExecContext(ctx, task.sql)
+	if err == nil && task.allocatesAutoID {
+		task.lastInsertID, err = result.LastInsertId()
+	}
+	atomic.AddInt64(&c.dmlCount, 1)
+	c.trace.recordSQL(c.caseIndex, dbIdx, txnID, traceDML, task.sql, err)
 	task.err = err
 	log.Infof("[dml] [instance %d] %s, err: %v", c.caseIndex, task.sql, err)
 	if err != nil {
 		err2 := checkConflict(task)
+		// A concurrent ADD PRIMARY KEY or MODIFY COLUMN makes the columns NOT
+		// NULL as well, a concurrent ADD CONSTRAINT adds checks, and a
+		// concurrent MODIFY COLUMN changes the type of the values.
+		if class := classifyError(err); err2 == nil && (class == classDuplicateEntry || class == classConstraintViolated ||
+			class == classNoDefaultValue || conversionErrorCodes[mysqlErrorCode(err)]) && task.racesUniqueChange() {
+			err2 = ddlTestErrorConflict{}
+		}
+		if err2 == nil && classifyError(err) == classForeignKey && task.racesForeignKeyChange() {
+			err2 = ddlTestErrorConflict{}
+		}
 		if err2 != nil {
+			observeDML(task.k, opStart, err, true)
+			ignoreError("dml", dmlKindName(task.k), classDDLConflict, err)
 			return nil
 		}
+		observeDML(task.k, opStart, err, acceptableDMLError(task.k, c.cfg.TestTp, err))
 		return errors.Annotatef(err, "Error when executing SQL: %s\n%s", task.sql, task.tblInfo.debugPrintToString())
 	}
+	observeDML(task.k, opStart, nil, false)
 	return nil
 }
 
+// checkedByModel reports whether the DML error `err` is predicted by the
+// local model, which is checked by `execDMLInLocal`.
+func checkedByModel(err error) bool {
+	class := classifyError(err)
+	return class == classDuplicateEntry || class == classForeignKey || class == classConstraintViolated
+}
+
+// execDMLInLocal executes the task on the local model if it succeeds on the
+// server, i.e. `task.err` is nil. It returns an error if the model and the
+// server disagree on whether the task fails with a duplicate key, breaks a
+// foreign key or violates a constraint.
 func (c *testCase) execDMLInLocal(task *dmlJobTask) error {
+	var err error
 	switch task.k {
 	case dmlInsert:
-		return c.doInsertJob(task)
+		err = c.doInsertJob(task)
 	case dmlUpdate:
-		return c.doUpdateJob(task)
+		err = c.doUpdateJob(task)
 	case dmlDelete:
-		return c.doDeleteJob(task)
+		err = c.doDeleteJob(task)
+	case dmlInsertSelect:
+		err = c.doInsertSelectJob(task)
+	default:
+		return fmt.Errorf("unknow dml task , %v", *task)
 	}
-	return fmt.Errorf("unknow dml task , %v", *task)
+	if expectedErrorCode(err) != 0 {
+		return checkExpectedError(err, task.err)
+	}
+	if err == nil && task.err != nil {
+		return fmt.Errorf("unexpected error: %v", task.err)
+	}
+	return err
 }
 
 // execSerialDMLSQL gets a job from taskCh, and then executes the job.
@@ -104,7 +162,7 @@ func (c *testCase) execSerialDMLSQL(taskCh chan *dmlJobTask) error {
 		return nil
 	}
 	ctx := context.Background()
-	dbIdx := rand.Intn(len(c.dbs))
+	dbIdx := c.dmlRand.Intn(len(c.dbs))
 	db := c.dbs[dbIdx]
 	conn, err := db.Conn(ctx)
 	if err != nil {
@@ -112,14 +170,17 @@ func (c *testCase) execSerialDMLSQL(taskCh chan *dmlJobTask) error {
 	}
 	defer conn.Close()
 	task := <-taskCh
-	err = c.sendDMLRequest(ctx, conn, task)
+	err = c.sendDMLRequest(ctx, conn, dbIdx, 0, task)
 	if err != nil {
-		if dmlIgnoreError(err) {
+		if dmlIgnoreError(task.k, c.cfg.TestTp, err) {
 			return nil
 		}
-		return errors.Trace(err)
-	}
-	if task.err != nil {
+		// A duplicate key error, a foreign key error or a constraint
+		// violation is checked by the local model.
+		if !checkedByModel(err) {
+			return errors.Trace(err)
+		}
+	} else if task.err != nil {
 		return nil
 	}
 	err = c.execDMLInLocal(task)
@@ -140,23 +201,32 @@ func (c *testCase) execDMLInTransactionSQL(taskCh chan *dmlJobTask) error {
 	}
 	defer conn.Close()
 
+	txnID := nextTxnID()
 	_, err = conn.ExecContext(ctx, "begin")
+	c.trace.recordSQL(c.caseIndex, 1, txnID, traceBegin, "begin", err)
 	log.Infof("[dml] [instance %d] begin error: %v", c.caseIndex, err)
 	if err != nil {
 		return errors.Annotatef(err, "Error when executing SQL: %s", "begin")
 	}
 
 	tasks := make([]*dmlJobTask, 0, tasksLen)
+	// checked marks the tasks whose results are checked by the local model,
+	// i.e. the succeeded ones and the ones failed with the errors predicted
+	// by the model, see `checkedByModel`.
+	checked := make([]bool, 0, tasksLen)
 	for i := 0; i < tasksLen; i++ {
 		task := <-taskCh
-		err = c.sendDMLRequest(ctx, conn, task)
+		err = c.sendDMLRequest(ctx, conn, 1, txnID, task)
 		tasks = append(tasks, task)
+		checked = append(checked, task.err == nil ||
+			err != nil && checkedByModel(err) && !acceptableDMLError(task.k, c.cfg.TestTp, err))
 	}
 
 	_, err = conn.ExecContext(ctx, "commit")
+	c.trace.recordSQL(c.caseIndex, 1, txnID, traceCommit, "commit", err)
 	log.Infof("[dml] [instance %d] commit error: %v", c.caseIndex, err)
 	if err != nil {
-		if dmlIgnoreError(err) {
+		if dmlIgnoreError(dmlKindNil, c.cfg.TestTp, err) {
 			return nil
 		}
 		for i := 0; i < tasksLen; i++ {
@@ -171,7 +241,7 @@ func (c *testCase) execDMLInTransactionSQL(taskCh chan *dmlJobTask) error {
 
 	for i := 0; i < tasksLen; i++ {
 		task := tasks[i]
-		if task.err != nil {
+		if !checked[i] {
 			continue
 		}
 		err = c.execDMLInLocal(task)
@@ -182,7 +252,7 @@ func (c *testCase) execDMLInTransactionSQL(taskCh chan *dmlJobTask) error {
 	return nil
 }
 
-const dmlSizeEachRound = 1
+var dmlSizeEachRound = 1
 
 func (c *testCase) generateInsert() error {
 	for i := 0; i < dmlSizeEachRound; i++ {
@@ -212,7 +282,7 @@ func (c *testCase) generateInsert() error {
 func (c *testCase) prepareInsert(cfg interface{}, taskCh chan *dmlJobTask) error {
 	c.tablesLock.Lock()
 	defer c.tablesLock.Unlock()
-	table := c.pickupRandomTable()
+	table := c.pickupRandomTable(c.dmlRand)
 	if table == nil {
 		return nil
 	}
@@ -227,8 +297,11 @@ func (c *testCase) prepareInsert(cfg interface{}, taskCh chan *dmlJobTask) error
 	assigns := make([]*ddlTestColumnDescriptor, 0)
 	for _, column := range columns {
 		pick := false
-		if column.isPrimaryKey {
-			// PrimaryKey Column is always assigned values
+		if column.isAutoID() {
+			// The auto ID is allocated by the server.
+			pick = false
+		} else if column.isPrimaryKey || column.notNull {
+			// PrimaryKey and NOT NULL Column is always assigned values
 			pick = true
 		} else {
 			// NonPrimaryKey Column is assigned by strategy
@@ -238,7 +311,7 @@ func (c *testCase) prepareInsert(cfg interface{}, taskCh chan *dmlJobTask) error
 			case ddlTestInsertColumnStrategyZeroNonPk:
 				pick = false
 			case ddlTestInsertColumnStrategyRandomNonPk:
-				if rand.Float64() <= float64(1)/float64(len(nonPkColumns)) {
+				if c.dmlRand.Float64() <= float64(1)/float64(len(nonPkColumns)) {
 					pick = true
 				}
 			}
@@ -246,16 +319,30 @@ func (c *testCase) prepareInsert(cfg interface{}, taskCh chan *dmlJobTask) error
 		if pick {
 			// check unique value when inserting into a column of primary key
 			if column.isPrimaryKey {
-				if newValue, ok := column.randValueUnique(column.rows); ok {
+				if newValue, ok := table.randValueUnique(c.dmlRand, column); ok {
 					assigns = append(assigns, &ddlTestColumnDescriptor{column, newValue})
 				} else {
 					return nil
 				}
+			} else if table.canBeNull(column) && c.dmlRand.Float64() < NullValueProbability {
+				assigns = append(assigns, &ddlTestColumnDescriptor{column, ddlTestValueNull})
+			} else {
+				assigns = append(assigns, &ddlTestColumnDescriptor{column, table.randColumnValue(c.dmlRand, column)})
+			}
+		}
+	}
+
+	// Reuse the unique key of an existing row sometimes, which should fail.
+	if c.dmlRand.Float64() < DuplicateKeyProbability {
+		for _, dup := range table.pickupDuplicateKey(c.dmlRand) {
+			if cd := dup.column.getMatchedColumnDescriptor(assigns); cd != nil {
+				cd.value = dup.value
 			} else {
-				assigns = append(assigns, &ddlTestColumnDescriptor{column, column.randValue()})
+				assigns = append(assigns, dup)
 			}
 		}
 	}
+	assigns = table.pickupReferencedValues(c.dmlRand, assigns, true)
 
 	// build SQL
 	sql := ""
@@ -263,8 +350,8 @@ func (c *testCase) prepareInsert(cfg interface{}, taskCh chan *dmlJobTask) error
 		if len(assigns) == 0 {
 			return nil
 		}
-		sql = fmt.Sprintf("INSERT INTO `%s` SET ", table.name)
-		perm := rand.Perm(len(assigns))
+		sql = fmt.Sprintf("INSERT INTO %s SET ", table.quotedName())
+		perm := c.dmlRand.Perm(len(assigns))
 		for i, idx := range perm {
 			assign := assigns[idx]
 			if i > 0 {
@@ -273,7 +360,7 @@ func (c *testCase) prepareInsert(cfg interface{}, taskCh chan *dmlJobTask) error
 			sql += fmt.Sprintf("`%s` = %v", assign.column.name, assign.getValueString())
 		}
 	} else {
-		sql = fmt.Sprintf("INSERT INTO `%s` VALUE (", table.name)
+		sql = fmt.Sprintf("INSERT INTO %s VALUE (", table.quotedName())
 		for colIdx, column := range columns {
 			if colIdx > 0 {
 				sql += ", "
@@ -281,6 +368,13 @@ func (c *testCase) prepareInsert(cfg interface{}, taskCh chan *dmlJobTask) error
 			cd := column.getMatchedColumnDescriptor(assigns)
 			if cd != nil {
 				sql += fmt.Sprintf("%v", cd.getValueString())
+			} else if column.isAutoID() {
+				// Both NULL and DEFAULT allocate an ID.
+				if c.dmlRand.Intn(2) == 0 {
+					sql += "NULL"
+				} else {
+					sql += "DEFAULT"
+				}
 			} else {
 				var missingValueSQL string
 				switch config.missingValueStrategy {
@@ -289,7 +383,7 @@ func (c *testCase) prepareInsert(cfg interface{}, taskCh chan *dmlJobTask) error
 				case ddlTestInsertMissingValueStrategyAllNull:
 					missingValueSQL = "NULL"
 				case ddlTestInsertMissingValueStrategyRandom:
-					if rand.Float64() <= 0.5 {
+					if c.dmlRand.Float64() <= 0.5 {
 						missingValueSQL = "DEFAULT"
 					} else {
 						missingValueSQL = "NULL"
@@ -311,11 +405,17 @@ func (c *testCase) prepareInsert(cfg interface{}, taskCh chan *dmlJobTask) error
 		sql += ")"
 	}
 
+	autoIDColumn := table.autoIDColumn()
 	task := &dmlJobTask{
-		k:       dmlInsert,
-		sql:     sql,
-		tblInfo: table,
-		assigns: assigns,
+		k:               dmlInsert,
+		sql:             sql,
+		tblInfo:         table,
+		assigns:         assigns,
+		uniqueEpoch:     table.loadUniqueEpoch(),
+		fkEpochs:        c.foreignKeyEpochs(table),
+		allocatesAutoID: autoIDColumn != nil && autoIDColumn.getMatchedColumnDescriptor(assigns) == nil,
+		autoIDBase:      table.autoIncID,
+		autoIDShardBits: table.autoIDShardBits(),
 	}
 	taskCh <- task
 	return nil
@@ -325,29 +425,55 @@ func (c *testCase) doInsertJob(task *dmlJobTask) error {
 	table := task.tblInfo
 	assigns := task.assigns
 
-	// append row
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
 	table.lock.Lock()
+	defer table.lock.Unlock()
+	row := make([]interface{}, 0, table.columns.Size())
 	for ite := table.columns.Iterator(); ite.Next(); {
 		column := ite.Value().(*ddlTestColumn)
 		cd := column.getMatchedColumnDescriptor(assigns)
-		if cd == nil {
+		if cd == nil && column.isAutoID() {
+			// The ID is unknown if the task fails.
+			if task.err == nil {
+				row = append(row, task.lastInsertID)
+			} else {
+				row = append(row, nil)
+			}
+		} else if cd == nil {
 			if column.isGenerated() {
 				cd = column.dependency.getMatchedColumnDescriptor(assigns)
 				if cd == nil {
-					column.rows.Add(nil)
+					row = append(row, nil)
 				} else {
-					column.rows.Add(cd.column.getDependenciedColsValue(column))
+					row = append(row, cd.column.getDependenciedColsValue(column))
 				}
 			} else {
 				// only happens when using SET
-				column.rows.Add(column.defaultValue)
+				row = append(row, column.defaultValue)
 			}
 		} else {
-			column.rows.Add(cd.value)
+			row = append(row, cd.value)
+		}
+	}
+	rows := [][]interface{}{row}
+	err := c.predictDuplicate(task, nil, rows)
+	if err == nil && task.allocatesAutoID && mysqlErrorCode(task.err) == errCodeDupEntry {
+		// The allocated ID may duplicate the ID of a row exchanged from
+		// another table.
+		err = expectError(errCodeDupEntry, "the auto ID of table %s may be duplicated", table.name)
+	}
+	err = chooseExpectedError(task.err, err, task.predictNoReferencedRow(rows), task.predictConstraintViolation(rows))
+	if err != nil || task.err != nil {
+		return err
+	}
+	if task.allocatesAutoID {
+		if err := table.checkAutoID(task); err != nil {
+			return err
 		}
 	}
-	table.numberOfRows++
-	table.lock.Unlock()
+	// append row
+	table.addRows([][]interface{}{row})
 	return nil
 }
 
@@ -396,8 +522,8 @@ func (c *testCase) buildWhereColumns(whereStrategy ddlTestWhereStrategy, pkColum
 	whereColumns := make([]*ddlTestColumnDescriptor, 0)
 	if whereStrategy == ddlTestWhereStrategyRandomInPk || whereStrategy == ddlTestWhereStrategyRandomMixed {
 		if len(pkColumns) > 0 {
-			picks := rand.Intn(len(pkColumns))
-			perm := rand.Perm(picks)
+			picks := c.dmlRand.Intn(len(pkColumns))
+			perm := c.dmlRand.Perm(picks)
 			for _, idx := range perm {
 				// value will be filled later
 				whereColumns = append(whereColumns, &ddlTestColumnDescriptor{pkColumns[idx], -1})
@@ -406,8 +532,8 @@ func (c *testCase) buildWhereColumns(whereStrategy ddlTestWhereStrategy, pkColum
 	}
 	if whereStrategy == ddlTestWhereStrategyRandomInNonPk || whereStrategy == ddlTestWhereStrategyRandomMixed {
 		if len(nonPkColumns) > 0 {
-			picks := rand.Intn(len(nonPkColumns))
-			perm := rand.Perm(picks)
+			picks := c.dmlRand.Intn(len(nonPkColumns))
+			perm := c.dmlRand.Perm(picks)
 			for _, idx := range perm {
 				// value will be filled later
 				whereColumns = append(whereColumns, &ddlTestColumnDescriptor{nonPkColumns[idx], -1})
@@ -417,7 +543,7 @@ func (c *testCase) buildWhereColumns(whereStrategy ddlTestWhereStrategy, pkColum
 
 	// fill values of where statements
 	if len(whereColumns) > 0 {
-		rowToUpdate := rand.Intn(numberOfRows)
+		rowToUpdate := c.dmlRand.Intn(numberOfRows)
 		for _, cd := range whereColumns {
 			cd.value = getRowFromArrayList(cd.column.rows, rowToUpdate)
 		}
@@ -429,7 +555,7 @@ func (c *testCase) buildWhereColumns(whereStrategy ddlTestWhereStrategy, pkColum
 func (c *testCase) prepareUpdate(cfg interface{}, taskCh chan *dmlJobTask) error {
 	c.tablesLock.Lock()
 	defer c.tablesLock.Unlock()
-	table := c.pickupRandomTable()
+	table := c.pickupRandomTable(c.dmlRand)
 	if table == nil {
 		return nil
 	}
@@ -454,7 +580,7 @@ func (c *testCase) prepareUpdate(cfg interface{}, taskCh chan *dmlJobTask) error
 	switch config.targetStrategy {
 	case ddlTestUpdateTargetStrategyRandom:
 		if len(nonPkColumnsAndNotGen) > 0 {
-			picks = rand.Intn(len(nonPkColumnsAndNotGen))
+			picks = c.dmlRand.Intn(len(nonPkColumnsAndNotGen))
 		}
 	case ddlTestUpdateTargetStrategyAllColumns:
 		picks = len(nonPkColumnsAndNotGen)
@@ -462,13 +588,19 @@ func (c *testCase) prepareUpdate(cfg interface{}, taskCh chan *dmlJobTask) error
 	if picks == 0 {
 		return nil
 	}
-	perm := rand.Perm(picks)
+	perm := c.dmlRand.Perm(picks)
 	for _, idx := range perm {
-		assigns = append(assigns, &ddlTestColumnDescriptor{nonPkColumnsAndNotGen[idx], nonPkColumnsAndNotGen[idx].randValue()})
+		column := nonPkColumnsAndNotGen[idx]
+		if table.canBeNull(column) && c.dmlRand.Float64() < NullValueProbability {
+			assigns = append(assigns, &ddlTestColumnDescriptor{column, ddlTestValueNull})
+		} else {
+			assigns = append(assigns, &ddlTestColumnDescriptor{column, table.randColumnValue(c.dmlRand, column)})
+		}
 	}
+	assigns = table.pickupReferencedValues(c.dmlRand, assigns, false)
 
 	// build SQL
-	sql := fmt.Sprintf("UPDATE `%s` SET ", table.name)
+	sql := fmt.Sprintf("UPDATE %s SET ", table.quotedName())
 	for i, cd := range assigns {
 		if i > 0 {
 			sql += ", "
@@ -491,6 +623,8 @@ func (c *testCase) prepareUpdate(cfg interface{}, taskCh chan *dmlJobTask) error
 		sql:          sql,
 		assigns:      assigns,
 		whereColumns: whereColumns,
+		uniqueEpoch:  table.loadUniqueEpoch(),
+		fkEpochs:     c.foreignKeyEpochs(table),
 	}
 
 	taskCh <- task
@@ -502,8 +636,11 @@ func (c *testCase) doUpdateJob(task *dmlJobTask) error {
 	assigns := task.assigns
 	whereColumns := task.whereColumns
 
-	// update values
-	table.lock.RLock()
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	changed := make(map[int][]interface{})
 	for i := 0; i < table.numberOfRows; i++ {
 		match := true
 		for _, cd := range whereColumns {
@@ -514,17 +651,42 @@ func (c *testCase) doUpdateJob(task *dmlJobTask) error {
 			}
 		}
 		if match {
+			row := table.getRow(i)
+			// The columns may be dropped by a concurrent DDL.
+			set := func(col *ddlTestColumn, value interface{}) {
+				if pos := table.columns.IndexOf(col); pos >= 0 {
+					row[pos] = value
+				}
+			}
 			for _, cd := range assigns {
-				cd.column.rows.Set(i, cd.value)
-				if cd.column.hasGenerateCol() {
-					for _, col := range cd.column.dependenciedCols {
-						cd.column.rows.Set(i, cd.column.getDependenciedColsValue(col))
-					}
+				set(cd.column, cd.value)
+				for _, col := range cd.column.dependenciedCols {
+					set(col, cd.column.getDependenciedColsValue(col))
 				}
 			}
+			changed[i] = row
 		}
 	}
-	table.lock.RUnlock()
+	changes, err := c.referentialActions(task, changed, nil)
+	rows := make([][]interface{}, 0, len(changed))
+	for _, row := range changed {
+		rows = append(rows, row)
+	}
+	err = chooseExpectedError(task.err, c.predictDuplicate(task, changed, nil), err, task.predictNoReferencedRow(rows),
+		task.predictConstraintViolation(rows))
+	if err != nil || task.err != nil {
+		return err
+	}
+
+	// update values
+	for i, row := range changed {
+		for j, value := range row {
+			getColumnFromArrayList(table.columns, j).rows.Set(i, value)
+		}
+	}
+	for _, change := range changes {
+		change.apply()
+	}
 	return nil
 
 }
@@ -548,7 +710,7 @@ func (c *testCase) generateDelete() error {
 func (c *testCase) prepareDelete(cfg interface{}, taskCh chan *dmlJobTask) error {
 	c.tablesLock.Lock()
 	defer c.tablesLock.Unlock()
-	table := c.pickupRandomTable()
+	table := c.pickupRandomTable(c.dmlRand)
 	if table == nil {
 		return nil
 	}
@@ -565,7 +727,7 @@ func (c *testCase) prepareDelete(cfg interface{}, taskCh chan *dmlJobTask) error
 	whereColumns := c.buildWhereColumns(config.whereStrategy, pkColumns, nonPkColumnsAndCanBeWhere, table.numberOfRows)
 
 	// build SQL
-	sql := fmt.Sprintf("DELETE FROM `%s`", table.name)
+	sql := fmt.Sprintf("DELETE FROM %s", table.quotedName())
 	if len(whereColumns) > 0 {
 		sql += " WHERE "
 		for i, cd := range whereColumns {
@@ -581,6 +743,8 @@ func (c *testCase) prepareDelete(cfg interface{}, taskCh chan *dmlJobTask) error
 		tblInfo:      table,
 		sql:          sql,
 		whereColumns: whereColumns,
+		uniqueEpoch:  table.loadUniqueEpoch(),
+		fkEpochs:     c.foreignKeyEpochs(table),
 	}
 	taskCh <- task
 	return nil
@@ -590,9 +754,12 @@ func (c *testCase) doDeleteJob(task *dmlJobTask) error {
 	table := task.tblInfo
 	whereColumns := task.whereColumns
 
-	// update values
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
 	table.lock.Lock()
-	for i := table.numberOfRows - 1; i >= 0; i-- {
+	defer table.lock.Unlock()
+	deleted := make(map[int]bool)
+	for i := 0; i < table.numberOfRows; i++ {
 		match := true
 		for _, cd := range whereColumns {
 			row := getRowFromArrayList(cd.column.rows, i)
@@ -602,14 +769,18 @@ func (c *testCase) doDeleteJob(task *dmlJobTask) error {
 			}
 		}
 		if match {
-			// we must use `table.columns` here, since there might be new columns after deletion
-			for ite := table.columns.Iterator(); ite.Next(); {
-				column := ite.Value().(*ddlTestColumn)
-				column.rows.Remove(i)
-			}
-			table.numberOfRows--
+			deleted[i] = true
 		}
 	}
-	table.lock.Unlock()
+	changes, err := c.referentialActions(task, nil, deleted)
+	if err != nil || task.err != nil {
+		return err
+	}
+
+	// update values
+	table.removeRows(func(i int) bool { return deleted[i] })
+	for _, change := range changes {
+		change.apply()
+	}
 	return nil
 }
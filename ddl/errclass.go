@@ -0,0 +1,511 @@
+package ddl
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+)
+
+// The built-in error classes.
+const (
+	classSchemaChanged         = "schema-changed"
+	classRetryable             = "retryable"
+	classConnection            = "connection"
+	classUnknownObject         = "unknown-object"
+	classDuplicateEntry        = "duplicate-entry"
+	classAutoIDExhausted       = "auto-id-exhausted"
+	classAutoIDOverflow        = "auto-id-overflow"
+	classUnsupportedShardRowID = "unsupported-shard-row-id"
+	classDataTruncated         = "data-truncated"
+	classNoDefaultValue        = "no-default-value"
+	classColumnSpecifiedTwice  = "column-specified-twice"
+	classDriverConversion      = "driver-conversion"
+	classNoRows                = "no-rows"
+	classDDLJobsMismatch       = "ddl-jobs-mismatch"
+	classModelConflict         = "model-conflict"
+	classNoPartition           = "no-partition"
+	classForeignKey            = "foreign-key"
+	classConstraintViolated    = "constraint-violated"
+	classNoMultiSchemaChange   = "no-multi-schema-change"
+	classNoExpressionIndex     = "no-expression-index"
+	classNoGCSafePoint         = "no-gc-safe-point"
+
+	// classDDLConflict is the class of the DML errors caused by a concurrent
+	// DDL, which are found by `checkConflict` instead of the registry.
+	classDDLConflict = "ddl-conflict"
+)
+
+// The MySQL error codes predicted by the local model, see `expectError`.
+const (
+	errCodeDBCreateExists             uint16 = 1007 // ER_DB_CREATE_EXISTS
+	errCodeDBDropExists               uint16 = 1008 // ER_DB_DROP_EXISTS
+	errCodeBadDB                      uint16 = 1049 // ER_BAD_DB_ERROR
+	errCodeTableExists                uint16 = 1050 // ER_TABLE_EXISTS_ERROR
+	errCodeBadTable                   uint16 = 1051 // ER_BAD_TABLE_ERROR
+	errCodeBadField                   uint16 = 1054 // ER_BAD_FIELD_ERROR
+	errCodeDupKeyName                 uint16 = 1061 // ER_DUP_KEYNAME
+	errCodeKeyColumnNotExists         uint16 = 1072 // ER_KEY_COLUMN_DOES_NOT_EXITS
+	errCodeBadNull                    uint16 = 1048 // ER_BAD_NULL_ERROR
+	errCodeDupEntry                   uint16 = 1062 // ER_DUP_ENTRY
+	errCodeParseError                 uint16 = 1064 // ER_PARSE_ERROR
+	errCodeMultiplePriKey             uint16 = 1068 // ER_MULTIPLE_PRI_KEY
+	errCodeWrongAutoKey               uint16 = 1075 // ER_WRONG_AUTO_KEY
+	errCodeCantDropFieldOrKey         uint16 = 1091 // ER_CANT_DROP_FIELD_OR_KEY
+	errCodeNoSuchTable                uint16 = 1146 // ER_NO_SUCH_TABLE
+	errCodeInvalidUseOfNull           uint16 = 1138 // ER_INVALID_USE_OF_NULL
+	errCodePrimaryCantHaveNull        uint16 = 1171 // ER_PRIMARY_CANT_HAVE_NULL
+	errCodeKeyDoesNotExist            uint16 = 1176 // ER_KEY_DOES_NOT_EXITS
+	errCodeUnknownSystemVariable      uint16 = 1193 // ER_UNKNOWN_SYSTEM_VARIABLE
+	errCodeViewInvalid                uint16 = 1356 // ER_VIEW_INVALID
+	errCodeRowIsReferenced            uint16 = 1451 // ER_ROW_IS_REFERENCED_2
+	errCodeNoReferencedRow            uint16 = 1452 // ER_NO_REFERENCED_ROW_2
+	errCodePartitionMaxValue          uint16 = 1481 // ER_PARTITION_MAXVALUE_ERROR
+	errCodeRangeNotIncreasing         uint16 = 1493 // ER_RANGE_NOT_INCREASING_ERROR
+	errCodeMultipleDefConstInList     uint16 = 1495 // ER_MULTIPLE_DEF_CONST_IN_LIST_PART_ERROR
+	errCodeDropPartitionNonExistent   uint16 = 1507 // ER_DROP_PARTITION_NON_EXISTENT
+	errCodeUniqueKeyNeedAllFields     uint16 = 1503 // ER_UNIQUE_KEY_NEED_ALL_FIELDS_IN_PF
+	errCodeDropLastPartition          uint16 = 1508 // ER_DROP_LAST_PARTITION
+	errCodeSameNamePartition          uint16 = 1517 // ER_SAME_NAME_PARTITION
+	errCodeNoPartitionForValue        uint16 = 1526 // ER_NO_PARTITION_FOR_GIVEN_VALUE
+	errCodeDropIndexFK                uint16 = 1553 // ER_DROP_INDEX_FK
+	errCodeTruncateIllegalFK          uint16 = 1701 // ER_TRUNCATE_ILLEGAL_FK
+	errCodeUnknownPartition           uint16 = 1735 // ER_UNKNOWN_PARTITION
+	errCodeTablesDifferentMetadata    uint16 = 1736 // ER_TABLES_DIFFERENT_METADATA
+	errCodeRowDoesNotMatchPartition   uint16 = 1737 // ER_ROW_DOES_NOT_MATCH_PARTITION
+	errCodePartitionExchangeFK        uint16 = 1740 // ER_PARTITION_EXCHANGE_FOREIGN_KEY
+	errCodeFKNoIndexParent            uint16 = 1822 // ER_FK_NO_INDEX_PARENT
+	errCodeFKCannotOpenParent         uint16 = 1824 // ER_FK_CANNOT_OPEN_PARENT
+	errCodeFKColumnCannotDrop         uint16 = 1828 // ER_FK_COLUMN_CANNOT_DROP
+	errCodeFKColumnCannotDropChild    uint16 = 1829 // ER_FK_COLUMN_CANNOT_DROP_CHILD
+	errCodeFKColumnNotNull            uint16 = 1830 // ER_FK_COLUMN_NOT_NULL
+	errCodePKIndexCantBeInvisible     uint16 = 3522 // ER_PK_INDEX_CANT_BE_INVISIBLE
+	errCodeFKCannotDropParent         uint16 = 3730 // ER_FK_CANNOT_DROP_PARENT
+	errCodeFKNoColumnParent           uint16 = 3734 // ER_FK_NO_COLUMN_PARENT
+	errCodeFunctionNotAllowedInIndex  uint16 = 3755 // ER_FUNCTIONAL_INDEX_FUNCTION_IS_NOT_ALLOWED
+	errCodeFKIncompatibleColumns      uint16 = 3780 // ER_FK_INCOMPATIBLE_COLUMNS
+	errCodeCheckViolated              uint16 = 3819 // ER_CHECK_CONSTRAINT_VIOLATED
+	errCodeDependentByFunctionalIndex uint16 = 3837 // ER_DEPENDENT_BY_FUNCTIONAL_INDEX
+	errCodeConstraintNotFound         uint16 = 3940 // ER_CONSTRAINT_NOT_FOUND
+	errCodeDependentByCheck           uint16 = 3959 // ER_DEPENDENT_BY_CHECK_CONSTRAINT
+	errCodeUnsupportedDDLOperation    uint16 = 8200 // ErrUnsupportedDDLOperation of TiDB
+)
+
+// errorClassDef defines an error class by MySQL error codes. The message
+// patterns only match the errors without a MySQL error code, like the ones of
+// the driver or the local model, and the ones whose code tells nothing, see
+// `unspecificErrorCodes`.
+type errorClassDef struct {
+	codes    []uint16
+	messages []*regexp.Regexp
+}
+
+// unspecificErrorCodes are the codes shared by many different errors, the
+// errors with them are classified by message.
+var unspecificErrorCodes = map[uint16]struct{}{
+	1105: {}, // ER_UNKNOWN_ERROR
+	8200: {}, // ErrUnsupportedDDLOperation of TiDB
+}
+
+var errorClasses = map[string]*errorClassDef{}
+
+// classOfErrorCode maps a MySQL error code to the only class it belongs to.
+var classOfErrorCode = map[uint16]string{}
+
+func init() {
+	for _, def := range []struct {
+		name     string
+		codes    []uint16
+		messages []string
+	}{
+		{classSchemaChanged, []uint16{8027, 8028}, []string{`Information schema is changed`, `Information schema is out of date`}},
+		{classRetryable, []uint16{8005, 8022, 9007}, []string{`try again later`}},
+		{classConnection, nil, []string{`invalid connection`, `bad connection`}},
+		{classUnknownObject, []uint16{errCodeDBDropExists, errCodeBadDB, errCodeBadTable, errCodeBadField, errCodeKeyColumnNotExists,
+			errCodeCantDropFieldOrKey, errCodeNoSuchTable, errCodeKeyDoesNotExist, errCodeDropPartitionNonExistent,
+			errCodeUnknownPartition}, []string{`Can't find column`, `column does not exist`}},
+		{classDuplicateEntry, []uint16{errCodeDupEntry}, nil},
+		{classAutoIDExhausted, []uint16{1467}, []string{`Failed to read auto-increment value from storage engine`}},
+		// Sometimes, set shard row id bits to a large value might cause global auto ID overflow error.
+		{classAutoIDOverflow, nil, []string{`cause next global auto ID( \d+ | )overflow`}},
+		{classUnsupportedShardRowID, nil, []string{`(?i)unsupported shard_row_id_bits for table with primary key as row id`}},
+		{classDataTruncated, []uint16{1264, 1265, 1406}, nil},
+		{classNoDefaultValue, []uint16{1364}, nil},
+		{classColumnSpecifiedTwice, []uint16{1110}, nil},
+		{classDriverConversion, nil, []string{`converting driver\.Value type`}},
+		// A row whose partitioning column isn't accepted by any partition.
+		{classNoPartition, []uint16{errCodeNoPartitionForValue}, nil},
+		// A DML breaking a foreign key, see `referentialActions`.
+		{classForeignKey, []uint16{errCodeRowIsReferenced, errCodeNoReferencedRow}, nil},
+		// A DML setting a NOT NULL column to NULL or violating a check, see
+		// `predictConstraintViolation`.
+		{classConstraintViolated, []uint16{errCodeBadNull, errCodeCheckViolated}, nil},
+		// TiDB before v6.2 only changes one column or index by ALTER TABLE.
+		{classNoMultiSchemaChange, nil, []string{`(?i)unsupported multi schema change`}},
+		// The servers that don't support the expression indexes, or the
+		// function in one.
+		{classNoExpressionIndex, []uint16{errCodeFunctionNotAllowedInIndex}, []string{`(?i)unsupported expression index`}},
+		// TiDB doesn't recover a table before the first GC sets the safe point.
+		{classNoGCSafePoint, nil, []string{`(?i)can not get 'tikv_gc_safe_point'`}},
+		{classNoRows, nil, []string{`no rows in result set`}},
+		{classDDLJobsMismatch, nil, []string{`^admin show ddl jobs len != len\(tasks\)`}},
+		// The errors of the local model when it conflicts with a concurrent DDL,
+		// see the `*Job` functions.
+		{classModelConflict, nil, []string{`is not exists\s*$`, `^schema \S+ doesn't exist$`, `column is deleted$`, `column has index reference$`}},
+	} {
+		if err := registerErrorClass(def.name, def.codes, def.messages); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// registerErrorClass adds the MySQL error codes and the message patterns to
+// the class `name`, the class is created if it doesn't exist. A code can only
+// belong to one class.
+func registerErrorClass(name string, codes []uint16, messages []string) error {
+	if name == "" {
+		return fmt.Errorf("empty error class name")
+	}
+	patterns := make([]*regexp.Regexp, 0, len(messages))
+	for _, message := range messages {
+		pattern, err := regexp.Compile(message)
+		if err != nil {
+			return fmt.Errorf("invalid message pattern %q of error class %s: %v", message, name, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	for _, code := range codes {
+		if class, ok := classOfErrorCode[code]; ok && class != name {
+			return fmt.Errorf("error code %d of error class %s already belongs to error class %s", code, name, class)
+		}
+		if _, ok := unspecificErrorCodes[code]; ok {
+			return fmt.Errorf("error code %d of error class %s is shared by many errors, use message patterns instead", code, name)
+		}
+	}
+	def, ok := errorClasses[name]
+	if !ok {
+		def = &errorClassDef{}
+		errorClasses[name] = def
+	}
+	for _, code := range codes {
+		classOfErrorCode[code] = name
+	}
+	def.codes = append(def.codes, codes...)
+	def.messages = append(def.messages, patterns...)
+	return nil
+}
+
+// mysqlErrorCode returns the MySQL error code of `err`, or 0 if it has none.
+func mysqlErrorCode(err error) uint16 {
+	if mysqlErr, ok := errors.Cause(err).(*mysql.MySQLError); ok {
+		return mysqlErr.Number
+	}
+	return 0
+}
+
+// expectedErrorCode returns the MySQL error code predicted by the local error
+// `err`, or 0 if it predicts nothing.
+func expectedErrorCode(err error) uint16 {
+	if expected, ok := errors.Cause(err).(ddlExpectedError); ok {
+		return expected.code
+	}
+	return 0
+}
+
+// isUnknownResult reports whether the local error `err` leaves the result of
+// the DDL to the server, see `ddlUnknownResult`.
+func isUnknownResult(err error) bool {
+	_, ok := errors.Cause(err).(ddlUnknownResult)
+	return ok
+}
+
+// checkExpectedError returns an error if the local error predicts a MySQL
+// error code, but the remote error has a different one.
+func checkExpectedError(local, remote error) error {
+	code := expectedErrorCode(local)
+	if code == 0 || mysqlErrorCode(remote) == code {
+		return nil
+	}
+	return fmt.Errorf("expected error %d (%v), but got: %v", code, local, remote)
+}
+
+// chooseExpectedError returns the one of the local errors `errs` that
+// predicts the MySQL error code of the remote error, or the first non-nil one.
+// A statement breaking more than one constraint fails with any of the errors.
+func chooseExpectedError(remote error, errs ...error) error {
+	var first error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if code := expectedErrorCode(err); code != 0 && code == mysqlErrorCode(remote) {
+			return err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// classifyError returns the class of `err`, or "" if it belongs to no class.
+func classifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+	if code := mysqlErrorCode(err); code != 0 {
+		if _, ok := unspecificErrorCodes[code]; !ok {
+			return classOfErrorCode[code]
+		}
+	}
+	names := make([]string, 0, len(errorClasses))
+	for name := range errorClasses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errStr := err.Error()
+	for _, name := range names {
+		for _, pattern := range errorClasses[name].messages {
+			if pattern.MatchString(errStr) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// acceptCondition is the condition under which an error class is acceptable.
+type acceptCondition int
+
+const (
+	acceptAlways acceptCondition = iota
+	// acceptInParallel accepts the class only in the parallel DDL test, where
+	// the DDLs run concurrently with each other and the local model may lag.
+	acceptInParallel
+)
+
+// acceptableErrors maps the acceptable error classes to their conditions.
+type acceptableErrors map[string]acceptCondition
+
+func (a acceptableErrors) accept(class string, tp DDLTestType) bool {
+	cond, ok := a[class]
+	if !ok {
+		return false
+	}
+	return cond == acceptAlways || tp == ParallelDDLTest
+}
+
+var (
+	// ddlCommonAcceptableErrors are acceptable for all kinds of DDL.
+	ddlCommonAcceptableErrors = acceptableErrors{
+		classSchemaChanged:    acceptAlways,
+		classConnection:       acceptAlways,
+		classDriverConversion: acceptAlways,
+		classNoRows:           acceptAlways,
+		classUnknownObject:    acceptInParallel,
+		classModelConflict:    acceptInParallel,
+		classDDLJobsMismatch:  acceptInParallel,
+	}
+
+	ddlAcceptableErrors = map[DDLKind]acceptableErrors{
+		ddlShardRowID: {
+			classAutoIDOverflow:        acceptAlways,
+			classUnsupportedShardRowID: acceptAlways,
+		},
+		ddlAddColumn: {
+			classNoDefaultValue: acceptAlways,
+		},
+		ddlAddIndex: {
+			classNoExpressionIndex: acceptAlways,
+		},
+		ddlSetDefaultValue: {
+			classNoDefaultValue: acceptAlways,
+		},
+		// The values that don't fit the new type are predicted by the local
+		// model, see `convertRows`.
+		ddlModifyColumn: {
+			classNoDefaultValue: acceptAlways,
+		},
+		ddlMultiSchemaChange: {
+			classNoDefaultValue:      acceptAlways,
+			classNoMultiSchemaChange: acceptAlways,
+		},
+		ddlRecoverTable: {
+			classNoGCSafePoint: acceptAlways,
+		},
+		ddlFlashbackTable: {
+			classNoGCSafePoint: acceptAlways,
+		},
+		ddlRecoverSchema: {
+			classNoGCSafePoint: acceptAlways,
+		},
+	}
+
+	// dmlCommonAcceptableErrors are acceptable for all kinds of DML, which
+	// always run concurrently with the DDLs.
+	dmlCommonAcceptableErrors = acceptableErrors{
+		classSchemaChanged:    acceptAlways,
+		classRetryable:        acceptAlways,
+		classConnection:       acceptAlways,
+		classUnknownObject:    acceptAlways,
+		classDriverConversion: acceptAlways,
+		classNoRows:           acceptAlways,
+	}
+
+	dmlAcceptableErrors = map[DMLKind]acceptableErrors{
+		// The duplicate key errors of INSERT and UPDATE are predicted by the
+		// local model, see `predictDuplicate`.
+		dmlInsert: {
+			// Sometimes, a insert to a table might generate an error caused by
+			// exceeding maximum auto increment id.
+			classAutoIDExhausted:      acceptAlways,
+			classDataTruncated:        acceptAlways,
+			classColumnSpecifiedTwice: acceptAlways,
+			classNoPartition:          acceptAlways,
+		},
+		dmlUpdate: {
+			classDataTruncated:        acceptAlways,
+			classColumnSpecifiedTwice: acceptAlways,
+			classNoPartition:          acceptAlways,
+		},
+		dmlDelete: {},
+		// The same as INSERT, the rows come from another table.
+		dmlInsertSelect: {
+			classAutoIDExhausted:      acceptAlways,
+			classDataTruncated:        acceptAlways,
+			classColumnSpecifiedTwice: acceptAlways,
+			classNoPartition:          acceptAlways,
+		},
+		// The commit of a transaction.
+		dmlKindNil: {
+			classDuplicateEntry: acceptAlways,
+		},
+	}
+
+	adminCheckAcceptableErrors = acceptableErrors{
+		classSchemaChanged: acceptAlways,
+		classRetryable:     acceptAlways,
+		classConnection:    acceptAlways,
+		classUnknownObject: acceptAlways,
+	}
+)
+
+// acceptErrorClasses makes the error classes acceptable under `cond` for the
+// statement kind named `kind`, which is a name in `mapOfDDLKind`, "insert",
+// "update", "delete", "insert select", "commit", "admin check", or "ddl" and "dml" for all
+// kinds of DDL and DML.
+func acceptErrorClasses(kind string, classes []string, cond acceptCondition) error {
+	var target acceptableErrors
+	switch kind {
+	case "ddl":
+		target = ddlCommonAcceptableErrors
+	case "dml":
+		target = dmlCommonAcceptableErrors
+	case "admin check":
+		target = adminCheckAcceptableErrors
+	case "commit":
+		target = dmlAcceptableErrors[dmlKindNil]
+	default:
+		if k, ok := mapOfDDLKind[kind]; ok {
+			if ddlAcceptableErrors[k] == nil {
+				ddlAcceptableErrors[k] = acceptableErrors{}
+			}
+			target = ddlAcceptableErrors[k]
+			break
+		}
+		for k, name := range mapOfDMLKindToString {
+			if name == kind {
+				target = dmlAcceptableErrors[k]
+			}
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("unknown statement kind %q", kind)
+	}
+	for _, class := range classes {
+		if _, ok := errorClasses[class]; !ok {
+			return fmt.Errorf("unknown error class %q of %q", class, kind)
+		}
+		target[class] = cond
+	}
+	return nil
+}
+
+// ddlIgnoreError reports whether `err` of a DDL of kind `k` is acceptable in
+// the test of type `tp`, the acceptable errors are counted and logged.
+func ddlIgnoreError(k DDLKind, tp DDLTestType, err error) bool {
+	if err == nil {
+		return true
+	}
+	if !acceptableDDLError(k, tp, err) {
+		return false
+	}
+	ignoreError("ddl", ddlKindName(k), classifyError(err), err)
+	return true
+}
+
+// acceptableDDLError is `ddlIgnoreError` without counting and logging.
+func acceptableDDLError(k DDLKind, tp DDLTestType, err error) bool {
+	class := classifyError(err)
+	return ddlCommonAcceptableErrors.accept(class, tp) || ddlAcceptableErrors[k].accept(class, tp)
+}
+
+// dmlIgnoreError reports whether `err` of a DML of kind `k` is acceptable in
+// the test of type `tp`, `dmlKindNil` means the commit of a transaction. The
+// acceptable errors are counted and logged.
+func dmlIgnoreError(k DMLKind, tp DDLTestType, err error) bool {
+	if err == nil {
+		return true
+	}
+	if !acceptableDMLError(k, tp, err) {
+		return false
+	}
+	ignoreError("dml", dmlKindName(k), classifyError(err), err)
+	return true
+}
+
+// acceptableDMLError is `dmlIgnoreError` without counting and logging.
+func acceptableDMLError(k DMLKind, tp DDLTestType, err error) bool {
+	class := classifyError(err)
+	return dmlCommonAcceptableErrors.accept(class, tp) || dmlAcceptableErrors[k].accept(class, tp)
+}
+
+// adminCheckIgnoreError reports whether `err` of `ADMIN CHECK TABLE` is
+// acceptable in the test of type `tp`, the acceptable errors are counted and
+// logged.
+func adminCheckIgnoreError(tp DDLTestType, err error) bool {
+	if err == nil {
+		return true
+	}
+	class := classifyError(err)
+	if !adminCheckAcceptableErrors.accept(class, tp) {
+		return false
+	}
+	ignoreError("admin check", "admin check", class, err)
+	return true
+}
+
+func ignoreError(tp, kind, class string, err error) {
+	ignoredErrorCounter.WithLabelValues(tp, class).Inc()
+	log.Warnf("[%s] ignore %s error of %s: %v", tp, class, kind, err)
+}
+
+func ddlKindName(k DDLKind) string {
+	if name, ok := mapOfDDLKindToString[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("ddl kind %d", k)
+}
+
+func dmlKindName(k DMLKind) string {
+	if k == dmlKindNil {
+		return "commit"
+	}
+	if name, ok := mapOfDMLKindToString[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("dml kind %d", k)
+}
@@ -0,0 +1,102 @@
+package ddl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDDLIgnoreError(t *testing.T) {
+	err := errors.New("shard_row_id_bits 6 will cause next global auto ID 1648238210354062187 overflow random")
+	assert.True(t, ddlIgnoreError(ddlShardRowID, SerialDDLTest, err))
+	err = errors.New("shard_row_id_bits 6 will cause next global auto ID 164823821035406218d overflow")
+	assert.False(t, ddlIgnoreError(ddlShardRowID, SerialDDLTest, err))
+	assert.True(t, ddlIgnoreError(ddlShardRowID, SerialDDLTest, errors.New("cause next global auto ID 92738 overflow error")))
+	assert.True(t, ddlIgnoreError(ddlShardRowID, SerialDDLTest, errors.New("cause next global auto ID overflow error")))
+	// The overflow is only acceptable for the kind that sets the shard row id bits.
+	assert.False(t, ddlIgnoreError(ddlAddIndex, SerialDDLTest, errors.New("cause next global auto ID overflow error")))
+
+	noTable := &mysql.MySQLError{Number: 1146, Message: "Table 'test.t' doesn't exist"}
+	assert.False(t, ddlIgnoreError(ddlAddIndex, SerialDDLTest, noTable))
+	assert.True(t, ddlIgnoreError(ddlAddIndex, ParallelDDLTest, noTable))
+	assert.True(t, ddlIgnoreError(ddlAddIndex, SerialDDLTest, &mysql.MySQLError{Number: 8028, Message: "Information schema is changed"}))
+	assert.False(t, ddlIgnoreError(ddlAddIndex, ParallelDDLTest, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'idx'"}))
+	assert.True(t, ddlIgnoreError(ddlDropColumn, ParallelDDLTest, fmt.Errorf("table %s is not exists", "t")))
+}
+
+func TestDMLIgnoreError(t *testing.T) {
+	dup := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"}
+	// Duplicate keys of INSERT and UPDATE are predicted by the model.
+	assert.False(t, dmlIgnoreError(dmlInsert, SerialDDLTest, dup))
+	assert.False(t, dmlIgnoreError(dmlUpdate, SerialDDLTest, errors.Annotate(dup, "Error when executing SQL")))
+	assert.False(t, dmlIgnoreError(dmlDelete, SerialDDLTest, dup))
+	assert.True(t, dmlIgnoreError(dmlKindNil, SerialDDLTest, dup))
+	assert.True(t, dmlIgnoreError(dmlDelete, SerialDDLTest, &mysql.MySQLError{Number: 9007, Message: "Write conflict, [try again later]"}))
+	assert.True(t, dmlIgnoreError(dmlUpdate, SerialDDLTest, errors.New("invalid connection")))
+	// A message isn't enough when the error has a specific code.
+	assert.False(t, dmlIgnoreError(dmlInsert, SerialDDLTest, &mysql.MySQLError{Number: 1213, Message: "index not found, try again later"}))
+	assert.False(t, dmlIgnoreError(dmlInsert, SerialDDLTest, errors.New("handle not found")))
+}
+
+func TestClassifyError(t *testing.T) {
+	assert.Equal(t, "", classifyError(nil))
+	assert.Equal(t, classUnknownObject, classifyError(&mysql.MySQLError{Number: 1146, Message: "Table 'test.t' doesn't exist"}))
+	assert.Equal(t, classDuplicateEntry, classifyError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}))
+	assert.Equal(t, classForeignKey, classifyError(&mysql.MySQLError{Number: 1451, Message: "Cannot delete or update a parent row"}))
+	assert.Equal(t, classUnsupportedShardRowID, classifyError(&mysql.MySQLError{Number: 8200, Message: "Unsupported shard_row_id_bits for table with primary key as row id"}))
+	assert.Equal(t, classSchemaChanged, classifyError(&mysql.MySQLError{Number: 1105, Message: "Information schema is changed"}))
+	assert.Equal(t, "", classifyError(&mysql.MySQLError{Number: 1105, Message: "runtime error: index out of range"}))
+	assert.Equal(t, classConnection, classifyError(errors.New("invalid connection")))
+	assert.Equal(t, classModelConflict, classifyError(fmt.Errorf("schema %s doesn't exist", "s")))
+	assert.Equal(t, classDDLJobsMismatch, classifyError(fmt.Errorf("admin show ddl jobs len != len(tasks)\nadmin get job\n")))
+	assert.Equal(t, "", classifyError(errors.New("Conflict operation")))
+}
+
+func TestRegisterErrorClass(t *testing.T) {
+	defer func() {
+		delete(errorClasses, "lock-wait-timeout")
+		delete(classOfErrorCode, 1205)
+		delete(dmlAcceptableErrors[dmlUpdate], "lock-wait-timeout")
+		delete(ddlAcceptableErrors[ddlAddIndex], "lock-wait-timeout")
+	}()
+
+	lockWaitTimeout := &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded; try restarting transaction"}
+	assert.Equal(t, "", classifyError(lockWaitTimeout))
+	assert.Nil(t, registerErrorClass("lock-wait-timeout", []uint16{1205}, []string{`^Lock wait timeout`}))
+	assert.Equal(t, "lock-wait-timeout", classifyError(lockWaitTimeout))
+	assert.Equal(t, "lock-wait-timeout", classifyError(errors.New("Lock wait timeout exceeded")))
+
+	assert.False(t, dmlIgnoreError(dmlUpdate, SerialDDLTest, lockWaitTimeout))
+	assert.Nil(t, acceptErrorClasses("update", []string{"lock-wait-timeout"}, acceptAlways))
+	assert.True(t, dmlIgnoreError(dmlUpdate, SerialDDLTest, lockWaitTimeout))
+	assert.False(t, dmlIgnoreError(dmlInsert, SerialDDLTest, lockWaitTimeout))
+	assert.Nil(t, acceptErrorClasses("add index", []string{"lock-wait-timeout"}, acceptInParallel))
+	assert.False(t, ddlIgnoreError(ddlAddIndex, SerialDDLTest, lockWaitTimeout))
+	assert.True(t, ddlIgnoreError(ddlAddIndex, ParallelDDLTest, lockWaitTimeout))
+
+	assert.NotNil(t, registerErrorClass("other-duplicate", []uint16{1062}, nil))
+	assert.NotNil(t, registerErrorClass("unknown", []uint16{1105}, nil))
+	assert.NotNil(t, registerErrorClass("bad-pattern", nil, []string{`(`}))
+	assert.NotNil(t, acceptErrorClasses("upsert", []string{"lock-wait-timeout"}, acceptAlways))
+	assert.NotNil(t, acceptErrorClasses("insert", []string{"no-such-class"}, acceptAlways))
+}
+
+func TestCheckExpectedError(t *testing.T) {
+	c := &testCase{tables: map[objectKey]*ddlTestTable{}}
+	table := &ddlTestTable{name: "t"}
+	localErr := c.dropTableJob(&ddlJobTask{k: ddlDropTable, tblInfo: table})
+	assert.Equal(t, errCodeBadTable, expectedErrorCode(localErr))
+	assert.Equal(t, "table t is not exists", localErr.Error())
+	assert.Equal(t, classModelConflict, classifyError(localErr))
+
+	assert.Nil(t, checkExpectedError(localErr, &mysql.MySQLError{Number: 1051, Message: "Unknown table 'test.t'"}))
+	assert.Nil(t, checkExpectedError(localErr, errors.Annotate(&mysql.MySQLError{Number: 1051, Message: "Unknown table 'test.t'"}, "drop table")))
+	assert.NotNil(t, checkExpectedError(localErr, &mysql.MySQLError{Number: 1105, Message: "unknown error"}))
+	assert.NotNil(t, checkExpectedError(localErr, errors.New("invalid connection")))
+	// Nothing is predicted.
+	assert.Equal(t, uint16(0), expectedErrorCode(errors.New("table t is not exists")))
+	assert.Nil(t, checkExpectedError(expectError(0, "column has index reference"), &mysql.MySQLError{Number: 1105, Message: "unknown error"}))
+}
@@ -0,0 +1,576 @@
+package ddl
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// A foreign key of a child table references the only column of the primary
+// key or of a unique index of the parent table, from an integer column of the
+// same type that is the first column of an index of the child table. The
+// foreign keys are kept simple for the model: the tables aren't partitioned,
+// a table is either a parent or a child, so no referential action goes beyond
+// one table, and there is at most one foreign key between two tables. The
+// model deletes or updates the child rows as the referential actions do, and
+// predicts the errors of the statements that would break a foreign key.
+
+// ReferencedRowProbability is the probability that an INSERT or an UPDATE of
+// a child table sets a foreign key column to the key of an existing parent
+// row, otherwise it mostly fails.
+var ReferencedRowProbability = 0.9
+
+// The referential actions of ON DELETE and ON UPDATE.
+const (
+	fkActionRestrict = "RESTRICT"
+	fkActionCascade  = "CASCADE"
+	fkActionSetNull  = "SET NULL"
+)
+
+var fkActions = []string{fkActionRestrict, fkActionCascade, fkActionSetNull}
+
+type ddlTestForeignKey struct {
+	name      string
+	column    *ddlTestColumn // the column of the child table.
+	parent    *ddlTestTable
+	refColumn *ddlTestColumn // the referenced column of the parent table.
+	onDelete  string
+	onUpdate  string
+}
+
+func (fk *ddlTestForeignKey) definition() string {
+	return fmt.Sprintf("CONSTRAINT `%s` FOREIGN KEY (`%s`) REFERENCES %s (`%s`) ON DELETE %s ON UPDATE %s",
+		fk.name, fk.column.name, fk.parent.quotedName(), fk.refColumn.name, fk.onDelete, fk.onUpdate)
+}
+
+// childForeignKey is a foreign key and its child table.
+type childForeignKey struct {
+	child *ddlTestTable
+	fk    *ddlTestForeignKey
+}
+
+// sameKey reports whether two values of foreign key columns are equal, NULL
+// equals nothing.
+func sameKey(a, b interface{}) bool {
+	x, ok := partitionValue(a)
+	if !ok {
+		return false
+	}
+	y, ok := partitionValue(b)
+	return ok && x == y
+}
+
+// indexKeys returns the columns of the primary key, unless `exceptPK`, and of
+// the indexes of the table other than the one named `except`. The indexes
+// leading by a prefix or an expression cannot serve a foreign key.
+func (table *ddlTestTable) indexKeys(except string, exceptPK bool) [][]*ddlTestColumn {
+	keys := make([][]*ddlTestColumn, 0, len(table.indexes)+1)
+	if len(table.primaryKey) > 0 && !exceptPK {
+		keys = append(keys, table.primaryKey)
+	}
+	for _, index := range table.indexes {
+		if index.name != except && index.part(0).isColumn() {
+			keys = append(keys, index.columns)
+		}
+	}
+	return keys
+}
+
+func isLeadingColumn(keys [][]*ddlTestColumn, column *ddlTestColumn) bool {
+	for _, key := range keys {
+		if len(key) > 0 && key[0] == column {
+			return true
+		}
+	}
+	return false
+}
+
+// referableColumns returns the columns that a foreign key can reference.
+func (table *ddlTestTable) referableColumns() []*ddlTestColumn {
+	var columns []*ddlTestColumn
+	for _, key := range table.uniqueKeys() {
+		if len(key) == 1 && isIntegerKind(key[0].k) && !key[0].isDeleted() && !containsColumn(columns, key[0]) {
+			columns = append(columns, key[0])
+		}
+	}
+	return columns
+}
+
+// canReference reports whether `column` of the table can reference `ref`.
+// The column isn't in a unique key, so that a cascaded update never makes
+// duplicate keys.
+func (table *ddlTestTable) canReference(column, ref *ddlTestColumn) bool {
+	if column.k != ref.k || column.fieldType != ref.fieldType || column.isPrimaryKey || column.isGenerated() ||
+		column.isAutoID() || column.isDeleted() || column.isRenamed() {
+		return false
+	}
+	for _, key := range table.uniqueKeys() {
+		if containsColumn(key, column) {
+			return false
+		}
+	}
+	for _, fk := range table.foreignKeys {
+		if fk.column == column {
+			return false
+		}
+	}
+	return isLeadingColumn(table.indexKeys("", false), column)
+}
+
+func (table *ddlTestTable) hasForeignKeyTo(parent *ddlTestTable) bool {
+	for _, fk := range table.foreignKeys {
+		if fk.parent == parent {
+			return true
+		}
+	}
+	return false
+}
+
+// referencingForeignKeys returns the foreign keys of the other tables that
+// reference `table`. The caller should hold `c.tablesLock` unless it's a DDL
+// job, since only the DDL jobs change the foreign keys.
+func (c *testCase) referencingForeignKeys(table *ddlTestTable) []childForeignKey {
+	var refs []childForeignKey
+	for _, key := range c.tableKeys() {
+		child := c.tables[key]
+		for _, fk := range child.foreignKeys {
+			if fk.parent == table {
+				refs = append(refs, childForeignKey{child, fk})
+			}
+		}
+	}
+	return refs
+}
+
+// foreignKeyOnColumn returns a foreign key of `table` on `column`, or one
+// referencing `column`, and whether the column is of the child table.
+func (c *testCase) foreignKeyOnColumn(table *ddlTestTable, column *ddlTestColumn) (*ddlTestForeignKey, bool) {
+	for _, fk := range table.foreignKeys {
+		if fk.column == column {
+			return fk, true
+		}
+	}
+	for _, ref := range c.referencingForeignKeys(table) {
+		if ref.fk.refColumn == column {
+			return ref.fk, false
+		}
+	}
+	return nil, false
+}
+
+// foreignKeyNeedingIndex returns a foreign key that can't do without the
+// index named `index`, or the primary key if `index` is empty, since no other
+// index of `table` starts with its column.
+func (c *testCase) foreignKeyNeedingIndex(table *ddlTestTable, index string) *ddlTestForeignKey {
+	key := table.primaryKey
+	for _, idx := range table.indexes {
+		if index != "" && idx.name == index {
+			key = idx.columns
+		}
+	}
+	if len(key) == 0 {
+		return nil
+	}
+	others := table.indexKeys(index, index == "")
+	needs := func(column *ddlTestColumn) bool {
+		return key[0] == column && !isLeadingColumn(others, column)
+	}
+	for _, fk := range table.foreignKeys {
+		if needs(fk.column) {
+			return fk
+		}
+	}
+	for _, ref := range c.referencingForeignKeys(table) {
+		if needs(ref.fk.refColumn) {
+			return ref.fk
+		}
+	}
+	return nil
+}
+
+// replaceForeignKeyColumn replaces `column` of `table` in the foreign keys
+// after it's modified. The caller should hold `c.tablesLock`.
+func (c *testCase) replaceForeignKeyColumn(table *ddlTestTable, column, newColumn *ddlTestColumn) {
+	for _, fk := range table.foreignKeys {
+		if fk.column == column {
+			fk.column = newColumn
+		}
+	}
+	for _, ref := range c.referencingForeignKeys(table) {
+		if ref.fk.refColumn == column {
+			ref.fk.refColumn = newColumn
+		}
+	}
+}
+
+// hasKey reports whether a row of the table has `value` in `column`.
+func (table *ddlTestTable) hasKey(column *ddlTestColumn, value interface{}) bool {
+	for i := 0; i < table.numberOfRows; i++ {
+		if sameKey(getRowFromArrayList(column.rows, i), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// pickupKey returns the value of `column` of a random row, or nil if it's
+// NULL or the table is empty.
+func (table *ddlTestTable) pickupKey(r *rand.Rand, column *ddlTestColumn) interface{} {
+	if table.numberOfRows == 0 {
+		return nil
+	}
+	value := getRowFromArrayList(column.rows, r.Intn(table.numberOfRows))
+	if _, ok := partitionValue(value); !ok {
+		return nil
+	}
+	return value
+}
+
+// hasOrphanRows reports whether a row of the table references no row of the
+// parent by `fk`. The caller should hold the locks of both tables.
+func (table *ddlTestTable) hasOrphanRows(fk *ddlTestForeignKey) bool {
+	for i := 0; i < table.numberOfRows; i++ {
+		value := getRowFromArrayList(fk.column.rows, i)
+		if _, ok := partitionValue(value); ok && !fk.parent.hasKey(fk.refColumn, value) {
+			return true
+		}
+	}
+	return false
+}
+
+type ddlForeignKeyJobArg struct {
+	fk *ddlTestForeignKey
+}
+
+func (c *testCase) generateAddForeignKey() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareAddForeignKey, nil, ddlAddForeignKey})
+	return nil
+}
+
+// prepareAddForeignKey adds a foreign key between two tables that have no
+// foreign key between them yet. The tables keep their roles of parent and
+// child even if the foreign key fails or is dropped.
+func (c *testCase) prepareAddForeignKey(_ interface{}, taskCh chan *ddlJobTask) error {
+	keys := c.tableKeys()
+	var candidates []childForeignKey
+	for _, parentKey := range keys {
+		parent := c.tables[parentKey]
+		if parent.isDeleted() || parent.partition != nil || len(parent.fkParents) > 0 {
+			continue
+		}
+		refColumns := parent.referableColumns()
+		for _, childKey := range keys {
+			child := c.tables[childKey]
+			// The tables of a foreign key are in the same schema, see
+			// `dropSchemaJob`.
+			if child == parent || child.schema != parent.schema || child.isDeleted() || child.partition != nil || child.fkReferenced ||
+				containsTable(child.fkParents, parent) || child.hasForeignKeyTo(parent) {
+				continue
+			}
+			for _, ref := range refColumns {
+				for ite := child.columns.Iterator(); ite.Next(); {
+					column := ite.Value().(*ddlTestColumn)
+					if child.canReference(column, ref) {
+						candidates = append(candidates, childForeignKey{child, &ddlTestForeignKey{column: column, parent: parent, refColumn: ref}})
+					}
+				}
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	candidate := candidates[c.ddlRand.Intn(len(candidates))]
+	child, fk := candidate.child, candidate.fk
+	fk.name = RandName(c.ddlRand)
+	fk.onDelete = fkActions[c.ddlRand.Intn(len(fkActions))]
+	fk.onUpdate = fkActions[c.ddlRand.Intn(len(fkActions))]
+	child.fkParents = append(child.fkParents, fk.parent)
+	fk.parent.fkReferenced = true
+	task := &ddlJobTask{
+		k:       ddlAddForeignKey,
+		sql:     fmt.Sprintf("ALTER TABLE %s ADD %s", child.quotedName(), fk.definition()),
+		tblInfo: child,
+		arg:     ddlJobArg(&ddlForeignKeyJobArg{fk: fk}),
+	}
+	taskCh <- task
+	return nil
+}
+
+func (c *testCase) addForeignKeyJob(task *ddlJobTask) error {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	child := task.tblInfo
+	fk := (*ddlForeignKeyJobArg)(task.arg).fk
+	child.lock.Lock()
+	defer child.lock.Unlock()
+	fk.parent.lock.Lock()
+	defer fk.parent.lock.Unlock()
+	if c.isTableDeleted(child) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", child.name)
+	}
+	if c.isTableDeleted(fk.parent) {
+		return expectError(errCodeFKCannotOpenParent, "parent table %s of foreign key %s is not exists", fk.parent.name, fk.name)
+	}
+	if child.isColumnDeleted(fk.column) {
+		return expectError(errCodeKeyColumnNotExists, "local Execute add foreign key %s on column %s error , column is deleted", fk.name, fk.column.name)
+	}
+	if fk.parent.isColumnDeleted(fk.refColumn) {
+		return expectError(errCodeFKNoColumnParent, "referenced column %s of foreign key %s is not exists", fk.refColumn.name, fk.name)
+	}
+	if fk.column.fieldType != fk.refColumn.fieldType {
+		return expectError(errCodeFKIncompatibleColumns, "columns %s and %s of foreign key %s are incompatible", fk.column.name, fk.refColumn.name, fk.name)
+	}
+	if !isLeadingColumn(fk.parent.indexKeys("", false), fk.refColumn) {
+		return expectError(errCodeFKNoIndexParent, "referenced column %s of foreign key %s isn't indexed", fk.refColumn.name, fk.name)
+	}
+	if fk.column.notNull && (fk.onDelete == fkActionSetNull || fk.onUpdate == fkActionSetNull) {
+		return expectError(errCodeFKColumnNotNull, "column %s of foreign key %s is NOT NULL", fk.column.name, fk.name)
+	}
+	if child.hasOrphanRows(fk) {
+		return expectError(errCodeNoReferencedRow, "a row of table %s references no row of table %s", child.name, fk.parent.name)
+	}
+	// The index may be dropped since the task is prepared, then the server
+	// creates one named after the foreign key.
+	if !isLeadingColumn(child.indexKeys("", false), fk.column) {
+		child.indexes = append(child.indexes, &ddlTestIndex{name: fk.name, signature: fk.column.name + ",", columns: []*ddlTestColumn{fk.column}})
+		fk.column.indexReferences++
+	}
+	child.foreignKeys = append(child.foreignKeys, fk)
+	return nil
+}
+
+func (c *testCase) generateDropForeignKey() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareDropForeignKey, nil, ddlDropForeignKey})
+	return nil
+}
+
+func (c *testCase) prepareDropForeignKey(_ interface{}, taskCh chan *ddlJobTask) error {
+	keys := make([]objectKey, 0, len(c.tables))
+	for key, table := range c.tables {
+		if !table.isDeleted() && len(table.foreignKeys) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sortObjectKeys(keys)
+	table := c.tables[keys[c.ddlRand.Intn(len(keys))]]
+	fk := table.foreignKeys[c.ddlRand.Intn(len(table.foreignKeys))]
+	task := &ddlJobTask{
+		k:       ddlDropForeignKey,
+		sql:     fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY `%s`", table.quotedName(), fk.name),
+		tblInfo: table,
+		arg:     ddlJobArg(&ddlForeignKeyJobArg{fk: fk}),
+	}
+	taskCh <- task
+	return nil
+}
+
+// dropForeignKeyJob drops the foreign key, but not its index.
+func (c *testCase) dropForeignKeyJob(task *ddlJobTask) error {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	table := task.tblInfo
+	fk := (*ddlForeignKeyJobArg)(task.arg).fk
+	if c.isTableDeleted(table) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
+	}
+	for i := range table.foreignKeys {
+		if table.foreignKeys[i] == fk {
+			table.foreignKeys = append(table.foreignKeys[:i], table.foreignKeys[i+1:]...)
+			return nil
+		}
+	}
+	return expectError(errCodeCantDropFieldOrKey, "table %s , foreign key %s is not exists", table.name, fk.name)
+}
+
+func containsTable(tables []*ddlTestTable, table *ddlTestTable) bool {
+	for _, t := range tables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+// foreignKeyEpochs returns `uniqueEpoch` of the tables related to `table` by
+// the foreign keys. The caller should hold `c.tablesLock`.
+func (c *testCase) foreignKeyEpochs(table *ddlTestTable) map[*ddlTestTable]int64 {
+	epochs := make(map[*ddlTestTable]int64)
+	for _, fk := range table.foreignKeys {
+		epochs[fk.parent] = fk.parent.loadUniqueEpoch()
+	}
+	for _, ref := range c.referencingForeignKeys(table) {
+		epochs[ref.child] = ref.child.loadUniqueEpoch()
+	}
+	return epochs
+}
+
+// racesForeignKeyChange reports whether a DDL that changes the foreign keys,
+// the unique keys or the rows of the table or of the tables related to it
+// runs since the task was prepared, see `racesUniqueChange`.
+func (task *dmlJobTask) racesForeignKeyChange() bool {
+	if task.racesUniqueChange() {
+		return true
+	}
+	for table, epoch := range task.fkEpochs {
+		if epoch%2 != 0 || table.loadUniqueEpoch() != epoch {
+			return true
+		}
+	}
+	return false
+}
+
+// pickupReferencedValues sets the foreign key columns in `assigns` to the
+// keys of existing parent rows mostly, the omitted ones are added if `add`.
+// The caller should hold `c.tablesLock` and the lock of the table.
+func (table *ddlTestTable) pickupReferencedValues(r *rand.Rand, assigns []*ddlTestColumnDescriptor, add bool) []*ddlTestColumnDescriptor {
+	for _, fk := range table.foreignKeys {
+		if fk.parent.isDeleted() || fk.column.isDeleted() || r.Float64() >= ReferencedRowProbability {
+			continue
+		}
+		cd := fk.column.getMatchedColumnDescriptor(assigns)
+		if cd == nil && !add {
+			continue
+		}
+		fk.parent.lock.RLock()
+		value := fk.parent.pickupKey(r, fk.refColumn)
+		fk.parent.lock.RUnlock()
+		if value == nil {
+			continue
+		}
+		if cd == nil {
+			assigns = append(assigns, &ddlTestColumnDescriptor{fk.column, value})
+		} else {
+			cd.value = value
+		}
+	}
+	return assigns
+}
+
+// predictNoReferencedRow returns ER_NO_REFERENCED_ROW_2 if one of the new
+// `rows` of the child table references no parent row. The prediction is
+// skipped if a DDL changes the foreign keys concurrently. The caller should
+// hold `c.tablesLock` and the lock of the table.
+func (task *dmlJobTask) predictNoReferencedRow(rows [][]interface{}) error {
+	table := task.tblInfo
+	if len(table.foreignKeys) == 0 || task.racesForeignKeyChange() {
+		return nil
+	}
+	for _, fk := range table.foreignKeys {
+		pos := table.columns.IndexOf(fk.column)
+		if pos < 0 {
+			continue
+		}
+		fk.parent.lock.RLock()
+		for _, row := range rows {
+			if _, ok := partitionValue(row[pos]); ok && !fk.parent.hasKey(fk.refColumn, row[pos]) {
+				fk.parent.lock.RUnlock()
+				return expectError(errCodeNoReferencedRow, "a row of table %s references no row of table %s", table.name, fk.parent.name)
+			}
+		}
+		fk.parent.lock.RUnlock()
+	}
+	return nil
+}
+
+// childRowsChange is the change of the rows of a child table made by the
+// referential actions of a foreign key.
+type childRowsChange struct {
+	table   *ddlTestTable
+	column  *ddlTestColumn
+	values  map[int]interface{}
+	deleted map[int]bool
+}
+
+func (change *childRowsChange) apply() {
+	table := change.table
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	for i, value := range change.values {
+		change.column.rows.Set(i, value)
+	}
+	if len(change.deleted) > 0 {
+		table.removeRows(func(i int) bool { return change.deleted[i] })
+	}
+}
+
+// referentialActions returns the changes of the child rows made by deleting
+// the rows of the parent table at the positions of `deleted`, or by changing
+// the rows at the positions of `changed`. It returns ER_ROW_IS_REFERENCED_2
+// if a deleted or changed key is referenced by a RESTRICT foreign key, which
+// is skipped if a DDL changes the foreign keys concurrently. The caller should
+// hold `c.tablesLock` and the lock of the table.
+func (c *testCase) referentialActions(task *dmlJobTask, changed map[int][]interface{}, deleted map[int]bool) ([]*childRowsChange, error) {
+	table := task.tblInfo
+	refs := c.referencingForeignKeys(table)
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	races := task.racesForeignKeyChange()
+	var changes []*childRowsChange
+	for _, ref := range refs {
+		child, fk := ref.child, ref.fk
+		refPos := table.columns.IndexOf(fk.refColumn)
+		if refPos < 0 || child.columns.IndexOf(fk.column) < 0 {
+			continue
+		}
+		// The changed keys, a nil new key means the row is deleted.
+		oldKeys, newKeys := make([]interface{}, 0), make([]interface{}, 0)
+		for i := range deleted {
+			oldKeys = append(oldKeys, getRowFromArrayList(fk.refColumn.rows, i))
+			newKeys = append(newKeys, nil)
+		}
+		for i, row := range changed {
+			if old := getRowFromArrayList(fk.refColumn.rows, i); !sameKey(old, row[refPos]) {
+				oldKeys = append(oldKeys, old)
+				newKeys = append(newKeys, row[refPos])
+			}
+		}
+		change := &childRowsChange{table: child, column: fk.column, values: make(map[int]interface{}), deleted: make(map[int]bool)}
+		child.lock.RLock()
+		for j := 0; j < child.numberOfRows; j++ {
+			value := getRowFromArrayList(fk.column.rows, j)
+			for k, old := range oldKeys {
+				if !sameKey(value, old) {
+					continue
+				}
+				action := fk.onUpdate
+				if newKeys[k] == nil {
+					action = fk.onDelete
+				}
+				switch {
+				case action == fkActionRestrict && !races:
+					child.lock.RUnlock()
+					return nil, expectError(errCodeRowIsReferenced, "a row of table %s is referenced by foreign key %s of table %s", table.name, fk.name, child.name)
+				case action == fkActionCascade && newKeys[k] == nil:
+					change.deleted[j] = true
+				case action == fkActionCascade:
+					change.values[j] = newKeys[k]
+				case action == fkActionSetNull:
+					change.values[j] = ddlTestValueNull
+				}
+			}
+		}
+		// A cascaded update may duplicate a unique key of the child table
+		// added after the foreign key, which takes the result of the server.
+		if len(change.values) > 0 && mysqlErrorCode(task.err) == errCodeDupEntry {
+			for _, key := range child.uniqueKeys() {
+				if containsColumn(key, fk.column) {
+					child.lock.RUnlock()
+					return nil, expectError(errCodeDupEntry, "duplicate key in table %s by foreign key %s", child.name, fk.name)
+				}
+			}
+		}
+		// Or violate a check of the child column, which the server may or
+		// may not evaluate for the cascaded rows.
+		if len(change.values) > 0 && mysqlErrorCode(task.err) == errCodeCheckViolated && len(child.checksOn(fk.column)) > 0 {
+			child.lock.RUnlock()
+			return nil, expectError(errCodeCheckViolated, "a check of table %s is violated by foreign key %s", child.name, fk.name)
+		}
+		child.lock.RUnlock()
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
@@ -0,0 +1,109 @@
+package ddl
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/emirpasic/gods/lists/arraylist"
+	"github.com/stretchr/testify/assert"
+)
+
+func newForeignKeyTables(onDelete, onUpdate string) (*testCase, *ddlTestTable, *ddlTestTable) {
+	id := &ddlTestColumn{k: KindInt32, name: "id", fieldType: "INT", isPrimaryKey: true, rows: arraylist.New()}
+	parent := &ddlTestTable{
+		name:       "p",
+		columns:    arraylist.New(id),
+		primaryKey: []*ddlTestColumn{id},
+		lock:       new(sync.RWMutex),
+	}
+	pid := &ddlTestColumn{k: KindInt32, name: "pid", fieldType: "INT", rows: arraylist.New()}
+	child := &ddlTestTable{
+		name:    "c",
+		columns: arraylist.New(pid),
+		indexes: []*ddlTestIndex{{name: "idx", columns: []*ddlTestColumn{pid}}},
+		lock:    new(sync.RWMutex),
+	}
+	child.foreignKeys = []*ddlTestForeignKey{{name: "fk", column: pid, parent: parent, refColumn: id, onDelete: onDelete, onUpdate: onUpdate}}
+	parent.addRows([][]interface{}{{int32(1)}, {int32(2)}})
+	child.addRows([][]interface{}{{int32(1)}, {int32(1)}, {ddlTestValueNull}})
+	c := &testCase{tables: map[objectKey]*ddlTestTable{parent.key(): parent, child.key(): child}}
+	return c, parent, child
+}
+
+func TestReferentialActions(t *testing.T) {
+	c, parent, child := newForeignKeyTables(fkActionCascade, fkActionSetNull)
+	assert.False(t, child.hasOrphanRows(child.foreignKeys[0]))
+	task := &dmlJobTask{tblInfo: parent}
+
+	// Deleting the unreferenced row changes nothing.
+	changes, err := c.referentialActions(task, nil, map[int]bool{1: true})
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Empty(t, changes[0].values)
+	assert.Empty(t, changes[0].deleted)
+
+	changes, err = c.referentialActions(task, nil, map[int]bool{0: true})
+	assert.NoError(t, err)
+	changes[0].apply()
+	assert.Equal(t, 1, child.numberOfRows)
+
+	c, parent, child = newForeignKeyTables(fkActionCascade, fkActionSetNull)
+	task = &dmlJobTask{tblInfo: parent}
+	changes, err = c.referentialActions(task, map[int][]interface{}{0: {int32(3)}}, nil)
+	assert.NoError(t, err)
+	changes[0].apply()
+	assert.Equal(t, []interface{}{ddlTestValueNull, ddlTestValueNull, ddlTestValueNull}, child.columns.Values()[0].(*ddlTestColumn).rows.Values())
+
+	c, parent, child = newForeignKeyTables(fkActionRestrict, fkActionCascade)
+	task = &dmlJobTask{tblInfo: parent}
+	_, err = c.referentialActions(task, nil, map[int]bool{0: true})
+	assert.Equal(t, errCodeRowIsReferenced, expectedErrorCode(err))
+	changes, err = c.referentialActions(task, map[int][]interface{}{0: {int32(3)}}, nil)
+	assert.NoError(t, err)
+	changes[0].apply()
+	assert.Equal(t, []interface{}{int32(3), int32(3), ddlTestValueNull}, child.columns.Values()[0].(*ddlTestColumn).rows.Values())
+	assert.True(t, child.hasOrphanRows(child.foreignKeys[0]))
+
+	// The prediction is skipped if a DDL changes the foreign keys concurrently.
+	child.beginUniqueChange()
+	task = &dmlJobTask{tblInfo: parent, fkEpochs: c.foreignKeyEpochs(parent)}
+	_, err = c.referentialActions(task, nil, map[int]bool{0: true})
+	assert.NoError(t, err)
+}
+
+func TestForeignKeyNeedingIndex(t *testing.T) {
+	c, parent, child := newForeignKeyTables(fkActionRestrict, fkActionRestrict)
+	assert.Equal(t, "fk", c.foreignKeyNeedingIndex(child, "idx").name)
+	assert.Equal(t, "fk", c.foreignKeyNeedingIndex(parent, "").name)
+	child.indexes = append(child.indexes, &ddlTestIndex{name: "idx2", columns: child.indexes[0].columns})
+	assert.Nil(t, c.foreignKeyNeedingIndex(child, "idx"))
+
+	fk, isChild := c.foreignKeyOnColumn(parent, parent.primaryKey[0])
+	assert.Equal(t, "fk", fk.name)
+	assert.False(t, isChild)
+}
+
+func TestRenameColumnOfForeignKeyWithCheck(t *testing.T) {
+	c, _, child := newForeignKeyTables(fkActionRestrict, fkActionRestrict)
+	pid := getColumnFromArrayList(child.columns, 0)
+	child.checks = []*ddlTestCheck{{name: "c", column: pid, op: ">=", value: 0, enforced: true}}
+	renamed := *pid
+	renamed.name = "pid2"
+	task := &ddlJobTask{k: ddlRenameColumn, tblInfo: child, arg: ddlJobArg(&ddlColumnJobArg{
+		origColumn:        pid,
+		column:            &renamed,
+		strategy:          ddlTestAddDropColumnStrategyAtRandom,
+		insertAfterColumn: pid,
+	})}
+
+	// The refused rename leaves the foreign key and the check on the column.
+	assert.Equal(t, errCodeDependentByCheck, expectedErrorCode(c.updateTableInfo(task)))
+	assert.True(t, child.foreignKeys[0].column == pid)
+	assert.True(t, child.checks[0].column == pid)
+
+	// So does the rename refused by an expression index.
+	child.checks = nil
+	child.indexes = append(child.indexes, &ddlTestIndex{name: "e", columns: []*ddlTestColumn{pid}, parts: []ddlTestKeyPart{{expr: keyPartLower}}})
+	assert.Equal(t, errCodeDependentByFunctionalIndex, expectedErrorCode(c.updateTableInfo(task)))
+	assert.True(t, child.foreignKeys[0].column == pid)
+}
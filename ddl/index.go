@@ -0,0 +1,262 @@
+package ddl
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// A key part of an index is a whole column, the prefix of a string column or
+// an expression on a column, in ascending or descending order. The model
+// only predicts the duplicates of the unique indexes on whole columns, so the
+// other key parts are only in non-unique indexes. `ALTER INDEX` makes an
+// index invisible or visible again, an invisible index cannot be used by an
+// index hint.
+
+// KeyPartProbability is the probability that a key part of a new index is a
+// prefix or an expression instead of the whole column.
+var KeyPartProbability = 0.3
+
+// DescKeyPartProbability is the probability that a key part of a new index is
+// in descending order.
+var DescKeyPartProbability = 0.2
+
+// MaxPrefixLength is the maximum length of the prefix of a key part.
+var MaxPrefixLength = 16
+
+// The expressions of the key parts, whose results are never BLOB or TEXT, and
+// never overflow.
+const (
+	keyPartLower = "LOWER(`%s`)"
+	keyPartPlus  = "`%s` + 1"
+)
+
+// ddlTestKeyPart is how an index uses one of its columns, the zero value is
+// the whole column in ascending order.
+type ddlTestKeyPart struct {
+	prefix int    // the length of the prefix of a string column, 0 means the whole column.
+	expr   string // the format of an expression on the column, like `keyPartLower`.
+	desc   bool
+}
+
+// isColumn reports whether the key part is the whole column.
+func (part ddlTestKeyPart) isColumn() bool {
+	return part.prefix == 0 && part.expr == ""
+}
+
+func (part ddlTestKeyPart) definition(column *ddlTestColumn) string {
+	var sql string
+	switch {
+	case part.expr != "":
+		sql = "(" + fmt.Sprintf(part.expr, column.name) + ")"
+	case part.prefix > 0:
+		sql = fmt.Sprintf("`%s`(%d)", column.name, part.prefix)
+	default:
+		sql = fmt.Sprintf("`%s`", column.name)
+	}
+	if part.desc {
+		sql += " DESC"
+	}
+	return sql
+}
+
+// statistics returns the key part as it's read from
+// `information_schema.STATISTICS`, see `readTableSchema`. The order isn't
+// compared on TiDB, which ignores DESC.
+func (part ddlTestKeyPart) statistics(column *ddlTestColumn, tidb bool) string {
+	s := column.name
+	if part.expr != "" {
+		s = "<expression>"
+	} else if part.prefix > 0 {
+		s += fmt.Sprintf("(%d)", part.prefix)
+	}
+	if part.desc && !tidb {
+		s += " DESC"
+	}
+	return s
+}
+
+// signature returns the key part as a part of `ddlTestIndex.signature`.
+func (part ddlTestKeyPart) signature(column *ddlTestColumn) string {
+	s := column.name
+	if part.expr != "" {
+		s = fmt.Sprintf(part.expr, column.name)
+	} else if part.prefix > 0 {
+		s += fmt.Sprintf("(%d)", part.prefix)
+	}
+	if part.desc {
+		s += " DESC"
+	}
+	return s
+}
+
+// part returns the key part of the index on `index.columns[i]`.
+func (index *ddlTestIndex) part(i int) ddlTestKeyPart {
+	if i < len(index.parts) {
+		return index.parts[i]
+	}
+	return ddlTestKeyPart{}
+}
+
+// keyPartsSQL returns the key parts of the index in ADD INDEX.
+func (index *ddlTestIndex) keyPartsSQL() string {
+	parts := make([]string, 0, len(index.columns))
+	for i, column := range index.columns {
+		parts = append(parts, index.part(i).definition(column))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// keyPartsSignature returns the signature of the key parts of the index.
+func (index *ddlTestIndex) keyPartsSignature() string {
+	signature := ""
+	for i, column := range index.columns {
+		signature += index.part(i).signature(column) + ","
+	}
+	return signature
+}
+
+// hasPartialKeyPart reports whether an index of the table has a prefix or an
+// expression on the column. The type of such a column isn't changed, since
+// the prefix must fit the column and the expression must not overflow.
+func (table *ddlTestTable) hasPartialKeyPart(column *ddlTestColumn) bool {
+	return table.keyPartOn(column, func(part ddlTestKeyPart) bool { return !part.isColumn() })
+}
+
+// hasExpressionOn reports whether an index of the table has an expression on
+// the column, which then cannot be renamed.
+func (table *ddlTestTable) hasExpressionOn(column *ddlTestColumn) bool {
+	return table.keyPartOn(column, func(part ddlTestKeyPart) bool { return part.expr != "" })
+}
+
+func (table *ddlTestTable) keyPartOn(column *ddlTestColumn, pred func(ddlTestKeyPart) bool) bool {
+	for _, index := range table.indexes {
+		for i, col := range index.columns {
+			if col == column && pred(index.part(i)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// canBeKeyPart reports whether the column can be in an index, maybe by a
+// prefix only.
+func (col *ddlTestColumn) canBeKeyPart() bool {
+	return col.canBeIndex() || col.needsPrefix()
+}
+
+// needsPrefix reports whether the column is a BLOB or a TEXT, which is only
+// indexed by a prefix.
+func (col *ddlTestColumn) needsPrefix() bool {
+	switch col.k {
+	case KindBLOB, KindTINYBLOB, KindMEDIUMBLOB, KindLONGBLOB, KindTEXT, KindTINYTEXT, KindMEDIUMTEXT, KindLONGTEXT:
+		return !col.isAutoID() && col.notGenerated()
+	}
+	return false
+}
+
+// randKeyPart returns a random key part on the column, which satisfies
+// `canBeKeyPart`. A BLOB or a TEXT is always indexed by a prefix.
+func randKeyPart(r *rand.Rand, col *ddlTestColumn) ddlTestKeyPart {
+	part := ddlTestKeyPart{desc: r.Float64() < DescKeyPartProbability}
+	isString := col.k == KindChar || col.k == KindVarChar
+	switch {
+	case col.needsPrefix():
+		part.prefix = r.Intn(MaxPrefixLength) + 1
+		if col.filedTypeM > 0 && part.prefix > col.filedTypeM {
+			part.prefix = col.filedTypeM
+		}
+	case col.isGenerated() || r.Float64() >= KeyPartProbability:
+	case isString && r.Intn(2) == 0:
+		part.expr = keyPartLower
+	case isString && col.filedTypeM > 1:
+		// A prefix as long as the column is the whole column.
+		part.prefix = r.Intn(minInt(col.filedTypeM-1, MaxPrefixLength)) + 1
+	case isIntegerKind(col.k) && col.k != KindBigInt:
+		part.expr = keyPartPlus
+	}
+	return part
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+type ddlAlterIndexArg struct {
+	index     *ddlTestIndex
+	invisible bool
+}
+
+func (c *testCase) generateAlterIndexVisibility() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareAlterIndexVisibility, nil, ddlAlterIndexVisibility})
+	return nil
+}
+
+func (c *testCase) prepareAlterIndexVisibility(_ interface{}, taskCh chan *ddlJobTask) error {
+	table := c.pickupRandomTable(c.ddlRand)
+	if table == nil {
+		return nil
+	}
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+	if len(table.indexes) == 0 {
+		return nil
+	}
+	index := table.indexes[c.ddlRand.Intn(len(table.indexes))]
+	visibility := "INVISIBLE"
+	if index.invisible {
+		visibility = "VISIBLE"
+	}
+	task := &ddlJobTask{
+		k:       ddlAlterIndexVisibility,
+		sql:     fmt.Sprintf("ALTER TABLE %s ALTER INDEX `%s` %s", table.quotedName(), index.name, visibility),
+		tblInfo: table,
+		arg:     ddlJobArg(&ddlAlterIndexArg{index: index, invisible: !index.invisible}),
+	}
+	taskCh <- task
+	return nil
+}
+
+// implicitPrimaryKey returns the index that is the primary key of a table
+// without one, which cannot be invisible. It's the first unique index on NOT
+// NULL columns without an expression, and on MySQL without a prefix either.
+func (c *testCase) implicitPrimaryKey(table *ddlTestTable) *ddlTestIndex {
+	if len(table.primaryKey) > 0 {
+		return nil
+	}
+	for _, index := range table.indexes {
+		implicit := index.unique
+		for i, column := range index.columns {
+			part := index.part(i)
+			if !column.notNull || part.expr != "" || c.cfg.MySQLCompatible && part.prefix > 0 {
+				implicit = false
+			}
+		}
+		if implicit {
+			return index
+		}
+	}
+	return nil
+}
+
+func (c *testCase) alterIndexVisibilityJob(task *ddlJobTask) error {
+	table := task.tblInfo
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	if c.isTableDeleted(table) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
+	}
+	arg := (*ddlAlterIndexArg)(task.arg)
+	if c.isIndexDeleted(arg.index, table) {
+		return expectError(errCodeKeyDoesNotExist, "index %s on table %s is not exists", arg.index.name, table.name)
+	}
+	if arg.invisible && c.implicitPrimaryKey(table) == arg.index {
+		return expectError(errCodePKIndexCantBeInvisible, "index %s is the primary key of table %s", arg.index.name, table.name)
+	}
+	arg.index.invisible = arg.invisible
+	return nil
+}
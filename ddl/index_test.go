@@ -0,0 +1,106 @@
+package ddl
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyParts(t *testing.T) {
+	c, table := newMultiSchemaTable()
+	a := getColumnFromArrayList(table.columns, 0)
+	b := getColumnFromArrayList(table.columns, 1)
+	s := &ddlTestColumn{k: KindVarChar, name: "s", fieldType: "VARCHAR(10)", filedTypeM: 10}
+	table.columns.Add(s)
+	index := &ddlTestIndex{name: "e", columns: []*ddlTestColumn{s, b, a}, parts: []ddlTestKeyPart{
+		{expr: keyPartLower}, {prefix: 0, desc: true}}}
+	index.signature = index.keyPartsSignature()
+	assert.Equal(t, "LOWER(`s`),b DESC,a,", index.signature)
+	assert.Equal(t, "ADD INDEX `e` ((LOWER(`s`)), `b` DESC, `a`)", index.clause())
+	assert.Equal(t, "<expression>,b DESC,a", index.part(0).statistics(s, false)+","+
+		index.part(1).statistics(b, false)+","+index.part(2).statistics(a, true))
+	assert.Equal(t, "b", index.part(1).statistics(b, true))
+
+	prefix := &ddlTestIndex{name: "p", columns: []*ddlTestColumn{s}, parts: []ddlTestKeyPart{{prefix: 3}}, invisible: true}
+	table.indexes = append(table.indexes, prefix)
+	assert.Equal(t, "CREATE TABLE `t` (`a` INT NULL, `b` INT NULL, `s` VARCHAR(10) NULL, INDEX `idx` (`a`), INDEX `p` (`s`(3)) INVISIBLE) "+
+		"COMMENT '' CHARACTER SET '' COLLATE ''", table.createTableSQL())
+	assert.True(t, table.hasPartialKeyPart(s))
+	assert.False(t, table.hasExpressionOn(s))
+	assert.False(t, table.hasPartialKeyPart(a))
+	assert.False(t, table.canChangeType(s, &ddlTestColumn{k: KindVarChar, name: "s", fieldType: "VARCHAR(2)", filedTypeM: 2}))
+	assert.True(t, table.canChangeType(a, &ddlTestColumn{k: KindBigInt, name: "a", fieldType: "BIGINT"}))
+
+	// The index on a prefix cannot serve a foreign key.
+	assert.False(t, isLeadingColumn(table.indexKeys("", false), s))
+
+	// The renamed column of an expression index fails.
+	table.indexes = append(table.indexes, index)
+	renamed := *b
+	renamed.name = "c"
+	task := &ddlJobTask{k: ddlRenameColumn, tblInfo: table, arg: ddlJobArg(&ddlColumnJobArg{
+		origColumn:        b,
+		column:            &renamed,
+		strategy:          ddlTestAddDropColumnStrategyAtRandom,
+		insertAfterColumn: b,
+	})}
+	assert.NoError(t, c.updateTableInfo(task))
+	task.arg = ddlJobArg(&ddlColumnJobArg{origColumn: s, column: &ddlTestColumn{k: KindVarChar, name: "t", fieldType: "VARCHAR(10)", filedTypeM: 10},
+		strategy: ddlTestAddDropColumnStrategyAtRandom, insertAfterColumn: s})
+	assert.Equal(t, errCodeDependentByFunctionalIndex, expectedErrorCode(c.updateTableInfo(task)))
+}
+
+func TestRandKeyPart(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	text := &ddlTestColumn{k: KindTEXT, name: "t", fieldType: "TEXT(4)", filedTypeM: 4}
+	char := &ddlTestColumn{k: KindChar, name: "c", fieldType: "CHAR(1)", filedTypeM: 1}
+	bigint := &ddlTestColumn{k: KindBigInt, name: "b", fieldType: "BIGINT"}
+	assert.True(t, text.canBeKeyPart())
+	assert.False(t, text.canBeIndex())
+	for i := 0; i < 100; i++ {
+		part := randKeyPart(r, text)
+		assert.True(t, part.prefix >= 1 && part.prefix <= 4)
+		assert.Zero(t, randKeyPart(r, char).prefix)
+		assert.Empty(t, randKeyPart(r, bigint).expr)
+	}
+}
+
+func TestAlterIndexVisibility(t *testing.T) {
+	c, table := newMultiSchemaTable()
+	a := getColumnFromArrayList(table.columns, 0)
+	index := table.indexes[0]
+	task := &ddlJobTask{k: ddlAlterIndexVisibility, tblInfo: table, arg: ddlJobArg(&ddlAlterIndexArg{index: index, invisible: true})}
+	assert.NoError(t, c.updateTableInfo(task))
+	assert.True(t, index.invisible)
+
+	// A unique index on NOT NULL columns is the primary key of the table.
+	c.cfg = &DDLCaseConfig{MySQLCompatible: true}
+	index.invisible = false
+	index.unique = true
+	a.notNull = true
+	assert.Equal(t, errCodePKIndexCantBeInvisible, expectedErrorCode(c.updateTableInfo(task)))
+	assert.False(t, index.invisible)
+
+	// Only the first one is, and only if it has no expression.
+	b := getColumnFromArrayList(table.columns, 1)
+	b.notNull = true
+	other := &ddlTestIndex{name: "u", unique: true, columns: []*ddlTestColumn{b}}
+	table.indexes = append(table.indexes, other)
+	task.arg = ddlJobArg(&ddlAlterIndexArg{index: other, invisible: true})
+	assert.NoError(t, c.updateTableInfo(task))
+	other.invisible = false
+	index.parts = []ddlTestKeyPart{{expr: keyPartLower}}
+	assert.Equal(t, errCodePKIndexCantBeInvisible, expectedErrorCode(c.updateTableInfo(task)))
+
+	// MySQL doesn't take a prefix index as the primary key, while TiDB does.
+	index.parts = []ddlTestKeyPart{{prefix: 2}}
+	assert.Equal(t, errCodePKIndexCantBeInvisible, expectedErrorCode(c.updateTableInfo(task)))
+	c.cfg.MySQLCompatible = false
+	task.arg = ddlJobArg(&ddlAlterIndexArg{index: index, invisible: true})
+	assert.Equal(t, errCodePKIndexCantBeInvisible, expectedErrorCode(c.updateTableInfo(task)))
+	assert.NoError(t, c.updateTableInfo(&ddlJobTask{k: ddlAlterIndexVisibility, tblInfo: table, arg: ddlJobArg(&ddlAlterIndexArg{index: other, invisible: true})}))
+
+	table.indexes = nil
+	assert.Equal(t, errCodeKeyDoesNotExist, expectedErrorCode(c.updateTableInfo(task)))
+}
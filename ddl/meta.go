@@ -13,24 +13,55 @@ import (
 	"time"
 
 	"github.com/emirpasic/gods/lists/arraylist"
-	"github.com/twinj/uuid"
 )
 
 type testCase struct {
-	cfg              *DDLCaseConfig
-	initDB           string
-	dbs              []*sql.DB
-	caseIndex        int
-	ddlOps           []ddlTestOpExecutor
-	dmlOps           []dmlTestOpExecutor
-	tables           map[string]*ddlTestTable
-	schemas          map[string]*ddlTestSchema
-	views            map[string]*ddlTestView
-	tablesLock       sync.RWMutex
-	stop             int32
-	lastDDLID        int
+	cfg        *DDLCaseConfig
+	initDB     string
+	dbs        []*sql.DB
+	caseIndex  int
+	ddlOps     []ddlTestOpExecutor
+	dmlOps     []dmlTestOpExecutor
+	tables     map[objectKey]*ddlTestTable
+	schemas    map[string]*ddlTestSchema
+	views      map[objectKey]*ddlTestView
+	tablesLock sync.RWMutex // tablesLock protects tables and views, and is held to lock more than one table.
+	stop       int32
+	seed       int64
+	// ddlRand and dmlRand are the random sources of the DDL and DML goroutines.
+	// They are seeded from `seed`, so that the same seed generates the same
+	// sequence of DDL (and, in serial mode, DML) statements.
+	ddlRand   *rand.Rand
+	dmlRand   *rand.Rand
+	lastDDLID int
+	trace     *traceRecorder
+	// rounds is the number of completed rounds, ddlCount and dmlCount are
+	// the number of DDL and DML statements sent.
+	rounds   int
+	ddlCount int64
+	dmlCount int64
+	// unknownTables are the tables, and the schemas by the keys with an empty
+	// name, whose metadata on the server may differ from the local model, see
+	// `markTablesUnknown`.
+	unknownTables    map[objectKey]string
+	unknownLock      sync.Mutex
 	charsets         []string
 	charsetsCollates map[string][]string
+	// checkConstraints is whether the server enforces CHECK constraints.
+	checkConstraints bool
+	// newCollation is whether the server compares the strings by their
+	// collations, see `collationKey`.
+	newCollation bool
+	// minTimestamp and maxTimestamp are the DATETIME values of the range of
+	// TIMESTAMP, see `timestampRange`.
+	minTimestamp, maxTimestamp string
+	// placementPolicy is the placement policy set by ALTER SCHEMA, empty if
+	// the server doesn't support placement policies.
+	placementPolicy string
+	// recoverable is whether the dropped and truncated tables can be
+	// restored, which only TiDB supports, see `ddlTestTombstone`.
+	recoverable bool
+	tombstones  []*ddlTestTombstone
 }
 
 type ddlTestErrorConflict struct {
@@ -40,6 +71,36 @@ func (err ddlTestErrorConflict) Error() string {
 	return "Conflict operation"
 }
 
+// ddlExpectedError is an error of the local model, which predicts the MySQL
+// error code the server returns for the same DDL, 0 means unknown.
+type ddlExpectedError struct {
+	code uint16
+	msg  string
+}
+
+func (err ddlExpectedError) Error() string {
+	return err.msg
+}
+
+func expectError(code uint16, format string, args ...interface{}) error {
+	return ddlExpectedError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// ddlUnknownResult is an error of the local model for a failed DDL whose
+// error it cannot decide. The error of the server isn't compared, and the
+// model stays unchanged like the server.
+type ddlUnknownResult struct {
+	msg string
+}
+
+func (err ddlUnknownResult) Error() string {
+	return err.msg
+}
+
+func unknownResult(format string, args ...interface{}) error {
+	return ddlUnknownResult{msg: fmt.Sprintf(format, args...)}
+}
+
 func (c *testCase) stopTest() {
 	atomic.StoreInt32(&c.stop, 1)
 }
@@ -56,6 +117,8 @@ type ddlTestSchema struct {
 	deleted bool
 	charset string
 	collate string
+	// placement is the placement policy of the schema, empty for none.
+	placement string
 }
 
 func (c *testCase) isSchemaDeleted(schema *ddlTestSchema) bool {
@@ -65,6 +128,16 @@ func (c *testCase) isSchemaDeleted(schema *ddlTestSchema) bool {
 	return true
 }
 
+// isSchemaNameDeleted reports whether the schema named `name` is dropped,
+// `initDB`, the empty name, is never dropped.
+func (c *testCase) isSchemaNameDeleted(name string) bool {
+	if name == "" {
+		return false
+	}
+	_, ok := c.schemas[name]
+	return !ok
+}
+
 func (schema *ddlTestSchema) setDeleted() {
 	schema.deleted = true
 }
@@ -73,20 +146,75 @@ func (schema *ddlTestSchema) isDeleted() bool {
 	return schema.deleted
 }
 
+// objectKey identifies a table or a view by its schema and name, the schema is
+// empty for `initDB`.
+type objectKey struct {
+	schema string
+	name   string
+}
+
+// sortObjectKeys sorts the keys since the iteration order of a map is random,
+// which makes a pick irreproducible with the same seed.
+func sortObjectKeys(keys []objectKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].schema != keys[j].schema {
+			return keys[i].schema < keys[j].schema
+		}
+		return keys[i].name < keys[j].name
+	})
+}
+
+// tableKeys returns the sorted keys of `c.tables`.
+func (c *testCase) tableKeys() []objectKey {
+	keys := make([]objectKey, 0, len(c.tables))
+	for key := range c.tables {
+		keys = append(keys, key)
+	}
+	sortObjectKeys(keys)
+	return keys
+}
+
+// quoteObjectName returns the quoted name of a table or a view, qualified by
+// its schema unless it's in `initDB`, which is the default database of the
+// connections.
+func quoteObjectName(schema, name string) string {
+	if schema == "" {
+		return fmt.Sprintf("`%s`", name)
+	}
+	return fmt.Sprintf("`%s`.`%s`", schema, name)
+}
+
+// schemaName returns the name of `schema` on the server, where the empty
+// schema is `initDB`.
+func (c *testCase) schemaName(schema string) string {
+	if schema == "" {
+		return c.initDB
+	}
+	return schema
+}
+
+// pickupRandomSchemaName picks `initDB`, as the empty name, or a schema from
+// `c.schemas` randomly for a new table or view.
+func (c *testCase) pickupRandomSchemaName(r *rand.Rand) string {
+	if schema := c.pickupRandomSchema(r); schema != nil && !schema.isDeleted() && r.Intn(2) == 0 {
+		return schema.name
+	}
+	return ""
+}
+
 // pickupRandomSchema picks a schema randomly from `c.schemas`.
-func (c *testCase) pickupRandomSchema() *ddlTestSchema {
-	schemaLen := len(c.schemas)
-	if schemaLen == 0 {
-		return nil
+func (c *testCase) pickupRandomSchema(r *rand.Rand) *ddlTestSchema {
+	schemaNames := make([]string, 0, len(c.schemas))
+	for name := range c.schemas {
+		schemaNames = append(schemaNames, name)
 	}
-	loc := rand.Intn(schemaLen)
-	for _, schema := range c.schemas {
-		if loc == 0 {
-			return schema
-		}
-		loc--
+	if len(schemaNames) == 0 {
+		return nil
 	}
-	return nil
+	// Sort the names since the iteration order of a map is random,
+	// which makes the pick irreproducible with the same seed.
+	sort.Strings(schemaNames)
+	return c.schemas[schemaNames[r.Intn(len(schemaNames))]]
 }
 
 // pickupRandomTables picks a table randomly. The callee should ensure that
@@ -96,22 +224,22 @@ func (c *testCase) pickupRandomSchema() *ddlTestSchema {
 // because the table list may be modified by another parallel DDL op. However
 // the DDL op callee doesn't need to acquire a lock because no one will modify the
 // table list in parallel ---- DDL ops are executed one by one.
-func (c *testCase) pickupRandomTable() *ddlTestTable {
-	tableNames := make([]string, 0)
-	for name, table := range c.tables {
+func (c *testCase) pickupRandomTable(r *rand.Rand) *ddlTestTable {
+	keys := make([]objectKey, 0)
+	for key, table := range c.tables {
 		if table.isDeleted() {
 			continue
 		}
-		tableNames = append(tableNames, name)
+		keys = append(keys, key)
 	}
-	if len(tableNames) == 0 {
+	if len(keys) == 0 {
 		return nil
 	}
-	name := tableNames[rand.Intn(len(tableNames))]
-	return c.tables[name]
+	sortObjectKeys(keys)
+	return c.tables[keys[r.Intn(len(keys))]]
 }
 
-func (c *testCase) pickupRandomCharsetAndCollate() (string, string) {
+func (c *testCase) pickupRandomCharsetAndCollate(r *rand.Rand) (string, string) {
 	// When a table created by a binary charset and collate, it would
 	// convert char type column to binary type which would cause the
 	// the following sql execution result not so intuitive:
@@ -140,20 +268,43 @@ func (c *testCase) pickupRandomCharsetAndCollate() (string, string) {
 	charset := "binary"
 	var collation string
 	for charset == "binary" {
-		charset = c.charsets[rand.Intn(len(c.charsets))]
+		charset = c.charsets[r.Intn(len(c.charsets))]
 		collations := c.charsetsCollates[charset]
-		collation = collations[rand.Intn(len(collations))]
+		collation = collations[r.Intn(len(collations))]
 	}
 	return charset, collation
 }
 
 func (c *testCase) isTableDeleted(table *ddlTestTable) bool {
-	if _, ok := c.tables[table.name]; ok {
+	if _, ok := c.tables[table.key()]; ok {
 		return false
 	}
 	return true
 }
 
+func (c *testCase) isViewDeleted(view *ddlTestView) bool {
+	if _, ok := c.views[view.key()]; ok {
+		return false
+	}
+	return true
+}
+
+// pickupRandomView picks a view randomly from `c.views`.
+func (c *testCase) pickupRandomView(r *rand.Rand) *ddlTestView {
+	keys := make([]objectKey, 0, len(c.views))
+	for key, view := range c.views {
+		if view.isDeleted() {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sortObjectKeys(keys)
+	return c.views[keys[r.Intn(len(keys))]]
+}
+
 func (c *testCase) isColumnDeleted(column *ddlTestColumn, table *ddlTestTable) bool {
 	for ite := table.columns.Iterator(); ite.Next(); {
 		col := ite.Value().(*ddlTestColumn)
@@ -175,19 +326,39 @@ func (c *testCase) isIndexDeleted(index *ddlTestIndex, table *ddlTestTable) bool
 
 type ddlTestTable struct {
 	deleted      int32
+	schema       string // the name of the schema, empty for `initDB`.
 	name         string
 	id           string // table_id , get from admin show ddl jobs
 	columns      *arraylist.List
 	indexes      []*ddlTestIndex
+	primaryKey   []*ddlTestColumn // the columns of the primary key in order.
+	pkType       string           // CLUSTERED or NONCLUSTERED on TiDB, see `pkTypeComment`.
+	partition    *ddlTestPartition
+	uniqueEpoch  int64 // see `beginUniqueChange`.
 	numberOfRows int
-	shardRowId   int64 // shard_row_id_bits
-	autoIncID    int64
-	comment      string // table comment
+	shardRowId   int64              // shard_row_id_bits
+	autoIncID    int64              // the base set by REBASE, the IDs allocated after it aren't less.
+	autoIDs      map[int64]struct{} // the IDs allocated since the table is created or truncated.
+	comment      string             // table comment
 	charset      string
 	collate      string
+	dbCharset    bool // whether the table is created with the default charset and collation of its schema.
+	checks       []*ddlTestCheck
+	foreignKeys  []*ddlTestForeignKey
+	fkParents    []*ddlTestTable // the parents of the foreign keys ever added to the table, see `prepareAddForeignKey`.
+	fkReferenced bool            // whether a foreign key has ever referenced the table.
 	lock         *sync.RWMutex
 }
 
+func (table *ddlTestTable) key() objectKey {
+	return objectKey{table.schema, table.name}
+}
+
+// quotedName returns the name of the table in SQL statements.
+func (table *ddlTestTable) quotedName() string {
+	return quoteObjectName(table.schema, table.name)
+}
+
 func (table *ddlTestTable) isDeleted() bool {
 	return atomic.LoadInt32(&table.deleted) != 0
 }
@@ -196,6 +367,10 @@ func (table *ddlTestTable) setDeleted() {
 	atomic.StoreInt32(&table.deleted, 1)
 }
 
+func (table *ddlTestTable) setDeletedRecover() {
+	atomic.StoreInt32(&table.deleted, 0)
+}
+
 func (table *ddlTestTable) filterColumns(predicate func(*ddlTestColumn) bool) []*ddlTestColumn {
 	retColumns := make([]*ddlTestColumn, 0)
 	for ite := table.columns.Iterator(); ite.Next(); {
@@ -232,11 +407,11 @@ func (table *ddlTestTable) predicateNonPrimaryKeyAndNotGen(col *ddlTestColumn) b
 }
 
 // pickupRandomColumns picks columns from `table.columns` randomly and return them.
-func (table *ddlTestTable) pickupRandomColumns() []*ddlTestColumn {
+func (table *ddlTestTable) pickupRandomColumns(r *rand.Rand) []*ddlTestColumn {
 	columns := table.filterColumns(table.predicateAll)
 	pickedCols := make([]*ddlTestColumn, 0)
 	for _, col := range columns {
-		if rand.Float64() > 0.6 {
+		if r.Float64() > 0.6 {
 			pickedCols = append(pickedCols, col)
 		}
 	}
@@ -245,12 +420,12 @@ func (table *ddlTestTable) pickupRandomColumns() []*ddlTestColumn {
 
 // pickupRandomColumn picks a column from `table.columns` randomly and
 // returns the column index and the column.
-func (table *ddlTestTable) pickupRandomColumn() (int, *ddlTestColumn) {
+func (table *ddlTestTable) pickupRandomColumn(r *rand.Rand) (int, *ddlTestColumn) {
 	columns := table.filterColumns(table.predicateAll)
 	if len(columns) == 0 {
 		return 0, nil
 	}
-	index := rand.Intn(len(columns))
+	index := r.Intn(len(columns))
 	return index, columns[index]
 }
 
@@ -268,10 +443,165 @@ func (table *ddlTestTable) isColumnDeleted(col *ddlTestColumn) bool {
 }
 
 // newRandAutoID returns a feasible new random auto_increment id according to
-// shard_row_id_bits of this table.
-func (table *ddlTestTable) newRandAutoID() int64 {
-	maxAutoID := int64(1<<(64-uint(table.shardRowId)-1)) - 1
-	return rand.Int63n(maxAutoID)
+// shard_row_id_bits of this table, or the shard bits of AUTO_RANDOM.
+func (table *ddlTestTable) newRandAutoID(r *rand.Rand) int64 {
+	return r.Int63n(maxAutoID(table.autoIDShardBits()))
+}
+
+// createTableSQL returns the CREATE TABLE statement of the table.
+func (table *ddlTestTable) createTableSQL() string {
+	sql := fmt.Sprintf("CREATE TABLE %s (", table.quotedName())
+	for i := 0; i < table.columns.Size(); i++ {
+		if i > 0 {
+			sql += ", "
+		}
+		column := getColumnFromArrayList(table.columns, i)
+		sql += fmt.Sprintf("`%s` %s", column.name, column.getDefinition())
+		for _, check := range table.checksOn(column) {
+			if check.inline {
+				sql += " " + check.definition()
+			}
+		}
+	}
+	if len(table.primaryKey) > 0 {
+		sql += ", PRIMARY KEY ("
+		for i, column := range table.primaryKey {
+			if i > 0 {
+				sql += ", "
+			}
+			sql += fmt.Sprintf("`%s`", column.name)
+		}
+		sql += ")" + pkTypeComment(table.pkType)
+	}
+	for _, index := range table.indexes {
+		if index.unique {
+			sql += ", UNIQUE"
+		} else {
+			sql += ","
+		}
+		sql += fmt.Sprintf(" INDEX `%s` (%s)", index.name, index.keyPartsSQL())
+		if index.invisible {
+			sql += " INVISIBLE"
+		}
+	}
+	for _, check := range table.checks {
+		if !check.inline {
+			sql += ", " + check.definition()
+		}
+	}
+	sql += fmt.Sprintf(") COMMENT '%s'", table.comment)
+	if !table.dbCharset {
+		sql += fmt.Sprintf(" CHARACTER SET '%s' COLLATE '%s'", table.charset, table.collate)
+	}
+	if table.partition != nil {
+		sql += " " + table.partition.definition()
+	}
+	return sql
+}
+
+// copyStructure returns an empty table named `name` with the columns, the
+// primary key, the indexes, the comment, the charset and the collation of
+// the table, but not partitioned.
+func (table *ddlTestTable) copyStructure(name string) *ddlTestTable {
+	newTable, _ := table.copyTable(name, false)
+	return newTable
+}
+
+// clone returns a copy of the table with its name, ID, options, checks and
+// partitioning, and its rows if `withRows`, which is independent of the
+// changes to the table. The foreign keys aren't copied.
+func (table *ddlTestTable) clone(withRows bool) *ddlTestTable {
+	newTable, copyColumn := table.copyTable(table.name, withRows)
+	newTable.id = table.id
+	newTable.shardRowId = table.shardRowId
+	newTable.autoIncID = table.autoIncID
+	if table.autoIDs != nil {
+		newTable.autoIDs = make(map[int64]struct{}, len(table.autoIDs))
+		for id := range table.autoIDs {
+			newTable.autoIDs[id] = struct{}{}
+		}
+	}
+	if withRows {
+		newTable.numberOfRows = table.numberOfRows
+	}
+	for _, check := range table.checks {
+		newCheck := *check
+		newCheck.column = copyColumn(check.column)
+		newTable.checks = append(newTable.checks, &newCheck)
+	}
+	if table.partition != nil {
+		partition := *table.partition
+		partition.column = copyColumn(partition.column)
+		partition.defs = make([]*ddlTestPartitionDef, 0, len(table.partition.defs))
+		for _, def := range table.partition.defs {
+			newDef := *def
+			newDef.values = append([]int64(nil), def.values...)
+			partition.defs = append(partition.defs, &newDef)
+		}
+		newTable.partition = &partition
+	}
+	return newTable
+}
+
+// copyTable returns a table named `name` with the columns, the primary key,
+// the indexes, the comment, the charset and the collation of the table, and
+// the function mapping a column of the table to its copy.
+func (table *ddlTestTable) copyTable(name string, withRows bool) (*ddlTestTable, func(*ddlTestColumn) *ddlTestColumn) {
+	newColumns := make(map[*ddlTestColumn]*ddlTestColumn, table.columns.Size())
+	copyColumn := func(col *ddlTestColumn) *ddlTestColumn {
+		if newCol, ok := newColumns[col]; ok {
+			return newCol
+		}
+		newCol := *col
+		newCol.deleted = 0
+		newCol.renamed = 0
+		newCol.rows = arraylist.New()
+		if withRows && col.rows != nil {
+			newCol.rows.Add(col.rows.Values()...)
+		}
+		newCol.dependency = nil
+		newCol.dependenciedCols = nil
+		if col.mValue != nil {
+			newCol.mValue = make(map[string]interface{}, len(col.mValue))
+			for k, v := range col.mValue {
+				newCol.mValue[k] = v
+			}
+		}
+		newColumns[col] = &newCol
+		return &newCol
+	}
+	newTable := &ddlTestTable{
+		schema:  table.schema,
+		name:    name,
+		columns: arraylist.New(),
+		indexes: make([]*ddlTestIndex, 0, len(table.indexes)),
+		pkType:  table.pkType,
+		comment: table.comment,
+		charset: table.charset,
+		collate: table.collate,
+		lock:    new(sync.RWMutex),
+	}
+	for ite := table.columns.Iterator(); ite.Next(); {
+		col := ite.Value().(*ddlTestColumn)
+		newCol := copyColumn(col)
+		if col.isGenerated() {
+			newCol.dependency = copyColumn(col.dependency)
+			newCol.dependency.dependenciedCols = append(newCol.dependency.dependenciedCols, newCol)
+		}
+		newTable.columns.Add(newCol)
+	}
+	for _, col := range table.primaryKey {
+		newTable.primaryKey = append(newTable.primaryKey, copyColumn(col))
+	}
+	for _, index := range table.indexes {
+		newIndex := &ddlTestIndex{name: index.name, signature: index.signature, unique: index.unique,
+			parts: append([]ddlTestKeyPart(nil), index.parts...), invisible: index.invisible}
+		for _, col := range index.columns {
+			newIndex.columns = append(newIndex.columns, copyColumn(col))
+		}
+		newTable.indexes = append(newTable.indexes, newIndex)
+	}
+	return newTable, copyColumn
 }
 
 func (table *ddlTestTable) debugPrintToString() string {
@@ -284,13 +614,28 @@ func (table *ddlTestTable) debugPrintToString() string {
 	}
 	buffer.WriteString(fmt.Sprintf("Comment: %s\nCharset: %s, Collate: %s\nShardRowId: %d\nAutoID: %d\n",
 		table.comment, table.charset, table.collate, table.shardRowId, table.autoIncID))
+	if table.pkType != "" {
+		buffer.WriteString(fmt.Sprintf("Primary key: %s\n", table.pkType))
+	}
+	if table.partition != nil {
+		buffer.WriteString(fmt.Sprintf("Partition: %s\n", table.partition.definition()))
+	}
 	buffer.WriteString("## Non-Primary Indexes: \n")
 	for i, index := range table.indexes {
-		buffer.WriteString(fmt.Sprintf("Index #%d: Name = `%s`, Columnns = [", i, index.name))
-		for _, column := range index.columns {
-			buffer.WriteString(fmt.Sprintf("`%s`, ", column.name))
+		buffer.WriteString(fmt.Sprintf("Index #%d: Name = `%s`, Unique = %v, Invisible = %v, Key parts = [%s]\n",
+			i, index.name, index.unique, index.invisible, index.keyPartsSQL()))
+	}
+	if len(table.checks) > 0 {
+		buffer.WriteString("## Checks: \n")
+		for i, check := range table.checks {
+			buffer.WriteString(fmt.Sprintf("Check #%d: %s\n", i, check.definition()))
+		}
+	}
+	if len(table.foreignKeys) > 0 {
+		buffer.WriteString("## Foreign keys: \n")
+		for i, fk := range table.foreignKeys {
+			buffer.WriteString(fmt.Sprintf("Foreign key #%d: %s\n", i, fk.definition()))
 		}
-		buffer.WriteString("]\n")
 	}
 	buffer.WriteString("## Columns: \n")
 	for i := 0; i < table.columns.Size(); i++ {
@@ -321,9 +666,40 @@ func (table *ddlTestTable) debugPrintToString() string {
 
 type ddlTestView struct {
 	id      string
+	schema  string // the name of the schema, empty for `initDB`.
 	name    string
 	columns []*ddlTestColumn
 	table   *ddlTestTable // the table that this view references.
+	deleted int32
+}
+
+func (view *ddlTestView) key() objectKey {
+	return objectKey{view.schema, view.name}
+}
+
+// quotedName returns the name of the view in SQL statements.
+func (view *ddlTestView) quotedName() string {
+	return quoteObjectName(view.schema, view.name)
+}
+
+func (view *ddlTestView) isDeleted() bool {
+	return atomic.LoadInt32(&view.deleted) != 0
+}
+
+func (view *ddlTestView) setDeleted() {
+	atomic.StoreInt32(&view.deleted, 1)
+}
+
+// selectSQL returns the SELECT statement that defines the view.
+func (view *ddlTestView) selectSQL() string {
+	sql := "select "
+	for i, column := range view.columns {
+		if i > 0 {
+			sql += ", "
+		}
+		sql += fmt.Sprintf("`%s`", column.name)
+	}
+	return sql + " from " + view.table.quotedName()
 }
 
 type ddlTestColumnDescriptor struct {
@@ -332,6 +708,9 @@ type ddlTestColumnDescriptor struct {
 }
 
 func (ddlt *ddlTestColumnDescriptor) getValueString() string {
+	if ddlt.value == ddlTestValueNull {
+		return "NULL"
+	}
 	// make bit data visible
 	if ddlt.column.k == KindBit {
 		return fmt.Sprintf("b'%v'", ddlt.value)
@@ -367,8 +746,13 @@ type ddlTestColumn struct {
 	filedTypeM      int //such as:  VARCHAR(10) ,    filedTypeM = 10
 	filedTypeD      int //such as:  DECIMAL(10,5) ,  filedTypeD = 5
 	filedPrecision  int
+	unsigned        bool   // whether an integer column is UNSIGNED, which is only set by MODIFY COLUMN.
+	collate         string // the collation of the table when the column is created or modified, see `collationKey`.
 	defaultValue    interface{}
 	isPrimaryKey    bool
+	notNull         bool // the columns of the primary key are NOT NULL, and stay so after it's dropped.
+	autoIncrement   bool
+	autoRandomBits  int64 // the shard bits of an AUTO_RANDOM column, see `isAutoID`.
 	rows            *arraylist.List
 	indexReferences int
 
@@ -410,20 +794,26 @@ func (col *ddlTestColumn) getMatchedColumnDescriptor(descriptors []*ddlTestColum
 }
 
 func (col *ddlTestColumn) getDefinition() string {
-	if col.isPrimaryKey {
-		return col.fieldType
-	}
-
 	if col.isGenerated() {
 		return fmt.Sprintf("%s AS (JSON_EXTRACT(`%s`,'$.%s'))", col.fieldType, col.dependency.name, col.nameOfGen)
 	}
 
-	if col.canHaveDefaultValue() {
-		return fmt.Sprintf("%s NULL DEFAULT %v", col.fieldType, getDefaultValueString(col.k, col.defaultValue))
+	null := "NULL"
+	if col.notNull {
+		null = "NOT NULL"
+	}
+	if col.autoIncrement {
+		return fmt.Sprintf("%s %s AUTO_INCREMENT", col.fieldType, null)
+	}
+	if col.autoRandomBits > 0 {
+		return fmt.Sprintf("%s %s /*T![auto_rand] AUTO_RANDOM(%d) */", col.fieldType, null, col.autoRandomBits)
+	}
+	// The columns of the primary key are created without default values.
+	if col.canHaveDefaultValue() && col.defaultValue != nil {
+		return fmt.Sprintf("%s %s DEFAULT %v", col.fieldType, null, getDefaultValueString(col.k, col.defaultValue))
 	} else {
-		return fmt.Sprintf("%s NULL", col.fieldType)
+		return fmt.Sprintf("%s %s", col.fieldType, null)
 	}
-
 }
 
 func (col *ddlTestColumn) getSelectName() string {
@@ -461,27 +851,10 @@ func (col *ddlTestColumn) getDependenciedColsValue(genCol *ddlTestColumn) interf
 	return v
 }
 
-// canBeModified returns whether this column can be changed by a SQL query `change column` or `modify column`.
-// Only a few type columns are supported. See https://pingcap.com/docs/sql/ddl/ for more detail.
-func (col *ddlTestColumn) canBeModified() bool {
-	typeSupported := false
-	switch col.k {
-	case KindTINYINT, KindSMALLINT, KindMEDIUMINT, KindInt32, KindBigInt:
-		typeSupported = true
-	case KindDECIMAL:
-		typeSupported = true
-	case KindChar, KindVarChar:
-		typeSupported = true
-	case KindTEXT, KindBLOB:
-		typeSupported = true
-	}
-	return typeSupported
-}
-
-func getDDLTestColumn(n int) *ddlTestColumn {
+func getDDLTestColumn(r *rand.Rand, n int) *ddlTestColumn {
 	column := &ddlTestColumn{
 		k:         n,
-		name:      uuid.NewV4().String(),
+		name:      RandName(r),
 		fieldType: ALLFieldType[n],
 		rows:      arraylist.New(),
 		deleted:   0,
@@ -489,20 +862,20 @@ func getDDLTestColumn(n int) *ddlTestColumn {
 	switch n {
 	case KindChar, KindVarChar, KindBLOB, KindTEXT, KindBit:
 		maxLen := GetMaxLenByKind(n)
-		column.filedTypeM = int(rand.Intn(maxLen))
+		column.filedTypeM = int(r.Intn(maxLen))
 		for column.filedTypeM == 0 && column.k == KindBit {
-			column.filedTypeM = int(rand.Intn(maxLen))
+			column.filedTypeM = int(r.Intn(maxLen))
 		}
 
 		for column.filedTypeM < 3 && column.k != KindBit { // len('""') = 2
-			column.filedTypeM = int(rand.Intn(maxLen))
+			column.filedTypeM = int(r.Intn(maxLen))
 		}
 		column.fieldType = fmt.Sprintf("%s(%d)", ALLFieldType[n], column.filedTypeM)
 	case KindTINYBLOB, KindMEDIUMBLOB, KindLONGBLOB, KindTINYTEXT, KindMEDIUMTEXT, KindLONGTEXT:
 		column.filedTypeM = GetMaxLenByKind(n)
 		column.fieldType = fmt.Sprintf("%s(%d)", ALLFieldType[n], column.filedTypeM)
 	case KindDECIMAL:
-		column.filedTypeM, column.filedTypeD = RandMD()
+		column.filedTypeM, column.filedTypeD = RandMD(r)
 		column.fieldType = fmt.Sprintf("%s(%d,%d)", ALLFieldType[n], column.filedTypeM, column.filedTypeD)
 	case KindEnum, KindSet:
 		maxLen := GetMaxLenByKind(n)
@@ -511,7 +884,7 @@ func getDDLTestColumn(n int) *ddlTestColumn {
 		m := make(map[string]struct{})
 		column.fieldType += "("
 		for i := 0; i < l; i++ {
-			column.setValue[i] = RandEnumString(m)
+			column.setValue[i] = RandEnumString(r, m)
 			if i > 0 {
 				column.fieldType += ", "
 			}
@@ -521,99 +894,84 @@ func getDDLTestColumn(n int) *ddlTestColumn {
 	}
 
 	if column.canHaveDefaultValue() {
-		column.defaultValue = column.randValue()
+		column.defaultValue = column.randValue(r)
 	}
 
 	return column
 }
 
-func getRandDDLTestColumn() *ddlTestColumn {
+func getRandDDLTestColumn(r *rand.Rand) *ddlTestColumn {
 	var n int
 	for {
-		n = RandDataType()
+		n = RandDataType(r)
 		if n != KindJSON {
 			break
 		}
 	}
-	return getDDLTestColumn(n)
+	return getDDLTestColumn(r, n)
 }
 
 // generateRandModifiedColumn returns a random column to modify column `col`.
 // It doesn't change any properties of column `col` and instead, it first
 // generates a copy of column `col` and then modifies some properties of the
 // generated column randomly. The parameter `renameCol` indicates whether to modify
-// column name.
-func generateRandModifiedColumn(col *ddlTestColumn, renameCol bool) *ddlTestColumn {
+// column name. The new type is one of `col.conversionsFrom()`, it returns nil
+// if there is none.
+func generateRandModifiedColumn(r *rand.Rand, col *ddlTestColumn, renameCol bool) *ddlTestColumn {
+	kinds := col.conversionsFrom()
+	if len(kinds) == 0 {
+		return nil
+	}
 	// Shadow copy of column col.
 	modifiedColumn := *col
 	if renameCol {
-		modifiedColumn.name = uuid.NewV4().String()
+		modifiedColumn.name = RandName(r)
 	} else {
 		modifiedColumn.name = col.name
 	}
-	// ModifyColumn operator has some limitations.
-	// See https://pingcap.com/docs/sql/ddl/ for more detail.
-	// For example, only supports type changes where original type
-	// is belong to integer types, string types or Blob types
-	// and only supports extending length of the original type.
-	// Charset and collate cannot be changed.
-	switch col.k {
-	case KindTINYINT, KindSMALLINT, KindMEDIUMINT, KindInt32, KindBigInt:
-		modifiedColumn.k = rand.Intn(KindBigInt-col.k+1) + col.k
-		modifiedColumn.fieldType = ALLFieldType[modifiedColumn.k]
-	case KindDECIMAL:
-		// Decimal column are not allowed to modify its precision.
-		// We ignore here.
-	case KindChar, KindVarChar:
-		modifiedColumn.k = rand.Intn(KindVarChar-col.k+1) + col.k
-		modifiedColumn.filedTypeM = rand.Intn(GetMaxLenByKind(modifiedColumn.k)-col.filedTypeM) + col.filedTypeM
-		modifiedColumn.fieldType = fmt.Sprintf("%s(%d)", ALLFieldType[modifiedColumn.k], modifiedColumn.filedTypeM)
-	case KindTEXT, KindBLOB:
-		// Only types on `TestFieldType` are considered.
-		// See ./datatype.go for more detail.
-		modifiedColumn.filedTypeM = rand.Intn(GetMaxLenByKind(col.k)-col.filedTypeM) + col.filedTypeM
-		modifiedColumn.fieldType = fmt.Sprintf("%s(%d)", ALLFieldType[col.k], modifiedColumn.filedTypeM)
-	}
+	modifiedColumn.k = kinds[r.Intn(len(kinds))]
+	modifiedColumn.setRandType(r, col)
+	modifiedColumn.defaultValue = nil
 	if modifiedColumn.canHaveDefaultValue() {
-		modifiedColumn.defaultValue = modifiedColumn.randValue()
+		modifiedColumn.defaultValue = modifiedColumn.randValue(r)
 	}
 	return &modifiedColumn
 }
 
-func getRandDDLTestColumnForJson() *ddlTestColumn {
+func getRandDDLTestColumnForJson(r *rand.Rand) *ddlTestColumn {
 	var n int
 	for {
-		n = RandDataType()
+		n = RandDataType(r)
 		if n != KindJSON && n != KindBit && n != KindSet && n != KindEnum {
 			break
 		}
 	}
-	return getDDLTestColumn(n)
+	return getDDLTestColumn(r, n)
 }
 
-func getRandDDLTestColumns() []*ddlTestColumn {
-	n := RandDataType()
+func getRandDDLTestColumns(r *rand.Rand) []*ddlTestColumn {
+	n := RandDataType(r)
 	cols := make([]*ddlTestColumn, 0)
 
 	if n == KindJSON {
-		cols = getRandJsonCol()
+		cols = getRandJsonCol(r)
 	} else {
-		column := getDDLTestColumn(n)
+		column := getDDLTestColumn(r, n)
 		cols = append(cols, column)
 	}
 	return cols
 }
 
-const JsonFieldNum = 5
+var JsonFieldNum = 5
 
-func getRandJsonCol() []*ddlTestColumn {
-	fieldNum := rand.Intn(JsonFieldNum) + 1
+func getRandJsonCol(r *rand.Rand) []*ddlTestColumn {
+	fieldNum := r.Intn(JsonFieldNum) + 1
 
 	cols := make([]*ddlTestColumn, 0, fieldNum+1)
 
 	column := &ddlTestColumn{
 		k:         KindJSON,
-		name:      uuid.NewV4().String(),
+		name:      RandName(r),
 		fieldType: ALLFieldType[KindJSON],
 		rows:      arraylist.New(),
 		deleted:   0,
@@ -623,9 +981,9 @@ func getRandJsonCol() []*ddlTestColumn {
 
 	m := make(map[string]interface{}, 0)
 	for i := 0; i < fieldNum; i++ {
-		col := getRandDDLTestColumnForJson()
-		col.nameOfGen = RandFieldName(m)
-		m[col.nameOfGen] = col.randValue()
+		col := getRandDDLTestColumnForJson(r)
+		col.nameOfGen = RandFieldName(r, m)
+		m[col.nameOfGen] = col.randValue(r)
 		col.dependency = column
 
 		column.dependenciedCols = append(column.dependenciedCols, col)
@@ -649,38 +1007,42 @@ func (col *ddlTestColumn) hasGenerateCol() bool {
 }
 
 // randValue return a rand value of the column
-func (col *ddlTestColumn) randValue() interface{} {
+func (col *ddlTestColumn) randValue(r *rand.Rand) interface{} {
+	if col.unsigned {
+		lower, upper := col.intRange()
+		return intValueOfKind(col.k, randInt64Between(r, lower, upper))
+	}
 	switch col.k {
 	case KindTINYINT:
-		return rand.Int31n(1<<8) - 1<<7
+		return r.Int31n(1<<8) - 1<<7
 	case KindSMALLINT:
-		return rand.Int31n(1<<16) - 1<<15
+		return r.Int31n(1<<16) - 1<<15
 	case KindMEDIUMINT:
-		return rand.Int31n(1<<24) - 1<<23
+		return r.Int31n(1<<24) - 1<<23
 	case KindInt32:
-		return rand.Int63n(1<<32) - 1<<31
+		return r.Int63n(1<<32) - 1<<31
 	case KindBigInt:
-		if rand.Intn(2) == 1 {
-			return rand.Int63()
+		if r.Intn(2) == 1 {
+			return r.Int63()
 		}
-		return -1 - rand.Int63()
+		return -1 - r.Int63()
 	case KindBit:
 		if col.filedTypeM >= 64 {
-			return fmt.Sprintf("%b", rand.Uint64())
+			return fmt.Sprintf("%b", r.Uint64())
 		} else {
 			m := col.filedTypeM
 			if col.filedTypeM > 7 { // it is a bug
 				m = m - 1
 			}
 			n := (int64)((1 << (uint)(m)) - 1)
-			return fmt.Sprintf("%b", rand.Int63n(n))
+			return fmt.Sprintf("%b", r.Int63n(n))
 		}
 	case KindFloat:
-		return rand.Float32() + 1
+		return r.Float32() + 1
 	case KindDouble:
-		return rand.Float64() + 1
+		return r.Float64() + 1
 	case KindDECIMAL:
-		return RandDecimal(col.filedTypeM, col.filedTypeD)
+		return RandDecimal(r, col.filedTypeM, col.filedTypeD)
 	case KindChar, KindVarChar, KindBLOB, KindTINYBLOB, KindMEDIUMBLOB, KindLONGBLOB, KindTEXT, KindTINYTEXT, KindMEDIUMTEXT, KindLONGTEXT:
 		if col.filedTypeM == 0 {
 			return ""
@@ -689,43 +1051,43 @@ func (col *ddlTestColumn) randValue() interface{} {
 				if col.filedTypeM <= 2 {
 					return ""
 				}
-				return RandSeq(rand.Intn(col.filedTypeM - 2))
+				return RandSeq(r, r.Intn(col.filedTypeM-2))
 			}
-			return RandSeq(rand.Intn(col.filedTypeM))
+			return RandSeq(r, r.Intn(col.filedTypeM))
 		}
 	case KindBool:
-		return rand.Intn(2)
+		return r.Intn(2)
 	case KindDATE:
-		randTime := time.Unix(MinDATETIME.Unix()+rand.Int63n(GapDATETIMEUnix), 0)
+		randTime := time.Unix(MinDATETIME.Unix()+r.Int63n(GapDATETIMEUnix), 0)
 		return randTime.Format(TimeFormatForDATE)
 	case KindTIME:
-		randTime := time.Unix(MinTIMESTAMP.Unix()+rand.Int63n(GapTIMESTAMPUnix), 0)
+		randTime := time.Unix(MinTIMESTAMP.Unix()+r.Int63n(GapTIMESTAMPUnix), 0)
 		return randTime.Format(TimeFormatForTIME)
 	case KindDATETIME:
-		randTime := randTime(MinDATETIME, GapDATETIMEUnix)
+		randTime := randTime(r, MinDATETIME, GapDATETIMEUnix)
 		return randTime.Format(TimeFormat)
 	case KindTIMESTAMP:
-		randTime := randTime(MinTIMESTAMP, GapTIMESTAMPUnix)
+		randTime := randTime(r, MinTIMESTAMP, GapTIMESTAMPUnix)
 		return randTime.Format(TimeFormat)
 	case KindYEAR:
-		return rand.Intn(254) + 1901 //1901 ~ 2155
+		return r.Intn(254) + 1901 //1901 ~ 2155
 	case KindJSON:
-		return col.randJsonValue()
+		return col.randJsonValue(r)
 	case KindEnum:
-		i := rand.Intn(len(col.setValue))
+		i := r.Intn(len(col.setValue))
 		return col.setValue[i]
 	case KindSet:
 		var l int
 		for l == 0 {
-			l = rand.Intn(len(col.setValue))
+			l = r.Intn(len(col.setValue))
 		}
 		idxs := make([]int, l)
 		m := make(map[int]struct{})
 		for i := 0; i < l; i++ {
-			idx := rand.Intn(len(col.setValue))
+			idx := r.Intn(len(col.setValue))
 			_, ok := m[idx]
 			for ok {
-				idx = rand.Intn(len(col.setValue))
+				idx = r.Intn(len(col.setValue))
 				_, ok = m[idx]
 			}
 			m[idx] = struct{}{}
@@ -745,12 +1107,12 @@ func (col *ddlTestColumn) randValue() interface{} {
 	}
 }
 
-func randTime(minTime time.Time, gap int64) time.Time {
+func randTime(r *rand.Rand, minTime time.Time, gap int64) time.Time {
 	// https://github.com/chronotope/chrono-tz/issues/23
 	// see all invalid time: https://timezonedb.com/time-zones/Asia/Shanghai
 	var randTime time.Time
 	for {
-		randTime = time.Unix(minTime.Unix()+rand.Int63n(gap), 0).In(Local)
+		randTime = time.Unix(minTime.Unix()+r.Int63n(gap), 0).In(Local)
 		if NotAmbiguousTime(randTime) {
 			break
 		}
@@ -758,21 +1120,21 @@ func randTime(minTime time.Time, gap int64) time.Time {
 	return randTime
 }
 
-func (col *ddlTestColumn) randJsonValue() string {
+func (col *ddlTestColumn) randJsonValue(r *rand.Rand) string {
 	for _, dCol := range col.dependenciedCols {
-		col.mValue[dCol.nameOfGen] = dCol.randValue()
+		col.mValue[dCol.nameOfGen] = dCol.randValue(r)
 	}
 	jsonRow, _ := json.Marshal(col.mValue)
 	return string(jsonRow)
 }
 
 // randValueUnique use for primary key column to get unique value
-func (col *ddlTestColumn) randValueUnique(rows *arraylist.List) (interface{}, bool) {
+func (table *ddlTestTable) randValueUnique(r *rand.Rand, col *ddlTestColumn) (interface{}, bool) {
 	// retry times
 	for i := 0; i < 10; i++ {
-		v := col.randValue()
+		v := table.randColumnValue(r, col)
 		flag := true
-		if rows.Contains(v) {
+		if col.rows.Contains(v) {
 			flag = false
 		}
 		if flag {
@@ -787,6 +1149,10 @@ func (col *ddlTestColumn) canBePrimary() bool {
 }
 
 func (col *ddlTestColumn) canBeIndex() bool {
+	// The auto ID column is only in the primary key, see `dropPrimaryKeyJob`.
+	if col.isAutoID() {
+		return false
+	}
 	switch col.k {
 	case KindChar, KindVarChar:
 		if col.filedTypeM == 0 {
@@ -814,7 +1180,7 @@ func (col *ddlTestColumn) canBeWhere() bool {
 	}
 }
 
-//BLOB, TEXT, GEOMETRY or JSON column 'b' can't have a default value")
+// BLOB, TEXT, GEOMETRY or JSON column 'b' can't have a default value")
 func (col *ddlTestColumn) canHaveDefaultValue() bool {
 	switch col.k {
 	case KindBLOB, KindTINYBLOB, KindMEDIUMBLOB, KindLONGBLOB, KindTEXT, KindTINYTEXT, KindMEDIUMTEXT, KindLONGTEXT, KindJSON:
@@ -827,5 +1193,17 @@ func (col *ddlTestColumn) canHaveDefaultValue() bool {
 type ddlTestIndex struct {
 	name      string
 	signature string
+	unique    bool
 	columns   []*ddlTestColumn
+	parts     []ddlTestKeyPart // how the index uses `columns`, see `part`.
+	invisible bool
+}
+
+// clause returns the ADD INDEX clause of ALTER TABLE that adds the index.
+func (index *ddlTestIndex) clause() string {
+	unique := ""
+	if index.unique {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf("ADD %sINDEX `%s` (%s)", unique, index.name, index.keyPartsSQL())
 }
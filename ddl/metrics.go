@@ -1,6 +1,19 @@
 package ddl
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
 
 var (
 	ddlFailedCounter = prometheus.NewCounter(
@@ -10,8 +23,245 @@ var (
 			Name:      "ddl_failed_total",
 			Help:      "Counter of failed ddl operations.",
 		})
+
+	ddlCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "tidb_test",
+			Subsystem: "stability",
+			Name:      "ddl_total",
+			Help:      "Counter of ddl statements by kind and result.",
+		}, []string{"kind", "result"})
+
+	ddlDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "tidb_test",
+			Subsystem: "stability",
+			Name:      "ddl_duration_seconds",
+			Help:      "Bucketed histogram of the execution time of ddl statements.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 20),
+		}, []string{"kind"})
+
+	dmlCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "tidb_test",
+			Subsystem: "stability",
+			Name:      "dml_total",
+			Help:      "Counter of dml statements by kind and result.",
+		}, []string{"kind", "result"})
+
+	dmlDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "tidb_test",
+			Subsystem: "stability",
+			Name:      "dml_duration_seconds",
+			Help:      "Bucketed histogram of the execution time of dml statements.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 20),
+		}, []string{"kind"})
+
+	ignoredErrorCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "tidb_test",
+			Subsystem: "stability",
+			Name:      "ignored_error_total",
+			Help:      "Counter of ignored errors by statement type and error class.",
+		}, []string{"type", "class"})
+
+	verifyCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "tidb_test",
+			Subsystem: "stability",
+			Name:      "verify_total",
+			Help:      "Counter of table verifications by result.",
+		}, []string{"result"})
+
+	tableRows = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "tidb_test",
+			Subsystem: "stability",
+			Name:      "table_rows",
+			Help:      "Bucketed histogram of the number of rows of the verified tables.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 16),
+		})
+
+	ddlJobsPending = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "tidb_test",
+			Subsystem: "stability",
+			Name:      "ddl_jobs_pending",
+			Help:      "The number of unfinished jobs in `admin show ddl jobs`.",
+		})
+
+	ddlJobsLag = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "tidb_test",
+			Subsystem: "stability",
+			Name:      "ddl_jobs_lag_seconds",
+			Help:      "The time since the oldest unfinished job in `admin show ddl jobs` started.",
+		})
 )
 
 func init() {
 	prometheus.MustRegister(ddlFailedCounter)
+	prometheus.MustRegister(ddlCounter)
+	prometheus.MustRegister(ddlDuration)
+	prometheus.MustRegister(dmlCounter)
+	prometheus.MustRegister(dmlDuration)
+	prometheus.MustRegister(ignoredErrorCounter)
+	prometheus.MustRegister(verifyCounter)
+	prometheus.MustRegister(tableRows)
+	prometheus.MustRegister(ddlJobsPending)
+	prometheus.MustRegister(ddlJobsLag)
+}
+
+const (
+	resultSuccess = "success"
+	resultIgnored = "ignored"
+	resultError   = "error"
+)
+
+func resultLabel(err error, ignored bool) string {
+	if err == nil {
+		return resultSuccess
+	}
+	if ignored {
+		return resultIgnored
+	}
+	return resultError
+}
+
+// observeDDL records a DDL statement of kind `k` that started at `start` and
+// returned `err`, `ignored` means the error is ignored by the test, which is
+// counted by `ddlIgnoreError`.
+func observeDDL(k DDLKind, start time.Time, err error, ignored bool) {
+	kind := ddlKindName(k)
+	ddlDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+	ddlCounter.WithLabelValues(kind, resultLabel(err, ignored)).Inc()
+}
+
+// observeDML records a DML statement like `observeDDL`.
+func observeDML(k DMLKind, start time.Time, err error, ignored bool) {
+	kind := dmlKindName(k)
+	dmlDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+	dmlCounter.WithLabelValues(kind, resultLabel(err, ignored)).Inc()
+}
+
+// startMetricsServer serves the metrics at http://`addr`/metrics.
+func startMetricsServer(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		log.Infof("[metrics] listening on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Errorf("[metrics] listen on %s error %v", addr, err)
+		}
+	}()
+}
+
+// pushMetrics pushes the metrics to the pushgateway at `addr` every
+// `interval` until `ctx` is done, and once more at the end.
+func pushMetrics(ctx context.Context, addr string, interval time.Duration) {
+	pusher := push.New(addr, "schrddl").Gatherer(prometheus.DefaultGatherer)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				if err := pusher.Push(); err != nil {
+					log.Warnf("[metrics] push to %s error %v", addr, err)
+				}
+				return
+			case <-ticker.C:
+				if err := pusher.Push(); err != nil {
+					log.Warnf("[metrics] push to %s error %v", addr, err)
+				}
+			}
+		}
+	}()
+}
+
+// collectDDLJobsLag updates the metrics of `admin show ddl jobs` every
+// `interval` until `ctx` is done.
+func collectDDLJobsLag(ctx context.Context, db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				pending, lag, err := getDDLJobsLag(db)
+				if err != nil {
+					log.Warnf("[metrics] admin show ddl jobs error %v", err)
+					continue
+				}
+				ddlJobsPending.Set(float64(pending))
+				ddlJobsLag.Set(lag.Seconds())
+			}
+		}
+	}()
+}
+
+// ddlJobStartTimeFormats are the formats of START_TIME in `admin show ddl jobs`
+// of different TiDB versions.
+var ddlJobStartTimeFormats = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05",
+}
+
+// getDDLJobsLag returns the number of unfinished DDL jobs, and the time since
+// the oldest of them started.
+func getDDLJobsLag(db *sql.DB) (int, time.Duration, error) {
+	rows, err := db.Query("admin show ddl jobs")
+	if err != nil {
+		return 0, 0, errors.Trace(err)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, 0, errors.Trace(err)
+	}
+	startTimeIdx, stateIdx := -1, -1
+	for i, col := range cols {
+		switch strings.ToUpper(col) {
+		case "START_TIME":
+			startTimeIdx = i
+		case "STATE":
+			stateIdx = i
+		}
+	}
+	if startTimeIdx < 0 || stateIdx < 0 {
+		return 0, 0, fmt.Errorf("admin show ddl jobs returns no START_TIME or STATE column: %v", cols)
+	}
+
+	pending := 0
+	var lag time.Duration
+	now := time.Now()
+	for rows.Next() {
+		rawResult := make([]sql.RawBytes, len(cols))
+		dest := make([]interface{}, len(cols))
+		for i := range rawResult {
+			dest[i] = &rawResult[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return 0, 0, errors.Trace(err)
+		}
+		switch string(rawResult[stateIdx]) {
+		case "synced", "cancelled", "rollback done", "done":
+			continue
+		}
+		pending++
+		for _, format := range ddlJobStartTimeFormats {
+			startTime, err := time.ParseInLocation(format, string(rawResult[startTimeIdx]), time.Local)
+			if err != nil {
+				continue
+			}
+			if now.Sub(startTime) > lag {
+				lag = now.Sub(startTime)
+			}
+			break
+		}
+	}
+	return pending, lag, errors.Trace(rows.Err())
 }
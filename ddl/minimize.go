@@ -0,0 +1,497 @@
+package ddl
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+)
+
+// Minimize shrinks a failing trace recorded with `--trace` into a minimal SQL
+// script. It first replays the trace to find the first divergence, which is
+// one of:
+//  1. a verify query returns different rows on the target and the reference
+//     database,
+//  2. `ADMIN CHECK TABLE` fails on the target,
+//  3. a statement fails on only one of the target and the reference database.
+//
+// Then it delta-debugs the statements before the divergence, drops all
+// statements on tables, columns and indexes that are not needed and shrinks
+// the select list of the verify query, as long as the same kind of divergence
+// (with the same error code) still reproduces. The result is written to
+// `outPath` together with the expected and actual rows or errors.
+//
+// The reference database `refCfg` is required for the first and the third
+// kind, an empty `refCfg.Addr` means there is none. It should be a database
+// the failure doesn't happen on, for example MySQL or a known good TiDB
+// version. NOTE: the database `DB` and all schemas created by the trace are
+// dropped and re-created on both sides before every attempt.
+func Minimize(dbCfg DBConfig, refCfg DBConfig, tracePath string, outPath string) error {
+	events, err := readTrace(tracePath)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	m := &minimizer{dbCfg: dbCfg, refCfg: refCfg}
+	for _, ev := range events {
+		if match := createSchemaRe.FindStringSubmatch(ev.SQL); match != nil {
+			m.schemas = append(m.schemas, match[1])
+		}
+	}
+
+	failIdx, err := m.findFailure(events)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Infof("[minimize] divergence at [seq %d] %s: %s", m.failure.Seq, m.failure.SQL, m.divergence)
+
+	// Only DDL and DML statements are needed to reproduce, transaction
+	// boundaries are added back by `m.assemble`.
+	var stmts []*traceEvent
+	for _, ev := range events[:failIdx] {
+		if ev.Kind == traceDDL || ev.Kind == traceDML {
+			stmts = append(stmts, ev)
+		}
+		if ev.Kind == traceBegin || ev.Kind == traceCommit {
+			m.txnBoundaries = append(m.txnBoundaries, ev)
+		}
+	}
+	if !m.reproduces(stmts) {
+		return errors.New("the divergence doesn't reproduce without the verify and admin check statements")
+	}
+
+	// Drop whole transactions at first, then single statements.
+	units := groupByTxn(stmts)
+	kept := ddmin(len(units), func(idx []int) bool {
+		return m.reproduces(flattenUnits(units, idx))
+	})
+	stmts = flattenUnits(units, kept)
+	log.Infof("[minimize] %d statements left after dropping transactions, %d attempts", len(stmts), m.attempts)
+	kept = ddmin(len(stmts), func(idx []int) bool {
+		return m.reproduces(pickEvents(stmts, idx))
+	})
+	stmts = pickEvents(stmts, kept)
+	log.Infof("[minimize] %d statements left after dropping statements, %d attempts", len(stmts), m.attempts)
+
+	stmts = m.dropIdentifiers(stmts)
+	log.Infof("[minimize] %d statements left after dropping objects, %d attempts", len(stmts), m.attempts)
+	if m.failure.Kind == traceVerify {
+		m.shrinkSelect(stmts)
+	}
+
+	// Run the result once more, so that the output shows its divergence.
+	if !m.reproduces(stmts) {
+		return errors.New("the minimized statements don't reproduce the divergence, the failure might be flaky")
+	}
+	if err := ioutil.WriteFile(outPath, m.script(tracePath, stmts), 0644); err != nil {
+		return errors.Trace(err)
+	}
+	log.Infof("[minimize] %d statements written to %s, %d attempts", len(stmts), outPath, m.attempts)
+	return nil
+}
+
+var (
+	createSchemaRe = regexp.MustCompile("(?i)^CREATE (?:DATABASE|SCHEMA) `([^`]+)`")
+	identifierRe   = regexp.MustCompile("`([^`]+)`")
+	errorNumberRe  = regexp.MustCompile(`^Error (\d+)`)
+)
+
+type minimizer struct {
+	dbCfg         DBConfig
+	refCfg        DBConfig
+	schemas       []string
+	txnBoundaries []*traceEvent
+	// failure is the event where the divergence shows up, and divergence
+	// is how it diverged at the last attempt that reproduced it.
+	failure    *traceEvent
+	divergence *divergence
+	attempts   int
+}
+
+// divergence describes how an event diverges. Two divergences are of the
+// same kind if they have the same `kind` and `class`.
+type divergence struct {
+	kind     traceEventKind
+	class    string
+	expected []string
+	actual   []string
+}
+
+func (d *divergence) String() string {
+	return fmt.Sprintf("%s %s, expected: %v, actual: %v", d.kind, d.class, d.expected, d.actual)
+}
+
+// open returns sessions on fresh target and reference databases. The
+// reference session is nil if there is no reference database.
+func (m *minimizer) open() (*traceSession, *traceSession, error) {
+	db, err := resetDatabase(m.dbCfg, m.schemas)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	target := newTraceSession(db)
+	if m.refCfg.Addr == "" {
+		return target, nil, nil
+	}
+	db, err = resetDatabase(m.refCfg, m.schemas)
+	if err != nil {
+		target.close()
+		return nil, nil, errors.Trace(err)
+	}
+	return target, newTraceSession(db), nil
+}
+
+// resetDatabase drops the database `dbCfg.DB` and `schemas`, creates
+// `dbCfg.DB` again and returns a client of it.
+func resetDatabase(dbCfg DBConfig, schemas []string) (*sql.DB, error) {
+	db, err := OpenDB(dbCfg.serverDSN(), 1)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer db.Close()
+	for _, name := range append(append([]string{}, schemas...), dbCfg.DB) {
+		if _, err := db.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS `%s`", name)); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	if _, err := db.Exec(fmt.Sprintf("CREATE DATABASE `%s`", dbCfg.DB)); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return OpenDB(dbCfg.DSN(), 20)
+}
+
+// findFailure replays all events and returns the index of the first one that
+// diverges.
+func (m *minimizer) findFailure(events []*traceEvent) (int, error) {
+	target, ref, err := m.open()
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer closeSessions(target, ref)
+	for i, ev := range events {
+		d := m.diverges(ev, target, ref)
+		if d == nil {
+			continue
+		}
+		if ev.Kind == traceVerify && ref == nil {
+			return 0, errors.Errorf("[seq %d] %s diverges from the trace, a reference database is needed to minimize row mismatches", ev.Seq, ev.SQL)
+		}
+		m.failure, m.divergence = ev, d
+		return i, nil
+	}
+	return 0, errors.New("the trace doesn't diverge, nothing to minimize")
+}
+
+// reproduces executes `stmts` on fresh databases and reports whether the
+// failure event diverges in the same way as in the trace afterwards.
+func (m *minimizer) reproduces(stmts []*traceEvent) bool {
+	m.attempts++
+	target, ref, err := m.open()
+	if err != nil {
+		log.Warnf("[minimize] open database error %v", err)
+		return false
+	}
+	defer closeSessions(target, ref)
+	events := m.assemble(stmts)
+	for _, ev := range events[:len(events)-1] {
+		target.exec(ev)
+		if ref != nil {
+			ref.exec(ev)
+		}
+	}
+	d := m.diverges(events[len(events)-1], target, ref)
+	if d == nil || d.kind != m.divergence.kind || d.class != m.divergence.class {
+		return false
+	}
+	m.divergence = d
+	return true
+}
+
+// assemble returns `stmts` and the failure event, with their transaction
+// boundaries added back, in the order of the trace.
+func (m *minimizer) assemble(stmts []*traceEvent) []*traceEvent {
+	events := append(append([]*traceEvent{}, stmts...), m.failure)
+	txns := make(map[int64]struct{})
+	for _, ev := range events {
+		if ev.Txn != 0 {
+			txns[ev.Txn] = struct{}{}
+		}
+	}
+	for _, ev := range m.txnBoundaries {
+		if _, ok := txns[ev.Txn]; ok {
+			events = append(events, ev)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Seq < events[j].Seq })
+	return events
+}
+
+// diverges executes `ev` on both sessions and returns how it diverges, nil
+// means it doesn't. Without a reference session, a verify event is compared
+// with the rows recorded in the trace.
+func (m *minimizer) diverges(ev *traceEvent, target, ref *traceSession) *divergence {
+	switch ev.Kind {
+	case traceVerify:
+		actualRowsMap, err := target.query(ev)
+		if err != nil {
+			return nil
+		}
+		expected := ev.Rows
+		if ref != nil {
+			expectedRowsMap, err := ref.query(ev)
+			if err != nil {
+				return nil
+			}
+			expected = expandRowSignatures(expectedRowsMap)
+		}
+		actual := expandRowSignatures(actualRowsMap)
+		missing, unexpected := checkRowSignatures(expected, actualRowsMap)
+		if missing == "" && unexpected == "" {
+			return nil
+		}
+		sort.Strings(expected)
+		return &divergence{kind: ev.Kind, class: "rows", expected: expected, actual: actual}
+	case traceAdminCheck:
+		err := target.exec(ev)
+		if err == nil || adminCheckIgnoreError(SerialDDLTest, err) {
+			return nil
+		}
+		return &divergence{kind: ev.Kind, class: errorNumber(err), actual: []string{err.Error()}}
+	}
+	err := target.exec(ev)
+	if ref == nil {
+		return nil
+	}
+	refErr := ref.exec(ev)
+	if (err == nil) == (refErr == nil) {
+		return nil
+	}
+	d := &divergence{kind: ev.Kind, expected: []string{fmt.Sprintf("%v", refErr)}, actual: []string{fmt.Sprintf("%v", err)}}
+	if err != nil {
+		d.class = "target " + errorNumber(err)
+	} else {
+		d.class = "reference " + errorNumber(refErr)
+	}
+	return d
+}
+
+// dropIdentifiers tries to drop all statements on each table, column, index
+// or schema that is not used by the failure event.
+func (m *minimizer) dropIdentifiers(stmts []*traceEvent) []*traceEvent {
+	used := make(map[string]struct{})
+	for _, match := range identifierRe.FindAllStringSubmatch(m.failure.SQL, -1) {
+		used[match[1]] = struct{}{}
+	}
+	var names []string
+	seen := make(map[string]struct{})
+	for _, ev := range stmts {
+		for _, match := range identifierRe.FindAllStringSubmatch(ev.SQL, -1) {
+			if _, ok := seen[match[1]]; ok {
+				continue
+			}
+			seen[match[1]] = struct{}{}
+			if _, ok := used[match[1]]; !ok {
+				names = append(names, match[1])
+			}
+		}
+	}
+	for _, name := range names {
+		quoted := fmt.Sprintf("`%s`", name)
+		var rest []*traceEvent
+		for _, ev := range stmts {
+			if !strings.Contains(ev.SQL, quoted) {
+				rest = append(rest, ev)
+			}
+		}
+		if len(rest) < len(stmts) && m.reproduces(rest) {
+			stmts = rest
+		}
+	}
+	return stmts
+}
+
+// shrinkSelect drops the columns of the failing verify query one by one, as
+// long as the rows still diverge.
+func (m *minimizer) shrinkSelect(stmts []*traceEvent) {
+	sql := m.failure.SQL
+	fromIdx := strings.Index(sql, " FROM ")
+	if !strings.HasPrefix(sql, "SELECT ") || fromIdx < 0 {
+		return
+	}
+	columns := strings.Split(sql[len("SELECT "):fromIdx], ", ")
+	if len(columns) != len(m.failure.Kinds) {
+		return
+	}
+	kinds := m.failure.Kinds
+	for i := len(columns) - 1; i >= 0 && len(columns) > 1; i-- {
+		origin := m.failure
+		candidate := *origin
+		candidateColumns := append(append([]string{}, columns[:i]...), columns[i+1:]...)
+		candidate.Kinds = append(append([]int{}, kinds[:i]...), kinds[i+1:]...)
+		candidate.SQL = "SELECT " + strings.Join(candidateColumns, ", ") + sql[fromIdx:]
+		m.failure = &candidate
+		if m.reproduces(stmts) {
+			columns, kinds = candidateColumns, candidate.Kinds
+		} else {
+			m.failure = origin
+		}
+	}
+}
+
+// script returns the minimized statements as a SQL script, followed by the
+// divergence as comments.
+func (m *minimizer) script(tracePath string, stmts []*traceEvent) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "-- Minimized from %s, %d attempts.\n", tracePath, m.attempts)
+	fmt.Fprintf(&buf, "-- Statements of a transaction are sent on the same connection.\n")
+	for _, ev := range m.assemble(stmts) {
+		if ev.Txn != 0 {
+			fmt.Fprintf(&buf, "%s; -- txn %d\n", ev.SQL, ev.Txn)
+		} else {
+			fmt.Fprintf(&buf, "%s;\n", ev.SQL)
+		}
+	}
+	fmt.Fprintf(&buf, "-- The last statement diverges (%s %s).\n", m.divergence.kind, m.divergence.class)
+	fmt.Fprintf(&buf, "-- Expected:\n")
+	for _, row := range m.divergence.expected {
+		fmt.Fprintf(&buf, "--   %s\n", row)
+	}
+	fmt.Fprintf(&buf, "-- Actual:\n")
+	for _, row := range m.divergence.actual {
+		fmt.Fprintf(&buf, "--   %s\n", row)
+	}
+	return buf.Bytes()
+}
+
+func closeSessions(target, ref *traceSession) {
+	target.close()
+	if ref != nil {
+		ref.close()
+	}
+}
+
+// errorNumber returns the MySQL error number of `err`, or the message if
+// `err` has no number.
+func errorNumber(err error) string {
+	if match := errorNumberRe.FindStringSubmatch(err.Error()); match != nil {
+		return match[1]
+	}
+	return err.Error()
+}
+
+// expandRowSignatures returns the sorted row signatures in `rowsMap`, with
+// each signature repeated by its number of occurrences.
+func expandRowSignatures(rowsMap map[string]int) []string {
+	var rows []string
+	for rowString, occurs := range rowsMap {
+		for i := 0; i < occurs; i++ {
+			rows = append(rows, rowString)
+		}
+	}
+	sort.Strings(rows)
+	return rows
+}
+
+// groupByTxn groups `stmts` into units, where statements of a transaction
+// are in the same unit and any other statement is a unit by itself.
+func groupByTxn(stmts []*traceEvent) [][]*traceEvent {
+	var units [][]*traceEvent
+	txnUnit := make(map[int64]int)
+	for _, ev := range stmts {
+		if ev.Txn == 0 {
+			units = append(units, []*traceEvent{ev})
+			continue
+		}
+		if idx, ok := txnUnit[ev.Txn]; ok {
+			units[idx] = append(units[idx], ev)
+			continue
+		}
+		txnUnit[ev.Txn] = len(units)
+		units = append(units, []*traceEvent{ev})
+	}
+	return units
+}
+
+func flattenUnits(units [][]*traceEvent, idx []int) []*traceEvent {
+	var stmts []*traceEvent
+	for _, i := range idx {
+		stmts = append(stmts, units[i]...)
+	}
+	sort.Slice(stmts, func(i, j int) bool { return stmts[i].Seq < stmts[j].Seq })
+	return stmts
+}
+
+func pickEvents(events []*traceEvent, idx []int) []*traceEvent {
+	picked := make([]*traceEvent, 0, len(idx))
+	for _, i := range idx {
+		picked = append(picked, events[i])
+	}
+	return picked
+}
+
+// ddmin returns a 1-minimal subset of the indexes [0, n) that `test` still
+// holds for, with the delta debugging algorithm by Zeller. The indexes in the
+// subset, and in every subset passed to `test`, are in ascending order.
+func ddmin(n int, test func([]int) bool) []int {
+	items := make([]int, n)
+	for i := range items {
+		items[i] = i
+	}
+	if n > 0 && test(nil) {
+		return nil
+	}
+	granularity := 2
+	for len(items) >= 2 {
+		chunks := splitIndexes(items, granularity)
+		reduced := false
+		for _, chunk := range chunks {
+			if test(chunk) {
+				items, granularity, reduced = chunk, 2, true
+				break
+			}
+		}
+		if !reduced && len(chunks) > 2 {
+			for i := range chunks {
+				complement := make([]int, 0, len(items))
+				for j, chunk := range chunks {
+					if j != i {
+						complement = append(complement, chunk...)
+					}
+				}
+				if test(complement) {
+					items, reduced = complement, true
+					if granularity--; granularity < 2 {
+						granularity = 2
+					}
+					break
+				}
+			}
+		}
+		if !reduced {
+			if granularity >= len(items) {
+				break
+			}
+			granularity *= 2
+			if granularity > len(items) {
+				granularity = len(items)
+			}
+		}
+	}
+	return items
+}
+
+// splitIndexes splits `items` into `n` chunks of almost the same size.
+func splitIndexes(items []int, n int) [][]int {
+	chunks := make([][]int, 0, n)
+	start := 0
+	for i := 0; i < n; i++ {
+		end := start + (len(items)-start)/(n-i)
+		chunks = append(chunks, items[start:end])
+		start = end
+	}
+	return chunks
+}
@@ -0,0 +1,46 @@
+package ddl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDDMin(t *testing.T) {
+	// The failure needs both 3 and 7.
+	attempts := 0
+	kept := ddmin(10, func(idx []int) bool {
+		attempts++
+		has3, has7 := false, false
+		for _, i := range idx {
+			has3 = has3 || i == 3
+			has7 = has7 || i == 7
+		}
+		return has3 && has7
+	})
+	assert.Equal(t, []int{3, 7}, kept)
+	assert.True(t, attempts < 45)
+
+	// The failure needs nothing.
+	assert.Len(t, ddmin(5, func([]int) bool { return true }), 0)
+	// The failure needs everything.
+	assert.Equal(t, []int{0, 1, 2}, ddmin(3, func(idx []int) bool { return len(idx) == 3 }))
+}
+
+func TestGroupByTxn(t *testing.T) {
+	stmts := []*traceEvent{
+		{Seq: 1},
+		{Seq: 2, Txn: 1},
+		{Seq: 3},
+		{Seq: 4, Txn: 1},
+		{Seq: 5, Txn: 2},
+	}
+	units := groupByTxn(stmts)
+	assert.Len(t, units, 4)
+	assert.Len(t, units[1], 2)
+	picked := flattenUnits(units, []int{1, 2})
+	assert.Len(t, picked, 3)
+	assert.Equal(t, int64(2), picked[0].Seq)
+	assert.Equal(t, int64(3), picked[1].Seq)
+	assert.Equal(t, int64(4), picked[2].Seq)
+}
@@ -0,0 +1,438 @@
+package ddl
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// A multi-schema change is an ALTER TABLE with several clauses, each adding,
+// dropping or modifying a column, or adding or dropping an index. Each clause
+// is a sub-task of the same kind and argument as the single DDL, and the
+// clauses change different columns and indexes, unless the statement is
+// generated to conflict. The server applies all the clauses or none, and so
+// does the model, see `multiSchemaChangeJob`.
+
+// MultiSchemaChangeClauses is the maximum number of clauses of a multi-schema
+// change.
+var MultiSchemaChangeClauses = 4
+
+// MultiSchemaConflictProbability is the probability that a multi-schema change
+// drops a column twice, indexes a column it drops, or adds an index twice.
+var MultiSchemaConflictProbability = 0.1
+
+type ddlMultiSchemaChangeArg struct {
+	subTasks []*ddlJobTask
+}
+
+// multiSchemaClauses picks the columns and indexes of the clauses of a
+// multi-schema change, `used` are the ones changed by the clauses so far.
+type multiSchemaClauses struct {
+	r           *rand.Rand
+	table       *ddlTestTable
+	used        map[*ddlTestColumn]bool
+	usedIndexes map[*ddlTestIndex]bool
+	dropped     int
+	subTasks    []*ddlJobTask
+}
+
+func (c *testCase) generateMultiSchemaChange() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareMultiSchemaChange, nil, ddlMultiSchemaChange})
+	return nil
+}
+
+func (c *testCase) prepareMultiSchemaChange(_ interface{}, taskCh chan *ddlJobTask) error {
+	table := c.pickupRandomTable(c.ddlRand)
+	if table == nil {
+		return nil
+	}
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	clauses := &multiSchemaClauses{
+		r:           c.ddlRand,
+		table:       table,
+		used:        make(map[*ddlTestColumn]bool),
+		usedIndexes: make(map[*ddlTestIndex]bool),
+	}
+	n := c.ddlRand.Intn(MultiSchemaChangeClauses-1) + 2
+	for i := 0; i < 2*n && len(clauses.subTasks) < n; i++ {
+		var sub *ddlJobTask
+		switch c.ddlRand.Intn(5) {
+		case 0:
+			sub = clauses.addColumn()
+		case 1:
+			sub = clauses.dropColumn()
+		case 2:
+			sub = c.modifyColumnClause(clauses)
+		case 3:
+			sub = clauses.addIndex()
+		case 4:
+			sub = clauses.dropIndex()
+		}
+		if sub != nil {
+			clauses.subTasks = append(clauses.subTasks, sub)
+		}
+	}
+	if len(clauses.subTasks) < 2 {
+		return nil
+	}
+	if c.ddlRand.Float64() < MultiSchemaConflictProbability {
+		if sub := clauses.conflict(); sub != nil {
+			clauses.subTasks = append(clauses.subTasks, sub)
+		}
+	}
+	sqls := make([]string, 0, len(clauses.subTasks))
+	for _, sub := range clauses.subTasks {
+		if sub.k == ddlDropColumn {
+			(*ddlColumnJobArg)(sub.arg).column.setDeleted()
+		}
+		sqls = append(sqls, sub.sql)
+	}
+	task := &ddlJobTask{
+		k:       ddlMultiSchemaChange,
+		sql:     fmt.Sprintf("ALTER TABLE %s %s", table.quotedName(), strings.Join(sqls, ", ")),
+		tblInfo: table,
+		arg:     ddlJobArg(&ddlMultiSchemaChangeArg{subTasks: clauses.subTasks}),
+	}
+	taskCh <- task
+	return nil
+}
+
+func (clauses *multiSchemaClauses) newSubTask(k DDLKind, sql string, arg ddlJobArg) *ddlJobTask {
+	return &ddlJobTask{k: k, sql: sql, tblInfo: clauses.table, arg: arg}
+}
+
+// pickupColumn returns a random column that no clause changes yet and
+// satisfies `pred`, or nil if there is none.
+func (clauses *multiSchemaClauses) pickupColumn(pred func(*ddlTestColumn) bool) *ddlTestColumn {
+	columns := clauses.table.filterColumns(func(col *ddlTestColumn) bool {
+		return !clauses.used[col] && !col.isRenamed() && pred(col)
+	})
+	if len(columns) == 0 {
+		return nil
+	}
+	return columns[clauses.r.Intn(len(columns))]
+}
+
+// canChange reports whether a clause may drop or modify the column. The
+// generated columns and their dependencies, the auto ID column and the
+// partitioning column are left to the single DDLs.
+func (clauses *multiSchemaClauses) canChange(col *ddlTestColumn) bool {
+	table := clauses.table
+	return !col.isGenerated() && !col.hasGenerateCol() && !col.isAutoID() &&
+		(table.partition == nil || table.partition.column != col)
+}
+
+// The new columns are added at the end, and the modified ones keep their
+// positions, so that the order of the columns doesn't depend on the order in
+// which the server applies the clauses.
+func (clauses *multiSchemaClauses) addColumn() *ddlJobTask {
+	column := getRandDDLTestColumn(clauses.r)
+	column.setRandNotNull(clauses.r, false)
+	return clauses.newSubTask(ddlAddColumn, fmt.Sprintf("ADD COLUMN `%s` %s", column.name, column.getDefinition()),
+		ddlJobArg(&ddlColumnJobArg{column: column, strategy: ddlTestAddDropColumnStrategyAtEnd}))
+}
+
+func (clauses *multiSchemaClauses) dropColumn() *ddlJobTask {
+	// A table keeps one column at least.
+	if clauses.dropped+1 >= len(clauses.table.filterColumns(clauses.table.predicateAll)) {
+		return nil
+	}
+	column := clauses.pickupColumn(func(col *ddlTestColumn) bool {
+		return clauses.canChange(col) && !col.isPrimaryKey && col.indexReferences == 0
+	})
+	if column == nil {
+		return nil
+	}
+	clauses.used[column] = true
+	clauses.dropped++
+	return clauses.newSubTask(ddlDropColumn, fmt.Sprintf("DROP COLUMN `%s`", column.name),
+		ddlJobArg(&ddlColumnJobArg{column: column, strategy: ddlTestAddDropColumnStrategyAtRandom}))
+}
+
+func (c *testCase) modifyColumnClause(clauses *multiSchemaClauses) *ddlJobTask {
+	table := clauses.table
+	origColumn := clauses.pickupColumn(clauses.canChange)
+	if origColumn == nil {
+		return nil
+	}
+	if fk, _ := c.foreignKeyOnColumn(table, origColumn); fk != nil {
+		return nil
+	}
+	column := generateRandModifiedColumn(clauses.r, origColumn, false)
+	if column == nil || !table.canChangeType(origColumn, column) {
+		return nil
+	}
+	if !origColumn.isPrimaryKey && clauses.r.Float64() < NotNullProbability {
+		column.notNull = !origColumn.notNull
+	}
+	clauses.used[origColumn] = true
+	return clauses.newSubTask(ddlModifyColumn, fmt.Sprintf("MODIFY COLUMN `%s` %s", origColumn.name, column.getDefinition()),
+		ddlJobArg(&ddlColumnJobArg{
+			origColumnIndex:   table.columns.IndexOf(origColumn),
+			origColumn:        origColumn,
+			column:            column,
+			strategy:          ddlTestAddDropColumnStrategyAtRandom,
+			insertAfterColumn: origColumn,
+		}))
+}
+
+func (clauses *multiSchemaClauses) addIndex() *ddlJobTask {
+	table := clauses.table
+	index := &ddlTestIndex{name: RandName(clauses.r), unique: clauses.r.Intn(3) == 0}
+	for i := clauses.r.Intn(3); i >= 0; i-- {
+		column := clauses.pickupColumn(func(col *ddlTestColumn) bool {
+			return col.canBeIndex() && !containsColumn(index.columns, col)
+		})
+		if column == nil {
+			break
+		}
+		index.columns = append(index.columns, column)
+		index.signature += column.name + ","
+		if column.isGenerated() {
+			index.unique = false
+		}
+	}
+	if len(index.columns) == 0 {
+		return nil
+	}
+	if index.unique && table.partition != nil && !containsColumn(index.columns, table.partition.column) {
+		index.unique = false
+	}
+	for _, idx := range table.indexes {
+		if idx.signature == index.signature {
+			return nil
+		}
+	}
+	for _, column := range index.columns {
+		clauses.used[column] = true
+	}
+	return clauses.newSubTask(ddlAddIndex, index.clause(), ddlJobArg(&ddlIndexJobArg{index: index}))
+}
+
+func (clauses *multiSchemaClauses) dropIndex() *ddlJobTask {
+	candidates := make([]*ddlTestIndex, 0, len(clauses.table.indexes))
+	for _, index := range clauses.table.indexes {
+		if clauses.usedIndexes[index] {
+			continue
+		}
+		free := true
+		for _, column := range index.columns {
+			free = free && !clauses.used[column]
+		}
+		if free {
+			candidates = append(candidates, index)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	index := candidates[clauses.r.Intn(len(candidates))]
+	clauses.usedIndexes[index] = true
+	for _, column := range index.columns {
+		clauses.used[column] = true
+	}
+	return clauses.newSubTask(ddlDropIndex, fmt.Sprintf("DROP INDEX `%s`", index.name), ddlJobArg(&ddlIndexJobArg{index: index}))
+}
+
+// conflict returns a clause that conflicts with one of the clauses, which
+// makes the statement fail on both TiDB and MySQL: it drops the same column
+// again, indexes a dropped column or adds an index of the same name again.
+func (clauses *multiSchemaClauses) conflict() *ddlJobTask {
+	candidates := make([]*ddlJobTask, 0, len(clauses.subTasks))
+	for _, sub := range clauses.subTasks {
+		if sub.k == ddlDropColumn || sub.k == ddlAddIndex {
+			candidates = append(candidates, sub)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sub := candidates[clauses.r.Intn(len(candidates))]
+	if sub.k == ddlDropColumn && clauses.r.Intn(2) == 0 {
+		column := (*ddlColumnJobArg)(sub.arg).column
+		index := &ddlTestIndex{name: RandName(clauses.r), signature: column.name + ",", columns: []*ddlTestColumn{column}}
+		return clauses.newSubTask(ddlAddIndex, index.clause(), ddlJobArg(&ddlIndexJobArg{index: index}))
+	}
+	return clauses.newSubTask(sub.k, sub.sql, sub.arg)
+}
+
+// expectConflictError returns the error of a multi-schema change whose
+// clauses conflict. TiDB fails with 8200 for any conflict, and MySQL with
+// `code`, which is 1091, 1072 or 1061 depending on the clauses.
+func (c *testCase) expectConflictError(code uint16, format string, args ...interface{}) error {
+	if !c.cfg.MySQLCompatible {
+		code = errCodeUnsupportedDDLOperation
+	}
+	return expectError(code, format, args...)
+}
+
+// conflictingClauses returns the error of a multi-schema change if two of its
+// clauses change the same column or index, or one indexes a column that
+// another drops or modifies, see `expectConflictError`.
+func (c *testCase) conflictingClauses(table *ddlTestTable, subTasks []*ddlJobTask) error {
+	changed := make(map[*ddlTestColumn]bool)
+	indexes := make(map[string]bool)
+	var indexed []*ddlTestColumn
+	for _, sub := range subTasks {
+		var column *ddlTestColumn
+		switch sub.k {
+		case ddlDropColumn:
+			column = (*ddlColumnJobArg)(sub.arg).column
+		case ddlModifyColumn:
+			column = (*ddlColumnJobArg)(sub.arg).origColumn
+		case ddlAddIndex, ddlDropIndex:
+			index := (*ddlIndexJobArg)(sub.arg).index
+			if indexes[index.name] {
+				code := errCodeCantDropFieldOrKey
+				if sub.k == ddlAddIndex {
+					code = errCodeDupKeyName
+				}
+				return c.expectConflictError(code, "index %s of table %s is changed twice", index.name, table.name)
+			}
+			indexes[index.name] = true
+			if sub.k == ddlAddIndex {
+				indexed = append(indexed, index.columns...)
+			}
+		}
+		if column == nil {
+			continue
+		}
+		if changed[column] {
+			return c.expectConflictError(errCodeCantDropFieldOrKey, "column %s of table %s is changed twice", column.name, table.name)
+		}
+		changed[column] = true
+	}
+	for _, column := range indexed {
+		if changed[column] {
+			return c.expectConflictError(errCodeKeyColumnNotExists, "column %s of table %s is indexed and changed", column.name, table.name)
+		}
+	}
+	return nil
+}
+
+// multiSchemaChangeJob applies the clauses in order. If one fails, the rest
+// are still applied to find all the errors the server may report, and then
+// the table is restored.
+func (c *testCase) multiSchemaChangeJob(task *ddlJobTask) error {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	table := task.tblInfo
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	arg := (*ddlMultiSchemaChangeArg)(task.arg)
+	if c.isTableDeleted(table) {
+		arg.recoverDroppedColumns()
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
+	}
+	if err := c.conflictingClauses(table, arg.subTasks); err != nil {
+		arg.recoverDroppedColumns()
+		return err
+	}
+	snapshot := c.snapshotTable(table)
+	var errs []error
+	for _, sub := range arg.subTasks {
+		sub.err = task.err
+		var err error
+		switch sub.k {
+		case ddlAddColumn:
+			err = c.applyAddColumn(sub)
+		case ddlDropColumn:
+			err = c.applyDropColumn(sub)
+		case ddlModifyColumn:
+			err = c.applyModifyColumn(sub)
+		case ddlAddIndex:
+			err = c.applyAddIndex(sub)
+		case ddlDropIndex:
+			err = c.dropIndexJob(sub)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		snapshot.restore()
+		arg.recoverDroppedColumns()
+		return chooseExpectedError(task.err, errs...)
+	}
+	return nil
+}
+
+func (arg *ddlMultiSchemaChangeArg) recoverDroppedColumns() {
+	for _, sub := range arg.subTasks {
+		if sub.k == ddlDropColumn {
+			(*ddlColumnJobArg)(sub.arg).column.setDeletedRecover()
+		}
+	}
+}
+
+// tableSnapshot is the part of a table that the jobs of the clauses of a
+// multi-schema change modify, see `restore`.
+type tableSnapshot struct {
+	table            *ddlTestTable
+	columns          []interface{}
+	primaryKey       []*ddlTestColumn
+	indexes          []*ddlTestIndex
+	indexColumns     [][]*ddlTestColumn
+	checks           []*ddlTestCheck
+	checkColumns     []*ddlTestColumn
+	fkColumns        map[*ddlTestForeignKey][2]*ddlTestColumn
+	indexReferences  map[*ddlTestColumn]int
+	dependenciedCols map[*ddlTestColumn][]*ddlTestColumn
+}
+
+// snapshotTable copies the part of the table that the column and index jobs
+// modify. The caller should hold `c.tablesLock` and the lock of the table.
+func (c *testCase) snapshotTable(table *ddlTestTable) *tableSnapshot {
+	s := &tableSnapshot{
+		table:            table,
+		columns:          table.columns.Values(),
+		primaryKey:       append([]*ddlTestColumn(nil), table.primaryKey...),
+		indexes:          append([]*ddlTestIndex(nil), table.indexes...),
+		checks:           append([]*ddlTestCheck(nil), table.checks...),
+		fkColumns:        make(map[*ddlTestForeignKey][2]*ddlTestColumn),
+		indexReferences:  make(map[*ddlTestColumn]int, table.columns.Size()),
+		dependenciedCols: make(map[*ddlTestColumn][]*ddlTestColumn, table.columns.Size()),
+	}
+	for _, index := range table.indexes {
+		s.indexColumns = append(s.indexColumns, append([]*ddlTestColumn(nil), index.columns...))
+	}
+	for _, check := range table.checks {
+		s.checkColumns = append(s.checkColumns, check.column)
+	}
+	for _, fk := range table.foreignKeys {
+		s.fkColumns[fk] = [2]*ddlTestColumn{fk.column, fk.refColumn}
+	}
+	for _, ref := range c.referencingForeignKeys(table) {
+		s.fkColumns[ref.fk] = [2]*ddlTestColumn{ref.fk.column, ref.fk.refColumn}
+	}
+	for ite := table.columns.Iterator(); ite.Next(); {
+		column := ite.Value().(*ddlTestColumn)
+		s.indexReferences[column] = column.indexReferences
+		s.dependenciedCols[column] = append([]*ddlTestColumn(nil), column.dependenciedCols...)
+	}
+	return s
+}
+
+// restore undoes the changes of the table since the snapshot.
+func (s *tableSnapshot) restore() {
+	table := s.table
+	table.columns.Clear()
+	table.columns.Add(s.columns...)
+	table.primaryKey = s.primaryKey
+	table.indexes = s.indexes
+	for i, index := range s.indexes {
+		index.columns = s.indexColumns[i]
+	}
+	table.checks = s.checks
+	for i, check := range s.checks {
+		check.column = s.checkColumns[i]
+	}
+	for fk, columns := range s.fkColumns {
+		fk.column, fk.refColumn = columns[0], columns[1]
+	}
+	for column, n := range s.indexReferences {
+		column.indexReferences = n
+		column.dependenciedCols = s.dependenciedCols[column]
+	}
+}
@@ -0,0 +1,99 @@
+package ddl
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/emirpasic/gods/lists/arraylist"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMultiSchemaTable() (*testCase, *ddlTestTable) {
+	a := &ddlTestColumn{k: KindInt32, name: "a", fieldType: "INT", rows: arraylist.New()}
+	b := &ddlTestColumn{k: KindInt32, name: "b", fieldType: "INT", rows: arraylist.New()}
+	table := &ddlTestTable{
+		name:    "t",
+		columns: arraylist.New(a, b),
+		indexes: []*ddlTestIndex{{name: "idx", signature: "a,", columns: []*ddlTestColumn{a}}},
+		lock:    new(sync.RWMutex),
+	}
+	a.indexReferences = 1
+	table.addRows([][]interface{}{{int32(1), int32(2)}, {int32(1), int32(3)}})
+	return &testCase{tables: map[objectKey]*ddlTestTable{table.key(): table}}, table
+}
+
+func newMultiSchemaTask(table *ddlTestTable, subTasks ...*ddlJobTask) *ddlJobTask {
+	for _, sub := range subTasks {
+		sub.tblInfo = table
+	}
+	return &ddlJobTask{k: ddlMultiSchemaChange, tblInfo: table, arg: ddlJobArg(&ddlMultiSchemaChangeArg{subTasks: subTasks})}
+}
+
+func TestMultiSchemaChange(t *testing.T) {
+	c, table := newMultiSchemaTable()
+	a := getColumnFromArrayList(table.columns, 0)
+	b := getColumnFromArrayList(table.columns, 1)
+	d := &ddlTestColumn{k: KindInt32, name: "d", fieldType: "INT", defaultValue: int32(0)}
+	index := &ddlTestIndex{name: "u", unique: true, columns: []*ddlTestColumn{b}}
+	task := newMultiSchemaTask(table,
+		&ddlJobTask{k: ddlAddColumn, arg: ddlJobArg(&ddlColumnJobArg{column: d, strategy: ddlTestAddDropColumnStrategyAtEnd})},
+		&ddlJobTask{k: ddlDropIndex, arg: ddlJobArg(&ddlIndexJobArg{index: table.indexes[0]})},
+		&ddlJobTask{k: ddlAddIndex, arg: ddlJobArg(&ddlIndexJobArg{index: index})})
+	assert.NoError(t, c.multiSchemaChangeJob(task))
+	assert.Equal(t, "CREATE TABLE `t` (`a` INT NULL, `b` INT NULL, `d` INT NULL DEFAULT '0', UNIQUE INDEX `u` (`b`)) "+
+		"COMMENT '' CHARACTER SET '' COLLATE ''", table.createTableSQL())
+	assert.Equal(t, 0, a.indexReferences)
+	assert.Equal(t, 1, b.indexReferences)
+
+	// The unique index on `a` fails, and the other clauses are undone.
+	c, table = newMultiSchemaTable()
+	a = getColumnFromArrayList(table.columns, 0)
+	b = getColumnFromArrayList(table.columns, 1)
+	sql := table.createTableSQL()
+	b.setDeleted()
+	task = newMultiSchemaTask(table,
+		&ddlJobTask{k: ddlDropColumn, arg: ddlJobArg(&ddlColumnJobArg{column: b})},
+		&ddlJobTask{k: ddlDropIndex, arg: ddlJobArg(&ddlIndexJobArg{index: table.indexes[0]})},
+		&ddlJobTask{k: ddlAddIndex, arg: ddlJobArg(&ddlIndexJobArg{index: &ddlTestIndex{name: "u", unique: true, columns: []*ddlTestColumn{a}}})})
+	assert.Equal(t, errCodeDupEntry, expectedErrorCode(c.multiSchemaChangeJob(task)))
+	assert.Equal(t, sql, table.createTableSQL())
+	assert.Equal(t, 1, a.indexReferences)
+	assert.False(t, b.isDeleted())
+}
+
+func TestConflictingClauses(t *testing.T) {
+	_, table := newMultiSchemaTable()
+	b := getColumnFromArrayList(table.columns, 1)
+	drop := &ddlJobTask{k: ddlDropColumn, arg: ddlJobArg(&ddlColumnJobArg{column: b})}
+	addIndex := &ddlJobTask{k: ddlAddIndex, arg: ddlJobArg(&ddlIndexJobArg{index: &ddlTestIndex{name: "i", columns: []*ddlTestColumn{b}}})}
+	dropIndex := &ddlJobTask{k: ddlDropIndex, arg: ddlJobArg(&ddlIndexJobArg{index: table.indexes[0]})}
+	c := &testCase{cfg: &DDLCaseConfig{MySQLCompatible: true}}
+	assert.NoError(t, c.conflictingClauses(table, []*ddlJobTask{drop, dropIndex}))
+	assert.Equal(t, errCodeCantDropFieldOrKey, expectedErrorCode(c.conflictingClauses(table, []*ddlJobTask{drop, drop})))
+	assert.Equal(t, errCodeKeyColumnNotExists, expectedErrorCode(c.conflictingClauses(table, []*ddlJobTask{addIndex, drop})))
+	assert.Equal(t, errCodeDupKeyName, expectedErrorCode(c.conflictingClauses(table, []*ddlJobTask{addIndex, dropIndex, addIndex})))
+	// TiDB fails with its own code for any conflict.
+	c.cfg.MySQLCompatible = false
+	assert.NoError(t, c.conflictingClauses(table, []*ddlJobTask{drop, dropIndex}))
+	assert.Equal(t, errCodeUnsupportedDDLOperation, expectedErrorCode(c.conflictingClauses(table, []*ddlJobTask{drop, drop})))
+	assert.Equal(t, errCodeUnsupportedDDLOperation, expectedErrorCode(c.conflictingClauses(table, []*ddlJobTask{addIndex, drop})))
+	assert.Equal(t, errCodeUnsupportedDDLOperation, expectedErrorCode(c.conflictingClauses(table, []*ddlJobTask{addIndex, dropIndex, addIndex})))
+}
+
+func TestRenameColumn(t *testing.T) {
+	c, table := newMultiSchemaTable()
+	a := getColumnFromArrayList(table.columns, 0)
+	renamed := *a
+	renamed.name = "c"
+	a.setRenamed()
+	task := &ddlJobTask{k: ddlRenameColumn, tblInfo: table, arg: ddlJobArg(&ddlColumnJobArg{
+		origColumn:        a,
+		column:            &renamed,
+		strategy:          ddlTestAddDropColumnStrategyAtRandom,
+		insertAfterColumn: a,
+	})}
+	assert.NoError(t, c.updateTableInfo(task))
+	assert.Equal(t, "CREATE TABLE `t` (`c` INT NULL, `b` INT NULL, INDEX `idx` (`c`)) COMMENT '' CHARACTER SET '' COLLATE ''", table.createTableSQL())
+	assert.Equal(t, []interface{}{int32(1), int32(1)}, renamed.rows.Values())
+	assert.True(t, task.isJobKind(ddlModifyColumn))
+}
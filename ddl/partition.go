@@ -0,0 +1,808 @@
+package ddl
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// A table may be partitioned by RANGE, LIST, HASH or KEY on an integer
+// column, see `AllowPartitionType`. The model doesn't record the partition of
+// each row, it is computed from the value of the partitioning column by
+// `locate`, so that the rows move between partitions with the definitions.
+// The hash function of KEY partitioning is internal to the server, so the
+// partition of a row is unknown then.
+
+type ddlTestPartitionType int
+
+const (
+	partitionByRange ddlTestPartitionType = iota
+	partitionByList
+	partitionByHash
+	partitionByKey
+)
+
+func (tp ddlTestPartitionType) String() string {
+	return [...]string{"RANGE", "LIST", "HASH", "KEY"}[tp]
+}
+
+// PartitionedTableProbability is the probability of creating a table
+// partitioned.
+var PartitionedTableProbability = 0.3
+
+// ddlTestPartitionDef is a partition of a RANGE or LIST partitioned table.
+type ddlTestPartitionDef struct {
+	name     string
+	lessThan int64 // VALUES LESS THAN (lessThan) of RANGE, unless maxValue is set.
+	maxValue bool
+	values   []int64 // VALUES IN (values) of LIST.
+}
+
+func (def *ddlTestPartitionDef) definition(tp ddlTestPartitionType) string {
+	switch {
+	case tp == partitionByList:
+		values := make([]string, 0, len(def.values))
+		for _, v := range def.values {
+			values = append(values, fmt.Sprintf("%d", v))
+		}
+		return fmt.Sprintf("PARTITION `%s` VALUES IN (%s)", def.name, strings.Join(values, ","))
+	case def.maxValue:
+		return fmt.Sprintf("PARTITION `%s` VALUES LESS THAN MAXVALUE", def.name)
+	default:
+		return fmt.Sprintf("PARTITION `%s` VALUES LESS THAN (%d)", def.name, def.lessThan)
+	}
+}
+
+// ddlTestPartition is the partitioning of a table. It is never changed once
+// created, the DDL jobs replace it with a new one instead.
+type ddlTestPartition struct {
+	tp     ddlTestPartitionType
+	column *ddlTestColumn
+	defs   []*ddlTestPartitionDef // the partitions of RANGE and LIST.
+	num    int                    // the number of partitions of HASH and KEY.
+	nextID int                    // the new partitions are named p<nextID>, p<nextID+1> and so on.
+}
+
+// newRandPartition returns a random partitioning on `column`.
+func newRandPartition(r *rand.Rand, column *ddlTestColumn) *ddlTestPartition {
+	p := &ddlTestPartition{
+		tp:     ddlTestPartitionType(r.Intn(int(partitionByKey) + 1)),
+		column: column,
+	}
+	min, max := intKindRange(column.k)
+	n := r.Intn(4) + 2
+	switch p.tp {
+	case partitionByRange:
+		bounds := make(map[int64]struct{}, n)
+		for len(bounds) < n {
+			bounds[randInt64Between(r, min+1, max)] = struct{}{}
+		}
+		sorted := make([]int64, 0, n)
+		for bound := range bounds {
+			sorted = append(sorted, bound)
+		}
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		for _, bound := range sorted {
+			p.defs = append(p.defs, &ddlTestPartitionDef{name: p.newName(), lessThan: bound})
+		}
+		p.defs[n-1].maxValue = r.Intn(2) == 0
+	case partitionByList:
+		used := make(map[int64]struct{})
+		for i := 0; i < n; i++ {
+			p.defs = append(p.defs, &ddlTestPartitionDef{name: p.newName(), values: randListValues(r, column.k, used)})
+		}
+	default:
+		p.num = n
+	}
+	return p
+}
+
+// randListValues returns 1 to 3 random values of the kind `k` that aren't in
+// `used`, and adds them to `used`.
+func randListValues(r *rand.Rand, k int, used map[int64]struct{}) []int64 {
+	min, max := intKindRange(k)
+	values := make([]int64, 0, 3)
+	for n := r.Intn(3) + 1; len(values) < n; {
+		v := randInt64Between(r, min, max)
+		if _, ok := used[v]; !ok {
+			used[v] = struct{}{}
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func (p *ddlTestPartition) newName() string {
+	p.nextID++
+	return fmt.Sprintf("p%d", p.nextID-1)
+}
+
+func (p *ddlTestPartition) clone() *ddlTestPartition {
+	newPart := *p
+	newPart.defs = append([]*ddlTestPartitionDef(nil), p.defs...)
+	return &newPart
+}
+
+// definition returns the PARTITION BY clause of CREATE TABLE.
+func (p *ddlTestPartition) definition() string {
+	if p.tp == partitionByHash || p.tp == partitionByKey {
+		return fmt.Sprintf("PARTITION BY %s (`%s`) PARTITIONS %d", p.tp, p.column.name, p.num)
+	}
+	defs := make([]string, 0, len(p.defs))
+	for _, def := range p.defs {
+		defs = append(defs, def.definition(p.tp))
+	}
+	return fmt.Sprintf("PARTITION BY %s (`%s`) (%s)", p.tp, p.column.name, strings.Join(defs, ", "))
+}
+
+// names returns the names of the partitions in order. The partitions of
+// HASH and KEY are named p0, p1 and so on by the server.
+func (p *ddlTestPartition) names() []string {
+	if p.tp == partitionByHash || p.tp == partitionByKey {
+		names := make([]string, 0, p.num)
+		for i := 0; i < p.num; i++ {
+			names = append(names, fmt.Sprintf("p%d", i))
+		}
+		return names
+	}
+	names := make([]string, 0, len(p.defs))
+	for _, def := range p.defs {
+		names = append(names, def.name)
+	}
+	return names
+}
+
+// index returns the position of the partition `name`, or -1 if there is no
+// such partition.
+func (p *ddlTestPartition) index(name string) int {
+	for i, n := range p.names() {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// isLocatable returns whether the partition of a row is known by the model.
+func (p *ddlTestPartition) isLocatable() bool {
+	return p.tp != partitionByKey
+}
+
+// locate returns the position of the partition of a row whose partitioning
+// column is `value`, or -1 if no partition accepts the value.
+func (p *ddlTestPartition) locate(value interface{}) int {
+	v, ok := partitionValue(value)
+	switch p.tp {
+	case partitionByRange:
+		// NULL is less than any value.
+		for i, def := range p.defs {
+			if !ok || def.maxValue || v < def.lessThan {
+				return i
+			}
+		}
+	case partitionByList:
+		if !ok {
+			return -1
+		}
+		for i, def := range p.defs {
+			for _, value := range def.values {
+				if value == v {
+					return i
+				}
+			}
+		}
+	case partitionByHash:
+		// NULL is hashed as 0.
+		idx := v % int64(p.num)
+		if idx < 0 {
+			idx = -idx
+		}
+		return int(idx)
+	}
+	return -1
+}
+
+// randValue returns a random value of the partitioning column, which is
+// accepted by a random partition.
+func (p *ddlTestPartition) randValue(r *rand.Rand) interface{} {
+	min, max := intKindRange(p.column.k)
+	switch p.tp {
+	case partitionByRange:
+		i := r.Intn(len(p.defs))
+		lower, upper := min, max
+		if i > 0 {
+			lower = p.defs[i-1].lessThan
+		}
+		if !p.defs[i].maxValue {
+			upper = p.defs[i].lessThan - 1
+		}
+		return intValueOfKind(p.column.k, randInt64Between(r, lower, upper))
+	case partitionByList:
+		def := p.defs[r.Intn(len(p.defs))]
+		return intValueOfKind(p.column.k, def.values[r.Intn(len(def.values))])
+	}
+	return p.column.randValue(r)
+}
+
+// canBePartitionColumn returns whether the column can be the partitioning
+// column of a table.
+func (col *ddlTestColumn) canBePartitionColumn() bool {
+	if col.isGenerated() {
+		return false
+	}
+	for _, k := range AllowPartitionType {
+		if col.k == k {
+			return true
+		}
+	}
+	return false
+}
+
+// randColumnValue returns a random value of `col`, the values of the
+// partitioning column mostly fall in one of the partitions.
+func (table *ddlTestTable) randColumnValue(r *rand.Rand, col *ddlTestColumn) interface{} {
+	if table.partition != nil && table.partition.column == col && r.Intn(10) > 0 {
+		return table.partition.randValue(r)
+	}
+	return col.randValue(r)
+}
+
+// isIntegerKind reports whether `k` is an integer kind.
+func isIntegerKind(k int) bool {
+	return k >= KindTINYINT && k <= KindBigInt
+}
+
+// intKindRange returns the range of the integer kind `k`.
+func intKindRange(k int) (int64, int64) {
+	switch k {
+	case KindTINYINT:
+		return math.MinInt8, math.MaxInt8
+	case KindSMALLINT:
+		return math.MinInt16, math.MaxInt16
+	case KindMEDIUMINT:
+		return -1 << 23, 1<<23 - 1
+	case KindInt32:
+		return math.MinInt32, math.MaxInt32
+	default:
+		return math.MinInt64, math.MaxInt64
+	}
+}
+
+// intValueOfKind converts `v` to the type of the values that `randValue`
+// returns for the integer kind `k`.
+func intValueOfKind(k int, v int64) interface{} {
+	if k < KindInt32 {
+		return int32(v)
+	}
+	return v
+}
+
+// partitionValue converts the value of an integer column to int64, it
+// returns false for NULL.
+func partitionValue(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// randInt64Between returns a random value in [lower, upper].
+func randInt64Between(r *rand.Rand, lower, upper int64) int64 {
+	width := uint64(upper-lower) + 1
+	if width == 0 {
+		return int64(r.Uint64())
+	}
+	return lower + int64(r.Uint64()%width)
+}
+
+// removeRows removes the rows for which `pred` returns true, and returns
+// their values in the order of `table.columns`. The caller should hold the
+// write lock of the table.
+func (table *ddlTestTable) removeRows(pred func(i int) bool) [][]interface{} {
+	var removed [][]interface{}
+	for i := table.numberOfRows - 1; i >= 0; i-- {
+		if !pred(i) {
+			continue
+		}
+		row := make([]interface{}, 0, table.columns.Size())
+		for ite := table.columns.Iterator(); ite.Next(); {
+			column := ite.Value().(*ddlTestColumn)
+			row = append(row, getRowFromArrayList(column.rows, i))
+			column.rows.Remove(i)
+		}
+		removed = append(removed, row)
+		table.numberOfRows--
+	}
+	return removed
+}
+
+// addRows appends the rows returned by `removeRows`.
+func (table *ddlTestTable) addRows(rows [][]interface{}) {
+	for _, row := range rows {
+		for i, value := range row {
+			getColumnFromArrayList(table.columns, i).rows.Add(value)
+		}
+		table.numberOfRows++
+	}
+}
+
+// removePartitionRows removes the rows in the partition at `idx`. The caller
+// should hold the write lock of the table.
+func (table *ddlTestTable) removePartitionRows(idx int) [][]interface{} {
+	p := table.partition
+	return table.removeRows(func(i int) bool {
+		return p.locate(getRowFromArrayList(p.column.rows, i)) == idx
+	})
+}
+
+// structureSignature returns a string that is equal for the tables which
+// partitions can be exchanged with each other: the columns, the primary key
+// and the indexes, regardless of the partitioning.
+func (table *ddlTestTable) structureSignature() string {
+	var buffer bytes.Buffer
+	for ite := table.columns.Iterator(); ite.Next(); {
+		column := ite.Value().(*ddlTestColumn)
+		buffer.WriteString(fmt.Sprintf("`%s` %s", column.name, column.fieldType))
+		if column.notNull {
+			buffer.WriteString(" NOT NULL")
+		}
+		if column.autoIncrement {
+			buffer.WriteString(" AUTO_INCREMENT")
+		}
+		buffer.WriteString(",")
+	}
+	buffer.WriteString("PRIMARY KEY(")
+	for _, column := range table.primaryKey {
+		buffer.WriteString(fmt.Sprintf("`%s`,", column.name))
+	}
+	buffer.WriteString(")")
+	indexes := make([]string, 0, len(table.indexes))
+	for _, index := range table.indexes {
+		indexes = append(indexes, fmt.Sprintf("INDEX `%s`(%s) unique=%v invisible=%v", index.name, index.keyPartsSignature(), index.unique, index.invisible))
+	}
+	sort.Strings(indexes)
+	buffer.WriteString(strings.Join(indexes, ","))
+	return buffer.String()
+}
+
+// isJobKind reports whether the task runs as a job of kind `k` in
+// `admin show ddl jobs`. ADD and COALESCE PARTITION of HASH and KEY may run
+// as REORGANIZE PARTITION, RENAME COLUMN runs as MODIFY COLUMN, FLASHBACK
+// TABLE as RECOVER TABLE, and CREATE TABLE ... LIKE and CREATE TABLE ...
+// SELECT as CREATE TABLE.
+func (task *ddlJobTask) isJobKind(k DDLKind) bool {
+	if k == task.k {
+		return true
+	}
+	if k == ddlModifyColumn && task.k == ddlRenameColumn {
+		return true
+	}
+	if k == ddlRecoverTable && task.k == ddlFlashbackTable {
+		return true
+	}
+	if k == ddlAddTable && (task.k == ddlCreateTableLike || task.k == ddlCreateTableSelect) {
+		return true
+	}
+	return k == ddlReorganizePartition && (task.k == ddlAddPartition || task.k == ddlCoalescePartition)
+}
+
+// ddlPartitionJobArg is the argument of the DDL jobs on partitions.
+type ddlPartitionJobArg struct {
+	names  []string               // the partitions to drop, truncate, reorganize or exchange.
+	defs   []*ddlTestPartitionDef // the new partitions of RANGE and LIST.
+	num    int                    // the number of partitions of HASH and KEY to add or coalesce.
+	nextID int                    // `nextID` of the partitioning after the job.
+	table  *ddlTestTable          // the table to exchange the partition with.
+}
+
+// newPartitionTask returns a task on the partitions of `table`.
+func newPartitionTask(k DDLKind, table *ddlTestTable, sql string, arg *ddlPartitionJobArg) *ddlJobTask {
+	return &ddlJobTask{
+		k:       k,
+		tblInfo: table,
+		sql:     sql,
+		arg:     ddlJobArg(arg),
+	}
+}
+
+func partitionDefinitions(tp ddlTestPartitionType, defs []*ddlTestPartitionDef) string {
+	sqls := make([]string, 0, len(defs))
+	for _, def := range defs {
+		sqls = append(sqls, def.definition(tp))
+	}
+	return strings.Join(sqls, ", ")
+}
+
+func quotedNames(names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, fmt.Sprintf("`%s`", name))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// pickupRandomPartitionedTable picks a partitioned table randomly, it returns
+// nil if the picked table isn't partitioned.
+func (c *testCase) pickupRandomPartitionedTable() *ddlTestTable {
+	table := c.pickupRandomTable(c.ddlRand)
+	if table == nil || table.partition == nil {
+		return nil
+	}
+	return table
+}
+
+func (c *testCase) generateAddPartition() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareAddPartition, nil, ddlAddPartition})
+	return nil
+}
+
+func (c *testCase) prepareAddPartition(_ interface{}, taskCh chan *ddlJobTask) error {
+	table := c.pickupRandomPartitionedTable()
+	if table == nil {
+		return nil
+	}
+	p := table.partition.clone()
+	arg := &ddlPartitionJobArg{}
+	switch p.tp {
+	case partitionByRange:
+		last := p.defs[len(p.defs)-1]
+		_, max := intKindRange(p.column.k)
+		if last.maxValue || last.lessThan >= max {
+			return nil
+		}
+		def := &ddlTestPartitionDef{name: p.newName(), lessThan: randInt64Between(c.ddlRand, last.lessThan+1, max)}
+		def.maxValue = c.ddlRand.Intn(4) == 0
+		arg.defs = []*ddlTestPartitionDef{def}
+	case partitionByList:
+		used := make(map[int64]struct{})
+		for _, def := range p.defs {
+			for _, v := range def.values {
+				used[v] = struct{}{}
+			}
+		}
+		arg.defs = []*ddlTestPartitionDef{{name: p.newName(), values: randListValues(c.ddlRand, p.column.k, used)}}
+	default:
+		arg.num = c.ddlRand.Intn(3) + 1
+	}
+	arg.nextID = p.nextID
+	sql := fmt.Sprintf("ALTER TABLE %s ADD PARTITION PARTITIONS %d", table.quotedName(), arg.num)
+	if len(arg.defs) > 0 {
+		sql = fmt.Sprintf("ALTER TABLE %s ADD PARTITION (%s)", table.quotedName(), partitionDefinitions(p.tp, arg.defs))
+	}
+	taskCh <- newPartitionTask(ddlAddPartition, table, sql, arg)
+	return nil
+}
+
+func (c *testCase) addPartitionJob(task *ddlJobTask) error {
+	table := task.tblInfo
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	if c.isTableDeleted(table) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
+	}
+	arg := (*ddlPartitionJobArg)(task.arg)
+	p := table.partition.clone()
+	for _, def := range arg.defs {
+		if p.index(def.name) >= 0 {
+			return expectError(errCodeSameNamePartition, "partition %s of table %s already exists", def.name, table.name)
+		}
+		if p.tp == partitionByRange {
+			last := p.defs[len(p.defs)-1]
+			if last.maxValue {
+				return expectError(errCodePartitionMaxValue, "the last partition of table %s is MAXVALUE", table.name)
+			}
+			if !def.maxValue && def.lessThan <= last.lessThan {
+				return expectError(errCodeRangeNotIncreasing, "partition %s of table %s isn't increasing", def.name, table.name)
+			}
+		} else {
+			for _, v := range def.values {
+				if p.locate(v) >= 0 {
+					return expectError(errCodeMultipleDefConstInList, "value %d of table %s is in another partition", v, table.name)
+				}
+			}
+		}
+		p.defs = append(p.defs, def)
+	}
+	p.num += arg.num
+	if arg.nextID > p.nextID {
+		p.nextID = arg.nextID
+	}
+	table.partition = p
+	return nil
+}
+
+func (c *testCase) generateDropPartition() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareDropPartition, nil, ddlDropPartition})
+	return nil
+}
+
+func (c *testCase) prepareDropPartition(_ interface{}, taskCh chan *ddlJobTask) error {
+	table := c.pickupRandomPartitionedTable()
+	// Only the partitions of RANGE and LIST can be dropped.
+	if table == nil || len(table.partition.defs) <= 1 {
+		return nil
+	}
+	def := table.partition.defs[c.ddlRand.Intn(len(table.partition.defs))]
+	sql := fmt.Sprintf("ALTER TABLE %s DROP PARTITION `%s`", table.quotedName(), def.name)
+	taskCh <- newPartitionTask(ddlDropPartition, table, sql, &ddlPartitionJobArg{names: []string{def.name}})
+	return nil
+}
+
+func (c *testCase) dropPartitionJob(task *ddlJobTask) error {
+	table := task.tblInfo
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	if c.isTableDeleted(table) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
+	}
+	arg := (*ddlPartitionJobArg)(task.arg)
+	idx := table.partition.index(arg.names[0])
+	if idx < 0 {
+		return expectError(errCodeDropPartitionNonExistent, "partition %s of table %s is not exists", arg.names[0], table.name)
+	}
+	if len(table.partition.defs) == 1 {
+		return expectError(errCodeDropLastPartition, "partition %s is the last partition of table %s", arg.names[0], table.name)
+	}
+	table.removePartitionRows(idx)
+	p := table.partition.clone()
+	p.defs = append(p.defs[:idx], p.defs[idx+1:]...)
+	table.partition = p
+	return nil
+}
+
+func (c *testCase) generateTruncatePartition() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareTruncatePartition, nil, ddlTruncatePartition})
+	return nil
+}
+
+func (c *testCase) prepareTruncatePartition(_ interface{}, taskCh chan *ddlJobTask) error {
+	table := c.pickupRandomPartitionedTable()
+	if table == nil || !table.partition.isLocatable() {
+		return nil
+	}
+	names := table.partition.names()
+	name := names[c.ddlRand.Intn(len(names))]
+	sql := fmt.Sprintf("ALTER TABLE %s TRUNCATE PARTITION `%s`", table.quotedName(), name)
+	taskCh <- newPartitionTask(ddlTruncatePartition, table, sql, &ddlPartitionJobArg{names: []string{name}})
+	return nil
+}
+
+func (c *testCase) truncatePartitionJob(task *ddlJobTask) error {
+	table := task.tblInfo
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	if c.isTableDeleted(table) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
+	}
+	arg := (*ddlPartitionJobArg)(task.arg)
+	idx := table.partition.index(arg.names[0])
+	if idx < 0 {
+		return expectError(errCodeUnknownPartition, "partition %s of table %s is not exists", arg.names[0], table.name)
+	}
+	table.removePartitionRows(idx)
+	return nil
+}
+
+func (c *testCase) generateReorganizePartition() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareReorganizePartition, nil, ddlReorganizePartition})
+	return nil
+}
+
+// prepareReorganizePartition either merges two adjacent partitions of RANGE or
+// LIST into one, or splits one into two. The rows stay in the table.
+func (c *testCase) prepareReorganizePartition(_ interface{}, taskCh chan *ddlJobTask) error {
+	table := c.pickupRandomPartitionedTable()
+	if table == nil || len(table.partition.defs) == 0 {
+		return nil
+	}
+	p := table.partition.clone()
+	arg := &ddlPartitionJobArg{}
+	i := c.ddlRand.Intn(len(p.defs))
+	def := p.defs[i]
+	if c.ddlRand.Intn(2) == 0 && i+1 < len(p.defs) {
+		next := p.defs[i+1]
+		arg.names = []string{def.name, next.name}
+		merged := &ddlTestPartitionDef{name: p.newName(), lessThan: next.lessThan, maxValue: next.maxValue}
+		if p.tp == partitionByList {
+			merged.values = append(append([]int64(nil), def.values...), next.values...)
+		}
+		arg.defs = []*ddlTestPartitionDef{merged}
+	} else {
+		arg.names = []string{def.name}
+		first := &ddlTestPartitionDef{name: p.newName()}
+		second := &ddlTestPartitionDef{name: p.newName(), lessThan: def.lessThan, maxValue: def.maxValue}
+		if p.tp == partitionByRange {
+			lower, upper := intKindRange(p.column.k)
+			if i > 0 {
+				lower = p.defs[i-1].lessThan
+			}
+			if !def.maxValue {
+				upper = def.lessThan - 1
+			}
+			if lower >= upper {
+				return nil
+			}
+			first.lessThan = randInt64Between(c.ddlRand, lower+1, upper)
+		} else {
+			if len(def.values) < 2 {
+				return nil
+			}
+			k := c.ddlRand.Intn(len(def.values)-1) + 1
+			first.values = append([]int64(nil), def.values[:k]...)
+			second.values = append([]int64(nil), def.values[k:]...)
+		}
+		arg.defs = []*ddlTestPartitionDef{first, second}
+	}
+	arg.nextID = p.nextID
+	sql := fmt.Sprintf("ALTER TABLE %s REORGANIZE PARTITION %s INTO (%s)", table.quotedName(),
+		quotedNames(arg.names), partitionDefinitions(p.tp, arg.defs))
+	taskCh <- newPartitionTask(ddlReorganizePartition, table, sql, arg)
+	return nil
+}
+
+func (c *testCase) reorganizePartitionJob(task *ddlJobTask) error {
+	table := task.tblInfo
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	if c.isTableDeleted(table) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
+	}
+	arg := (*ddlPartitionJobArg)(task.arg)
+	p := table.partition.clone()
+	idx := p.index(arg.names[0])
+	for i, name := range arg.names {
+		if idx < 0 || p.index(name) != idx+i {
+			return expectError(errCodeDropPartitionNonExistent, "partition %s of table %s is not exists", name, table.name)
+		}
+	}
+	for _, def := range arg.defs {
+		if j := p.index(def.name); j >= 0 && (j < idx || j >= idx+len(arg.names)) {
+			return expectError(errCodeSameNamePartition, "partition %s of table %s already exists", def.name, table.name)
+		}
+	}
+	p.defs = append(append(append([]*ddlTestPartitionDef(nil), p.defs[:idx]...), arg.defs...), p.defs[idx+len(arg.names):]...)
+	if arg.nextID > p.nextID {
+		p.nextID = arg.nextID
+	}
+	table.partition = p
+	return nil
+}
+
+func (c *testCase) generateCoalescePartition() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareCoalescePartition, nil, ddlCoalescePartition})
+	return nil
+}
+
+func (c *testCase) prepareCoalescePartition(_ interface{}, taskCh chan *ddlJobTask) error {
+	table := c.pickupRandomPartitionedTable()
+	// Only the partitions of HASH and KEY can be coalesced.
+	if table == nil || table.partition.num <= 1 {
+		return nil
+	}
+	num := c.ddlRand.Intn(table.partition.num-1) + 1
+	sql := fmt.Sprintf("ALTER TABLE %s COALESCE PARTITION %d", table.quotedName(), num)
+	taskCh <- newPartitionTask(ddlCoalescePartition, table, sql, &ddlPartitionJobArg{num: num})
+	return nil
+}
+
+func (c *testCase) coalescePartitionJob(task *ddlJobTask) error {
+	table := task.tblInfo
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	if c.isTableDeleted(table) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
+	}
+	arg := (*ddlPartitionJobArg)(task.arg)
+	if arg.num >= table.partition.num {
+		return expectError(errCodeDropLastPartition, "table %s has only %d partitions", table.name, table.partition.num)
+	}
+	p := table.partition.clone()
+	p.num -= arg.num
+	table.partition = p
+	return nil
+}
+
+func (c *testCase) generateExchangePartition() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareExchangePartition, nil, ddlExchangePartition})
+	return nil
+}
+
+// prepareExchangePartition exchanges a partition with a non-partitioned
+// table of the same structure. If there is no such table, it creates one.
+func (c *testCase) prepareExchangePartition(_ interface{}, taskCh chan *ddlJobTask) error {
+	table := c.pickupRandomPartitionedTable()
+	if table == nil || !table.partition.isLocatable() {
+		return nil
+	}
+	for ite := table.columns.Iterator(); ite.Next(); {
+		if ite.Value().(*ddlTestColumn).isGenerated() {
+			return nil
+		}
+	}
+	signature := table.structureSignature()
+	keys := make([]objectKey, 0)
+	for key, t := range c.tables {
+		// A table with foreign keys cannot be exchanged.
+		if len(t.fkParents) > 0 || t.fkReferenced {
+			continue
+		}
+		if t != table && !t.isDeleted() && t.partition == nil && t.structureSignature() == signature {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		nt := table.copyStructure(RandName(c.ddlRand))
+		taskCh <- &ddlJobTask{
+			k:       ddlAddTable,
+			sql:     nt.createTableSQL(),
+			tblInfo: nt,
+		}
+		return nil
+	}
+	sortObjectKeys(keys)
+	nt := c.tables[keys[c.ddlRand.Intn(len(keys))]]
+	names := table.partition.names()
+	name := names[c.ddlRand.Intn(len(names))]
+	sql := fmt.Sprintf("ALTER TABLE %s EXCHANGE PARTITION `%s` WITH TABLE %s", table.quotedName(), name, nt.quotedName())
+	taskCh <- newPartitionTask(ddlExchangePartition, table, sql, &ddlPartitionJobArg{names: []string{name}, table: nt})
+	return nil
+}
+
+func (c *testCase) exchangePartitionJob(task *ddlJobTask) error {
+	table := task.tblInfo
+	arg := (*ddlPartitionJobArg)(task.arg)
+	nt := arg.table
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	nt.lock.Lock()
+	defer nt.lock.Unlock()
+	if c.isTableDeleted(table) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
+	}
+	if c.isTableDeleted(nt) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", nt.name)
+	}
+	idx := table.partition.index(arg.names[0])
+	if idx < 0 {
+		return expectError(errCodeUnknownPartition, "partition %s of table %s is not exists", arg.names[0], table.name)
+	}
+	if len(nt.foreignKeys) > 0 {
+		return expectError(errCodePartitionExchangeFK, "table %s has foreign keys", nt.name)
+	}
+	// MySQL refuses a table referenced by foreign keys as well, TiDB only
+	// checks the foreign keys on it.
+	if c.cfg.MySQLCompatible && len(c.referencingForeignKeys(nt)) > 0 {
+		return expectError(errCodePartitionExchangeFK, "table %s is referenced by foreign keys", nt.name)
+	}
+	if nt.partition != nil || nt.structureSignature() != table.structureSignature() {
+		return expectError(errCodeTablesDifferentMetadata, "table %s and %s are different", table.name, nt.name)
+	}
+	// Whether the checks of the tables have to be the same, and whether the
+	// rows are validated against them, differ by the servers and their
+	// versions. A failed exchange isn't compared, and one that succeeds is
+	// followed by the model.
+	if (len(table.checks) > 0 || len(nt.checks) > 0) && task.err != nil {
+		return unknownResult("table %s and %s have checks", table.name, nt.name)
+	}
+	pos := table.columns.IndexOf(table.partition.column)
+	ntColumn := getColumnFromArrayList(nt.columns, pos)
+	for i := 0; i < nt.numberOfRows; i++ {
+		if table.partition.locate(getRowFromArrayList(ntColumn.rows, i)) != idx {
+			return expectError(errCodeRowDoesNotMatchPartition, "a row of table %s doesn't match partition %s", nt.name, arg.names[0])
+		}
+	}
+	rows := table.removePartitionRows(idx)
+	table.addRows(nt.removeRows(func(int) bool { return true }))
+	nt.addRows(rows)
+	return nil
+}
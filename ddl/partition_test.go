@@ -0,0 +1,149 @@
+package ddl
+
+import (
+	"database/sql"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/emirpasic/gods/lists/arraylist"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionLocate(t *testing.T) {
+	column := &ddlTestColumn{k: KindInt32, name: "a"}
+	p := &ddlTestPartition{tp: partitionByRange, column: column, defs: []*ddlTestPartitionDef{
+		{name: "p0", lessThan: 10},
+		{name: "p1", lessThan: 20},
+	}}
+	assert.Equal(t, 0, p.locate(int64(-5)))
+	assert.Equal(t, 0, p.locate(ddlTestValueNull))
+	assert.Equal(t, 1, p.locate(int64(10)))
+	assert.Equal(t, -1, p.locate(int64(20)))
+	p.defs[1].maxValue = true
+	assert.Equal(t, 1, p.locate(int64(1000)))
+
+	p = &ddlTestPartition{tp: partitionByList, column: column, defs: []*ddlTestPartitionDef{
+		{name: "p0", values: []int64{1, 3}},
+		{name: "p1", values: []int64{2}},
+	}}
+	assert.Equal(t, 1, p.locate(int32(2)))
+	assert.Equal(t, -1, p.locate(int64(4)))
+	assert.Equal(t, -1, p.locate(nil))
+
+	p = &ddlTestPartition{tp: partitionByHash, column: column, num: 3}
+	assert.Equal(t, 1, p.locate(int64(-7)))
+	assert.Equal(t, 0, p.locate(nil))
+	assert.Equal(t, []string{"p0", "p1", "p2"}, p.names())
+}
+
+func TestRandPartition(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, k := range AllowPartitionType {
+		column := &ddlTestColumn{k: k, name: "a"}
+		for i := 0; i < 100; i++ {
+			p := newRandPartition(r, column)
+			if !p.isLocatable() {
+				continue
+			}
+			v := p.randValue(r)
+			assert.GreaterOrEqual(t, p.locate(v), 0, "%s, value %v", p.definition(), v)
+			assert.IsType(t, column.randValue(r), v)
+		}
+	}
+}
+
+func TestPartitionDefinition(t *testing.T) {
+	a := &ddlTestColumn{k: KindInt32, name: "a", fieldType: "INT", isPrimaryKey: true, notNull: true}
+	b := &ddlTestColumn{k: KindBigInt, name: "b", fieldType: "BIGINT", defaultValue: int64(3)}
+	table := &ddlTestTable{
+		name:       "t",
+		columns:    arraylist.New(a, b),
+		indexes:    []*ddlTestIndex{{name: "idx", columns: []*ddlTestColumn{b}}},
+		primaryKey: []*ddlTestColumn{a},
+		comment:    "c",
+		charset:    "utf8mb4",
+		collate:    "utf8mb4_bin",
+		partition: &ddlTestPartition{tp: partitionByRange, column: a, defs: []*ddlTestPartitionDef{
+			{name: "p0", lessThan: 10},
+			{name: "p1", maxValue: true},
+		}},
+		lock: new(sync.RWMutex),
+	}
+	assert.Equal(t, "CREATE TABLE `t` (`a` INT NOT NULL, `b` BIGINT NULL DEFAULT '3', PRIMARY KEY (`a`), INDEX `idx` (`b`)) "+
+		"COMMENT 'c' CHARACTER SET 'utf8mb4' COLLATE 'utf8mb4_bin' "+
+		"PARTITION BY RANGE (`a`) (PARTITION `p0` VALUES LESS THAN (10), PARTITION `p1` VALUES LESS THAN MAXVALUE)",
+		table.createTableSQL())
+
+	twin := table.copyStructure("t2")
+	assert.Nil(t, twin.partition)
+	assert.Equal(t, table.structureSignature(), twin.structureSignature())
+	assert.NotSame(t, a, twin.primaryKey[0])
+	assert.Same(t, getColumnFromArrayList(twin.columns, 1), twin.indexes[0].columns[0])
+
+	actual := &tableSchema{partitionMethod: "RANGE", partitions: []partitionSchema{
+		{name: "p0", description: sql.NullString{String: "10", Valid: true}},
+		{name: "p1", description: sql.NullString{String: "MAXVALUE", Valid: true}},
+	}}
+	assert.Empty(t, table.partitionDiff(actual))
+	actual.partitions[0].description.String = "20"
+	assert.Equal(t, []string{"partition `p0`: expected less than 10, got \"20\""}, table.partitionDiff(actual))
+	assert.Equal(t, []string{"partition: expected none, got RANGE"}, twin.partitionDiff(actual))
+}
+
+func newExchangeTables() (*testCase, *ddlTestTable, *ddlTestTable) {
+	a := &ddlTestColumn{k: KindInt32, name: "a", fieldType: "INT", rows: arraylist.New()}
+	table := &ddlTestTable{
+		name:    "t",
+		columns: arraylist.New(a),
+		partition: &ddlTestPartition{tp: partitionByRange, column: a, defs: []*ddlTestPartitionDef{
+			{name: "p0", lessThan: 10},
+			{name: "p1", maxValue: true},
+		}},
+		lock: new(sync.RWMutex),
+	}
+	nt := table.copyStructure("nt")
+	table.addRows([][]interface{}{{int32(1)}, {int32(20)}})
+	nt.addRows([][]interface{}{{int32(2)}})
+	c := &testCase{cfg: &DDLCaseConfig{}, tables: map[objectKey]*ddlTestTable{table.key(): table, nt.key(): nt}}
+	return c, table, nt
+}
+
+func TestExchangePartitionReferencedTable(t *testing.T) {
+	c, table, nt := newExchangeTables()
+	id := getColumnFromArrayList(nt.columns, 0)
+	child := newSchemaTable("", "c")
+	child.foreignKeys = []*ddlTestForeignKey{{name: "fk", column: getColumnFromArrayList(child.columns, 0), parent: nt, refColumn: id}}
+	c.tables[child.key()] = child
+	arg := &ddlPartitionJobArg{names: []string{"p0"}, table: nt}
+	task := newPartitionTask(ddlExchangePartition, table, "", arg)
+
+	// MySQL refuses a table referenced by foreign keys.
+	c.cfg.MySQLCompatible = true
+	assert.Equal(t, errCodePartitionExchangeFK, expectedErrorCode(c.exchangePartitionJob(task)))
+	assert.Equal(t, 2, table.numberOfRows)
+
+	c.cfg.MySQLCompatible = false
+	assert.NoError(t, c.exchangePartitionJob(task))
+	assert.Equal(t, []interface{}{int32(20), int32(2)}, getColumnFromArrayList(table.columns, 0).rows.Values())
+	assert.Equal(t, []interface{}{int32(1)}, id.rows.Values())
+}
+
+func TestExchangePartitionWithChecks(t *testing.T) {
+	c, table, nt := newExchangeTables()
+	nt.checks = []*ddlTestCheck{{name: "c", column: getColumnFromArrayList(nt.columns, 0), op: ">=", value: 0, enforced: true}}
+	arg := &ddlPartitionJobArg{names: []string{"p0"}, table: nt}
+	task := newPartitionTask(ddlExchangePartition, table, "", arg)
+
+	// A failed exchange of the tables with checks isn't compared.
+	task.err = &mysql.MySQLError{Number: errCodeTablesDifferentMetadata}
+	err := c.exchangePartitionJob(task)
+	assert.True(t, isUnknownResult(err))
+	assert.Zero(t, expectedErrorCode(err))
+	assert.Equal(t, 2, table.numberOfRows)
+
+	task.err = nil
+	assert.NoError(t, c.exchangePartitionJob(task))
+	assert.Equal(t, []interface{}{int32(1)}, getColumnFromArrayList(nt.columns, 0).rows.Values())
+}
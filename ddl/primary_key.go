@@ -0,0 +1,191 @@
+package ddl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The primary key of a table on TiDB is either clustered, i.e. the rows are
+// stored by the primary key, or non-clustered, i.e. the rows are stored by a
+// hidden row ID, which is sharded by SHARD_ROW_ID_BITS. The type is always
+// specified on TiDB, and never on MySQL.
+const (
+	pkTypeClustered    = "CLUSTERED"
+	pkTypeNonClustered = "NONCLUSTERED"
+)
+
+// pkTypeComment returns the comment of the primary key type `tp` in
+// `CREATE TABLE` and `SHOW CREATE TABLE`, it's empty if `tp` is empty.
+func pkTypeComment(tp string) string {
+	if tp == "" {
+		return ""
+	}
+	return fmt.Sprintf(" /*T![clustered_index] %s */", tp)
+}
+
+// randPKType returns a random primary key type on TiDB.
+func (c *testCase) randPKType() string {
+	if c.cfg.MySQLCompatible {
+		return ""
+	}
+	if c.ddlRand.Intn(2) == 0 {
+		return pkTypeClustered
+	}
+	return pkTypeNonClustered
+}
+
+// isClustered reports whether the rows of the table are stored by the
+// primary key, then neither the primary key can be dropped nor
+// SHARD_ROW_ID_BITS can be set.
+func (table *ddlTestTable) isClustered() bool {
+	return table.pkType == pkTypeClustered
+}
+
+type ddlPrimaryKeyJobArg struct {
+	columns []*ddlTestColumn
+	pkType  string
+}
+
+func (c *testCase) generateAddPrimaryKey() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareAddPrimaryKey, nil, ddlAddPrimaryKey})
+	return nil
+}
+
+// prepareAddPrimaryKey adds a primary key on one or two columns of a table
+// without primary key. Adding a clustered primary key isn't supported by
+// TiDB, which is tried sometimes.
+func (c *testCase) prepareAddPrimaryKey(_ interface{}, taskCh chan *ddlJobTask) error {
+	table := c.pickupRandomTable(c.ddlRand)
+	if table == nil || len(table.primaryKey) > 0 {
+		return nil
+	}
+	n := 1 + c.ddlRand.Intn(2)
+	if n > table.columns.Size() {
+		n = table.columns.Size()
+	}
+	columns := make([]*ddlTestColumn, 0, n+1)
+	for _, idx := range c.ddlRand.Perm(table.columns.Size())[:n] {
+		column := getColumnFromArrayList(table.columns, idx)
+		if fk, _ := c.foreignKeyOnColumn(table, column); fk != nil {
+			continue
+		}
+		if column.canBePrimary() && !column.isDeleted() {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	if table.partition != nil && c.ddlRand.Intn(4) > 0 && !containsColumn(columns, table.partition.column) {
+		columns = append(columns, table.partition.column)
+	}
+	pkType := ""
+	if !c.cfg.MySQLCompatible {
+		pkType = pkTypeNonClustered
+		if c.ddlRand.Intn(10) == 0 {
+			pkType = pkTypeClustered
+		}
+	}
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, fmt.Sprintf("`%s`", column.name))
+	}
+	sql := fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s)%s", table.quotedName(), strings.Join(names, ", "), pkTypeComment(pkType))
+	task := &ddlJobTask{
+		k:       ddlAddPrimaryKey,
+		sql:     sql,
+		tblInfo: table,
+		arg:     ddlJobArg(&ddlPrimaryKeyJobArg{columns: columns, pkType: pkType}),
+	}
+	taskCh <- task
+	return nil
+}
+
+func (c *testCase) addPrimaryKeyJob(task *ddlJobTask) error {
+	table := task.tblInfo
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	if c.isTableDeleted(table) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
+	}
+	arg := (*ddlPrimaryKeyJobArg)(task.arg)
+	if arg.pkType == pkTypeClustered {
+		return expectError(errCodeUnsupportedDDLOperation, "adding clustered primary key to table %s", table.name)
+	}
+	if len(table.primaryKey) > 0 {
+		return expectError(errCodeMultiplePriKey, "table %s has a primary key", table.name)
+	}
+	for _, column := range arg.columns {
+		if table.isColumnDeleted(column) {
+			return expectError(errCodeKeyColumnNotExists, "local Execute add primary key on column %s error , column is deleted", column.name)
+		}
+	}
+	if table.partition != nil && !containsColumn(arg.columns, table.partition.column) {
+		return expectError(errCodeUniqueKeyNeedAllFields, "primary key on table %s doesn't include the partitioning column", table.name)
+	}
+	for _, column := range arg.columns {
+		if column.rows.Contains(nil) || column.rows.Contains(ddlTestValueNull) {
+			return expectError(errCodeInvalidUseOfNull, "column %s of table %s has NULL", column.name, table.name)
+		}
+	}
+	if err := table.duplicateError([][]*ddlTestColumn{arg.columns}, table.allRows(), nil, c.newCollation); err != nil {
+		return err
+	}
+	for _, column := range arg.columns {
+		column.isPrimaryKey = true
+		column.notNull = true
+	}
+	table.primaryKey = arg.columns
+	table.pkType = arg.pkType
+	return nil
+}
+
+func (c *testCase) generateDropPrimaryKey() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareDropPrimaryKey, nil, ddlDropPrimaryKey})
+	return nil
+}
+
+// prepareDropPrimaryKey drops the primary key of a table, which fails if the
+// primary key is clustered.
+func (c *testCase) prepareDropPrimaryKey(_ interface{}, taskCh chan *ddlJobTask) error {
+	table := c.pickupRandomTable(c.ddlRand)
+	if table == nil || len(table.primaryKey) == 0 {
+		return nil
+	}
+	task := &ddlJobTask{
+		k:       ddlDropPrimaryKey,
+		sql:     fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY", table.quotedName()),
+		tblInfo: table,
+	}
+	taskCh <- task
+	return nil
+}
+
+// dropPrimaryKeyJob drops the primary key, the columns stay NOT NULL.
+func (c *testCase) dropPrimaryKeyJob(task *ddlJobTask) error {
+	table := task.tblInfo
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	if c.isTableDeleted(table) {
+		return expectError(errCodeNoSuchTable, "table %s is not exists", table.name)
+	}
+	if len(table.primaryKey) == 0 {
+		return expectError(errCodeCantDropFieldOrKey, "table %s , primary key is not exists", table.name)
+	}
+	if table.isClustered() {
+		return expectError(errCodeUnsupportedDDLOperation, "dropping clustered primary key of table %s", table.name)
+	}
+	// The auto ID column must be a key.
+	if table.primaryKey[0].isAutoID() {
+		return expectError(errCodeWrongAutoKey, "dropping primary key on the auto ID column of table %s", table.name)
+	}
+	if fk := c.foreignKeyNeedingIndex(table, ""); fk != nil {
+		return expectError(errCodeDropIndexFK, "primary key of table %s is needed in foreign key %s", table.name, fk.name)
+	}
+	for _, column := range table.primaryKey {
+		column.isPrimaryKey = false
+	}
+	table.primaryKey = nil
+	table.pkType = ""
+	return nil
+}
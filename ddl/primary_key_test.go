@@ -0,0 +1,37 @@
+package ddl
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/emirpasic/gods/lists/arraylist"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrimaryKeyDefinition(t *testing.T) {
+	a := &ddlTestColumn{k: KindVarChar, name: "a", fieldType: "VARCHAR(10)", filedTypeM: 10, isPrimaryKey: true, notNull: true}
+	b := &ddlTestColumn{k: KindInt32, name: "b", fieldType: "INT", notNull: true, defaultValue: int64(3)}
+	table := &ddlTestTable{
+		name:       "t",
+		columns:    arraylist.New(a, b),
+		primaryKey: []*ddlTestColumn{a},
+		pkType:     pkTypeClustered,
+		comment:    "c",
+		charset:    "utf8mb4",
+		collate:    "utf8mb4_bin",
+		lock:       new(sync.RWMutex),
+	}
+	sql := table.createTableSQL()
+	assert.Equal(t, "CREATE TABLE `t` (`a` VARCHAR(10) NOT NULL, `b` INT NOT NULL DEFAULT '3', "+
+		"PRIMARY KEY (`a`) /*T![clustered_index] CLUSTERED */) COMMENT 'c' CHARACTER SET 'utf8mb4' COLLATE 'utf8mb4_bin'", sql)
+	assert.True(t, table.isClustered())
+	assert.Equal(t, pkTypeClustered, table.copyStructure("t2").pkType)
+
+	// SHOW CREATE TABLE of TiDB.
+	m := showCreatePKType.FindStringSubmatch("CREATE TABLE `t` (\n  `a` varchar(10) NOT NULL,\n" +
+		"  PRIMARY KEY (`a`) /*T![clustered_index] NONCLUSTERED */\n) ENGINE=InnoDB")
+	assert.Equal(t, []string{"PRIMARY KEY (`a`) /*T![clustered_index] NONCLUSTERED */", pkTypeNonClustered}, m)
+
+	table.pkType = ""
+	assert.Contains(t, table.createTableSQL(), "PRIMARY KEY (`a`))")
+}
@@ -0,0 +1,265 @@
+package ddl
+
+import (
+	"fmt"
+	"time"
+)
+
+// A dropped or truncated table, and a dropped schema with its tables, is
+// kept as a tombstone with its rows. On TiDB, RECOVER TABLE and FLASHBACK
+// TABLE restore the latest tombstone of a table name, and FLASHBACK DATABASE
+// the latest one of a schema name, until the GC removes the old data. The
+// tables with foreign keys and the views aren't restored by the model, so
+// they aren't kept.
+
+// recoverWindow is how long the model restores a tombstone. TiDB restores the
+// data newer than the GC safe point, which is at most `gcLifeTime` ago, the
+// margin leaves time for the tombstone to be restored by a slow batch.
+const recoverWindow = gcLifeTime / 2
+
+type ddlTestTombstone struct {
+	table     *ddlTestTable   // the dropped or truncated table, nil for a schema.
+	schema    *ddlTestSchema  // the dropped schema, nil for a table.
+	tables    []*ddlTestTable // the tables of the dropped schema.
+	truncated bool
+	recovered bool // TiDB refuses to restore the same table or schema twice.
+	droppedAt time.Time
+}
+
+func (tomb *ddlTestTombstone) name() string {
+	if tomb.table != nil {
+		return tomb.table.name
+	}
+	return tomb.schema.name
+}
+
+// hasForeignKeys reports whether a foreign key has ever referenced the table
+// or been on it, then it isn't kept as a tombstone.
+func (table *ddlTestTable) hasForeignKeys() bool {
+	return len(table.foreignKeys) > 0 || len(table.fkParents) > 0 || table.fkReferenced
+}
+
+// addTableTombstone keeps the table, which is being dropped or truncated,
+// as a tombstone. The caller should hold the lock of the table.
+func (c *testCase) addTableTombstone(table *ddlTestTable, truncated bool) {
+	if !c.recoverable {
+		return
+	}
+	c.removeTombstones(func(tomb *ddlTestTombstone) bool {
+		return tomb.table != nil && tomb.table.key() == table.key()
+	})
+	// The older tombstones are shadowed by the new one, which isn't restored.
+	if table.hasForeignKeys() {
+		return
+	}
+	c.tombstones = append(c.tombstones, &ddlTestTombstone{table: table.clone(true), truncated: truncated, droppedAt: time.Now()})
+}
+
+// addSchemaTombstone keeps the schema, which is being dropped, with its
+// tables as a tombstone. The tombstones of the tables dropped before aren't
+// restored any more. The caller should hold `c.tablesLock`.
+func (c *testCase) addSchemaTombstone(schema *ddlTestSchema, tables []*ddlTestTable) {
+	if !c.recoverable {
+		return
+	}
+	c.removeTombstones(func(tomb *ddlTestTombstone) bool {
+		return tomb.table != nil && tomb.table.schema == schema.name || tomb.schema != nil && tomb.schema.name == schema.name
+	})
+	tomb := &ddlTestTombstone{schema: schema, droppedAt: time.Now()}
+	for _, table := range tables {
+		table.lock.RLock()
+		if table.hasForeignKeys() {
+			table.lock.RUnlock()
+			return
+		}
+		tomb.tables = append(tomb.tables, table.clone(true))
+		table.lock.RUnlock()
+	}
+	c.tombstones = append(c.tombstones, tomb)
+}
+
+func (c *testCase) removeTombstones(pred func(*ddlTestTombstone) bool) {
+	tombstones := c.tombstones[:0]
+	for _, tomb := range c.tombstones {
+		if !pred(tomb) {
+			tombstones = append(tombstones, tomb)
+		}
+	}
+	c.tombstones = tombstones
+}
+
+// latestTombstone returns the latest tombstone of the table `key`, or of the
+// schema `key.schema` if `key.name` is empty.
+func (c *testCase) latestTombstone(key objectKey) *ddlTestTombstone {
+	for i := len(c.tombstones) - 1; i >= 0; i-- {
+		tomb := c.tombstones[i]
+		if key.name != "" && tomb.table != nil && tomb.table.key() == key ||
+			key.name == "" && tomb.schema != nil && tomb.schema.name == key.schema {
+			return tomb
+		}
+	}
+	return nil
+}
+
+// pickupRandomTombstone picks the latest tombstone of a table or a schema
+// randomly, which satisfies `pred`. The tombstones out of `recoverWindow`
+// are removed.
+func (c *testCase) pickupRandomTombstone(pred func(*ddlTestTombstone) bool) *ddlTestTombstone {
+	deadline := time.Now().Add(-recoverWindow)
+	c.removeTombstones(func(tomb *ddlTestTombstone) bool { return tomb.droppedAt.Before(deadline) })
+	candidates := make([]*ddlTestTombstone, 0, len(c.tombstones))
+	for _, tomb := range c.tombstones {
+		key := objectKey{schema: tomb.name()}
+		if tomb.table != nil {
+			key = tomb.table.key()
+		}
+		if c.latestTombstone(key) == tomb && !tomb.recovered && pred(tomb) {
+			candidates = append(candidates, tomb)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[c.ddlRand.Intn(len(candidates))]
+}
+
+// ddlRecoverArg is the argument of RECOVER TABLE, FLASHBACK TABLE and
+// FLASHBACK DATABASE.
+type ddlRecoverArg struct {
+	key     objectKey // the table to restore, or the schema `key.schema` if `key.name` is empty.
+	newName string    // the name of the restored table or schema.
+	id      string    // the ID of the restored table or schema, see `getSortTask`.
+	// tables are the tombstones of the restored tables when the task is
+	// prepared, see `uniqueChangeTables`.
+	tables []*ddlTestTable
+}
+
+func (c *testCase) generateRecoverTable() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareRecoverTable, nil, ddlRecoverTable})
+	return nil
+}
+
+// prepareRecoverTable restores a dropped table with its name.
+func (c *testCase) prepareRecoverTable(_ interface{}, taskCh chan *ddlJobTask) error {
+	if !c.recoverable {
+		return nil
+	}
+	tomb := c.pickupRandomTombstone(func(tomb *ddlTestTombstone) bool { return tomb.table != nil && !tomb.truncated })
+	if tomb == nil {
+		return nil
+	}
+	task := &ddlJobTask{
+		k:   ddlRecoverTable,
+		sql: fmt.Sprintf("RECOVER TABLE %s", tomb.table.quotedName()),
+		arg: ddlJobArg(&ddlRecoverArg{key: tomb.table.key(), newName: tomb.table.name, tables: []*ddlTestTable{tomb.table}}),
+	}
+	taskCh <- task
+	return nil
+}
+
+func (c *testCase) generateFlashbackTable() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareFlashbackTable, nil, ddlFlashbackTable})
+	return nil
+}
+
+// prepareFlashbackTable restores a dropped or truncated table with a new name.
+func (c *testCase) prepareFlashbackTable(_ interface{}, taskCh chan *ddlJobTask) error {
+	if !c.recoverable {
+		return nil
+	}
+	tomb := c.pickupRandomTombstone(func(tomb *ddlTestTombstone) bool { return tomb.table != nil })
+	if tomb == nil {
+		return nil
+	}
+	newName := RandName(c.ddlRand)
+	task := &ddlJobTask{
+		k:   ddlFlashbackTable,
+		sql: fmt.Sprintf("FLASHBACK TABLE %s TO `%s`", tomb.table.quotedName(), newName),
+		arg: ddlJobArg(&ddlRecoverArg{key: tomb.table.key(), newName: newName, tables: []*ddlTestTable{tomb.table}}),
+	}
+	taskCh <- task
+	return nil
+}
+
+// recoverTableJob restores the latest tombstone of the table when the job
+// runs, which may be newer than the one when the task is prepared.
+func (c *testCase) recoverTableJob(task *ddlJobTask) error {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	arg := (*ddlRecoverArg)(task.arg)
+	if c.isSchemaNameDeleted(arg.key.schema) {
+		return expectError(errCodeBadDB, "schema %s doesn't exist", arg.key.schema)
+	}
+	tomb := c.latestTombstone(arg.key)
+	if tomb == nil || tomb.recovered {
+		return expectError(0, "table %s cannot be recovered", arg.key.name)
+	}
+	newKey := objectKey{arg.key.schema, arg.newName}
+	if _, ok := c.tables[newKey]; ok {
+		return expectError(errCodeTableExists, "table %s already exists", arg.newName)
+	}
+	if _, ok := c.views[newKey]; ok {
+		return expectError(errCodeTableExists, "view %s already exists", arg.newName)
+	}
+	tomb.recovered = true
+	table := tomb.table.clone(true)
+	table.name = arg.newName
+	table.id = arg.id
+	c.tables[newKey] = table
+	return nil
+}
+
+func (c *testCase) generateRecoverSchema() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareRecoverSchema, nil, ddlRecoverSchema})
+	return nil
+}
+
+// prepareRecoverSchema restores a dropped schema with its tables by FLASHBACK
+// DATABASE, with its name or a new one.
+func (c *testCase) prepareRecoverSchema(_ interface{}, taskCh chan *ddlJobTask) error {
+	if !c.recoverable {
+		return nil
+	}
+	tomb := c.pickupRandomTombstone(func(tomb *ddlTestTombstone) bool { return tomb.schema != nil })
+	if tomb == nil {
+		return nil
+	}
+	arg := &ddlRecoverArg{key: objectKey{schema: tomb.schema.name}, newName: tomb.schema.name, tables: tomb.tables}
+	sql := fmt.Sprintf("FLASHBACK %s `%s`", dbSchemaSyntax[c.ddlRand.Intn(len(dbSchemaSyntax))], tomb.schema.name)
+	if c.ddlRand.Intn(2) == 0 {
+		arg.newName = RandName(c.ddlRand)
+		sql += fmt.Sprintf(" TO `%s`", arg.newName)
+	}
+	task := &ddlJobTask{
+		k:   ddlRecoverSchema,
+		sql: sql,
+		arg: ddlJobArg(arg),
+	}
+	taskCh <- task
+	return nil
+}
+
+func (c *testCase) recoverSchemaJob(task *ddlJobTask) error {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	arg := (*ddlRecoverArg)(task.arg)
+	tomb := c.latestTombstone(arg.key)
+	if tomb == nil || tomb.recovered {
+		return expectError(0, "schema %s cannot be recovered", arg.key.schema)
+	}
+	if _, ok := c.schemas[arg.newName]; ok {
+		return expectError(errCodeDBCreateExists, "schema %s already exists", arg.newName)
+	}
+	tomb.recovered = true
+	schema := *tomb.schema
+	schema.name = arg.newName
+	schema.id = arg.id
+	schema.deleted = false
+	c.schemas[schema.name] = &schema
+	for _, table := range tomb.tables {
+		table = table.clone(true)
+		table.schema = schema.name
+		c.tables[table.key()] = table
+	}
+	return nil
+}
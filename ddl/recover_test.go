@@ -0,0 +1,100 @@
+package ddl
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClone(t *testing.T) {
+	_, table := newMultiSchemaTable()
+	a := getColumnFromArrayList(table.columns, 0)
+	table.checks = []*ddlTestCheck{{name: "c", column: a, op: ">=", value: 0, enforced: true}}
+	table.partition = &ddlTestPartition{tp: partitionByList, column: a, defs: []*ddlTestPartitionDef{{name: "p0", values: []int64{1}}}}
+	table.autoIDs = map[int64]struct{}{1: {}}
+
+	clone := table.clone(true)
+	assert.Equal(t, table.createTableSQL(), clone.createTableSQL())
+	assert.Equal(t, 2, clone.numberOfRows)
+	cloneA := getColumnFromArrayList(clone.columns, 0)
+	assert.Equal(t, a.rows.Values(), cloneA.rows.Values())
+	assert.True(t, clone.checks[0].column == cloneA)
+	assert.True(t, clone.partition.column == cloneA)
+
+	// The clone is independent of the changes to the table.
+	a.rows.Add(int32(5))
+	table.partition.defs[0].values[0] = 2
+	table.autoIDs[2] = struct{}{}
+	assert.Equal(t, 2, cloneA.rows.Size())
+	assert.Equal(t, int64(1), clone.partition.defs[0].values[0])
+	assert.Len(t, clone.autoIDs, 1)
+	assert.Zero(t, table.clone(false).numberOfRows)
+	assert.Zero(t, getColumnFromArrayList(table.clone(false).columns, 0).rows.Size())
+}
+
+func TestRecoverTable(t *testing.T) {
+	c, table := newMultiSchemaTable()
+	c.recoverable = true
+	rows := getColumnFromArrayList(table.columns, 1).rows.Values()
+
+	// TRUNCATE keeps the rows, which FLASHBACK TABLE restores with a new name.
+	assert.NoError(t, c.updateTableInfo(&ddlJobTask{k: ddlTruncateTable, tblInfo: table}))
+	assert.Zero(t, table.numberOfRows)
+	flashback := &ddlJobTask{k: ddlFlashbackTable, arg: ddlJobArg(&ddlRecoverArg{key: table.key(), newName: "t2"})}
+	assert.NoError(t, c.updateTableInfo(flashback))
+	restored := c.tables[objectKey{"", "t2"}]
+	assert.Equal(t, rows, getColumnFromArrayList(restored.columns, 1).rows.Values())
+	assert.Error(t, c.updateTableInfo(flashback))
+
+	// RECOVER TABLE restores the latest tombstone of the name.
+	table.setDeleted()
+	assert.NoError(t, c.updateTableInfo(&ddlJobTask{k: ddlDropTable, tblInfo: table}))
+	tomb := c.latestTombstone(table.key())
+	assert.False(t, tomb.truncated)
+	recover := &ddlJobTask{k: ddlRecoverTable, arg: ddlJobArg(&ddlRecoverArg{key: table.key(), newName: "t"})}
+	assert.NoError(t, c.updateTableInfo(recover))
+	assert.True(t, tomb.recovered)
+	assert.False(t, c.isTableDeleted(c.tables[table.key()]))
+	assert.Zero(t, c.tables[table.key()].numberOfRows)
+
+	tomb.recovered = false
+	assert.Equal(t, errCodeTableExists, expectedErrorCode(c.updateTableInfo(recover)))
+
+	// The old tombstones are out of the GC life time.
+	c.ddlRand = rand.New(rand.NewSource(1))
+	tomb.droppedAt = time.Now().Add(-gcLifeTime)
+	assert.Nil(t, c.pickupRandomTombstone(func(*ddlTestTombstone) bool { return true }))
+	assert.Empty(t, c.tombstones)
+}
+
+func TestRecoverSchema(t *testing.T) {
+	s := &ddlTestSchema{name: "s", charset: "utf8mb4"}
+	table := newSchemaTable("s", "t")
+	table.addRows([][]interface{}{{int32(1)}})
+	c := &testCase{
+		schemas:     map[string]*ddlTestSchema{"s": s},
+		tables:      map[objectKey]*ddlTestTable{table.key(): table},
+		recoverable: true,
+	}
+	s.setDeleted()
+	task := &ddlJobTask{k: ddlDropSchema, schemaInfo: s, arg: ddlJobArg(&ddlDropSchemaArg{tables: []*ddlTestTable{table}})}
+	assert.NoError(t, c.updateTableInfo(task))
+	assert.Empty(t, c.tables)
+
+	task = &ddlJobTask{k: ddlRecoverSchema, arg: ddlJobArg(&ddlRecoverArg{key: objectKey{schema: "s"}, newName: "s2"})}
+	assert.NoError(t, c.updateTableInfo(task))
+	assert.Equal(t, "utf8mb4", c.schemas["s2"].charset)
+	assert.False(t, c.schemas["s2"].isDeleted())
+	restored := c.tables[objectKey{"s2", "t"}]
+	assert.Equal(t, 1, restored.numberOfRows)
+	assert.Equal(t, "`s2`.`t`", restored.quotedName())
+	assert.Error(t, c.updateTableInfo(task))
+
+	// A schema with foreign keys isn't restored.
+	c.tombstones = nil
+	table.fkReferenced = true
+	c.addSchemaTombstone(s, []*ddlTestTable{table})
+	assert.Empty(t, c.tombstones)
+}
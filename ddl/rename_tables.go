@@ -0,0 +1,187 @@
+package ddl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RENAME TABLE renames more than one table in a statement, which swaps two
+// tables by a temporary name:
+//
+//	RENAME TABLE a TO tmp, b TO a, tmp TO b
+//
+// The renames run in order and atomically, a rename whose source doesn't exist
+// or whose target does fails the statement and none of the tables is renamed.
+
+// ddlTableRename is a rename of RENAME TABLE, from the table `from` to `to`.
+type ddlTableRename struct {
+	table *ddlTestTable // the table renamed when the task is prepared.
+	from  objectKey
+	to    objectKey
+}
+
+// ddlRenameTablesArg is the argument of RENAME TABLE of more than one table.
+type ddlRenameTablesArg struct {
+	renames []ddlTableRename
+}
+
+// hasTableID reports whether `id` is the ID of a renamed table.
+func (arg *ddlRenameTablesArg) hasTableID(id string) bool {
+	for _, rename := range arg.renames {
+		if rename.table.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// pickupRenameKey picks a new name for the table in a random schema. The
+// tables of the foreign keys stay in their schema, see `dropSchemaJob`.
+func (c *testCase) pickupRenameKey(table *ddlTestTable) objectKey {
+	key := objectKey{table.schema, RandName(c.ddlRand)}
+	if len(table.fkParents) == 0 && !table.fkReferenced {
+		key.schema = c.pickupRandomSchemaName(c.ddlRand)
+	}
+	return key
+}
+
+func (c *testCase) generateRenameTables() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareRenameTables, nil, ddlRenameTables})
+	return nil
+}
+
+// prepareRenameTables swaps two tables, or renames two or three tables to new
+// names. The tables are marked deleted like `prepareRenameTable`, so the
+// DMLs pick up them by the new names after the batch.
+func (c *testCase) prepareRenameTables(_ interface{}, taskCh chan *ddlJobTask) error {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	n := 2 + c.ddlRand.Intn(2)
+	tables := make([]*ddlTestTable, 0, n)
+	for len(tables) < n {
+		table := c.pickupRandomTable(c.ddlRand)
+		if table == nil {
+			break
+		}
+		table.setDeleted()
+		tables = append(tables, table)
+	}
+	if len(tables) < 2 {
+		for _, table := range tables {
+			table.setDeletedRecover()
+		}
+		return nil
+	}
+
+	var renames []ddlTableRename
+	a, b := tables[0], tables[1]
+	// A table with foreign keys is only swapped in its schema.
+	if c.ddlRand.Intn(2) == 0 && (a.schema == b.schema || !a.hasForeignKeys() && !b.hasForeignKeys()) {
+		for _, table := range tables[2:] {
+			table.setDeletedRecover()
+		}
+		tmp := objectKey{a.schema, RandName(c.ddlRand)}
+		renames = []ddlTableRename{{a, a.key(), tmp}, {b, b.key(), a.key()}, {a, tmp, b.key()}}
+	} else {
+		for _, table := range tables {
+			renames = append(renames, ddlTableRename{table, table.key(), c.pickupRenameKey(table)})
+		}
+	}
+	clauses := make([]string, 0, len(renames))
+	for _, rename := range renames {
+		clauses = append(clauses, fmt.Sprintf("%s TO %s",
+			quoteObjectName(rename.from.schema, rename.from.name), quoteObjectName(rename.to.schema, rename.to.name)))
+	}
+	task := &ddlJobTask{
+		k:       ddlRenameTables,
+		sql:     "RENAME TABLE " + strings.Join(clauses, ", "),
+		tblInfo: a,
+		arg:     ddlJobArg(&ddlRenameTablesArg{renames: renames}),
+	}
+	taskCh <- task
+	return nil
+}
+
+// renameTablesJob runs the renames in order on the names of the tables when
+// the job runs, then moves each table to its final name. The table under a
+// new name is a shallow copy like `prepareRenameTable`, which is made by the
+// job so that it has the rows added by the DMLs before it.
+func (c *testCase) renameTablesJob(task *ddlJobTask) error {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	arg := (*ddlRenameTablesArg)(task.arg)
+	// The tables by their names after the renames so far, nil for a name
+	// renamed away.
+	renamed := make(map[objectKey]*ddlTestTable)
+	lookup := func(key objectKey) *ddlTestTable {
+		if table, ok := renamed[key]; ok {
+			return table
+		}
+		return c.tables[key]
+	}
+	for _, rename := range arg.renames {
+		table := lookup(rename.from)
+		if table == nil {
+			c.recoverRenameTables(arg)
+			return expectError(errCodeNoSuchTable, "table %s is not exists", rename.from.name)
+		}
+		if _, ok := c.views[rename.to]; ok || lookup(rename.to) != nil {
+			c.recoverRenameTables(arg)
+			return expectError(errCodeTableExists, "table %s already exists", rename.to.name)
+		}
+		if c.isSchemaNameDeleted(rename.to.schema) {
+			c.recoverRenameTables(arg)
+			return expectError(0, "schema %s doesn't exist", rename.to.schema)
+		}
+		renamed[rename.from] = nil
+		renamed[rename.to] = table
+	}
+
+	keys := make([]objectKey, 0, len(renamed))
+	for key := range renamed {
+		keys = append(keys, key)
+	}
+	sortObjectKeys(keys)
+	// The foreign keys referencing the tables follow them, the children may
+	// be renamed too.
+	refs := make(map[*ddlTestTable][]childForeignKey)
+	for _, key := range keys {
+		if table := renamed[key]; table != nil {
+			refs[table] = c.referencingForeignKeys(table)
+		}
+	}
+	for _, key := range keys {
+		if renamed[key] == nil {
+			delete(c.tables, key)
+		}
+	}
+	for _, key := range keys {
+		table := renamed[key]
+		if table == nil {
+			continue
+		}
+		table.lock.Lock()
+		newTbl := *table
+		table.setDeleted()
+		table.lock.Unlock()
+		newTbl.schema, newTbl.name = key.schema, key.name
+		newTbl.setDeletedRecover()
+		// The unique changes of the batch are ended on the old table.
+		newTbl.uniqueEpoch = 0
+		c.tables[key] = &newTbl
+		for _, ref := range refs[table] {
+			ref.fk.parent = &newTbl
+		}
+	}
+	return nil
+}
+
+// recoverRenameTables unmarks the tables of a failed RENAME TABLE which still
+// exist, see `prepareRenameTables`.
+func (c *testCase) recoverRenameTables(arg *ddlRenameTablesArg) {
+	for _, rename := range arg.renames {
+		if c.tables[rename.table.key()] == rename.table {
+			rename.table.setDeletedRecover()
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package ddl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSwapTables(t *testing.T) {
+	c, a := newMultiSchemaTable()
+	b := newSchemaTable("", "t2")
+	b.addRows([][]interface{}{{int32(5)}})
+	c.tables[b.key()] = b
+	a.id, b.id = "1", "2"
+	tmp := objectKey{"", "tmp"}
+	arg := &ddlRenameTablesArg{renames: []ddlTableRename{{a, a.key(), tmp}, {b, b.key(), a.key()}, {a, tmp, b.key()}}}
+	task := &ddlJobTask{k: ddlRenameTables, tblInfo: a, arg: ddlJobArg(arg)}
+	assert.True(t, arg.hasTableID("2"))
+	a.setDeleted()
+	b.setDeleted()
+
+	// An insert prepared before the swap runs before the job.
+	insert := &dmlJobTask{k: dmlInsert, tblInfo: a, assigns: []*ddlTestColumnDescriptor{
+		{column: getColumnFromArrayList(a.columns, 0), value: int32(4)},
+		{column: getColumnFromArrayList(a.columns, 1), value: int32(4)},
+	}}
+	assert.NoError(t, c.doInsertJob(insert))
+	assert.NoError(t, c.updateTableInfo(task))
+	swappedA, swappedB := c.tables[objectKey{"", "t2"}], c.tables[objectKey{"", "t"}]
+	assert.Len(t, c.tables, 2)
+	assert.Equal(t, "1", swappedA.id)
+	assert.Equal(t, 3, swappedA.numberOfRows)
+	assert.Equal(t, "2", swappedB.id)
+	assert.Equal(t, []interface{}{int32(5)}, getColumnFromArrayList(swappedB.columns, 0).rows.Values())
+	assert.False(t, swappedA.isDeleted())
+	assert.False(t, swappedB.isDeleted())
+
+	// An insert into the old table which fails after the swap conflicts.
+	assert.Error(t, checkConflict(insert))
+}
+
+func TestRenameTablesMissingSource(t *testing.T) {
+	c, a := newMultiSchemaTable()
+	b := newSchemaTable("", "t2")
+	arg := &ddlRenameTablesArg{renames: []ddlTableRename{{a, a.key(), objectKey{"", "t3"}}, {b, b.key(), objectKey{"", "t4"}}}}
+	task := &ddlJobTask{k: ddlRenameTables, tblInfo: a, arg: ddlJobArg(arg)}
+	a.setDeleted()
+	b.setDeleted()
+	assert.Equal(t, errCodeNoSuchTable, expectedErrorCode(c.updateTableInfo(task)))
+	// None of the tables is renamed.
+	assert.Equal(t, map[objectKey]*ddlTestTable{a.key(): a}, c.tables)
+	assert.False(t, a.isDeleted())
+
+	// Both tables are renamed to the same name.
+	c.tables[b.key()] = b
+	b.setDeleted()
+	arg.renames[1].to = objectKey{"", "t3"}
+	assert.Equal(t, errCodeTableExists, expectedErrorCode(c.updateTableInfo(task)))
+	assert.Len(t, c.tables, 2)
+	assert.False(t, b.isDeleted())
+}
+
+func TestSwapTablesUniqueChange(t *testing.T) {
+	a, b := newSchemaTable("", "t1"), newSchemaTable("", "t2")
+	tmp := objectKey{"", "tmp"}
+	arg := &ddlRenameTablesArg{renames: []ddlTableRename{{a, a.key(), tmp}, {b, b.key(), a.key()}, {a, tmp, b.key()}}}
+	task := &ddlJobTask{k: ddlRenameTables, tblInfo: a, arg: ddlJobArg(arg)}
+	// Each table is only begun once, see `execSerialDDLSQL`.
+	assert.Equal(t, []*ddlTestTable{a, b}, task.uniqueChangeTables())
+}
@@ -2,14 +2,12 @@ package ddl
 
 import (
 	"database/sql"
-	"fmt"
 	"os"
 	"os/signal"
-	"regexp"
-	"strings"
 	"syscall"
 	"time"
 
+	"github.com/juju/errors"
 	"github.com/ngaut/log"
 	"golang.org/x/net/context"
 )
@@ -35,46 +33,68 @@ func OpenDB(dsn string, maxIdleConns int) (*sql.DB, error) {
 	return db, nil
 }
 
-func Run(dbAddr string, dbName string, concurrency int, tablesToCreate int, mysqlCompatible bool, testTp DDLTestType) {
+// Run runs the DDL test until it is interrupted by a signal, the configured
+// duration or rounds are reached, or a divergence is found. It returns nil
+// only if the test finishes without interruption and without divergence.
+func Run(dbCfg DBConfig, cfg *DDLCaseConfig) error {
+	log.Infof("[ddl] seed %d, rerun with --seed=%d to reproduce", cfg.Seed, cfg.Seed)
 	ctx, cancel := context.WithCancel(context.Background())
-	dbss := make([][]*sql.DB, 0, concurrency)
-	dbDSN := fmt.Sprintf("root:@tcp(%s)/%s", dbAddr, dbName)
-	for i := 0; i < concurrency; i++ {
+	defer cancel()
+	dbss := make([][]*sql.DB, 0, cfg.Concurrency)
+	dbDSN := dbCfg.DSN()
+	for i := 0; i < cfg.Concurrency; i++ {
 		dbs := make([]*sql.DB, 0, 2)
 		// Parallel send DDL request need more connection to send DDL request concurrently
 		db0, err := OpenDB(dbDSN, 20)
 		if err != nil {
-			log.Fatalf("[ddl] create db client error %v", err)
+			return errors.Annotatef(err, "create db client error")
 		}
 		db1, err := OpenDB(dbDSN, 1)
 		if err != nil {
-			log.Fatalf("[ddl] create db client error %v", err)
+			return errors.Annotatef(err, "create db client error")
 		}
 		dbs = append(dbs, db0)
 		dbs = append(dbs, db1)
 		dbss = append(dbss, dbs)
 	}
 
+	interrupted := make(chan os.Signal, 1)
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc,
 		syscall.SIGHUP,
 		syscall.SIGINT,
 		syscall.SIGTERM,
 		syscall.SIGQUIT)
+	defer signal.Stop(sc)
 	go func() {
-		sig := <-sc
-		log.Infof("[ddl] Got signal [%d] to exist.", sig)
-		cancel()
-		os.Exit(0)
+		select {
+		case sig := <-sc:
+			log.Infof("[ddl] Got signal [%d] to exist.", sig)
+			interrupted <- sig
+			cancel()
+		case <-ctx.Done():
+		}
 	}()
 
-	cfg := DDLCaseConfig{
-		Concurrency:     concurrency,
-		TablesToCreate:  tablesToCreate,
-		MySQLCompatible: mysqlCompatible,
-		TestTp:          testTp,
+	if cfg.MetricsAddr != "" {
+		startMetricsServer(cfg.MetricsAddr)
+	}
+	if cfg.PushGateway != "" {
+		pushMetrics(ctx, cfg.PushGateway, defaultPushMetricsInterval)
+	}
+	if (cfg.MetricsAddr != "" || cfg.PushGateway != "") && !cfg.MySQLCompatible {
+		collectDDLJobsLag(ctx, dbss[0][0], defaultPushMetricsInterval)
+	}
+
+	ddl := NewDDLCase(cfg)
+	if cfg.TracePath != "" {
+		closeTrace, err := ddl.SetTrace(cfg.TracePath)
+		if err != nil {
+			return errors.Annotatef(err, "create trace error")
+		}
+		defer closeTrace()
+		log.Infof("[ddl] record trace to %s", cfg.TracePath)
 	}
-	ddl := NewDDLCase(&cfg)
 	exeDDLFunc := SerialExecuteOperations
 	if cfg.TestTp == ParallelDDLTest {
 		exeDDLFunc = ParallelExecuteOperations
@@ -83,81 +103,16 @@ func Run(dbAddr string, dbName string, concurrency int, tablesToCreate int, mysq
 	if enableTransactionTest {
 		execDMLFunc = TransactionExecuteOperations
 	}
-	if err := ddl.Initialize(ctx, dbss, dbName); err != nil {
-		log.Fatalf("[ddl] initialze error %v", err)
+	if err := ddl.Initialize(ctx, dbss, dbCfg.DB); err != nil {
+		return errors.Annotatef(err, "[seed %d] initialze error", cfg.Seed)
 	}
 	if err := ddl.Execute(ctx, dbss, exeDDLFunc, execDMLFunc); err != nil {
-		log.Fatalf("[ddl] execute error %v", err)
-	}
-}
-
-func dmlIgnoreError(err error) bool {
-	if err == nil {
-		return true
-	}
-	errStr := err.Error()
-	if strings.Contains(errStr, "Information schema is changed") {
-		return true
-	}
-	if strings.Contains(errStr, "try again later") {
-		return true
-	}
-	// Sometimes, there might be duplicated entry error caused by concurrent.
-	// So we ignore here.
-	if strings.Contains(errStr, "Duplicate entry") {
-		return true
-	}
-	// Sometimes, a insert to a table might generate an error caused by exceeding maximum auto increment id,
-	// we ignore this error here.
-	if strings.Contains(errStr, "Failed to read auto-increment value from storage engine") {
-		return true
-	}
-	if strings.Contains(errStr, "invalid connection") {
-		return true
-	}
-	if strings.Contains(errStr, "doesn't exist") || strings.Contains(errStr, "not found") ||
-		strings.Contains(errStr, "column is deleted") || strings.Contains(errStr, "Can't find column") ||
-		strings.Contains(errStr, "converting driver.Value type") || strings.Contains(errStr, "column specified twice") ||
-		strings.Contains(errStr, "Out of range value for column") || strings.Contains(errStr, "Unknown column") ||
-		strings.Contains(errStr, "column has index reference") || strings.Contains(errStr, "Data too long for column") ||
-		strings.Contains(errStr, "Data Truncated") || strings.Contains(errStr, "no rows in result set") {
-		return true
-	}
-	return false
-}
-
-func ddlIgnoreError(err error) bool {
-	if err == nil {
-		return true
-	}
-	errStr := err.Error()
-	log.Warnf("check DDL err:%s", errStr)
-	if strings.Contains(errStr, "Information schema is changed") {
-		return true
-	}
-	// Sometimes, set shard row id bits to a large value might cause global auto ID overflow error.
-	// We ignore this error here.
-	if match, _ := regexp.MatchString(`cause next global auto ID( \d+ | )overflow`, errStr); match {
-		return true
-	}
-	if strings.Contains(errStr, "invalid connection") {
-		return true
-	}
-	if strings.Contains(errStr, "unsupported shard_row_id_bits for table with primary key as row id") {
-		return true
+		return errors.Trace(err)
 	}
-	if strings.Contains(errStr, "table doesn't exist") ||
-		strings.Contains(errStr, "doesn't have a default value") ||
-		strings.Contains(errStr, "is not exists") || strings.Contains(errStr, "column does not exist") ||
-		strings.Contains(errStr, "doesn't exist") || strings.Contains(errStr, "Unknown table") ||
-		strings.Contains(errStr, "admin show ddl jobs len != len(tasks)") ||
-		strings.Contains(errStr, "doesn't exist") || strings.Contains(errStr, "not found") ||
-		strings.Contains(errStr, "column is deleted") || strings.Contains(errStr, "Can't find column") ||
-		strings.Contains(errStr, "converting driver.Value type") || strings.Contains(errStr, "column specified twice") ||
-		strings.Contains(errStr, "Out of range value for column") || strings.Contains(errStr, "Unknown column") ||
-		strings.Contains(errStr, "column has index reference") || strings.Contains(errStr, "Data too long for column") ||
-		strings.Contains(errStr, "Data Truncated") || strings.Contains(errStr, "no rows in result set") {
-		return true
+	select {
+	case sig := <-interrupted:
+		return errors.Errorf("[seed %d] interrupted by signal %v", cfg.Seed, sig)
+	default:
 	}
-	return false
+	return nil
 }
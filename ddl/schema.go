@@ -0,0 +1,190 @@
+package ddl
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+)
+
+// placementPolicyName is the placement policy set by ALTER SCHEMA on TiDB.
+// It only changes how the replicas are scheduled, not the data.
+const placementPolicyName = "schrddl_policy"
+
+// InheritCharsetProbability is the probability that a table created in a
+// schema of the test inherits the charset and the collation of the schema.
+var InheritCharsetProbability = 0.5
+
+// createPlacementPolicy creates the placement policy `placementPolicyName` on
+// TiDB, and returns its name, or the empty name if the server doesn't support
+// placement policies.
+func createPlacementPolicy(db *sql.DB, mysqlCompatible bool) (string, error) {
+	if mysqlCompatible {
+		return "", nil
+	}
+	_, err := db.Exec(fmt.Sprintf("CREATE PLACEMENT POLICY IF NOT EXISTS `%s` FOLLOWERS=2", placementPolicyName))
+	if mysqlErrorCode(err) == errCodeParseError {
+		log.Warnf("[ddl] placement policies are not supported: %v", err)
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return placementPolicyName, nil
+}
+
+type ddlAlterSchemaArg struct {
+	charset   string
+	collate   string
+	placement string // the new placement policy if `alterPlacement`, empty for DEFAULT.
+
+	alterPlacement bool
+}
+
+func (c *testCase) generateAlterSchema() error {
+	c.ddlOps = append(c.ddlOps, ddlTestOpExecutor{c.prepareAlterSchema, nil, ddlAlterSchema})
+	return nil
+}
+
+// prepareAlterSchema changes the default charset and collation of a schema,
+// or its placement policy on TiDB.
+func (c *testCase) prepareAlterSchema(_ interface{}, taskCh chan *ddlJobTask) error {
+	schema := c.pickupRandomSchema(c.ddlRand)
+	if schema == nil {
+		return nil
+	}
+	arg := &ddlAlterSchemaArg{}
+	syntax := dbSchemaSyntax[c.ddlRand.Intn(len(dbSchemaSyntax))]
+	var sql string
+	if c.placementPolicy != "" && c.ddlRand.Intn(3) == 0 {
+		arg.alterPlacement = true
+		policy := "DEFAULT"
+		if schema.placement == "" {
+			arg.placement = c.placementPolicy
+			policy = fmt.Sprintf("`%s`", c.placementPolicy)
+		}
+		sql = fmt.Sprintf("ALTER %s `%s` PLACEMENT POLICY = %s", syntax, schema.name, policy)
+	} else {
+		arg.charset, arg.collate = c.pickupRandomCharsetAndCollate(c.ddlRand)
+		// TiDB doesn't run a job for the unchanged options.
+		if arg.charset == schema.charset && arg.collate == schema.collate {
+			return nil
+		}
+		sql = fmt.Sprintf("ALTER %s `%s` CHARACTER SET '%s' COLLATE '%s'", syntax, schema.name, arg.charset, arg.collate)
+	}
+	task := &ddlJobTask{
+		k:          ddlAlterSchema,
+		sql:        sql,
+		schemaInfo: schema,
+		arg:        ddlJobArg(arg),
+	}
+	taskCh <- task
+	return nil
+}
+
+func (c *testCase) alterSchemaJob(task *ddlJobTask) error {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	schema := task.schemaInfo
+	if c.isSchemaDeleted(schema) {
+		return expectError(errCodeBadDB, "schema %s doesn't exist", schema.name)
+	}
+	arg := (*ddlAlterSchemaArg)(task.arg)
+	if arg.alterPlacement {
+		schema.placement = arg.placement
+	} else {
+		schema.charset, schema.collate = arg.charset, arg.collate
+	}
+	return nil
+}
+
+// inheritSchemaCharset sets the charset and the collation of the table
+// created without them to the defaults of its schema. The caller should hold
+// `c.tablesLock`.
+func (c *testCase) inheritSchemaCharset(table *ddlTestTable) {
+	if !table.dbCharset {
+		return
+	}
+	if schema, ok := c.schemas[table.schema]; ok {
+		table.charset, table.collate = schema.charset, schema.collate
+	}
+}
+
+// schemaOptions is a row of `information_schema.SCHEMATA`.
+type schemaOptions struct {
+	charset   string
+	collate   string
+	placement sql.NullString
+}
+
+// readSchemaOptions reads the options of the schema `name`, it returns nil
+// if the schema doesn't exist. The placement policy is only read if
+// `placement` is true, which the servers without placement policies lack.
+func readSchemaOptions(db *sql.DB, name string, placement bool) (*schemaOptions, error) {
+	options := &schemaOptions{}
+	query := "SELECT DEFAULT_CHARACTER_SET_NAME, DEFAULT_COLLATION_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?"
+	dest := []interface{}{&options.charset, &options.collate}
+	if placement {
+		query = "SELECT DEFAULT_CHARACTER_SET_NAME, DEFAULT_COLLATION_NAME, TIDB_PLACEMENT_POLICY_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?"
+		dest = append(dest, &options.placement)
+	}
+	err := db.QueryRow(query, name).Scan(dest...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return options, nil
+}
+
+// optionsDiff returns the differences between the schema and the options read
+// from the server, `actual` is nil if the schema doesn't exist on the server.
+func (schema *ddlTestSchema) optionsDiff(actual *schemaOptions, placement bool) []string {
+	if actual == nil {
+		return []string{"schema doesn't exist"}
+	}
+	var diffs []string
+	if actual.charset != schema.charset {
+		diffs = append(diffs, fmt.Sprintf("charset: expected %s, got %s", schema.charset, actual.charset))
+	}
+	if actual.collate != schema.collate {
+		diffs = append(diffs, fmt.Sprintf("collate: expected %s, got %s", schema.collate, actual.collate))
+	}
+	if placement && actual.placement.String != schema.placement {
+		diffs = append(diffs, fmt.Sprintf("placement policy: expected %q, got %q", schema.placement, actual.placement.String))
+	}
+	return diffs
+}
+
+// executeVerifySchemata verifies the options of the schemas created by the
+// test against `information_schema.SCHEMATA`, see `executeVerifySchema`.
+func (c *testCase) executeVerifySchemata() error {
+	c.tablesLock.RLock()
+	schemas := make([]*ddlTestSchema, 0, len(c.schemas))
+	for _, schema := range c.schemas {
+		schemas = append(schemas, schema)
+	}
+	c.tablesLock.RUnlock()
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].name < schemas[j].name })
+
+	placement := c.placementPolicy != ""
+	for _, schema := range schemas {
+		if c.isTableUnknown(objectKey{schema: schema.name}) {
+			continue
+		}
+		actual, err := readSchemaOptions(c.dbs[0], schema.name, placement)
+		if err != nil {
+			return errors.Annotatef(err, "read options of schema `%s`", schema.name)
+		}
+		if diffs := schema.optionsDiff(actual, placement); len(diffs) > 0 {
+			verifyCounter.WithLabelValues("fail").Inc()
+			c.stopTest()
+			return fmt.Errorf("Options of schema `%s` differ from the local model:\n%s", schema.name, strings.Join(diffs, "\n"))
+		}
+	}
+	return nil
+}
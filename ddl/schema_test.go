@@ -0,0 +1,92 @@
+package ddl
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/emirpasic/gods/lists/arraylist"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSchemaTable(schema, name string) *ddlTestTable {
+	a := &ddlTestColumn{k: KindInt32, name: "a", fieldType: "INT", rows: arraylist.New()}
+	return &ddlTestTable{schema: schema, name: name, columns: arraylist.New(a), lock: new(sync.RWMutex)}
+}
+
+func TestQuotedName(t *testing.T) {
+	table := newSchemaTable("s", "t")
+	view := &ddlTestView{schema: "s", name: "v", columns: []*ddlTestColumn{getColumnFromArrayList(table.columns, 0)}, table: table}
+	assert.Equal(t, "`s`.`t`", table.quotedName())
+	assert.Equal(t, "`v`", (&ddlTestView{name: "v"}).quotedName())
+	assert.Equal(t, "select `a` from `s`.`t`", view.selectSQL())
+	assert.Equal(t, "CREATE TABLE `s`.`t` (`a` INT NULL) COMMENT '' CHARACTER SET '' COLLATE ''", table.createTableSQL())
+	c := &testCase{initDB: "test"}
+	assert.Equal(t, "test", c.schemaName(""))
+	assert.Equal(t, "s", c.schemaName("s"))
+}
+
+func TestDropSchema(t *testing.T) {
+	s := &ddlTestSchema{name: "s"}
+	t1, t2, other := newSchemaTable("s", "t"), newSchemaTable("s", "t2"), newSchemaTable("", "t")
+	view := &ddlTestView{schema: "s", name: "v", table: other}
+	c := &testCase{
+		schemas: map[string]*ddlTestSchema{"s": s},
+		tables:  map[objectKey]*ddlTestTable{t1.key(): t1, t2.key(): t2, other.key(): other},
+		views:   map[objectKey]*ddlTestView{view.key(): view},
+	}
+	assert.False(t, c.isTableDeleted(t1))
+	assert.False(t, c.isTableDeleted(other))
+
+	// A table of the schema is referenced by a table in another schema.
+	fk := &ddlTestForeignKey{name: "fk", column: getColumnFromArrayList(other.columns, 0), parent: t1, refColumn: getColumnFromArrayList(t1.columns, 0)}
+	other.foreignKeys = []*ddlTestForeignKey{fk}
+	s.setDeleted()
+	task := &ddlJobTask{k: ddlDropSchema, schemaInfo: s, arg: ddlJobArg(&ddlDropSchemaArg{tables: []*ddlTestTable{t1, t2}})}
+	assert.Equal(t, errCodeFKCannotDropParent, expectedErrorCode(c.updateTableInfo(task)))
+	assert.False(t, s.isDeleted())
+	assert.Equal(t, []*ddlTestTable{t1, t2}, task.uniqueChangeTables())
+
+	other.foreignKeys = nil
+	assert.NoError(t, c.updateTableInfo(task))
+	assert.True(t, c.isTableDeleted(t1))
+	assert.True(t, t2.isDeleted())
+	assert.True(t, view.isDeleted())
+	assert.False(t, c.isTableDeleted(other))
+	assert.Equal(t, errCodeDBDropExists, expectedErrorCode(c.updateTableInfo(task)))
+
+	// A table or a view in the dropped schema isn't created.
+	assert.Equal(t, errCodeBadDB, expectedErrorCode(c.updateTableInfo(&ddlJobTask{k: ddlAddTable, tblInfo: newSchemaTable("s", "t3")})))
+	renamed := newSchemaTable("s", "t4")
+	task = &ddlJobTask{k: ddlRenameTable, tblInfo: other, arg: ddlJobArg(renamed)}
+	assert.Error(t, c.updateTableInfo(task))
+	renamed.schema = ""
+	assert.NoError(t, c.updateTableInfo(task))
+	assert.Equal(t, map[objectKey]*ddlTestTable{{"", "t4"}: renamed}, c.tables)
+}
+
+func TestAlterSchema(t *testing.T) {
+	s := &ddlTestSchema{name: "s", charset: "utf8mb4", collate: "utf8mb4_bin"}
+	c := &testCase{schemas: map[string]*ddlTestSchema{"s": s}, tables: map[objectKey]*ddlTestTable{}}
+	table := newSchemaTable("s", "t")
+	table.dbCharset = true
+	assert.Equal(t, "CREATE TABLE `s`.`t` (`a` INT NULL) COMMENT ''", table.createTableSQL())
+
+	task := &ddlJobTask{k: ddlAlterSchema, schemaInfo: s, arg: ddlJobArg(&ddlAlterSchemaArg{charset: "latin1", collate: "latin1_bin"})}
+	assert.NoError(t, c.updateTableInfo(task))
+	assert.NoError(t, c.updateTableInfo(&ddlJobTask{k: ddlAddTable, tblInfo: table}))
+	assert.Equal(t, "latin1", table.charset)
+	assert.Equal(t, "latin1_bin", table.collate)
+	assert.False(t, table.copyStructure("t2").dbCharset)
+
+	task.arg = ddlJobArg(&ddlAlterSchemaArg{alterPlacement: true, placement: placementPolicyName})
+	assert.NoError(t, c.updateTableInfo(task))
+	assert.Equal(t, "latin1", s.charset)
+	assert.Equal(t, placementPolicyName, s.placement)
+	actual := &schemaOptions{charset: "latin1", collate: "latin1_bin"}
+	assert.Empty(t, s.optionsDiff(actual, false))
+	assert.Equal(t, []string{`placement policy: expected "schrddl_policy", got ""`}, s.optionsDiff(actual, true))
+	assert.Len(t, s.optionsDiff(nil, false), 1)
+
+	delete(c.schemas, "s")
+	assert.Equal(t, errCodeBadDB, expectedErrorCode(c.updateTableInfo(task)))
+}
@@ -0,0 +1,251 @@
+package ddl
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+)
+
+// A trace is a JSON-lines file that records every statement sent to the
+// database by the test, in the order the results come back. It can be
+// re-executed against a fresh database by `Replay`, which also re-runs the
+// integrity verification at the points where the original run did it.
+
+type traceEventKind string
+
+const (
+	traceDDL        traceEventKind = "ddl"
+	traceDML        traceEventKind = "dml"
+	traceBegin      traceEventKind = "begin"
+	traceCommit     traceEventKind = "commit"
+	traceVerify     traceEventKind = "verify"
+	traceAdminCheck traceEventKind = "admin-check"
+)
+
+type traceEvent struct {
+	Seq      int64          `json:"seq"`
+	Instance int            `json:"instance"`
+	Conn     int            `json:"conn"`
+	Txn      int64          `json:"txn,omitempty"`
+	Kind     traceEventKind `json:"kind"`
+	SQL      string         `json:"sql"`
+	Time     time.Time      `json:"time"`
+	Err      string         `json:"err,omitempty"`
+	// Kinds and Rows are only set for verify events, they are the data types
+	// of the selected columns and the row signatures the test expected.
+	Kinds []int    `json:"kinds,omitempty"`
+	Rows  []string `json:"rows,omitempty"`
+}
+
+// traceRecorder appends trace events to a file. Each event is written with a
+// single unbuffered write, so the trace is complete even if the process
+// exits through `log.Fatalf`. A nil *traceRecorder records nothing.
+type traceRecorder struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+	seq int64
+}
+
+func newTraceRecorder(path string) (*traceRecorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &traceRecorder{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (t *traceRecorder) record(ev *traceEvent) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	ev.Seq = t.seq
+	ev.Time = time.Now()
+	if err := t.enc.Encode(ev); err != nil {
+		log.Warnf("[trace] failed to record %s: %v", ev.SQL, err)
+	}
+}
+
+func (t *traceRecorder) recordSQL(instance, conn int, txn int64, kind traceEventKind, sql string, err error) {
+	if t == nil {
+		return
+	}
+	ev := &traceEvent{Instance: instance, Conn: conn, Txn: txn, Kind: kind, SQL: sql}
+	if err != nil {
+		ev.Err = err.Error()
+	}
+	t.record(ev)
+}
+
+func (t *traceRecorder) close() error {
+	if t == nil {
+		return nil
+	}
+	return t.f.Close()
+}
+
+var traceTxnID int64
+
+// nextTxnID returns an identifier for a new transaction in the trace.
+func nextTxnID() int64 {
+	return atomic.AddInt64(&traceTxnID, 1)
+}
+
+// Replay re-executes the trace in `tracePath` against the database `dbCfg`,
+// which should be a fresh one. Statements are executed one by
+// one in the recorded order, statements of a transaction are sent on the
+// same connection. A verify event re-runs the query and compares the result
+// with the recorded expected rows, and an error is returned at the first
+// verification that fails.
+func Replay(dbCfg DBConfig, tracePath string) error {
+	events, err := readTrace(tracePath)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	db, err := OpenDB(dbCfg.serverDSN(), 1)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	_, err = db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", dbCfg.DB))
+	db.Close()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	db, err = OpenDB(dbCfg.DSN(), 20)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := enableCheckConstraints(db, false); err != nil {
+		return errors.Trace(err)
+	}
+
+	s := newTraceSession(db)
+	defer s.close()
+	mismatches := 0
+	for _, ev := range events {
+		if ev.Kind == traceVerify {
+			if err := replayVerify(s, ev); err != nil {
+				return errors.Trace(err)
+			}
+			continue
+		}
+		err := s.exec(ev)
+		log.Infof("[replay] [instance %d] [seq %d] %s, err: %v", ev.Instance, ev.Seq, ev.SQL, err)
+		if (err == nil) != (ev.Err == "") {
+			mismatches++
+			log.Warnf("[replay] [instance %d] [seq %d] result differs, recorded err: %s, replay err: %v", ev.Instance, ev.Seq, ev.Err, err)
+		}
+		if ev.Kind == traceAdminCheck && err != nil && !adminCheckIgnoreError(SerialDDLTest, err) {
+			return errors.Annotatef(err, "[seq %d] Error when executing SQL: %s", ev.Seq, ev.SQL)
+		}
+	}
+	log.Infof("[replay] %d events replayed, %d results differ from the trace", len(events), mismatches)
+	return nil
+}
+
+func replayVerify(s *traceSession, ev *traceEvent) error {
+	actualRowsMap, err := s.query(ev)
+	if err != nil {
+		return errors.Annotatef(err, "[seq %d] Error when executing SQL: %s", ev.Seq, ev.SQL)
+	}
+	missing, unexpected := checkRowSignatures(ev.Rows, actualRowsMap)
+	if missing == "" && unexpected == "" {
+		if ev.Err != "" {
+			log.Warnf("[replay] [instance %d] [seq %d] verification failed in the trace but passes now: %s", ev.Instance, ev.Seq, ev.Err)
+		}
+		return nil
+	}
+	if missing != "" {
+		return fmt.Errorf("[seq %d] Expecting row %s but not found, sql: %s, recorded err: %s", ev.Seq, missing, ev.SQL, ev.Err)
+	}
+	return fmt.Errorf("[seq %d] Unexpected row %s, sql: %s, recorded err: %s", ev.Seq, unexpected, ev.SQL, ev.Err)
+}
+
+// readTrace reads all events of the trace file at `path`.
+func readTrace(path string) ([]*traceEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+	var events []*traceEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		ev := &traceEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), ev); err != nil {
+			return nil, errors.Annotatef(err, "invalid trace event: %s", scanner.Text())
+		}
+		events = append(events, ev)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return events, nil
+}
+
+// traceSession executes trace events on a database, statements of the same
+// transaction are sent on the same connection.
+type traceSession struct {
+	db   *sql.DB
+	txns map[int64]*sql.Conn
+}
+
+func newTraceSession(db *sql.DB) *traceSession {
+	return &traceSession{db: db, txns: make(map[int64]*sql.Conn)}
+}
+
+// exec executes the statement of `ev` and returns its error.
+func (s *traceSession) exec(ev *traceEvent) error {
+	ctx := context.Background()
+	if ev.Kind == traceBegin {
+		conn, err := s.db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		s.txns[ev.Txn] = conn
+	}
+	var err error
+	if conn, ok := s.txns[ev.Txn]; ok {
+		_, err = conn.ExecContext(ctx, ev.SQL)
+	} else {
+		_, err = s.db.ExecContext(ctx, ev.SQL)
+	}
+	if ev.Kind == traceCommit {
+		if conn, ok := s.txns[ev.Txn]; ok {
+			conn.Close()
+			delete(s.txns, ev.Txn)
+		}
+	}
+	return err
+}
+
+// query executes the query of a verify event and returns its row signatures.
+func (s *traceSession) query(ev *traceEvent) (map[string]int, error) {
+	rows, err := s.db.Query(ev.SQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return readRowSignatures(rows, ev.Kinds)
+}
+
+func (s *traceSession) close() {
+	for _, conn := range s.txns {
+		conn.Close()
+	}
+	s.db.Close()
+}
@@ -0,0 +1,57 @@
+package ddl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	trace, err := newTraceRecorder(path)
+	assert.Nil(t, err)
+	trace.recordSQL(1, 0, 0, traceDDL, "create table t (a int)", nil)
+	trace.recordSQL(1, 1, 3, traceDML, "insert into t values (1)", errors.New("Duplicate entry"))
+	trace.record(&traceEvent{Instance: 1, Kind: traceVerify, SQL: "select a from t", Kinds: []int{KindInt32}, Rows: []string{"1,"}})
+	assert.Nil(t, trace.close())
+
+	// A nil recorder records nothing.
+	var nilTrace *traceRecorder
+	nilTrace.recordSQL(0, 0, 0, traceDDL, "drop table t", nil)
+
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+	var events []traceEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev traceEvent
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &ev))
+		events = append(events, ev)
+	}
+	assert.Len(t, events, 3)
+	assert.Equal(t, int64(1), events[0].Seq)
+	assert.Equal(t, "", events[0].Err)
+	assert.Equal(t, int64(3), events[1].Txn)
+	assert.Equal(t, "Duplicate entry", events[1].Err)
+	assert.Equal(t, traceVerify, events[2].Kind)
+	assert.Equal(t, []string{"1,"}, events[2].Rows)
+}
+
+func TestCheckRowSignatures(t *testing.T) {
+	missing, unexpected := checkRowSignatures([]string{"1,", "1,", "2,"}, map[string]int{"1,": 2, "2,": 1})
+	assert.Equal(t, "", missing)
+	assert.Equal(t, "", unexpected)
+
+	missing, _ = checkRowSignatures([]string{"1,", "1,"}, map[string]int{"1,": 1})
+	assert.Equal(t, "1,", missing)
+
+	missing, unexpected = checkRowSignatures([]string{"1,"}, map[string]int{"1,": 1, "3,": 1})
+	assert.Equal(t, "", missing)
+	assert.Equal(t, "3,", unexpected)
+}
@@ -0,0 +1,275 @@
+package ddl
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+
+	"github.com/juju/errors"
+)
+
+// The unique keys of a table are its primary key and its unique indexes. The
+// model predicts whether an INSERT, an UPDATE or an ADD UNIQUE INDEX fails
+// with a duplicate key from the rows in memory. The strings of a key are
+// compared by the collation of their column, see `collationKey`.
+
+// DuplicateKeyProbability is the probability that an INSERT reuses the unique
+// key of an existing row.
+var DuplicateKeyProbability = 0.1
+
+// UniqueKeyProbability is the probability that a table is created with a
+// unique key.
+var UniqueKeyProbability = 0.3
+
+// uniqueKeys returns the columns of the primary key and of the unique indexes.
+func (table *ddlTestTable) uniqueKeys() [][]*ddlTestColumn {
+	keys := make([][]*ddlTestColumn, 0, len(table.indexes)+1)
+	if len(table.primaryKey) > 0 {
+		keys = append(keys, table.primaryKey)
+	}
+	for _, index := range table.indexes {
+		if index.unique {
+			keys = append(keys, index.columns)
+		}
+	}
+	return keys
+}
+
+// newCollationEnabled reports whether the server compares the strings by
+// their collations. TiDB compares them in binary unless its new collation
+// framework is enabled when the cluster is bootstrapped.
+func newCollationEnabled(db *sql.DB, mysqlCompatible bool) (bool, error) {
+	if mysqlCompatible {
+		return true, nil
+	}
+	var value string
+	err := db.QueryRow("SELECT VARIABLE_VALUE FROM mysql.tidb WHERE VARIABLE_NAME = 'new_collation_enabled'").Scan(&value)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return strings.EqualFold(value, "true"), errors.Trace(err)
+}
+
+// collationKey returns the key by which the collation of the column compares
+// the string `s`. The `_ci` collations are case insensitive, and all but the
+// binary and the `_0900_` ones are PAD SPACE, which ignores trailing spaces.
+// CHAR drops the trailing spaces anyway. The strings are compared in binary
+// if `newCollation` is false, and so are the values of the other types.
+func (col *ddlTestColumn) collationKey(s string, newCollation bool) string {
+	if !newCollation || col.k != KindChar && col.k != KindVarChar && col.k != KindTEXT {
+		return s
+	}
+	if col.k == KindChar || col.collate != "binary" && !strings.Contains(col.collate, "_0900_") {
+		s = strings.TrimRight(s, " ")
+	}
+	if strings.HasSuffix(col.collate, "_ci") {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// keySignature returns the signature of the key of `row` on `columns` at
+// `positions`, which is equal for the keys that the server compares equal.
+// It returns false if a column of the key is NULL, which is never duplicated.
+func keySignature(row []interface{}, columns []*ddlTestColumn, positions []int, newCollation bool) (string, bool) {
+	var sig strings.Builder
+	for i, pos := range positions {
+		value := row[pos]
+		if value == nil || value == ddlTestValueNull {
+			return "", false
+		}
+		sig.WriteString(columns[i].collationKey(fmt.Sprintf("%v", value), newCollation) + ",")
+	}
+	return sig.String(), true
+}
+
+// getRow returns the values of the row `i` in the order of `table.columns`.
+func (table *ddlTestTable) getRow(i int) []interface{} {
+	row := make([]interface{}, 0, table.columns.Size())
+	for ite := table.columns.Iterator(); ite.Next(); {
+		row = append(row, getRowFromArrayList(ite.Value().(*ddlTestColumn).rows, i))
+	}
+	return row
+}
+
+// findDuplicate reports whether the rows would have a duplicate key on one of
+// `keys` after the rows at the positions of `changed` are replaced and the
+// rows `added` are appended. Only the duplicates involving a changed or added
+// row are found. The caller should hold the lock of the table.
+func (table *ddlTestTable) findDuplicate(keys [][]*ddlTestColumn, changed map[int][]interface{}, added [][]interface{}, newCollation bool) bool {
+	for _, key := range keys {
+		positions := make([]int, 0, len(key))
+		for _, column := range key {
+			pos := table.columns.IndexOf(column)
+			if pos < 0 {
+				break
+			}
+			positions = append(positions, pos)
+		}
+		if len(positions) != len(key) {
+			continue
+		}
+		// The signatures of the changed and added rows, and of the others.
+		newSigs, oldSigs := make(map[string]int), make(map[string]int)
+		count := func(row []interface{}, sigs map[string]int) {
+			if sig, ok := keySignature(row, key, positions, newCollation); ok {
+				sigs[sig]++
+			}
+		}
+		for i := 0; i < table.numberOfRows; i++ {
+			if row, ok := changed[i]; ok {
+				count(row, newSigs)
+			} else {
+				count(table.getRow(i), oldSigs)
+			}
+		}
+		for _, row := range added {
+			count(row, newSigs)
+		}
+		for sig, n := range newSigs {
+			if n > 1 || oldSigs[sig] > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// duplicateError returns the duplicate key error that a statement should fail
+// with if it changes the rows like `findDuplicate`, or nil.
+func (table *ddlTestTable) duplicateError(keys [][]*ddlTestColumn, changed map[int][]interface{}, added [][]interface{}, newCollation bool) error {
+	if table.findDuplicate(keys, changed, added, newCollation) {
+		return expectError(errCodeDupEntry, "duplicate key in table %s", table.name)
+	}
+	return nil
+}
+
+// allRows returns the rows by their positions, which are all checked when a
+// unique key is added.
+func (table *ddlTestTable) allRows() map[int][]interface{} {
+	rows := make(map[int][]interface{}, table.numberOfRows)
+	for i := 0; i < table.numberOfRows; i++ {
+		rows[i] = table.getRow(i)
+	}
+	return rows
+}
+
+// predictDuplicate returns the duplicate key error that the task should fail
+// with, if it changes the rows at the positions of `changed` and appends the
+// rows `added`. The prediction is skipped if a DDL changes the unique keys of
+// the table concurrently.
+func (c *testCase) predictDuplicate(task *dmlJobTask, changed map[int][]interface{}, added [][]interface{}) error {
+	if task.racesUniqueChange() {
+		return nil
+	}
+	table := task.tblInfo
+	return table.duplicateError(table.uniqueKeys(), changed, added, c.newCollation)
+}
+
+// beginUniqueChange marks that a DDL which changes the unique keys or removes
+// rows of the table starts, `uniqueEpoch` is odd until `endUniqueChange`.
+func (table *ddlTestTable) beginUniqueChange() {
+	atomic.AddInt64(&table.uniqueEpoch, 1)
+}
+
+func (table *ddlTestTable) endUniqueChange() {
+	atomic.AddInt64(&table.uniqueEpoch, 1)
+}
+
+func (table *ddlTestTable) loadUniqueEpoch() int64 {
+	return atomic.LoadInt64(&table.uniqueEpoch)
+}
+
+// racesUniqueChange reports whether a DDL that changes the unique keys of the
+// table, or the rows copied by INSERT ... SELECT, runs since the task was
+// prepared, and then the result of the task on the server may differ from the
+// model.
+func (task *dmlJobTask) racesUniqueChange() bool {
+	return task.uniqueEpoch%2 != 0 || task.tblInfo.loadUniqueEpoch() != task.uniqueEpoch || task.racesSourceChange()
+}
+
+// uniqueChangeTables returns the tables whose unique keys, constraints or rows
+// the DDL changes, see `racesUniqueChange`.
+func (task *ddlJobTask) uniqueChangeTables() []*ddlTestTable {
+	switch task.k {
+	case ddlAddIndex, ddlDropIndex:
+		if (*ddlIndexJobArg)(task.arg).index.unique {
+			return []*ddlTestTable{task.tblInfo}
+		}
+	case ddlAddPrimaryKey, ddlDropPrimaryKey, ddlTruncateTable, ddlDropPartition, ddlTruncatePartition:
+		return []*ddlTestTable{task.tblInfo}
+	case ddlExchangePartition:
+		return []*ddlTestTable{task.tblInfo, (*ddlPartitionJobArg)(task.arg).table}
+	case ddlDropTable:
+		return []*ddlTestTable{task.tblInfo}
+	case ddlDropSchema:
+		return (*ddlDropSchemaArg)(task.arg).tables
+	case ddlAddForeignKey, ddlDropForeignKey:
+		return []*ddlTestTable{task.tblInfo, (*ddlForeignKeyJobArg)(task.arg).fk.parent}
+	case ddlAddCheck, ddlDropCheck, ddlAlterCheck:
+		return []*ddlTestTable{task.tblInfo}
+	case ddlDropColumn:
+		// Dropping a column of a composite unique index shrinks the index.
+		return []*ddlTestTable{task.tblInfo}
+	case ddlModifyColumn:
+		// Changing the type converts the rows.
+		if arg := (*ddlColumnJobArg)(task.arg); arg.column.notNull != arg.origColumn.notNull ||
+			arg.column.fieldType != arg.origColumn.fieldType {
+			return []*ddlTestTable{task.tblInfo}
+		}
+	case ddlRecoverTable, ddlFlashbackTable, ddlRecoverSchema:
+		// The restored tables have the rows of their tombstones.
+		return (*ddlRecoverArg)(task.arg).tables
+	case ddlRenameTables:
+		var tables []*ddlTestTable
+		for _, rename := range (*ddlRenameTablesArg)(task.arg).renames {
+			if !containsTable(tables, rename.table) {
+				tables = append(tables, rename.table)
+			}
+		}
+		return tables
+	case ddlCreateTableSelect:
+		// The new table has the rows of the source.
+		return []*ddlTestTable{task.tblInfo}
+	case ddlMultiSchemaChange:
+		for _, sub := range (*ddlMultiSchemaChangeArg)(task.arg).subTasks {
+			if len(sub.uniqueChangeTables()) > 0 {
+				return []*ddlTestTable{task.tblInfo}
+			}
+		}
+	}
+	return nil
+}
+
+// pickupDuplicateKey returns the values of a random unique key of a random
+// row, or nil if the key has a NULL. The caller should hold the lock of the
+// table.
+func (table *ddlTestTable) pickupDuplicateKey(r *rand.Rand) []*ddlTestColumnDescriptor {
+	keys := table.uniqueKeys()
+	if len(keys) == 0 || table.numberOfRows == 0 {
+		return nil
+	}
+	key := keys[r.Intn(len(keys))]
+	i := r.Intn(table.numberOfRows)
+	values := make([]*ddlTestColumnDescriptor, 0, len(key))
+	for _, column := range key {
+		value := getRowFromArrayList(column.rows, i)
+		// An AUTO_RANDOM column cannot be assigned explicitly.
+		if column.isDeleted() || column.isGenerated() || column.autoRandomBits > 0 || value == nil || value == ddlTestValueNull {
+			return nil
+		}
+		values = append(values, &ddlTestColumnDescriptor{column, value})
+	}
+	return values
+}
+
+func containsColumn(columns []*ddlTestColumn, column *ddlTestColumn) bool {
+	for _, col := range columns {
+		if col == column {
+			return true
+		}
+	}
+	return false
+}
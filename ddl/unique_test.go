@@ -0,0 +1,93 @@
+package ddl
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/emirpasic/gods/lists/arraylist"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindDuplicate(t *testing.T) {
+	id := &ddlTestColumn{k: KindInt32, name: "id", rows: arraylist.New()}
+	name := &ddlTestColumn{k: KindVarChar, name: "name", rows: arraylist.New()}
+	table := &ddlTestTable{
+		name:       "t",
+		columns:    arraylist.New(id, name),
+		primaryKey: []*ddlTestColumn{id},
+		indexes:    []*ddlTestIndex{{name: "uk", columns: []*ddlTestColumn{name}, unique: true}},
+		lock:       new(sync.RWMutex),
+	}
+	table.addRows([][]interface{}{{int64(1), "abc"}, {int64(2), ddlTestValueNull}})
+	keys := table.uniqueKeys()
+	assert.Len(t, keys, 2)
+
+	assert.True(t, table.findDuplicate(keys, nil, [][]interface{}{{int64(1), "xyz"}}, false))
+	// NULL is never duplicated.
+	assert.False(t, table.findDuplicate(keys, nil, [][]interface{}{{int64(3), ddlTestValueNull}}, false))
+	// A changed row doesn't conflict with its old values.
+	assert.False(t, table.findDuplicate(keys, map[int][]interface{}{0: {int64(1), "abd"}}, nil, false))
+	assert.True(t, table.findDuplicate(keys, map[int][]interface{}{1: {int64(1), "x"}}, nil, false))
+
+	columns := [][]*ddlTestColumn{{name}}
+	assert.NoError(t, table.duplicateError(columns, table.allRows(), nil, false))
+	table.addRows([][]interface{}{{int64(3), "abc"}})
+	assert.Equal(t, errCodeDupEntry, expectedErrorCode(table.duplicateError(columns, table.allRows(), nil, false)))
+}
+
+func TestFindDuplicateByCollation(t *testing.T) {
+	name := &ddlTestColumn{k: KindVarChar, name: "name", rows: arraylist.New()}
+	table := &ddlTestTable{
+		name:    "t",
+		columns: arraylist.New(name),
+		indexes: []*ddlTestIndex{{name: "uk", columns: []*ddlTestColumn{name}, unique: true}},
+		lock:    new(sync.RWMutex),
+	}
+	table.addRows([][]interface{}{{"abc"}})
+	keys := table.uniqueKeys()
+	for _, c := range []struct {
+		collate      string
+		newCollation bool
+		value        string
+		dup          bool
+	}{
+		{"utf8mb4_general_ci", true, "ABC ", true},
+		{"utf8mb4_bin", true, "ABC", false},
+		{"utf8mb4_bin", true, "abc ", true},
+		{"utf8mb4_0900_ai_ci", true, "ABC", true},
+		{"utf8mb4_0900_ai_ci", true, "abc ", false},
+		// TiDB compares in binary without the new collation framework.
+		{"utf8mb4_general_ci", false, "ABC", false},
+	} {
+		name.collate = c.collate
+		assert.Equal(t, c.dup, table.findDuplicate(keys, nil, [][]interface{}{{c.value}}, c.newCollation), "%s %q", c.collate, c.value)
+	}
+	// CHAR drops the trailing spaces under any collation.
+	name.k = KindChar
+	assert.True(t, table.findDuplicate(keys, nil, [][]interface{}{{"abc "}}, true))
+}
+
+func TestDropColumnRacesUniqueKey(t *testing.T) {
+	a := &ddlTestColumn{k: KindInt32, name: "a", rows: arraylist.New()}
+	b := &ddlTestColumn{k: KindInt32, name: "b", rows: arraylist.New(), indexReferences: 1}
+	table := &ddlTestTable{
+		name:    "t",
+		columns: arraylist.New(a, b),
+		indexes: []*ddlTestIndex{{name: "uk", columns: []*ddlTestColumn{a, b}, unique: true}},
+		lock:    new(sync.RWMutex),
+	}
+	table.addRows([][]interface{}{{int32(1), int32(1)}})
+	c := &testCase{}
+	insert := &dmlJobTask{tblInfo: table, uniqueEpoch: table.loadUniqueEpoch()}
+	rows := [][]interface{}{{int32(1), int32(2)}}
+	assert.NoError(t, c.predictDuplicate(insert, nil, rows))
+
+	// Dropping `b` shrinks the unique index to `a`, so the INSERT may fail
+	// with a duplicate key if it runs after the DDL.
+	drop := &ddlJobTask{k: ddlDropColumn, tblInfo: table, arg: ddlJobArg(&ddlColumnJobArg{column: b})}
+	assert.Equal(t, []*ddlTestTable{table}, drop.uniqueChangeTables())
+	table.beginUniqueChange()
+	assert.True(t, insert.racesUniqueChange())
+	table.endUniqueChange()
+	assert.True(t, insert.racesUniqueChange())
+}
@@ -15,8 +15,10 @@ package ddl
 
 import (
 	"database/sql"
+	"fmt"
 	"math/rand"
 	"strings"
+	"time"
 
 	"github.com/emirpasic/gods/lists/arraylist"
 	"github.com/ngaut/log"
@@ -40,8 +42,12 @@ func PadRight(str, pad string, length int) string {
 	return str[:length]
 }
 
+// gcLifeTime is how long TiKV keeps the old data during the test, which
+// bounds how long a dropped table can be recovered, see `recoverWindow`.
+const gcLifeTime = 10 * time.Minute
+
 func enableTiKVGC(db *sql.DB) {
-	sql := "update mysql.tidb set VARIABLE_VALUE = '10m' where VARIABLE_NAME = 'tikv_gc_life_time';"
+	sql := fmt.Sprintf("update mysql.tidb set VARIABLE_VALUE = '%s' where VARIABLE_NAME = 'tikv_gc_life_time';", gcLifeTime)
 	_, err := db.Exec(sql)
 	if err != nil {
 		log.Warnf("Failed to enable TiKV GC")
@@ -83,51 +89,62 @@ func parallel(funcs ...func() error) error {
 
 const letterBytes = "abcdefghijklmnopqrstuvwxyz1234567890"
 
-func RandSeq(n int) string {
+func RandSeq(r *rand.Rand, n int) string {
 	b := make([]byte, n)
 	for i := range b {
-		b[i] = letterBytes[rand.Intn(len(letterBytes))]
+		b[i] = letterBytes[r.Intn(len(letterBytes))]
 	}
 	return string(b)
 }
 
+// RandName returns a random name in the form of a version 4 UUID. Unlike
+// `uuid.NewV4()`, the name is drawn from `r`, so a run started with the same
+// seed creates objects with the same names.
+func RandName(r *rand.Rand) string {
+	var b [16]byte
+	r.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
 const numberBytes = "0123456789"
 
-func randNum(n int) []byte {
+func randNum(r *rand.Rand, n int) []byte {
 	b := make([]byte, n)
 	for i := range b {
-		b[i] = numberBytes[rand.Int63()%int64(len(numberBytes))]
+		b[i] = numberBytes[r.Int63()%int64(len(numberBytes))]
 	}
 	return b
 }
 
-func RandMD() (m int, d int) {
+func RandMD(r *rand.Rand) (m int, d int) {
 	for m == 0 {
-		m = rand.Intn(MAXDECIMALM)
+		m = r.Intn(MAXDECIMALM)
 	}
 	min := m
 	if min > MAXDECIMALN {
 		min = MAXDECIMALN
 	}
-	d = rand.Intn(min)
+	d = r.Intn(min)
 	return
 }
 
 // RandMDN returns a filedTypeM and filedTypeD randomly which are not smaller
 // than the given filedTypeM `m` and filedTypeD `d`.
-func RandMDN(m int, d int) (int, int) {
-	newM := rand.Intn(MAXDECIMALM-m) + m
+func RandMDN(r *rand.Rand, m int, d int) (int, int) {
+	newM := r.Intn(MAXDECIMALM-m) + m
 	min := newM
 	if min > MAXDECIMALN {
 		min = MAXDECIMALN
 	}
-	newD := rand.Intn(min-d) + d
+	newD := r.Intn(min-d) + d
 	return newM, newD
 }
 
-func RandDecimal(m, d int) string {
-	ms := randNum(m - d)
-	ds := randNum(d)
+func RandDecimal(r *rand.Rand, m, d int) string {
+	ms := randNum(r, m-d)
+	ds := randNum(r, d)
 	var i int
 	for i = range ms {
 		if ms[i] != byte('0') {
@@ -136,7 +153,7 @@ func RandDecimal(m, d int) string {
 	}
 	ms = ms[i:]
 	l := len(ms) + len(ds) + 1
-	flag := rand.Intn(2)
+	flag := r.Intn(2)
 	//check for 0.0... avoid -0.0
 	zeroFlag := true
 	for i := range ms {
@@ -167,11 +184,11 @@ func RandDecimal(m, d int) string {
 
 const FieldNameLen = 8
 
-func RandFieldName(m map[string]interface{}) string {
-	name := RandSeq(FieldNameLen)
+func RandFieldName(r *rand.Rand, m map[string]interface{}) string {
+	name := RandSeq(r, FieldNameLen)
 	_, ok := m[name]
 	for ok {
-		name = RandSeq(FieldNameLen)
+		name = RandSeq(r, FieldNameLen)
 		_, ok = m[name]
 	}
 	return name
@@ -179,14 +196,14 @@ func RandFieldName(m map[string]interface{}) string {
 
 const EnumValueLen = 5
 
-func RandEnumString(m map[string]struct{}) string {
-	l := rand.Intn(EnumValueLen) + 1
-	name := RandSeq(l)
+func RandEnumString(r *rand.Rand, m map[string]struct{}) string {
+	l := r.Intn(EnumValueLen) + 1
+	name := RandSeq(r, l)
 	nameL := strings.ToLower(name)
 	_, ok := m[nameL]
 	for ok {
-		l = rand.Intn(EnumValueLen) + 1
-		name = RandSeq(l)
+		l = r.Intn(EnumValueLen) + 1
+		name = RandSeq(r, l)
 		nameL = strings.ToLower(name)
 		_, ok = m[nameL]
 	}
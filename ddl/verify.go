@@ -0,0 +1,872 @@
+package ddl
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+)
+
+// tableSchema is the metadata of a table read from the server.
+type tableSchema struct {
+	comment        string
+	charset        string
+	collate        string
+	shardRowIDBits int64
+	pkType         string // CLUSTERED or NONCLUSTERED on TiDB.
+	columns        []columnSchema
+	// indexes maps the index names to their key parts, see
+	// `ddlTestKeyPart.statistics`, the primary key is named "PRIMARY".
+	indexes map[string][]string
+	// uniqueIndexes is the set of the names of the unique indexes.
+	uniqueIndexes map[string]bool
+	// invisibleIndexes is the set of the names of the invisible indexes.
+	invisibleIndexes map[string]bool
+	// partitionMethod is empty if the table isn't partitioned.
+	partitionMethod string
+	partitions      []partitionSchema
+}
+
+// partitionSchema is a row of `information_schema.PARTITIONS`.
+type partitionSchema struct {
+	name        string
+	description sql.NullString
+}
+
+// columnSchema is a row of `information_schema.COLUMNS`.
+type columnSchema struct {
+	name         string
+	dataType     string
+	columnType   string
+	nullable     bool
+	defaultValue sql.NullString
+	charLength   sql.NullInt64
+	precision    sql.NullInt64
+	scale        sql.NullInt64
+	extra        string
+}
+
+var (
+	showCreateCharsetRe      = regexp.MustCompile(`CHARSET=(\w+)`)
+	showCreateShardRowIDBits = regexp.MustCompile(`SHARD_ROW_ID_BITS=(\d+)`)
+	showCreatePKType         = regexp.MustCompile(`PRIMARY KEY \(.*\) /\*T!\[clustered_index\] (\w+) \*/`)
+)
+
+// markTablesUnknown marks that the metadata of the tables `keys` on the server
+// may differ from the local model for `reason`, for example a DDL on them
+// returns "invalid connection". A key with an empty name is a schema. They are
+// resynced by the next `executeVerifySchema`, and skipped by the
+// verifications until then.
+func (c *testCase) markTablesUnknown(reason string, keys ...objectKey) {
+	c.unknownLock.Lock()
+	defer c.unknownLock.Unlock()
+	if c.unknownTables == nil {
+		c.unknownTables = make(map[objectKey]string)
+	}
+	for _, key := range keys {
+		if _, ok := c.unknownTables[key]; !ok {
+			log.Warnf("[ddl] [instance %d] skip verification of %s until it is resynced, %s", c.caseIndex, quoteObjectName(key.schema, key.name), reason)
+		}
+		c.unknownTables[key] = reason
+	}
+}
+
+// markTasksUnknown marks the tables changed by `tasks` unknown.
+func (c *testCase) markTasksUnknown(reason string, tasks ...*ddlJobTask) {
+	var keys []objectKey
+	for _, task := range tasks {
+		keys = append(keys, c.changedKeys(task)...)
+	}
+	c.markTablesUnknown(reason, keys...)
+}
+
+// changedKeys returns the keys of the tables, the views and the schemas whose
+// metadata the task changes.
+func (c *testCase) changedKeys(task *ddlJobTask) []objectKey {
+	var keys []objectKey
+	if task.tblInfo != nil {
+		keys = append(keys, task.tblInfo.key())
+	}
+	if task.viewInfo != nil {
+		keys = append(keys, task.viewInfo.key())
+	}
+	if task.schemaInfo != nil {
+		keys = append(keys, objectKey{schema: task.schemaInfo.name})
+	}
+	switch task.k {
+	case ddlRenameTable:
+		keys = append(keys, (*ddlTestTable)(task.arg).key())
+	case ddlRenameTables:
+		for _, rename := range (*ddlRenameTablesArg)(task.arg).renames {
+			keys = append(keys, rename.from, rename.to)
+		}
+	case ddlRecoverTable, ddlFlashbackTable:
+		arg := (*ddlRecoverArg)(task.arg)
+		keys = append(keys, objectKey{arg.key.schema, arg.newName})
+	case ddlRecoverSchema:
+		keys = append(keys, objectKey{schema: (*ddlRecoverArg)(task.arg).newName})
+	case ddlExchangePartition:
+		keys = append(keys, (*ddlPartitionJobArg)(task.arg).table.key())
+	}
+	return keys
+}
+
+// isTableUnknown reports whether the table `key`, or its schema, is marked
+// unknown, see `markTablesUnknown`.
+func (c *testCase) isTableUnknown(key objectKey) bool {
+	c.unknownLock.Lock()
+	defer c.unknownLock.Unlock()
+	if _, ok := c.unknownTables[key]; ok {
+		return true
+	}
+	_, ok := c.unknownTables[objectKey{schema: key.schema}]
+	return ok && key.schema != ""
+}
+
+// resyncUnknownTables compares the unknown tables and schemas with the
+// server. The ones that match are known again. An unknown table that differs
+// is dropped on the server and from the model, unless a foreign key
+// references it, and then it is skipped until a later round. It must be
+// called by the DDL goroutine.
+func (c *testCase) resyncUnknownTables() error {
+	c.unknownLock.Lock()
+	keys := make([]objectKey, 0, len(c.unknownTables))
+	for key := range c.unknownTables {
+		keys = append(keys, key)
+	}
+	c.unknownLock.Unlock()
+	sortObjectKeys(keys)
+
+	db := c.dbs[0]
+	placement := c.placementPolicy != ""
+	for _, key := range keys {
+		synced := false
+		if key.name == "" {
+			actual, err := readSchemaOptions(db, key.schema, placement)
+			if err != nil {
+				return errors.Annotatef(err, "read options of schema `%s`", key.schema)
+			}
+			c.tablesLock.RLock()
+			schema := c.schemas[key.schema]
+			synced = schema == nil && actual == nil || schema != nil && len(schema.optionsDiff(actual, placement)) == 0
+			c.tablesLock.RUnlock()
+		} else {
+			actual, err := readTableSchema(db, c.schemaName(key.schema), key.name)
+			if err != nil {
+				return errors.Annotatef(err, "read schema of table `%s`", key.name)
+			}
+			synced, err = c.resyncTable(key, actual)
+			if err != nil {
+				return errors.Trace(err)
+			}
+		}
+		if !synced {
+			log.Infof("[ddl] [instance %d] %s is still unknown", c.caseIndex, quoteObjectName(key.schema, key.name))
+			continue
+		}
+		c.unknownLock.Lock()
+		delete(c.unknownTables, key)
+		c.unknownLock.Unlock()
+		log.Infof("[ddl] [instance %d] %s is resynced", c.caseIndex, quoteObjectName(key.schema, key.name))
+	}
+	return nil
+}
+
+// resyncTable makes the table `key` of the model match `actual` on the
+// server, and reports whether it does.
+func (c *testCase) resyncTable(key objectKey, actual *tableSchema) (bool, error) {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	table := c.tables[key]
+	if table == nil && actual == nil {
+		return true, nil
+	}
+	if table != nil && actual != nil {
+		table.lock.RLock()
+		diffs := table.schemaDiff(actual, !c.cfg.MySQLCompatible)
+		table.lock.RUnlock()
+		if len(diffs) == 0 {
+			// The table may be marked deleted by a task whose job is given up.
+			table.setDeletedRecover()
+			return true, nil
+		}
+	}
+	if table != nil && len(c.referencingForeignKeys(table)) > 0 {
+		return false, nil
+	}
+	sql := fmt.Sprintf("DROP TABLE IF EXISTS %s", quoteObjectName(key.schema, key.name))
+	_, err := c.dbs[0].Exec(sql)
+	log.Infof("[ddl] [instance %d] %s, err: %v", c.caseIndex, sql, err)
+	if err != nil {
+		if ddlIgnoreError(ddlDropTable, c.cfg.TestTp, err) || mysqlErrorCode(err) == errCodeFKCannotDropParent {
+			return false, nil
+		}
+		return false, errors.Annotatef(err, "Error when executing SQL: %s", sql)
+	}
+	if table != nil {
+		table.setDeleted()
+		delete(c.tables, key)
+	}
+	// The tombstone of the dropped table isn't restored, see `addTableTombstone`.
+	c.removeTombstones(func(tomb *ddlTestTombstone) bool {
+		return tomb.table != nil && tomb.table.key() == key
+	})
+	return true, nil
+}
+
+// executeVerifySchema verifies the metadata of the tables on the server, i.e.
+// `information_schema` and `SHOW CREATE TABLE`, against the local model. It
+// must be called by the DDL goroutine, which is the only one changing the
+// schema.
+func (c *testCase) executeVerifySchema() error {
+	if err := c.resyncUnknownTables(); err != nil {
+		return errors.Trace(err)
+	}
+	c.tablesLock.RLock()
+	keys := c.tableKeys()
+	c.tablesLock.RUnlock()
+
+	db := c.dbs[0]
+	for _, key := range keys {
+		c.tablesLock.RLock()
+		table, ok := c.tables[key]
+		c.tablesLock.RUnlock()
+		if !ok || c.isTableUnknown(key) {
+			continue
+		}
+		actual, err := readTableSchema(db, c.schemaName(table.schema), table.name)
+		if err != nil {
+			return errors.Annotatef(err, "read schema of table `%s`", table.name)
+		}
+		table.lock.RLock()
+		diffs := table.schemaDiff(actual, !c.cfg.MySQLCompatible)
+		table.lock.RUnlock()
+		if len(diffs) > 0 {
+			verifyCounter.WithLabelValues("fail").Inc()
+			c.stopTest()
+			return fmt.Errorf("Schema of table `%s` differs from the local model:\n%s\n%s", table.name,
+				strings.Join(diffs, "\n"), table.debugPrintToString())
+		}
+		log.Infof("[ddl] [instance %d] schema of table `%s` verified", c.caseIndex, table.name)
+	}
+	return c.executeVerifySchemata()
+}
+
+// readTableSchema reads the metadata of the table `schemaName`.`tableName`, it
+// returns nil if the table doesn't exist.
+func readTableSchema(db *sql.DB, schemaName, tableName string) (*tableSchema, error) {
+	schema := &tableSchema{indexes: make(map[string][]string), uniqueIndexes: make(map[string]bool), invisibleIndexes: make(map[string]bool)}
+	err := db.QueryRow("SELECT TABLE_COMMENT, TABLE_COLLATION FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?",
+		schemaName, tableName).Scan(&schema.comment, &schema.collate)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	rows, err := db.Query("SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, IS_NULLABLE, COLUMN_DEFAULT, CHARACTER_MAXIMUM_LENGTH, "+
+		"NUMERIC_PRECISION, NUMERIC_SCALE, EXTRA FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? "+
+		"ORDER BY ORDINAL_POSITION", schemaName, tableName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for rows.Next() {
+		var col columnSchema
+		var nullable string
+		if err := rows.Scan(&col.name, &col.dataType, &col.columnType, &nullable, &col.defaultValue, &col.charLength,
+			&col.precision, &col.scale, &col.extra); err != nil {
+			rows.Close()
+			return nil, errors.Trace(err)
+		}
+		col.nullable = nullable == "YES"
+		schema.columns = append(schema.columns, col)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	rows, err = db.Query("SELECT INDEX_NAME, COLUMN_NAME, NON_UNIQUE, SUB_PART, COLLATION, IS_VISIBLE FROM information_schema.STATISTICS "+
+		"WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY INDEX_NAME, SEQ_IN_INDEX", schemaName, tableName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for rows.Next() {
+		var indexName, visible string
+		var columnName, collation sql.NullString
+		var subPart sql.NullInt64
+		var nonUnique int
+		if err := rows.Scan(&indexName, &columnName, &nonUnique, &subPart, &collation, &visible); err != nil {
+			rows.Close()
+			return nil, errors.Trace(err)
+		}
+		// The column of an expression is NULL.
+		part := "<expression>"
+		if columnName.Valid {
+			part = columnName.String
+		}
+		if subPart.Valid {
+			part += fmt.Sprintf("(%d)", subPart.Int64)
+		}
+		if collation.String == "D" {
+			part += " DESC"
+		}
+		schema.indexes[indexName] = append(schema.indexes[indexName], part)
+		schema.uniqueIndexes[indexName] = nonUnique == 0
+		schema.invisibleIndexes[indexName] = visible == "NO"
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	rows, err = db.Query("SELECT PARTITION_NAME, PARTITION_METHOD, PARTITION_DESCRIPTION FROM information_schema.PARTITIONS "+
+		"WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND PARTITION_NAME IS NOT NULL ORDER BY PARTITION_ORDINAL_POSITION",
+		schemaName, tableName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for rows.Next() {
+		var part partitionSchema
+		if err := rows.Scan(&part.name, &schema.partitionMethod, &part.description); err != nil {
+			rows.Close()
+			return nil, errors.Trace(err)
+		}
+		schema.partitions = append(schema.partitions, part)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var name, createTable string
+	if err := db.QueryRow(fmt.Sprintf("SHOW CREATE TABLE `%s`.`%s`", schemaName, tableName)).Scan(&name, &createTable); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if m := showCreateCharsetRe.FindStringSubmatch(createTable); m != nil {
+		schema.charset = m[1]
+	}
+	if m := showCreateShardRowIDBits.FindStringSubmatch(createTable); m != nil {
+		schema.shardRowIDBits, _ = strconv.ParseInt(m[1], 10, 64)
+	}
+	if m := showCreatePKType.FindStringSubmatch(createTable); m != nil {
+		schema.pkType = m[1]
+	}
+	return schema, nil
+}
+
+// schemaDiff returns the differences between the table and the metadata read
+// from the server, `actual` is nil if the table doesn't exist on the server.
+// The TiDB only options, i.e. SHARD_ROW_ID_BITS and the type of the primary
+// key, are compared if `tidb` is true. The caller should hold the read lock of
+// the table.
+func (table *ddlTestTable) schemaDiff(actual *tableSchema, tidb bool) []string {
+	if actual == nil {
+		return []string{"table doesn't exist"}
+	}
+	var diffs []string
+	diff := func(format string, args ...interface{}) {
+		diffs = append(diffs, fmt.Sprintf(format, args...))
+	}
+	if actual.comment != table.comment {
+		diff("comment: expected %q, got %q", table.comment, actual.comment)
+	}
+	if actual.charset != table.charset {
+		diff("charset: expected %s, got %s", table.charset, actual.charset)
+	}
+	if actual.collate != table.collate {
+		diff("collate: expected %s, got %s", table.collate, actual.collate)
+	}
+	if tidb && actual.shardRowIDBits != table.shardRowId {
+		diff("shard_row_id_bits: expected %d, got %d", table.shardRowId, actual.shardRowIDBits)
+	}
+	if tidb && actual.pkType != table.pkType {
+		diff("primary key: expected %q, got %q", table.pkType, actual.pkType)
+	}
+
+	expectedNames := make([]string, 0, table.columns.Size())
+	for i := 0; i < table.columns.Size(); i++ {
+		expectedNames = append(expectedNames, getColumnFromArrayList(table.columns, i).name)
+	}
+	actualNames := make([]string, 0, len(actual.columns))
+	for _, col := range actual.columns {
+		actualNames = append(actualNames, col.name)
+	}
+	if strings.Join(expectedNames, ",") != strings.Join(actualNames, ",") {
+		diff("columns: expected [%s], got [%s]", strings.Join(expectedNames, ", "), strings.Join(actualNames, ", "))
+	} else {
+		for i, col := range actual.columns {
+			for _, d := range getColumnFromArrayList(table.columns, i).schemaDiff(&col) {
+				diff("column `%s`: %s", col.name, d)
+			}
+		}
+	}
+
+	expectedIndexes := make(map[string][]string, len(table.indexes)+1)
+	expectedUnique := map[string]bool{"PRIMARY": true}
+	expectedInvisible := make(map[string]bool, len(table.indexes))
+	var primaryKey []string
+	for _, col := range table.primaryKey {
+		primaryKey = append(primaryKey, col.name)
+	}
+	if len(primaryKey) > 0 {
+		expectedIndexes["PRIMARY"] = primaryKey
+	}
+	for _, index := range table.indexes {
+		parts := make([]string, 0, len(index.columns))
+		for i, col := range index.columns {
+			parts = append(parts, index.part(i).statistics(col, tidb))
+		}
+		expectedIndexes[index.name] = parts
+		expectedUnique[index.name] = index.unique
+		expectedInvisible[index.name] = index.invisible
+	}
+	indexNames := make([]string, 0, len(expectedIndexes)+len(actual.indexes))
+	for name := range expectedIndexes {
+		indexNames = append(indexNames, name)
+	}
+	for name := range actual.indexes {
+		if _, ok := expectedIndexes[name]; !ok {
+			indexNames = append(indexNames, name)
+		}
+	}
+	sort.Strings(indexNames)
+	for _, name := range indexNames {
+		expected, expectedOK := expectedIndexes[name]
+		got, actualOK := actual.indexes[name]
+		switch {
+		case !actualOK:
+			diff("index `%s`: missing", name)
+		case !expectedOK:
+			diff("index `%s`: unexpected on [%s]", name, strings.Join(got, ", "))
+		case strings.Join(expected, ",") != strings.Join(got, ","):
+			diff("index `%s`: expected on [%s], got [%s]", name, strings.Join(expected, ", "), strings.Join(got, ", "))
+		case expectedUnique[name] != actual.uniqueIndexes[name]:
+			diff("index `%s`: unique: expected %v, got %v", name, expectedUnique[name], actual.uniqueIndexes[name])
+		case expectedInvisible[name] != actual.invisibleIndexes[name]:
+			diff("index `%s`: invisible: expected %v, got %v", name, expectedInvisible[name], actual.invisibleIndexes[name])
+		}
+	}
+	return append(diffs, table.partitionDiff(actual)...)
+}
+
+// partitionDiff returns the differences between the partitioning of the
+// table and `information_schema.PARTITIONS`.
+func (table *ddlTestTable) partitionDiff(actual *tableSchema) []string {
+	p := table.partition
+	if p == nil {
+		if actual.partitionMethod != "" {
+			return []string{fmt.Sprintf("partition: expected none, got %s", actual.partitionMethod)}
+		}
+		return nil
+	}
+	var diffs []string
+	diff := func(format string, args ...interface{}) {
+		diffs = append(diffs, fmt.Sprintf(format, args...))
+	}
+	if !strings.EqualFold(actual.partitionMethod, p.tp.String()) {
+		diff("partition method: expected %s, got %q", p.tp, actual.partitionMethod)
+	}
+	actualNames := make([]string, 0, len(actual.partitions))
+	for _, part := range actual.partitions {
+		actualNames = append(actualNames, part.name)
+	}
+	expectedNames := p.names()
+	if strings.Join(expectedNames, ",") != strings.Join(actualNames, ",") {
+		diff("partitions: expected [%s], got [%s]", strings.Join(expectedNames, ", "), strings.Join(actualNames, ", "))
+		return diffs
+	}
+	if p.tp != partitionByRange {
+		return diffs
+	}
+	for i, def := range p.defs {
+		expected := strconv.FormatInt(def.lessThan, 10)
+		if def.maxValue {
+			expected = "MAXVALUE"
+		}
+		if got := actual.partitions[i].description; !got.Valid || got.String != expected {
+			diff("partition `%s`: expected less than %s, got %v", def.name, expected, nullStringString(got))
+		}
+	}
+	return diffs
+}
+
+// schemaDiff returns the differences between the column and a row of
+// `information_schema.COLUMNS`.
+func (col *ddlTestColumn) schemaDiff(actual *columnSchema) []string {
+	var diffs []string
+	diff := func(format string, args ...interface{}) {
+		diffs = append(diffs, fmt.Sprintf(format, args...))
+	}
+	dataType := strings.ToLower(actual.dataType)
+	switch col.k {
+	case KindBLOB, KindTINYBLOB, KindMEDIUMBLOB, KindLONGBLOB:
+		// The server chooses the type by the length.
+		if !strings.HasSuffix(dataType, "blob") {
+			diff("data type: expected a blob type, got %s", dataType)
+		}
+	case KindTEXT, KindTINYTEXT, KindMEDIUMTEXT, KindLONGTEXT:
+		if !strings.HasSuffix(dataType, "text") {
+			diff("data type: expected a text type, got %s", dataType)
+		}
+	case KindBool:
+		if dataType != "tinyint" {
+			diff("data type: expected tinyint, got %s", dataType)
+		}
+	default:
+		if expected := strings.ToLower(ALLFieldType[col.k]); dataType != expected {
+			diff("data type: expected %s, got %s", expected, dataType)
+		}
+	}
+	switch col.k {
+	case KindChar, KindVarChar:
+		if !actual.charLength.Valid || actual.charLength.Int64 != int64(col.filedTypeM) {
+			diff("length: expected %d, got %v", col.filedTypeM, nullInt64String(actual.charLength))
+		}
+	case KindDECIMAL:
+		if !actual.precision.Valid || actual.precision.Int64 != int64(col.filedTypeM) ||
+			!actual.scale.Valid || actual.scale.Int64 != int64(col.filedTypeD) {
+			diff("precision: expected (%d,%d), got (%v,%v)", col.filedTypeM, col.filedTypeD,
+				nullInt64String(actual.precision), nullInt64String(actual.scale))
+		}
+	case KindEnum, KindSet:
+		values := make([]string, 0, len(col.setValue))
+		for _, v := range col.setValue {
+			values = append(values, fmt.Sprintf("'%s'", v))
+		}
+		expected := fmt.Sprintf("%s(%s)", strings.ToLower(ALLFieldType[col.k]), strings.Join(values, ","))
+		if actual.columnType != expected {
+			diff("column type: expected %s, got %s", expected, actual.columnType)
+		}
+	}
+	if actual.nullable == col.notNull {
+		diff("nullable: expected %v, got %v", !col.notNull, actual.nullable)
+	}
+	if generated := strings.Contains(strings.ToUpper(actual.extra), "GENERATED"); generated != col.isGenerated() {
+		diff("generated: expected %v, got %v", col.isGenerated(), generated)
+	}
+	if autoIncrement := strings.Contains(strings.ToLower(actual.extra), "auto_increment"); autoIncrement != col.autoIncrement {
+		diff("auto_increment: expected %v, got %v", col.autoIncrement, autoIncrement)
+	}
+	// Only the kinds whose default values are formatted the same by the model
+	// and the server are compared.
+	switch col.k {
+	case KindTINYINT, KindSMALLINT, KindMEDIUMINT, KindInt32, KindBigInt, KindBool,
+		KindChar, KindVarChar, KindEnum, KindDATE, KindDATETIME, KindYEAR:
+		if col.isGenerated() {
+			break
+		}
+		expected := sql.NullString{}
+		if col.defaultValue != nil {
+			expected = sql.NullString{String: fmt.Sprintf("%v", col.defaultValue), Valid: true}
+		}
+		if expected != actual.defaultValue {
+			diff("default value: expected %v, got %v", nullStringString(expected), nullStringString(actual.defaultValue))
+		}
+	}
+	return diffs
+}
+
+func nullInt64String(v sql.NullInt64) string {
+	if !v.Valid {
+		return "NULL"
+	}
+	return strconv.FormatInt(v.Int64, 10)
+}
+
+func nullStringString(v sql.NullString) string {
+	if !v.Valid {
+		return "NULL"
+	}
+	return fmt.Sprintf("%q", v.String)
+}
+
+// verifyIndexRows reads `table` through `index` twice, once selecting only the
+// columns of the index, which is covered by the index, and once selecting all
+// `columns`, which needs to look up the table by the index. Both results are
+// compared with the rows in memory, so that a corrupted index is found even
+// without `ADMIN CHECK TABLE`. `ORDER BY` makes MySQL read the index as well.
+// An invisible index cannot be read, see `verifyInvisibleIndex`.
+func (c *testCase) verifyIndexRows(table *ddlTestTable, index *ddlTestIndex, columns []*ddlTestColumn, uniqID int32, gotTableTime time.Time) (bool, error) {
+	for _, column := range index.columns {
+		if column.isDeleted() || column.isRenamed() {
+			return true, nil
+		}
+	}
+	table.lock.RLock()
+	invisible := index.invisible
+	table.lock.RUnlock()
+	if invisible {
+		return c.verifyInvisibleIndex(table, index, uniqID)
+	}
+	for _, read := range []struct {
+		hint    string
+		columns []*ddlTestColumn
+	}{
+		{"USE INDEX", index.columns},
+		{"FORCE INDEX", columns},
+	} {
+		sql := buildIndexReadSQL(table.quotedName(), index, read.hint, read.columns)
+		ok, err := c.verifyTableRows(table, read.columns, sql, nil, isStaleRead(table, read.columns), uniqID, gotTableTime)
+		if err != nil && classifyError(err) == classUnknownObject {
+			// The index is dropped or renamed by a concurrent DDL, which the
+			// schema verification checks.
+			log.Infof("[ddl] [instance %d] skip verifying index `%s` of table `%s`, err: %v", c.caseIndex, index.name, table.name, err)
+			return true, nil
+		}
+		if !ok || err != nil {
+			return ok, errors.Trace(err)
+		}
+	}
+	return true, nil
+}
+
+// verifyInvisibleIndex checks that the index hint on the invisible `index`
+// fails with ER_KEY_DOES_NOT_EXITS, unless the index is made visible or
+// dropped meanwhile.
+func (c *testCase) verifyInvisibleIndex(table *ddlTestTable, index *ddlTestIndex, uniqID int32) (bool, error) {
+	sql := buildIndexReadSQL(table.quotedName(), index, "USE INDEX", index.columns)
+	rows, err := c.dbs[c.dmlRand.Intn(len(c.dbs))].Query(sql)
+	if err == nil {
+		rows.Close()
+	}
+	log.Infof("[ddl] [instance %d] %s, selectID:%v, err: %v", c.caseIndex, sql, uniqID, err)
+	table.lock.RLock()
+	invisible := index.invisible && !c.isIndexDeleted(index, table)
+	table.lock.RUnlock()
+	if !invisible || mysqlErrorCode(err) == errCodeKeyDoesNotExist {
+		return true, nil
+	}
+	if err != nil {
+		if classifyError(err) == classUnknownObject {
+			return true, nil
+		}
+		return false, errors.Annotatef(err, "Error when executing SQL: %s\n%s", sql, table.debugPrintToString())
+	}
+	verifyCounter.WithLabelValues("fail").Inc()
+	c.stopTest()
+	return false, fmt.Errorf("Invisible index `%s` of table `%s` is used, sql: %s, selectID:%v\n%s", index.name, table.name, sql, uniqID, table.debugPrintToString())
+}
+
+// buildIndexReadSQL returns the SQL that selects `columns` from the table
+// `quotedName` through `index` with the index hint `hint`.
+func buildIndexReadSQL(quotedName string, index *ddlTestIndex, hint string, columns []*ddlTestColumn) string {
+	sql := "SELECT "
+	for i, column := range columns {
+		if i > 0 {
+			sql += ", "
+		}
+		sql += column.getSelectName()
+	}
+	sql += fmt.Sprintf(" FROM %s %s (`%s`) ORDER BY ", quotedName, hint, index.name)
+	for i, column := range index.columns {
+		if i > 0 {
+			sql += ", "
+		}
+		sql += fmt.Sprintf("`%s`", column.name)
+	}
+	return sql
+}
+
+// verifyPartitionRows reads every partition of `table` by `PARTITION (p)`
+// selection, and compares the result with the rows that `partition` locates
+// in it. `sql` selects `columns` from the whole table. The partition of a row
+// of KEY partitioning is unknown, so the whole table read is enough then.
+func (c *testCase) verifyPartitionRows(table *ddlTestTable, partition *ddlTestPartition, columns []*ddlTestColumn, sql string, uniqID int32, gotTableTime time.Time) (bool, error) {
+	if !partition.isLocatable() {
+		return true, nil
+	}
+	isStale := isStaleRead(table, columns)
+	for i, name := range partition.names() {
+		idx := i
+		filter := func(row int) bool {
+			return partition.locate(getRowFromArrayList(partition.column.rows, row)) == idx
+		}
+		ok, err := c.verifyTableRows(table, columns, fmt.Sprintf("%s PARTITION (`%s`)", sql, name), filter, func() bool {
+			table.lock.RLock()
+			defer table.lock.RUnlock()
+			return isStale() || table.partition != partition
+		}, uniqID, gotTableTime)
+		if err != nil && classifyError(err) == classUnknownObject {
+			// The partition is dropped by a concurrent DDL.
+			log.Infof("[ddl] [instance %d] skip verifying partition `%s` of table `%s`, err: %v", c.caseIndex, name, table.name, err)
+			return true, nil
+		}
+		if !ok || err != nil {
+			return ok, errors.Trace(err)
+		}
+	}
+	return true, nil
+}
+
+// executeVerifyViews selects from every view and compares the result with
+// the rows of the columns it references. A view whose base table or columns
+// are dropped or renamed is invalid, and querying it must fail with
+// ER_VIEW_INVALID.
+func (c *testCase) executeVerifyViews(uniqID int32, gotTableTime time.Time) error {
+	c.tablesLock.RLock()
+	keys := make([]objectKey, 0, len(c.views))
+	for key := range c.views {
+		keys = append(keys, key)
+	}
+	sortObjectKeys(keys)
+	viewsSnapshot := make([]*ddlTestView, 0, len(keys))
+	for _, key := range keys {
+		viewsSnapshot = append(viewsSnapshot, c.views[key])
+	}
+	c.tablesLock.RUnlock()
+
+	for _, view := range viewsSnapshot {
+		if view.isDeleted() {
+			continue
+		}
+		if err := c.verifyViewRows(view, uniqID, gotTableTime); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// resolveView looks up the base table and the columns of `view` by name, as
+// the database does when the view is queried. It returns a nil table if the
+// view is invalid.
+func (c *testCase) resolveView(view *ddlTestView) (*ddlTestTable, []*ddlTestColumn) {
+	c.tablesLock.RLock()
+	table, ok := c.tables[view.table.key()]
+	c.tablesLock.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+	columns := make([]*ddlTestColumn, 0, len(view.columns))
+	for _, viewColumn := range view.columns {
+		var column *ddlTestColumn
+		for ite := table.columns.Iterator(); ite.Next(); {
+			col := ite.Value().(*ddlTestColumn)
+			if col.name == viewColumn.name && !col.isDeleted() {
+				column = col
+				break
+			}
+		}
+		if column == nil {
+			return nil, nil
+		}
+		columns = append(columns, column)
+	}
+	return table, columns
+}
+
+func (c *testCase) verifyViewRows(view *ddlTestView, uniqID int32, gotTableTime time.Time) error {
+	sql := "SELECT "
+	for i, column := range view.columns {
+		if i > 0 {
+			sql += ", "
+		}
+		sql += column.getSelectName()
+	}
+	sql += " FROM " + view.quotedName()
+
+	table, columns := c.resolveView(view)
+	if table != nil {
+		isStale := isStaleRead(table, columns)
+		_, err := c.verifyTableRows(table, columns, sql, nil, func() bool {
+			if view.isDeleted() || isStale() {
+				return true
+			}
+			for _, column := range columns {
+				if column.isRenamed() {
+					return true
+				}
+			}
+			return false
+		}, uniqID, gotTableTime)
+		return errors.Trace(err)
+	}
+
+	db := c.dbs[c.dmlRand.Intn(len(c.dbs))]
+	rows, err := db.Query(sql)
+	if err == nil {
+		rows.Close()
+	}
+	log.Infof("[ddl] [instance %d] %s, err: %v, selectID:%v", c.caseIndex, sql, err, uniqID)
+	// The view may be dropped, replaced or become valid again by a concurrent
+	// DDL, and the model may be unknown after ignored DDL errors.
+	if table, _ := c.resolveView(view); table != nil || view.isDeleted() || c.isTableUnknown(view.key()) || c.isTableUnknown(view.table.key()) {
+		return nil
+	}
+	localErr := expectError(errCodeViewInvalid, "view %s references invalid table or columns", view.name)
+	if err = checkExpectedError(localErr, err); err != nil {
+		verifyCounter.WithLabelValues("fail").Inc()
+		c.stopTest()
+		return fmt.Errorf("Error when executing SQL: %s\n %v\n%s", sql, err, view.table.debugPrintToString())
+	}
+	verifyCounter.WithLabelValues("pass").Inc()
+	return nil
+}
+
+// executeVerifyForeignKeys checks that every child row references a parent
+// row on the server. A foreign key that is added, dropped, or whose tables
+// are changed by a concurrent DDL is skipped.
+func (c *testCase) executeVerifyForeignKeys(uniqID int32) error {
+	type fkSnapshot struct {
+		childForeignKey
+		epoch int64
+		sql   string
+	}
+	c.tablesLock.RLock()
+	var snapshots []fkSnapshot
+	for _, key := range c.tableKeys() {
+		child := c.tables[key]
+		// The columns of the foreign keys are changed under the locks of the
+		// tables, like `predictNoReferencedRow`.
+		child.lock.RLock()
+		for _, fk := range child.foreignKeys {
+			if fk.parent != child {
+				fk.parent.lock.RLock()
+			}
+			sql := fmt.Sprintf("SELECT COUNT(*) FROM %s AS c LEFT JOIN %s AS p ON c.`%s` = p.`%s` WHERE c.`%s` IS NOT NULL AND p.`%s` IS NULL",
+				child.quotedName(), fk.parent.quotedName(), fk.column.name, fk.refColumn.name, fk.column.name, fk.refColumn.name)
+			if fk.parent != child {
+				fk.parent.lock.RUnlock()
+			}
+			snapshots = append(snapshots, fkSnapshot{childForeignKey{child, fk}, child.loadUniqueEpoch(), sql})
+		}
+		child.lock.RUnlock()
+	}
+	c.tablesLock.RUnlock()
+
+	for _, s := range snapshots {
+		db := c.dbs[c.dmlRand.Intn(len(c.dbs))]
+		var count int
+		err := db.QueryRow(s.sql).Scan(&count)
+		log.Infof("[ddl] [instance %d] %s, count: %d, err: %v, selectID:%v", c.caseIndex, s.sql, count, err, uniqID)
+		c.tablesLock.RLock()
+		s.child.lock.RLock()
+		stale := c.isTableUnknown(s.child.key()) || c.isTableUnknown(s.fk.parent.key()) || s.epoch%2 != 0 || s.child.loadUniqueEpoch() != s.epoch || s.child.isDeleted() || s.fk.parent.isDeleted() ||
+			!s.child.hasForeignKeyTo(s.fk.parent)
+		s.child.lock.RUnlock()
+		c.tablesLock.RUnlock()
+		if stale {
+			continue
+		}
+		if err != nil {
+			return errors.Annotatef(err, "Error when executing SQL: %s", s.sql)
+		}
+		if count > 0 {
+			verifyCounter.WithLabelValues("fail").Inc()
+			c.stopTest()
+			return fmt.Errorf("%d rows of table `%s` reference no row of table `%s` by foreign key `%s`, sql: %s, selectID:%v\n%s",
+				count, s.child.name, s.fk.parent.name, s.fk.name, s.sql, uniqID, s.child.debugPrintToString())
+		}
+		verifyCounter.WithLabelValues("pass").Inc()
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package ddl
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+
+	"github.com/emirpasic/gods/lists/arraylist"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaDiff(t *testing.T) {
+	id := &ddlTestColumn{k: KindInt32, name: "id", fieldType: "INT", isPrimaryKey: true, notNull: true}
+	name := &ddlTestColumn{k: KindVarChar, name: "name", fieldType: "VARCHAR(10)", filedTypeM: 10, defaultValue: "abc"}
+	price := &ddlTestColumn{k: KindDECIMAL, name: "price", fieldType: "DECIMAL(10,2)", filedTypeM: 10, filedTypeD: 2, defaultValue: "1.50"}
+	table := &ddlTestTable{
+		name:       "t",
+		columns:    arraylist.New(id, name, price),
+		indexes:    []*ddlTestIndex{{name: "idx", columns: []*ddlTestColumn{name, price}}},
+		primaryKey: []*ddlTestColumn{id},
+		pkType:     pkTypeClustered,
+		comment:    "comment",
+		charset:    "utf8mb4",
+		collate:    "utf8mb4_bin",
+		shardRowId: 2,
+		lock:       new(sync.RWMutex),
+	}
+	actual := &tableSchema{
+		comment:        "comment",
+		charset:        "utf8mb4",
+		collate:        "utf8mb4_bin",
+		shardRowIDBits: 2,
+		pkType:         pkTypeClustered,
+		columns: []columnSchema{
+			{name: "id", dataType: "int", columnType: "int(11)", nullable: false},
+			{name: "name", dataType: "varchar", columnType: "varchar(10)", nullable: true,
+				defaultValue: sql.NullString{String: "abc", Valid: true}, charLength: sql.NullInt64{Int64: 10, Valid: true}},
+			{name: "price", dataType: "decimal", columnType: "decimal(10,2)", nullable: true,
+				defaultValue: sql.NullString{String: "1.50", Valid: true}, precision: sql.NullInt64{Int64: 10, Valid: true}, scale: sql.NullInt64{Int64: 2, Valid: true}},
+		},
+		indexes:       map[string][]string{"PRIMARY": {"id"}, "idx": {"name", "price"}},
+		uniqueIndexes: map[string]bool{"PRIMARY": true},
+	}
+	assert.Empty(t, table.schemaDiff(actual, true))
+	assert.Equal(t, []string{"table doesn't exist"}, table.schemaDiff(nil, true))
+
+	actual.shardRowIDBits = 0
+	actual.pkType = pkTypeNonClustered
+	actual.collate = "utf8mb4_general_ci"
+	actual.columns[1].charLength.Int64 = 20
+	actual.columns[1].defaultValue = sql.NullString{}
+	actual.indexes["idx"] = []string{"price", "name"}
+	actual.indexes["idx2"] = []string{"id"}
+	table.indexes = append(table.indexes, &ddlTestIndex{name: "uk", columns: []*ddlTestColumn{price}, unique: true})
+	actual.indexes["uk"] = []string{"price"}
+	assert.Equal(t, []string{
+		"collate: expected utf8mb4_bin, got utf8mb4_general_ci",
+		"shard_row_id_bits: expected 2, got 0",
+		"primary key: expected \"CLUSTERED\", got \"NONCLUSTERED\"",
+		"column `name`: length: expected 10, got 20",
+		"column `name`: default value: expected \"abc\", got NULL",
+		"index `idx`: expected on [name, price], got [price, name]",
+		"index `idx2`: unexpected on [id]",
+		"index `uk`: unique: expected true, got false",
+	}, table.schemaDiff(actual, true))
+	assert.Len(t, table.schemaDiff(actual, false), 6)
+
+	actual.columns[1], actual.columns[2] = actual.columns[2], actual.columns[1]
+	delete(actual.indexes, "PRIMARY")
+	assert.Contains(t, table.schemaDiff(actual, false), "columns: expected [id, name, price], got [id, price, name]")
+	assert.Contains(t, table.schemaDiff(actual, false), "index `PRIMARY`: missing")
+}
+
+func TestBuildIndexReadSQL(t *testing.T) {
+	id := &ddlTestColumn{k: KindInt32, name: "id"}
+	flag := &ddlTestColumn{k: KindBit, name: "flag"}
+	name := &ddlTestColumn{k: KindVarChar, name: "name"}
+	index := &ddlTestIndex{name: "idx", columns: []*ddlTestColumn{flag, name}}
+
+	assert.Equal(t, "SELECT bin(`flag`), `name` FROM `t` USE INDEX (`idx`) ORDER BY `flag`, `name`",
+		buildIndexReadSQL("`t`", index, "USE INDEX", index.columns))
+	assert.Equal(t, "SELECT `id`, bin(`flag`), `name` FROM `t` FORCE INDEX (`idx`) ORDER BY `flag`, `name`",
+		buildIndexReadSQL("`t`", index, "FORCE INDEX", []*ddlTestColumn{id, flag, name}))
+}
+
+func TestResolveView(t *testing.T) {
+	a := &ddlTestColumn{k: KindInt32, name: "a"}
+	b := &ddlTestColumn{k: KindVarChar, name: "b"}
+	table := &ddlTestTable{name: "t", columns: arraylist.New(a, b), lock: new(sync.RWMutex)}
+	view := &ddlTestView{name: "v", columns: []*ddlTestColumn{b, a}, table: table}
+	c := &testCase{tables: map[objectKey]*ddlTestTable{table.key(): table}, views: map[objectKey]*ddlTestView{view.key(): view}}
+	assert.Equal(t, "select `b`, `a` from `t`", view.selectSQL())
+
+	resolved, columns := c.resolveView(view)
+	assert.Equal(t, table, resolved)
+	assert.Equal(t, []*ddlTestColumn{b, a}, columns)
+
+	// A column is changed by `MODIFY COLUMN`, the view reads the new one.
+	newB := &ddlTestColumn{k: KindVarChar, name: "b"}
+	table.columns.Set(1, newB)
+	_, columns = c.resolveView(view)
+	assert.Equal(t, []*ddlTestColumn{newB, a}, columns)
+
+	// A column is renamed.
+	table.columns.Set(1, &ddlTestColumn{k: KindVarChar, name: "c"})
+	resolved, _ = c.resolveView(view)
+	assert.Nil(t, resolved)
+
+	// The base table is renamed.
+	table.columns.Set(1, newB)
+	delete(c.tables, objectKey{name: "t"})
+	c.tables[objectKey{name: "t2"}] = table
+	resolved, _ = c.resolveView(view)
+	assert.Nil(t, resolved)
+}
+
+func TestMarkTablesUnknown(t *testing.T) {
+	c := &testCase{tables: map[objectKey]*ddlTestTable{}}
+	table := newSchemaTable("s", "t")
+	renamed := newSchemaTable("", "t2")
+	c.markTasksUnknown("test", &ddlJobTask{k: ddlRenameTable, tblInfo: table, arg: ddlJobArg(renamed)})
+	assert.True(t, c.isTableUnknown(table.key()))
+	assert.True(t, c.isTableUnknown(renamed.key()))
+	assert.False(t, c.isTableUnknown(objectKey{"", "t"}))
+
+	// The tables of an unknown schema are unknown.
+	c.markTasksUnknown("test", &ddlJobTask{k: ddlAlterSchema, schemaInfo: &ddlTestSchema{name: "s2"}})
+	assert.True(t, c.isTableUnknown(objectKey{"s2", "t"}))
+
+	// A table missing on both sides is resynced.
+	synced, err := c.resyncTable(renamed.key(), nil)
+	assert.NoError(t, err)
+	assert.True(t, synced)
+}
@@ -3,16 +3,15 @@ module github.com/PingCAP-QE/schrddl
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v0.4.1
 	github.com/emirpasic/gods v1.12.0
 	github.com/go-sql-driver/mysql v1.4.1
 	github.com/juju/errors v0.0.0-20200330140219-3fe23663418f
 	github.com/juju/testing v0.0.0-20210324180055-18c50b0c2098 // indirect
-	github.com/myesui/uuid v1.0.0 // indirect
 	github.com/ngaut/log v0.0.0-20180314031856-b8e36e7ba5ac
 	github.com/pingcap/errors v0.11.4
 	github.com/prometheus/client_golang v1.10.0
 	github.com/stretchr/testify v1.7.0
-	github.com/twinj/uuid v1.0.0
 	golang.org/x/net v0.0.0-20210508051633-16afe75a6701
 	gopkg.in/stretchr/testify.v1 v1.2.2 // indirect
 )
@@ -15,32 +15,155 @@ package main
 
 import (
 	"flag"
+	"os"
+	"time"
 
 	. "github.com/PingCAP-QE/schrddl/ddl"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/juju/errors"
 	"github.com/ngaut/log"
 )
 
 var (
-	dbAddr          = flag.String("addr", "127.0.0.1:4000", "database address")
-	dbName          = flag.String("db", "test", "database name")
+	defaultCfg      = NewConfig()
+	dbFlag          = newDBFlags(flag.CommandLine)
 	mode            = flag.String("mode", "serial", "test mode: serial, parallel")
-	concurrency     = flag.Int("concurrency", 20, "concurrency")
-	tablesToCreate  = flag.Int("tables", 1, "the number of the tables to create")
+	concurrency     = flag.Int("concurrency", defaultCfg.Concurrency, "concurrency")
+	tablesToCreate  = flag.Int("tables", defaultCfg.TablesToCreate, "the number of the tables to create")
 	mysqlCompatible = flag.Bool("mysql-compatible", false, "disable TiDB-only features")
+	seed            = flag.Int64("seed", 0, "random seed, 0 means using the current time")
+	duration        = flag.Duration("duration", 0, "stop the test after this duration, 0 means no limit")
+	rounds          = flag.Int("rounds", 0, "stop each goroutine of the test after this number of rounds, 0 means no limit")
+	metricsAddr     = flag.String("metrics-addr", "", "serve the metrics at http://<metrics-addr>/metrics, empty means disabled")
+	pushGateway     = flag.String("pushgateway", "", "push the metrics to this pushgateway address, empty means disabled")
+	tracePath       = flag.String("trace", "", "record the executed SQL statements to this file, see `schrddl replay`")
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		replay(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "minimize" {
+		minimize(os.Args[2:])
+		return
+	}
 	flag.Parse()
-	log.Infof("[%s-ddl] start ddl", *mode)
-	var testType DDLTestType
-	switch *mode {
-	case "serial":
-		testType = SerialDDLTest
-	case "parallel":
-		testType = ParallelDDLTest
-	default:
-		log.Fatalf("unknown test mode: %s", *mode)
-	}
-	Run(*dbAddr, *dbName, *concurrency, *tablesToCreate, *mysqlCompatible, testType)
+	cfg := dbFlag.load(flag.CommandLine)
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "mode":
+			err = cfg.TestTp.UnmarshalText([]byte(*mode))
+		case "concurrency":
+			cfg.Concurrency = *concurrency
+		case "tables":
+			cfg.TablesToCreate = *tablesToCreate
+		case "mysql-compatible":
+			cfg.MySQLCompatible = *mysqlCompatible
+		case "seed":
+			cfg.Seed = *seed
+		case "duration":
+			cfg.Duration = Duration(*duration)
+		case "rounds":
+			cfg.Rounds = *rounds
+		case "metrics-addr":
+			cfg.MetricsAddr = *metricsAddr
+		case "pushgateway":
+			cfg.PushGateway = *pushGateway
+		case "trace":
+			cfg.TracePath = *tracePath
+		}
+	})
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	log.Infof("[%s-ddl] start ddl", cfg.TestTp)
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	if err := Run(cfg.DBConfig, &cfg.DDLCaseConfig); err != nil {
+		log.Errorf("[%s-ddl] %s", cfg.TestTp, errors.ErrorStack(err))
+		os.Exit(1)
+	}
+}
+
+// dbFlags are the flags of the config file and the tested database, which
+// are shared by all subcommands.
+type dbFlags struct {
+	config   *string
+	addr     *string
+	db       *string
+	user     *string
+	password *string
+}
+
+func newDBFlags(fs *flag.FlagSet) *dbFlags {
+	defaults := NewConfig()
+	return &dbFlags{
+		config:   fs.String("config", "", "TOML config file, the flags set in the command line override it"),
+		addr:     fs.String("addr", defaults.Addr, "database address"),
+		db:       fs.String("db", defaults.DB, "database name"),
+		user:     fs.String("user", defaults.User, "database user"),
+		password: fs.String("password", defaults.Password, "database password"),
+	}
+}
+
+// load loads the config file if any, and then overrides it with the flags
+// set in the command line.
+func (f *dbFlags) load(fs *flag.FlagSet) *Config {
+	cfg := NewConfig()
+	if *f.config != "" {
+		if err := LoadConfig(*f.config, cfg); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "addr":
+			cfg.Addr = *f.addr
+		case "db":
+			cfg.DB = *f.db
+		case "user":
+			cfg.User = *f.user
+		case "password":
+			cfg.Password = *f.password
+		}
+	})
+	return cfg
+}
+
+// replay implements `schrddl replay [flags] <trace>`, which re-executes a trace
+// recorded with `--trace` against a fresh database.
+func replay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	dbFlag := newDBFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatalf("usage: schrddl replay [--config file] [--addr addr] [--db db] [--user user] [--password password] <trace>")
+	}
+	cfg := dbFlag.load(fs)
+	if err := Replay(cfg.DBConfig, fs.Arg(0)); err != nil {
+		log.Fatalf("[replay] %v", err)
+	}
+	log.Infof("[replay] done")
+}
+
+// minimize implements `schrddl minimize [flags] <trace>`, which shrinks a
+// failing trace into a minimal SQL script.
+func minimize(args []string) {
+	fs := flag.NewFlagSet("minimize", flag.ExitOnError)
+	dbFlag := newDBFlags(fs)
+	refAddr := fs.String("reference-addr", "", "address of the reference database, which is needed to minimize row mismatches and result mismatches, the same user and password are used")
+	output := fs.String("output", "minimized.sql", "the output SQL script")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatalf("usage: schrddl minimize [--config file] [--addr addr] [--reference-addr addr] [--db db] [--output file] <trace>")
+	}
+	cfg := dbFlag.load(fs)
+	refCfg := cfg.DBConfig
+	refCfg.Addr = *refAddr
+	if err := Minimize(cfg.DBConfig, refCfg, fs.Arg(0), *output); err != nil {
+		log.Fatalf("[minimize] %v", err)
+	}
 }